@@ -0,0 +1,429 @@
+package capctx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/edb/pkg/corerelo"
+)
+
+// The BTF functions added for the wrappers around the main programs are named with this prefix and the program name.
+const wrapperFuncPrefix = "instrument_wrapper_"
+
+// btfHeader is the header of a raw BTF blob
+type btfHeader struct {
+	Magic     uint16
+	Version   uint8
+	Flags     uint8
+	HdrLen    uint32
+	TypeOff   uint32
+	TypeLen   uint32
+	StringOff uint32
+	StringLen uint32
+}
+
+const btfMagic = 0xeB9F
+
+// rewriteBTF updates the func info of a collection with instrumented programs, so it describes the instrumented
+// instructions.
+//
+// The kernel requires func info and line info at the start of every function. The instrumentation adds a new
+// entrypoint and a wrapper function and prepends instructions to all BPF-to-BPF functions, so func and line info are
+// moved to the new function starts and a BTF function is added for each wrapper. All functions become static, since
+// the kernel verifies global functions without knowledge of the caller, which doesn't work for the frame pointer we
+// pass along.
+//
+// CO-RE relocations are resolved against the kernel BTF first, relocations which are already resolved are left alone.
+func rewriteBTF(spec *ebpf.CollectionSpec) error {
+	// Static copies of the functions, shared by all programs since BPF-to-BPF functions are part of every program
+	// calling them.
+	staticFuncs := make(map[*btf.Func]*btf.Func)
+	static := func(fn *btf.Func) *btf.Func {
+		if fn.Linkage == btf.StaticFunc {
+			return fn
+		}
+
+		if staticFn, found := staticFuncs[fn]; found {
+			return staticFn
+		}
+
+		staticFn := &btf.Func{Name: fn.Name, Type: fn.Type, Linkage: btf.StaticFunc}
+		staticFuncs[fn] = staticFn
+		return staticFn
+	}
+
+	for name, prog := range spec.Programs {
+		mainFn, err := moveFuncInfo(prog)
+		if err != nil {
+			return fmt.Errorf("program '%s': %w", name, err)
+		}
+
+		if mainFn == nil {
+			continue
+		}
+
+		wrapperFn := &btf.Func{Name: wrapperFuncPrefix + name, Type: mainFn.Type, Linkage: btf.StaticFunc}
+		for i := range prog.Instructions {
+			inst := &prog.Instructions[i]
+
+			fn := btf.FuncMetadata(inst)
+			if fn == nil {
+				continue
+			}
+
+			if inst.Symbol() == "instrument-main-prog-wrapper" {
+				*inst = btf.WithFuncMetadata(*inst, wrapperFn)
+			} else {
+				*inst = btf.WithFuncMetadata(*inst, static(fn))
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasFuncInfo returns true if the program has BTF func info. Loaders only accept line info along with func info.
+func hasFuncInfo(prog *ebpf.ProgramSpec) bool {
+	return len(prog.Instructions) > 0 && btf.FuncMetadata(&prog.Instructions[0]) != nil
+}
+
+// functionReferences returns the symbols of all BPF-to-BPF functions called or referenced by the instructions.
+func functionReferences(insns asm.Instructions) map[string]bool {
+	refs := make(map[string]bool)
+	for _, ref := range insns.FunctionReferences() {
+		refs[ref] = true
+	}
+	return refs
+}
+
+// withMetadata returns a copy of the instruction which only keeps the metadata exposed by cilium/ebpf: the symbol,
+// reference, source and map of the instruction, and the given func info. cilium/ebpf has no way to remove the other
+// metadata, like CO-RE relocations, or to remove func info.
+func withMetadata(ins asm.Instruction, fn *btf.Func) asm.Instruction {
+	cpy := ins
+	cpy.Metadata = asm.Metadata{}
+
+	if sym := ins.Symbol(); sym != "" {
+		cpy = cpy.WithSymbol(sym)
+	}
+	if m := ins.Map(); m != nil {
+		_ = cpy.AssociateMap(m)
+	} else if ref := ins.Reference(); ref != "" {
+		cpy = cpy.WithReference(ref)
+	}
+	if src := ins.Source(); src != nil {
+		cpy = cpy.WithSource(src)
+	}
+	if fn != nil {
+		cpy = btf.WithFuncMetadata(cpy, fn)
+	}
+
+	return cpy
+}
+
+// moveFuncInfo resolves the CO-RE relocations of an instrumented program and moves func and line info to the first
+// instructions of all functions. The new entrypoint gets the func info of the original entrypoint, which is returned
+// so the wrapper can get func info of its own. Nil is returned if the program has no func info. The func and line info
+// of programs which are not instrumented are left as is.
+func moveFuncInfo(prog *ebpf.ProgramSpec) (*btf.Func, error) {
+	insns := prog.Instructions
+
+	if err := applyCORERelocations(insns, nil); err != nil {
+		return nil, fmt.Errorf("CO-RE relocations: %w", err)
+	}
+
+	// Line info is only accepted with func info, so without func info there is nothing to rewrite.
+	var funcInfo bool
+	for i := range insns {
+		if btf.FuncMetadata(&insns[i]) != nil {
+			funcInfo = true
+			break
+		}
+	}
+	if !funcInfo {
+		return nil, nil
+	}
+
+	wrapperIdx := -1
+	funcStarts := map[int]bool{0: true}
+	funcRefs := functionReferences(insns)
+	for i := range insns {
+		if funcRefs[insns[i].Symbol()] {
+			funcStarts[i] = true
+		}
+		if insns[i].Symbol() == "instrument-main-prog-wrapper" {
+			wrapperIdx = i
+		}
+	}
+
+	// Programs which are not instrumented keep their func and line info
+	if wrapperIdx == -1 {
+		return btf.FuncMetadata(&insns[0]), nil
+	}
+
+	// Instrumentation added before the original first instruction of a function has no BTF info.
+	curFunc := 0
+	for i := range insns {
+		if funcStarts[i] {
+			curFunc = i
+			continue
+		}
+
+		if fn := btf.FuncMetadata(&insns[i]); fn != nil {
+			insns[i] = withMetadata(insns[i], nil)
+			if btf.FuncMetadata(&insns[curFunc]) == nil {
+				insns[curFunc] = btf.WithFuncMetadata(insns[curFunc], fn)
+			}
+		}
+
+		if line, ok := insns[i].Source().(*btf.Line); ok {
+			if _, ok := insns[curFunc].Source().(*btf.Line); !ok {
+				insns[curFunc] = insns[curFunc].WithSource(line)
+			}
+		}
+	}
+
+	// The wrapper now holds the func info of the original entrypoint, copy it to the new entrypoint which takes the
+	// place of the original program. The wrapper gets its own func info later.
+	mainFn := btf.FuncMetadata(&insns[wrapperIdx])
+	if mainFn == nil {
+		return nil, errors.New("main program has no BTF func info")
+	}
+	insns[0] = btf.WithFuncMetadata(insns[0], mainFn)
+	if line, ok := insns[wrapperIdx].Source().(*btf.Line); ok {
+		insns[0] = insns[0].WithSource(line)
+	}
+
+	for i := range insns {
+		if funcStarts[i] && btf.FuncMetadata(&insns[i]) == nil {
+			return nil, fmt.Errorf("function '%s' has no BTF func info", insns[i].Symbol())
+		}
+	}
+
+	return mainFn, nil
+}
+
+// applyCORERelocations resolves all CO-RE relocations of insns against the target BTF and removes the relocations.
+// If target is nil, the BTF of the running kernel is used. Like libbpf, instructions of relocations without a match
+// in the target are poisoned. An error listing every failed relocation is returned if any relocation fails.
+func applyCORERelocations(insns asm.Instructions, target *btf.Spec) error {
+	var failed []string
+	relos := corerelo.Relocate(insns, target)
+	for i := range relos {
+		r := &relos[i]
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("instruction %d: %s", r.Index, r))
+			continue
+		}
+
+		ins := &insns[r.Index]
+		*ins = withMetadata(*ins, btf.FuncMetadata(ins))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d relocations failed:\n%s", len(failed), len(relos), strings.Join(failed, "\n"))
+	}
+
+	return nil
+}
+
+// btfMapDefs builds the BTF of map definitions in the .maps section. Map definitions are structs where every member
+// is a pointer to an int array, the size of the array is the value of the attribute.
+type btfMapDefs struct {
+	intType *btf.Int
+	intPtrs map[uint32]*btf.Pointer
+	// The .maps DATASEC, nil if no map definitions have been added
+	datasec *btf.Datasec
+}
+
+// intPtr returns a 'int (*)[n]' type
+func (b *btfMapDefs) intPtr(n uint32) *btf.Pointer {
+	if b.intType == nil {
+		b.intType = &btf.Int{Name: "int", Size: 4, Encoding: btf.Signed}
+		b.intPtrs = make(map[uint32]*btf.Pointer)
+	}
+
+	if ptr, ok := b.intPtrs[n]; ok {
+		return ptr
+	}
+
+	ptr := &btf.Pointer{Target: &btf.Array{Index: b.intType, Type: b.intType, Nelems: n}}
+	b.intPtrs[n] = ptr
+	return ptr
+}
+
+// mapDef returns the struct of a map definition
+func (b *btfMapDefs) mapDef(m *ebpf.MapSpec) *btf.Struct {
+	members := []btf.Member{
+		{Name: "type", Type: b.intPtr(uint32(m.Type))},
+		{Name: "key_size", Type: b.intPtr(m.KeySize)},
+		{Name: "value_size", Type: b.intPtr(m.ValueSize)},
+		{Name: "max_entries", Type: b.intPtr(m.MaxEntries)},
+	}
+	if m.Flags != 0 {
+		members = append(members, btf.Member{Name: "map_flags", Type: b.intPtr(m.Flags)})
+	}
+	if m.Pinning != ebpf.PinNone {
+		members = append(members, btf.Member{Name: "pinning", Type: b.intPtr(uint32(m.Pinning))})
+	}
+	size := uint32(len(members) * 8)
+
+	// The inner map of a map-in-map is described by a flexible array of pointers to its definition
+	if m.InnerMap != nil {
+		inner := &btf.Pointer{Target: b.mapDef(m.InnerMap)}
+		members = append(members, btf.Member{Name: "values", Type: &btf.Array{Index: b.intType, Type: inner}})
+	}
+
+	for i := range members {
+		members[i].Offset = btf.Bits(i * 64)
+	}
+
+	return &btf.Struct{Size: size, Members: members}
+}
+
+// add adds the definition of a map at the given offset in the .maps section and returns the size of the definition
+func (b *btfMapDefs) add(name string, m *ebpf.MapSpec, offset uint32) uint32 {
+	def := b.mapDef(m)
+	v := &btf.Var{Name: name, Type: def, Linkage: btf.GlobalVar}
+
+	if b.datasec == nil {
+		b.datasec = &btf.Datasec{Name: ".maps"}
+	}
+	b.datasec.Vars = append(b.datasec.Vars, btf.VarSecinfo{Type: v, Offset: offset, Size: def.Size})
+	b.datasec.Size = offset + def.Size
+	return def.Size
+}
+
+// btfExtHeader is the header of the .BTF.ext section
+type btfExtHeader struct {
+	Magic       uint16
+	Version     uint8
+	Flags       uint8
+	HdrLen      uint32
+	FuncInfoOff uint32
+	FuncInfoLen uint32
+	LineInfoOff uint32
+	LineInfoLen uint32
+	// No CO-RE relocations are written, but loaders expect the fields to be present
+	COREReloOff uint32
+	COREReloLen uint32
+}
+
+// btfExtInfo builds the func and line info of the .BTF.ext section. Offsets are in bytes from the start of the ELF
+// section of the instruction.
+type btfExtInfo struct {
+	sections  []string
+	funcInfos map[string][]extFuncInfo
+	lines     map[string][]extLineInfo
+}
+
+type extFuncInfo struct {
+	off uint32
+	fn  *btf.Func
+}
+
+type extLineInfo struct {
+	off  uint32
+	line *btf.Line
+}
+
+// add adds the func and line info of the instruction at the given offset of the section
+func (e *btfExtInfo) add(section string, off uint32, ins *asm.Instruction) {
+	fn := btf.FuncMetadata(ins)
+	line, _ := ins.Source().(*btf.Line)
+	if fn == nil && line == nil {
+		return
+	}
+
+	if e.funcInfos == nil {
+		e.funcInfos = make(map[string][]extFuncInfo)
+		e.lines = make(map[string][]extLineInfo)
+	}
+
+	if _, found := e.funcInfos[section]; !found {
+		if _, found = e.lines[section]; !found {
+			e.sections = append(e.sections, section)
+		}
+	}
+
+	if fn != nil {
+		e.funcInfos[section] = append(e.funcInfos[section], extFuncInfo{off, fn})
+	}
+	if line != nil {
+		e.lines[section] = append(e.lines[section], extLineInfo{off, line})
+	}
+}
+
+// funcs returns the functions the func info refers to
+func (e *btfExtInfo) funcs() []*btf.Func {
+	var fns []*btf.Func
+	for _, sec := range e.sections {
+		for _, fi := range e.funcInfos[sec] {
+			fns = append(fns, fi.fn)
+		}
+	}
+	return fns
+}
+
+// marshal writes the .BTF.ext section, funcIDs are the type IDs of the functions. The names of sections and files and
+// the lines of line info are added to strtab, which must be the string table of the BTF of the functions.
+func (e *btfExtInfo) marshal(w io.Writer, bo binary.ByteOrder, funcIDs map[*btf.Func]btf.TypeID,
+	strtab *stringTable) error {
+	var funcInfo, lineInfo bytes.Buffer
+
+	// Record sizes of struct bpf_func_info and struct bpf_line_info
+	_ = binary.Write(&funcInfo, bo, uint32(8))
+	_ = binary.Write(&lineInfo, bo, uint32(16))
+
+	for _, sec := range e.sections {
+		secName := strtab.add(sec)
+
+		if funcs := e.funcInfos[sec]; len(funcs) > 0 {
+			_ = binary.Write(&funcInfo, bo, []uint32{secName, uint32(len(funcs))})
+			for _, fi := range funcs {
+				id, found := funcIDs[fi.fn]
+				if !found {
+					return fmt.Errorf("func info of '%s': no type ID", fi.fn.Name)
+				}
+				_ = binary.Write(&funcInfo, bo, []uint32{fi.off, uint32(id)})
+			}
+		}
+
+		if lines := e.lines[sec]; len(lines) > 0 {
+			_ = binary.Write(&lineInfo, bo, []uint32{secName, uint32(len(lines))})
+			for _, li := range lines {
+				_ = binary.Write(&lineInfo, bo, []uint32{
+					li.off,
+					strtab.add(li.line.FileName()),
+					strtab.add(li.line.Line()),
+					li.line.LineNumber()<<10 | li.line.LineColumn(),
+				})
+			}
+		}
+	}
+
+	header := btfExtHeader{
+		Magic:       btfMagic,
+		Version:     1,
+		HdrLen:      uint32(binary.Size(btfExtHeader{})),
+		FuncInfoLen: uint32(funcInfo.Len()),
+		LineInfoOff: uint32(funcInfo.Len()),
+		LineInfoLen: uint32(lineInfo.Len()),
+		COREReloOff: uint32(funcInfo.Len() + lineInfo.Len()),
+	}
+	if err := binary.Write(w, bo, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(funcInfo.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(lineInfo.Bytes())
+	return err
+}
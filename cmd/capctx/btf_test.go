@@ -0,0 +1,80 @@
+package capctx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+)
+
+// The CO-RE test objects of cilium/ebpf, shared with pkg/corerelo
+const (
+	coreTestObject = "../../pkg/corerelo/testdata/relocs_read-el.elf"
+	coreTestTarget = "../../pkg/corerelo/testdata/relocs_read_tgt-el.elf"
+)
+
+func loadCORETest(t *testing.T) (asm.Instructions, *btf.Spec) {
+	t.Helper()
+
+	spec, err := ebpf.LoadCollectionSpec(coreTestObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := btf.LoadSpec(coreTestTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spec.Programs["reads"].Instructions, target
+}
+
+func TestApplyCORERelocations(t *testing.T) {
+	insns, target := loadCORETest(t)
+
+	var funcInfo int
+	for i := range insns {
+		if btf.FuncMetadata(&insns[i]) != nil {
+			funcInfo++
+		}
+	}
+
+	if err := applyCORERelocations(insns, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relocations are removed, so loaders don't apply them again, the func info is kept
+	for i := range insns {
+		if btf.CORERelocationMetadata(&insns[i]) != nil {
+			t.Errorf("instruction %d still has a CO-RE relocation", i)
+		}
+		if btf.FuncMetadata(&insns[i]) != nil {
+			funcInfo--
+		}
+	}
+	if funcInfo != 0 {
+		t.Errorf("%d instructions lost their func info", funcInfo)
+	}
+}
+
+func TestApplyCORERelocationsErrors(t *testing.T) {
+	insns, target := loadCORETest(t)
+
+	// Change the offset of the first relocated load, so the fixup doesn't match the instruction
+	for i := range insns {
+		if btf.CORERelocationMetadata(&insns[i]) != nil && insns[i].OpCode.Class() == asm.LdXClass {
+			insns[i].Offset++
+			break
+		}
+	}
+
+	err := applyCORERelocations(insns, target)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "1 of ") || !strings.Contains(err.Error(), "instruction ") {
+		t.Errorf("error doesn't report the failed relocation: %s", err)
+	}
+}
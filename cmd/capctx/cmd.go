@@ -1,13 +1,13 @@
 package capctx
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -17,8 +17,11 @@ import (
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/perf"
 	"github.com/dylandreimerink/edb/analyse"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/mapdump"
 	"github.com/dylandreimerink/mimic"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	_ "unsafe"
 )
@@ -30,7 +33,30 @@ func Command() *cobra.Command {
 		Long: "This command modifies the input program, adding instrumentation to it. The instrumented program will " +
 			"be loaded into the kernel and pinned in a given dir until this command end. While running this command " +
 			"will capture the context and results of helper functions and generate a context file from them.\n\n" +
-			"After starting this command, a loader program should unpin the program and attach it.",
+			"After starting this command, a loader program should unpin the program and attach it.\n\n" +
+			"Contexts are captured for the following program types:\n" +
+			"  XDP        - The xdp_md and the first 100 bytes of the packet\n" +
+			"  SKB        - For TC, socket filter, cGroup SKB, LWT and SK SKB programs, the __sk_buff up to and " +
+			"including the hash field and the first 100 bytes of the packet. The packet starts where it starts for " +
+			"the program, so for cGroup SKB programs at the network header.\n" +
+			"  Kprobe     - The x86_64 pt_regs\n" +
+			"  Perf event - The bpf_perf_event_data\n" +
+			"  Tracepoint - The first 512 bytes of the tracepoint record\n" +
+			"  Raw tracepoint - The bpf_raw_tracepoint_args, all 12 args, args the tracepoint doesn't have hold " +
+			"whatever follows the args in kernel memory\n\n" +
+			"Flow dissector programs can't be instrumented, for other program types only the helper calls are " +
+			"captured.\n\n" +
+			"Contexts are written to the context file as soon as they are captured. By default the context file is " +
+			"a JSON array which is completed when the capture stops, with --jsonl every context is written as a " +
+			"single line, so the file is usable even if this command doesn't exit cleanly. The capture stops on " +
+			"SIGINT or SIGTERM, after --duration or once --count contexts are captured. With --sample only some " +
+			"executions of the program are captured, the choice is made in the program so skipped executions have " +
+			"little overhead.\n\n" +
+			"Programs which keep state in maps behave differently when replayed with empty maps. With " +
+			"--map-pin-path, maps pinned by name are loaded from the given directory, the same way libbpf does, so " +
+			"the instrumented programs use the existing maps. With --dump-maps the contents of the maps are written " +
+			"next to the context file when the capture starts, 'capture.json' gets 'capture.maps.json', which can be " +
+			"loaded in the debugger with 'map load'.",
 		RunE: captureContextRun,
 		Args: cobra.ExactArgs(2),
 	}
@@ -41,18 +67,55 @@ func Command() *cobra.Command {
 	f.BoolVar(&flagVerifierLog, "verifier-log", false, "Print the verifier log")
 	f.BoolVar(&flagVerifierVerbose, "verifier-verbose", false, "If set, the verbose log is printed, not just the normal log")
 	f.BoolVar(&flagDebugAnalysis, "debug-analysis", false, "Print program analysis debug info")
+	f.IntVar(&flagCount, "count", 0, "Stop after capturing this many contexts")
+	f.DurationVar(&flagDuration, "duration", 0, "Stop after capturing for this duration, for example '30s' or '5m'")
+	f.BoolVar(&flagJSONLines, "jsonl", false, "Write the contexts as JSON lines, one context per line")
+	f.BoolVar(&flagDumpMaps, "dump-maps", false, "Write the contents of the maps next to the context file when the "+
+		"capture starts")
+	f.StringVar(&flagMapPinPath, "map-pin-path", "", "Load maps pinned by name from this directory instead of "+
+		"creating new ones, maps which aren't pinned yet are created and pinned")
+	addInstrumentFlags(f)
 
 	return cmd
 }
 
+// addInstrumentFlags adds the flags which influence the instrumentation
+func addInstrumentFlags(f *pflag.FlagSet) {
+	f.StringVar(&flagSample, "sample", "", "Only capture 1 in N executions of the program, randomly, given as 'N' "+
+		"or '1/N'")
+	f.StringSliceVar(&flagPrograms, "program", nil, "Only instrument the programs with the given names, other "+
+		"programs are loaded as is. Can be given multiple times")
+}
+
 var (
 	flagPlainProg       bool
 	flagInstProg        bool
 	flagVerifierLog     bool
 	flagVerifierVerbose bool
 	flagDebugAnalysis   bool
+	flagCount           int
+	flagDuration        time.Duration
+	flagJSONLines       bool
+	flagDumpMaps        bool
+	flagMapPinPath      string
+	flagSample          string
+	flagPrograms        []string
 )
 
+// parseSample parses the --sample flag, which is either 'N' or '1/N'
+func parseSample(sample string) (int, error) {
+	if sample == "" {
+		return 1, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(sample, "1/"))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid sample rate '%s', expected 'N' or '1/N' where N is a positive number", sample)
+	}
+
+	return n, nil
+}
+
 const (
 	feedbackMap = "ebpf_instrument_map"
 	bufferMap   = "ebpf_buffer_map"
@@ -67,47 +130,29 @@ func captureContextRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("load collection: %w", err)
 	}
 
-	for name, prog := range spec.Programs {
-		if flagPlainProg {
-			fmt.Println(name, " plain:")
-			fmt.Println(prog.Instructions)
-		}
+	err = instrumentCollection(spec)
+	if err != nil {
+		return err
+	}
 
-		err := instrumentProgram(prog)
-		if err != nil {
-			return fmt.Errorf("instrument program '%s': %w", name, err)
-		}
+	// Modifying the instructions without modifying the BTF will cause verifier rejection.
+	err = rewriteBTF(spec)
+	if err != nil {
+		return fmt.Errorf("rewrite BTF: %w", err)
+	}
 
-		if flagInstProg {
+	if flagInstProg {
+		for name, prog := range spec.Programs {
 			fmt.Println(name, " instrumented:")
 			fmt.Println(prog.Instructions)
 		}
-
-		// Disable BTF since modifying the instructions without modifying the BTF will cause verifier rejection.
-		// TODO add BTF rewriting
-		prog.BTF = nil
-
-		// Otherwise the kernel verifier might discard our instrumentation
-		prog.License = "GPL"
-	}
-
-	spec.Maps[feedbackMap] = &ebpf.MapSpec{
-		Name:      feedbackMap,
-		Type:      ebpf.PerfEventArray,
-		ValueSize: 4,
-	}
-	spec.Maps[bufferMap] = &ebpf.MapSpec{
-		Name:       bufferMap,
-		Type:       ebpf.PerCPUArray,
-		KeySize:    4,
-		ValueSize:  bufferSize,
-		MaxEntries: 1,
 	}
 
 	opts := &ebpf.CollectionOptions{Programs: ebpf.ProgramOptions{LogLevel: 1, LogSize: 200 * 1 << 20}}
 	if flagVerifierVerbose {
 		opts.Programs.LogLevel = 2
 	}
+	opts.Maps.PinPath = flagMapPinPath
 
 	holder := typeFromSpec(spec)
 	err = spec.LoadAndAssign(holder, opts)
@@ -150,67 +195,203 @@ func captureContextRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("can't find feedback map in map holder")
 	}
 
+	if flagDumpMaps {
+		dumpPath := mapdump.PathForContext(args[1])
+		err = dumpMaps(holder, dumpPath)
+		if err != nil {
+			return fmt.Errorf("dump maps: %w", err)
+		}
+		fmt.Printf("Map contents written to '%s'\n", dumpPath)
+	}
+
+	ctxFile, err := os.Create(args[1])
+	if err != nil {
+		return fmt.Errorf("create context file: %w", err)
+	}
+	defer ctxFile.Close()
+
 	r, err := perf.NewReader(m, bufferSize)
 	if err != nil {
 		return fmt.Errorf("new perf reader: %w", err)
 	}
-	defer m.Close()
+	defer r.Close()
+
+	enc := ctxutil.NewStreamEncoder(ctxFile, flagJSONLines)
+
+	var (
+		captured int
+		readErr  error
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		captured, readErr = readContexts(r, enc)
+	}()
 
 	sigChan := make(chan os.Signal, 2)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	var ctxs []mimic.Context
+	var timeout <-chan time.Time
+	if flagDuration > 0 {
+		timeout = time.After(flagDuration)
+	}
 
-	go func() {
-		i := 0
-		for {
-			err := r.Resume()
-			if err != nil {
-				fmt.Printf("resume: %s", err.Error())
-				continue
-			}
+	select {
+	case <-sigChan:
+	case <-timeout:
+	case <-done:
+	}
 
-			record, err := r.Read()
-			if err != nil {
-				fmt.Printf("pref read: %s", err.Error())
-				continue
-			}
+	// Closing the reader stops the reading goroutine, wait for it so it is done writing before we complete the file.
+	r.Close()
+	<-done
 
-			ctx, err := decodeFeedback(record.RawSample)
-			if err != nil {
-				fmt.Printf("decode feedback: %s", err.Error())
-				continue
-			}
+	// Complete the file even if reading failed, so the contexts captured so far can be used
+	err = enc.Close()
+	if readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return fmt.Errorf("write context file: %w", err)
+	}
 
-			if ctx != nil {
-				ctx.SetName(fmt.Sprintf("%d (%s)", i, time.Now()))
-				i++
+	fmt.Printf("%d contexts written to '%s'\n", captured, args[1])
 
-				ctxs = append(ctxs, ctx)
+	return nil
+}
 
-				fmt.Println(i, "contexts captured")
+// readContexts reads the feedback of the instrumented programs and writes the contexts to enc, until the reader is
+// closed or --count contexts have been captured.
+func readContexts(r *perf.Reader, enc *ctxutil.StreamEncoder) (int, error) {
+	captured := 0
+	for flagCount == 0 || captured < flagCount {
+		record, err := r.Read()
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				break
 			}
+			return captured, fmt.Errorf("perf read: %w", err)
 		}
-	}()
 
-	<-sigChan
+		if record.LostSamples > 0 {
+			fmt.Printf("%d samples lost, the perf buffer was full\n", record.LostSamples)
+			continue
+		}
 
-	ctxFile, err := os.Create(args[1])
-	if err != nil {
-		return fmt.Errorf("create context file: %w", err)
+		ctx, err := decodeFeedback(record.RawSample)
+		if err != nil {
+			fmt.Printf("decode feedback: %s\n", err.Error())
+			continue
+		}
+
+		ctx.SetName(fmt.Sprintf("%d (%s)", captured, time.Now()))
+		err = enc.Encode(ctx)
+		if err != nil {
+			return captured, fmt.Errorf("write context: %w", err)
+		}
+		captured++
+
+		fmt.Println(captured, "contexts captured")
 	}
-	defer ctxFile.Close()
 
-	jsonEncoder := json.NewEncoder(ctxFile)
-	jsonEncoder.SetIndent("", "  ")
-	err = jsonEncoder.Encode(ctxs)
+	return captured, nil
+}
+
+// instrumentCollection instruments the programs in the collection selected by --program, or all if none are
+// selected, and adds the maps used by the instrumentation.
+func instrumentCollection(spec *ebpf.CollectionSpec) error {
+	sample, err := parseSample(flagSample)
 	if err != nil {
-		return fmt.Errorf("json encode context: %w", err)
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, name := range flagPrograms {
+		if spec.Programs[name] == nil {
+			return fmt.Errorf("program '%s' doesn't exist", name)
+		}
+		selected[name] = true
+	}
+
+	for name, prog := range spec.Programs {
+		if len(selected) > 0 && !selected[name] {
+			continue
+		}
+
+		if flagPlainProg {
+			fmt.Println(name, " plain:")
+			fmt.Println(prog.Instructions)
+		}
+
+		err := instrumentProgram(prog, spec.Maps, sample)
+		if err != nil {
+			return fmt.Errorf("instrument program '%s': %w", name, err)
+		}
+
+		// Otherwise the kernel verifier might discard our instrumentation
+		prog.License = "GPL"
+	}
+
+	spec.Maps[feedbackMap] = &ebpf.MapSpec{
+		Name:      feedbackMap,
+		Type:      ebpf.PerfEventArray,
+		KeySize:   4,
+		ValueSize: 4,
+	}
+	spec.Maps[bufferMap] = &ebpf.MapSpec{
+		Name:       bufferMap,
+		Type:       ebpf.PerCPUArray,
+		KeySize:    4,
+		ValueSize:  bufferSize,
+		MaxEntries: 1,
 	}
 
 	return nil
 }
 
+// dumpMaps writes the contents of all maps in the holder, except the maps of the instrumentation, to path.
+func dumpMaps(sh specHolder, path string) error {
+	var dump mapdump.Dump
+
+	shStruct := reflect.ValueOf(sh).Elem()
+	shStructType := shStruct.Type()
+	for i := 0; i < shStruct.NumField(); i++ {
+		m, ok := shStruct.Field(i).Interface().(*ebpf.Map)
+		if !ok {
+			continue
+		}
+
+		name := shStructType.Field(i).Tag.Get("ebpf")
+		if name == feedbackMap || name == bufferMap {
+			continue
+		}
+
+		dm, err := mapdump.FromMap(name, m)
+		if err != nil {
+			if errors.Is(err, mapdump.ErrUnsupported) {
+				fmt.Printf("Not dumping map '%s': %s\n", name, err)
+				continue
+			}
+			return fmt.Errorf("map '%s': %w", name, err)
+		}
+
+		dump.Maps = append(dump.Maps, dm)
+	}
+
+	sort.Slice(dump.Maps, func(i, j int) bool {
+		return dump.Maps[i].Name < dump.Maps[j].Name
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return mapdump.Encode(f, dump)
+}
+
 type specHolder interface{}
 
 func GetMapByName(sh specHolder, name string) *ebpf.Map {
@@ -236,23 +417,20 @@ func typeFromSpec(spec *ebpf.CollectionSpec) specHolder {
 	progPtrType := reflect.TypeOf(&ebpf.Program{})
 	mapPtrType := reflect.TypeOf(&ebpf.Map{})
 
+	// The names of the fields don't matter, only the tags, names like '.rodata.str1.1' aren't valid Go identifiers so
+	// the fields are numbered.
 	i := 0
 	for name := range spec.Programs {
 		fields = append(fields, reflect.StructField{
-			Name: strings.Title(name),
+			Name: fmt.Sprint("Field", i),
 			Type: progPtrType,
 			Tag:  reflect.StructTag(fmt.Sprintf("ebpf:\"%s\"", name)),
 		})
 		i++
 	}
 	for name := range spec.Maps {
-		switch name {
-		case ".rodata", ".data", ".bss":
-			// Don't include global maps in struct
-			continue
-		}
 		fields = append(fields, reflect.StructField{
-			Name: strings.Title(name),
+			Name: fmt.Sprint("Field", i),
 			Type: mapPtrType,
 			Tag:  reflect.StructTag(fmt.Sprintf("ebpf:\"%s\"", name)),
 		})
@@ -414,6 +592,8 @@ const (
 	bufferPtr = -16
 	// Offset within the first stack frame where the a pointer to the start of the feedback buffer is stored
 	bufferStartPtr = -24
+	// Offset within the first stack frame where the sample decision is stored, 0 if the execution is sampled
+	sampleOff = -32
 )
 
 type MsgType byte
@@ -438,7 +618,10 @@ const (
 	rOutData
 )
 
-func instrumentProgram(prog *ebpf.ProgramSpec) error {
+// instrumentProgram adds instrumentation to the program, which sends the context and helper calls of 1 in sample
+// executions to userspace. maps are the maps of the collection, they are used to find the value size of maps passed
+// to helpers.
+func instrumentProgram(prog *ebpf.ProgramSpec, maps map[string]*ebpf.MapSpec, sample int) error {
 
 	// Create a program checker and pass it a CTX at R1(for now)
 	permChecker := analyse.NewChecker()
@@ -476,8 +659,8 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 	// Create an new entrypoint, which will perform a BPF-to-BPF call to the real entrypoint.
 	// We do this so we can use the first stack frame as memory which the main program will not touch.
 	newInstructions = append(newInstructions, []asm.Instruction{
-		// Store R1(ctx) in the first stack frame
-		// TODO store other initial registers as well(R2-R5) for tracepoints and the like
+		// Store R1(ctx) in the first stack frame. R1 is the only argument of every program type, the verifier
+		// rejects reads of R2-R5 on entry, arguments of the traced function are part of the context.
 		asm.StoreMem(asm.R10, ctxOff, asm.R1, asm.DWord),
 
 		// Get ptr to map value 0, and store it at bufferPtr
@@ -491,25 +674,51 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 		asm.StoreMem(asm.R10, bufferStartPtr, asm.R0, asm.DWord),
 		asm.Add.Imm(asm.R0, 4),
 		asm.StoreMem(asm.R10, bufferPtr, asm.R0, asm.DWord),
+	}...)
+
+	if sample > 1 {
+		newInstructions = append(newInstructions,
+			// Only executions where the random number modulo the sample rate is 0 are sent
+			asm.FnGetPrandomU32.Call(),
+			asm.Mod.Imm(asm.R0, int32(sample)),
+			asm.StoreMem(asm.R10, sampleOff, asm.R0, asm.DWord),
+			// Don't capture the context if this execution isn't sampled
+			asm.JNE.Imm(asm.R0, 0, "instrument-main-call"),
+		)
+	}
 
-		// TODO restore other initial registers as well(R2-R5) for tracepoints and the like
+	newInstructions = append(newInstructions,
 		// Restore CTX to R1
 		asm.LoadMem(asm.R1, asm.R10, ctxOff, asm.DWord),
-	}...)
+	)
 
 	// Capture the passed context
-	newInstructions = append(newInstructions, sendCtx(prog.Type)...)
+	ctxInstructions, err := sendCtx(prog.Type)
+	if err != nil {
+		return err
+	}
+	newInstructions = append(newInstructions, ctxInstructions...)
 
 	newInstructions = append(newInstructions, []asm.Instruction{
 		// Restore CTX to R1
-		asm.LoadMem(asm.R1, asm.R10, ctxOff, asm.DWord),
+		asm.LoadMem(asm.R1, asm.R10, ctxOff, asm.DWord).WithSymbol("instrument-main-call"),
 		// Pass the first frame pointer as second argument, call the main program.
 		asm.Mov.Reg(asm.R2, asm.R10),
 		asm.Call.Label("instrument-main-prog-wrapper"),
 
 		// Save R0(return value of main prog)
 		asm.Mov.Reg(asm.R6, asm.R0),
+	}...)
 
+	if sample > 1 {
+		newInstructions = append(newInstructions,
+			// Skip sending if this execution isn't sampled
+			asm.LoadMem(asm.R1, asm.R10, sampleOff, asm.DWord),
+			asm.JNE.Imm(asm.R1, 0, "instrument-main-skip-send"),
+		)
+	}
+
+	newInstructions = append(newInstructions, []asm.Instruction{
 		// Returned to instrumentation wrapper
 		// Restore CTX to R1
 		asm.LoadMem(asm.R1, asm.R10, ctxOff, asm.DWord),
@@ -532,7 +741,7 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 		asm.FnPerfEventOutput.Call().WithSymbol("send-buffer"),
 
 		// Restore R0 of main program
-		asm.Mov.Reg(asm.R0, asm.R6),
+		asm.Mov.Reg(asm.R0, asm.R6).WithSymbol("instrument-main-skip-send"),
 
 		// Exit program
 		asm.Return().WithSymbol("instrument-main-exit"),
@@ -558,7 +767,7 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 	}
 
 	// Also record all existing labels, at this point all symbols are function entrypoints
-	functionReferences := prog.Instructions.FunctionReferences()
+	functionReferences := functionReferences(prog.Instructions)
 
 	// A bpf-to-bpf function can be called from multiple funcs, but the callee can only access 1 set of offsets from the
 	// prev call frame. So for each caller, get the first free offset on the stack, take the max of all callers.
@@ -644,7 +853,19 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 		if inst.IsBuiltinCall() {
 			fn := asm.BuiltinFunc(inst.Constant)
 
-			helperInstr := helperInstrumentation(fpOff, primarySaveOff)[fn]
+			mapValueSize := helperMapValueSize(prog.Instructions, i, maps)
+			helperInstr := helperInstrumentation(fn, mapValueSize, fpOff, primarySaveOff)
+
+			if sample > 1 {
+				// Send the helper call only if this execution is sampled
+				newInstructions = append(newInstructions, sampledOnly(
+					merge(sendHelperID(fn, fpOff, primarySaveOff), helperInstr.pre),
+					inst,
+					helperInstr.post,
+					fpOff,
+				)...)
+				continue
+			}
 
 			// Send the ID of the helper function
 			newInstructions = append(newInstructions, sendHelperID(fn, fpOff, primarySaveOff)...)
@@ -707,5 +928,16 @@ func instrumentProgram(prog *ebpf.ProgramSpec) error {
 	return nil
 }
 
+// isInstrumented returns true if the program has been instrumented by instrumentProgram
+func isInstrumented(prog *ebpf.ProgramSpec) bool {
+	for _, ins := range prog.Instructions {
+		if ins.Symbol() == "instrument-main-prog-wrapper" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Copied from sys/unix
 const BPF_F_CURRENT_CPU = 0xffffffff
@@ -2,28 +2,213 @@ package capctx
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
 	"github.com/dylandreimerink/mimic"
 )
 
 // TODO should we make this configurable, start with 100 and allow the user to increase if they expect to need more
 // packet data?
-const maxXDPPacketSize = 100
+const maxPacketSize = 100
+
+// The amount of bytes copied from the start of a tracepoint record. The layout and size of the record differ per
+// tracepoint, so we copy a fixed amount which should cover the fixed fields and the dynamic data of most tracepoints.
+const maxTracepointSize = 512
+
+// capturedSKBFields are the fields at the start of `struct __sk_buff` which are captured. Each field is 32 bits. All
+// program types which get a __sk_buff can read these fields, except for the fields in skippedSKBFields.
+var capturedSKBFields = []string{
+	"len",
+	"pkt_type",
+	"mark",
+	"queue_mapping",
+	"protocol",
+	"vlan_present",
+	"vlan_tci",
+	"vlan_proto",
+	"priority",
+	"ingress_ifindex",
+	"ifindex",
+	"tc_index",
+	"cb0",
+	"cb1",
+	"cb2",
+	"cb3",
+	"cb4",
+	"hash",
+}
+
+// skippedSKBFields are the captured __sk_buff fields which the verifier doesn't allow a program type to read. Zero is
+// sent in their place so the layout of the message is the same for all program types.
+var skippedSKBFields = map[ebpf.ProgramType]map[string]bool{
+	// sk_skb_is_valid_access refuses reads of `mark`
+	ebpf.SkSKB: {"mark": true},
+}
+
+// ctxDataHeader returns the instructions which load the buffer pointer into R0, write the ctx data message header and
+// advance R0 to the end of the header.
+func ctxDataHeader(progType ebpf.ProgramType) []asm.Instruction {
+	return []asm.Instruction{
+		// Load buf pointer
+		// __u32 *buf = ...;
+		asm.LoadMem(asm.R0, asm.R10, bufferPtr, asm.DWord),
+
+		// Set msg type
+		asm.StoreImm(asm.R0, 0, int64(ctxData), asm.Byte),
+		asm.StoreImm(asm.R0, 1, int64(progType), asm.Word),
+		// Advance buf ptr
+		asm.Add.Imm(asm.R0, 5),
+	}
+}
+
+// sendSKBCtx copies the captured __sk_buff fields and up to maxPacketSize bytes of the packet. Not all program types
+// have direct packet access, so bpf_skb_load_bytes is used to copy the packet.
+func sendSKBCtx(progType ebpf.ProgramType) []asm.Instruction {
+	insts := append(ctxDataHeader(progType),
+		// Store location of size in R7
+		asm.Mov.Reg(asm.R7, asm.R0),
+		// Advance buf ptr, 2 bytes for `size`
+		asm.Add.Imm(asm.R0, 2),
+	)
+
+	// Copy __sk_buff fields
+	for i, field := range capturedSKBFields {
+		if skippedSKBFields[progType][field] {
+			insts = append(insts, asm.StoreImm(asm.R0, int16(i*4), 0, asm.Word))
+			continue
+		}
 
-func sendCtx(progType ebpf.ProgramType) []asm.Instruction {
+		insts = append(insts,
+			asm.LoadMem(asm.R2, asm.R1, int16(i*4), asm.Word),
+			asm.StoreMem(asm.R0, int16(i*4), asm.R2, asm.Word),
+		)
+	}
+
+	return append(insts,
+		asm.Add.Imm(asm.R0, int32(len(capturedSKBFields)*4)),
+		// Store location of the packet in R6
+		asm.Mov.Reg(asm.R6, asm.R0),
+
+		// size = 0
+		asm.Mov.Imm(asm.R8, 0),
+		// len = min(skb->len, maxPacketSize)
+		asm.LoadMem(asm.R4, asm.R1, 0, asm.Word),
+		asm.JLE.Imm(asm.R4, maxPacketSize, "skb_cp_len"),
+		asm.Mov.Imm(asm.R4, maxPacketSize),
+		// if len < 1: goto skb_cp_done
+		asm.JLT.Imm(asm.R4, 1, "skb_cp_done").WithSymbol("skb_cp_len"),
+		asm.Mov.Reg(asm.R8, asm.R4),
+
+		// bpf_skb_load_bytes(skb, 0, buf, len)
+		asm.Mov.Imm(asm.R2, 0),
+		asm.Mov.Reg(asm.R3, asm.R6),
+		asm.FnSkbLoadBytes.Call(),
+		// If the packet could not be loaded, send no packet
+		asm.JEq.Imm(asm.R0, 0, "skb_cp_done"),
+		asm.Mov.Imm(asm.R8, 0),
+
+		// Set `size` of ctx_data msg.
+		asm.StoreMem(asm.R7, 0, asm.R8, asm.Half).WithSymbol("skb_cp_done"),
+		// Advance buf ptr past the packet
+		asm.Add.Reg(asm.R6, asm.R8),
+		// Store buf ptr
+		asm.StoreMem(asm.R10, bufferPtr, asm.R6, asm.DWord),
+	)
+}
+
+// sendRegsCtx copies the first `fields` 64-bit fields of the context, used for pt_regs based contexts.
+func sendRegsCtx(progType ebpf.ProgramType, fields int) []asm.Instruction {
+	insts := ctxDataHeader(progType)
+	for i := 0; i < fields; i++ {
+		insts = append(insts,
+			asm.LoadMem(asm.R2, asm.R1, int16(i*8), asm.DWord),
+			asm.StoreMem(asm.R0, int16(i*8), asm.R2, asm.DWord),
+		)
+	}
+
+	return append(insts,
+		asm.Add.Imm(asm.R0, int32(fields*8)),
+		// Store buf ptr
+		asm.StoreMem(asm.R10, bufferPtr, asm.R0, asm.DWord),
+	)
+}
+
+// sendTracepointCtx copies the first maxTracepointSize bytes of the tracepoint record. Direct context access beyond the
+// fixed fields of a tracepoint causes the kernel to refuse attaching the program, so bpf_probe_read_kernel is used.
+func sendTracepointCtx(progType ebpf.ProgramType) []asm.Instruction {
+	return append(ctxDataHeader(progType),
+		// Store location of the record in R6
+		asm.Mov.Reg(asm.R6, asm.R0),
+
+		// bpf_probe_read_kernel(buf, maxTracepointSize, ctx)
+		asm.Mov.Reg(asm.R1, asm.R0),
+		asm.Mov.Imm(asm.R2, maxTracepointSize),
+		asm.LoadMem(asm.R3, asm.R10, ctxOff, asm.DWord),
+		asm.FnProbeReadKernel.Call(),
+
+		// Advance buf ptr past the record, on error the helper zeroes the record
+		asm.Add.Imm(asm.R6, maxTracepointSize),
+		// Store buf ptr
+		asm.StoreMem(asm.R10, bufferPtr, asm.R6, asm.DWord),
+	)
+}
+
+// sendRawTracepointCtx copies the max amount of args of a raw tracepoint. The number of args differs per tracepoint and
+// direct context access beyond the args of the tracepoint causes the kernel to refuse attaching the program, so
+// bpf_probe_read_kernel is used. Args beyond those of the tracepoint are whatever follows them in kernel memory.
+func sendRawTracepointCtx(progType ebpf.ProgramType) []asm.Instruction {
+	return append(ctxDataHeader(progType),
+		// Store location of the args in R6
+		asm.Mov.Reg(asm.R6, asm.R0),
+
+		// bpf_probe_read_kernel(buf, RawTracepointArgs * 8, ctx)
+		asm.Mov.Reg(asm.R1, asm.R0),
+		asm.Mov.Imm(asm.R2, ctxutil.RawTracepointArgs*8),
+		asm.LoadMem(asm.R3, asm.R10, ctxOff, asm.DWord),
+		asm.FnProbeReadKernel.Call(),
+
+		// Advance buf ptr past the args, on error the helper zeroes the args
+		asm.Add.Imm(asm.R6, ctxutil.RawTracepointArgs*8),
+		// Store buf ptr
+		asm.StoreMem(asm.R10, bufferPtr, asm.R6, asm.DWord),
+	)
+}
+
+// errFlowDissectorCtx is returned for flow dissector programs, their __sk_buff only gives access to the packet and
+// flow keys, which the program fills in. Capturing these isn't supported.
+var errFlowDissectorCtx = errors.New("capturing the context of flow dissector programs is unsupported")
+
+func sendCtx(progType ebpf.ProgramType) ([]asm.Instruction, error) {
 	switch progType {
 	case ebpf.SocketFilter, ebpf.SchedACT, ebpf.SchedCLS, ebpf.CGroupSKB, ebpf.LWTIn, ebpf.LWTOut, ebpf.LWTXmit,
-		ebpf.SkSKB, ebpf.LWTSeg6Local, ebpf.FlowDissector:
+		ebpf.SkSKB, ebpf.LWTSeg6Local:
 		// __sk_buff
+		return sendSKBCtx(progType), nil
+
+	case ebpf.FlowDissector:
+		// __sk_buff, but only data, data_end and flow_keys can be accessed
+		return nil, errFlowDissectorCtx
 
-	case ebpf.Kprobe, ebpf.PerfEvent, ebpf.RawTracepoint:
+	case ebpf.Kprobe:
 		// pt_regs
+		return sendRegsCtx(progType, len(ctxutil.PTRegsFields)), nil
+
+	case ebpf.PerfEvent:
+		// bpf_perf_event_data
+		return sendRegsCtx(progType, len(ctxutil.PTRegsFields)+len(ctxutil.PerfEventDataFields)), nil
+
+	case ebpf.RawTracepoint:
+		// bpf_raw_tracepoint_args
+		return sendRawTracepointCtx(progType), nil
 
 	case ebpf.TracePoint:
 		// different per tracepoint
 		// https://stackoverflow.com/questions/64944729/read-ebpf-tracepoint-argument
+		return sendTracepointCtx(progType), nil
 
 	case ebpf.XDP:
 		// xdp_md
@@ -72,8 +257,8 @@ func sendCtx(progType ebpf.ProgramType) []asm.Instruction {
 			asm.Mov.Reg(asm.R9, asm.R6).WithSymbol("xdp_md_cp_cmp"),
 			asm.Add.Imm(asm.R9, 1),
 			asm.JGT.Reg(asm.R9, asm.R7, "xdp_md_cp_done"),
-			// if i > maxXDPPacketSize: goto xdp_md_cp_done
-			asm.JGT.Imm(asm.R1, maxXDPPacketSize, "xdp_md_cp_done"),
+			// if i > maxPacketSize: goto xdp_md_cp_done
+			asm.JGT.Imm(asm.R1, maxPacketSize, "xdp_md_cp_done"),
 
 			// *buf = (__u8) *cur
 			asm.LoadMem(asm.R8, asm.R6, 0, asm.Byte),
@@ -91,7 +276,7 @@ func sendCtx(progType ebpf.ProgramType) []asm.Instruction {
 
 			// Store buf ptr
 			asm.StoreMem(asm.R10, bufferPtr, asm.R0, asm.DWord),
-		}
+		}, nil
 
 	case ebpf.CGroupSock:
 		// bpf_sock
@@ -139,7 +324,7 @@ func sendCtx(progType ebpf.ProgramType) []asm.Instruction {
 		// struct args*
 	}
 
-	return nil
+	return nil, nil
 }
 
 func ctxDataDecode(progType ebpf.ProgramType, data []byte) (mimic.Context, []byte, error) {
@@ -147,15 +332,107 @@ func ctxDataDecode(progType ebpf.ProgramType, data []byte) (mimic.Context, []byt
 
 	switch progType {
 	case ebpf.SocketFilter, ebpf.SchedACT, ebpf.SchedCLS, ebpf.CGroupSKB, ebpf.LWTIn, ebpf.LWTOut, ebpf.LWTXmit,
-		ebpf.SkSKB, ebpf.LWTSeg6Local, ebpf.FlowDissector:
+		ebpf.SkSKB, ebpf.LWTSeg6Local:
 		// __sk_buff
+		hdrSize := 2 + len(capturedSKBFields)*4
+		if len(data) < hdrSize {
+			return nil, nil, fmt.Errorf("sk_buff ctx data too small")
+		}
 
-	case ebpf.Kprobe, ebpf.PerfEvent, ebpf.RawTracepoint:
-		// pt_regs
+		size := int(ne.Uint16(data[0:2]))
+		fields := data[2:hdrSize]
+		if len(data) < hdrSize+size {
+			return nil, nil, fmt.Errorf("sk_buff ctx data missing packet data")
+		}
+		pkt := data[hdrSize : hdrSize+size]
+		data = data[hdrSize+size:]
+
+		// The kernel already removed the VLAN tag, if any, so don't let NewSKBuff look at the packet.
+		ctx := ctxutil.NewSKBuff("", nil, 0)
+		ctxutil.Memory(ctx, "pkt").Block.Value = pkt
+		ctxutil.Memory(ctx, "data_end").Pointer.Offset = len(pkt)
+
+		for i, name := range capturedSKBFields {
+			value := int64(ne.Uint32(fields[i*4:]))
+			if skippedSKBFields[progType][name] {
+				value = 0
+			}
+			if err := ctxutil.SetInt(ctx, name, value); err != nil {
+				return nil, nil, err
+			}
+		}
+		// Not all program types can read wire_len, the length is the best guess we have
+		if err := ctxutil.SetInt(ctx, "wire_len", int64(ne.Uint32(fields[0:4]))); err != nil {
+			return nil, nil, err
+		}
+
+		return ctx, data, nil
+
+	case ebpf.FlowDissector:
+		// __sk_buff, but only data, data_end and flow_keys can be accessed
+		return nil, nil, errFlowDissectorCtx
+
+	case ebpf.Kprobe, ebpf.PerfEvent:
+		// pt_regs or bpf_perf_event_data
+		ctx := ctxutil.NewPTRegs("")
+		fields := ctxutil.PTRegsFields
+		if progType == ebpf.PerfEvent {
+			ctx = ctxutil.NewPerfEventData("")
+			fields = append(append([]string{}, ctxutil.PTRegsFields...), ctxutil.PerfEventDataFields...)
+		}
+
+		if len(data) < len(fields)*8 {
+			return nil, nil, fmt.Errorf("pt_regs ctx data too small")
+		}
+
+		for i, name := range fields {
+			if err := ctxutil.SetInt(ctx, name, int64(ne.Uint64(data[i*8:]))); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return ctx, data[len(fields)*8:], nil
+
+	case ebpf.RawTracepoint:
+		// bpf_raw_tracepoint_args
+		if len(data) < ctxutil.RawTracepointArgs*8 {
+			return nil, nil, fmt.Errorf("raw tracepoint ctx data too small")
+		}
+
+		ctx := ctxutil.NewRawTracepoint("")
+		for i := 0; i < ctxutil.RawTracepointArgs; i++ {
+			if err := ctxutil.SetInt(ctx, fmt.Sprintf("args%d", i), int64(ne.Uint64(data[i*8:]))); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return ctx, data[ctxutil.RawTracepointArgs*8:], nil
 
 	case ebpf.TracePoint:
-		// different per tracepoint
-		// https://stackoverflow.com/questions/64944729/read-ebpf-tracepoint-argument
+		// different per tracepoint, we only know the record as a block of bytes. The bytes after the actual record
+		// are whatever was in the trace buffer at the time.
+		if len(data) < maxTracepointSize {
+			return nil, nil, fmt.Errorf("tracepoint ctx data too small")
+		}
+
+		ctx := &mimic.GenericContext{
+			Emulator: make(map[string]interface{}),
+			Registers: mimic.GenericContextRegisters{
+				R1: "tracepoint",
+			},
+			Memory: []mimic.GenericContextMemory{
+				{
+					Name: "tracepoint",
+					Type: "block",
+					Block: &mimic.GenericContextMemoryBlock{
+						Value:     data[:maxTracepointSize],
+						ByteOrder: ne,
+					},
+				},
+			},
+		}
+
+		return ctx, data[maxTracepointSize:], nil
 
 	case ebpf.XDP:
 		// xdp_md
@@ -0,0 +1,82 @@
+package capctx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/mimic"
+)
+
+func TestCtxDataDecodeRawTracepoint(t *testing.T) {
+	ne := mimic.GetNativeEndianness()
+
+	data := make([]byte, ctxutil.RawTracepointArgs*8+3)
+	for i := 0; i < ctxutil.RawTracepointArgs; i++ {
+		ne.PutUint64(data[i*8:], uint64(i+1))
+	}
+
+	ctx, rest, err := ctxDataDecode(ebpf.RawTracepoint, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 3 {
+		t.Errorf("got %d bytes after the ctx data, want 3", len(rest))
+	}
+
+	gctx := ctx.(*mimic.GenericContext)
+	for i, mem := range gctx.Memory[:ctxutil.RawTracepointArgs] {
+		if mem.Int == nil || mem.Int.Value != int64(i+1) {
+			t.Errorf("%s = %+v, want %d", mem.Name, mem.Int, i+1)
+		}
+	}
+
+	if _, _, err = ctxDataDecode(ebpf.RawTracepoint, data[:8]); err == nil {
+		t.Error("expected error for truncated ctx data")
+	}
+}
+
+func TestSkSKBSkipsMark(t *testing.T) {
+	const markOff = 2 * 4
+
+	for _, progType := range []ebpf.ProgramType{ebpf.SkSKB, ebpf.SchedCLS} {
+		insts, err := sendCtx(progType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var readsMark bool
+		for _, inst := range insts {
+			if inst.OpCode.Class().IsLoad() && inst.Src == asm.R1 && inst.Offset == markOff {
+				readsMark = true
+			}
+		}
+		if want := progType != ebpf.SkSKB; readsMark != want {
+			t.Errorf("%s: reads mark %v, want %v", progType, readsMark, want)
+		}
+	}
+
+	ne := mimic.GetNativeEndianness()
+	data := make([]byte, 2+len(capturedSKBFields)*4)
+	ne.PutUint32(data[2+markOff:], 0xffff)
+
+	ctx, _, err := ctxDataDecode(ebpf.SkSKB, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark := ctxutil.Memory(ctx.(*mimic.GenericContext), "mark"); mark.Int.Value != 0 {
+		t.Errorf("mark = %d, want 0", mark.Int.Value)
+	}
+}
+
+func TestFlowDissectorUnsupported(t *testing.T) {
+	if _, err := sendCtx(ebpf.FlowDissector); !errors.Is(err, errFlowDissectorCtx) {
+		t.Errorf("sendCtx: got %v, want %v", err, errFlowDissectorCtx)
+	}
+
+	if _, _, err := ctxDataDecode(ebpf.FlowDissector, nil); !errors.Is(err, errFlowDissectorCtx) {
+		t.Errorf("ctxDataDecode: got %v, want %v", err, errFlowDissectorCtx)
+	}
+}
@@ -0,0 +1,632 @@
+package capctx
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+)
+
+// BPF relocation types, not defined by debug/elf
+const (
+	rBPF64_64 = 1
+	rBPF64_32 = 10
+)
+
+// elfSection is a section of the ELF file we are writing
+type elfSection struct {
+	name  string
+	typ   elf.SectionType
+	flags elf.SectionFlag
+	data  bytes.Buffer
+	// size of SHT_NOBITS sections
+	size    uint64
+	link    uint32
+	info    uint32
+	entsize uint64
+	rels    []elfRel
+	index   uint16
+}
+
+type elfRel struct {
+	offset uint64
+	symbol string
+	typ    uint32
+}
+
+type elfSymbol struct {
+	name    string
+	section *elfSection
+	bind    elf.SymBind
+	typ     elf.SymType
+	value   uint64
+	size    uint64
+}
+
+// elfWriter writes a collection as relocatable eBPF ELF file, which can be loaded by libbpf, cilium/ebpf or any
+// other loader supporting BTF map definitions.
+type elfWriter struct {
+	bo       binary.ByteOrder
+	sections []*elfSection
+	symbols  []elfSymbol
+	strtab   stringTable
+
+	btfMaps btfMapDefs
+	extInfo btfExtInfo
+	// The BTF of the global data sections
+	datasecs []*btf.Datasec
+}
+
+// writeELF writes all programs and maps of the collection to w as a relocatable ELF file. Programs are placed in
+// their original sections, the BPF-to-BPF functions of each program are placed in .text, prefixed with the name of
+// the program since the instrumentation of a function depends on its callers. Maps are written as BTF map
+// definitions, global data as data sections.
+//
+// The func and line info of programs with func info is written, along with the BTF of their functions, the map
+// definitions and global data. CO-RE relocations aren't written, so programs must not contain them.
+func writeELF(w io.Writer, spec *ebpf.CollectionSpec, bo binary.ByteOrder) error {
+	ew := &elfWriter{bo: bo}
+
+	err := ew.addMaps(spec)
+	if err != nil {
+		return err
+	}
+
+	progNames := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		progNames = append(progNames, name)
+	}
+	sort.Strings(progNames)
+
+	var (
+		license       string
+		kernelVersion uint32
+	)
+	for _, name := range progNames {
+		prog := spec.Programs[name]
+		if err := ew.addProgram(prog, spec); err != nil {
+			return fmt.Errorf("program '%s': %w", name, err)
+		}
+
+		license = prog.License
+		if prog.KernelVersion != 0 {
+			kernelVersion = prog.KernelVersion
+		}
+	}
+
+	if license != "" {
+		sec := ew.section("license", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE)
+		sec.data.WriteString(license)
+		sec.data.WriteByte(0)
+		ew.symbol(elfSymbol{
+			name:    "_license",
+			section: sec,
+			bind:    elf.STB_GLOBAL,
+			typ:     elf.STT_OBJECT,
+			size:    uint64(sec.data.Len()),
+		})
+	}
+
+	if kernelVersion != 0 {
+		sec := ew.section("version", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE)
+		_ = binary.Write(&sec.data, bo, kernelVersion)
+		ew.symbol(elfSymbol{
+			name:    "_version",
+			section: sec,
+			bind:    elf.STB_GLOBAL,
+			typ:     elf.STT_OBJECT,
+			size:    4,
+		})
+	}
+
+	if err = ew.addBTF(); err != nil {
+		return err
+	}
+
+	return ew.write(w)
+}
+
+// section returns the section with the given name, creating it if it doesn't exist yet.
+func (ew *elfWriter) section(name string, typ elf.SectionType, flags elf.SectionFlag) *elfSection {
+	for _, sec := range ew.sections {
+		if sec.name == name {
+			return sec
+		}
+	}
+
+	sec := &elfSection{name: name, typ: typ, flags: flags}
+	ew.sections = append(ew.sections, sec)
+	return sec
+}
+
+// textSection returns the .text section, which contains all BPF-to-BPF functions.
+func (ew *elfWriter) textSection() *elfSection {
+	for _, sec := range ew.sections {
+		if sec.name == ".text" {
+			return sec
+		}
+	}
+
+	sec := ew.section(".text", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR)
+	ew.symbol(elfSymbol{
+		name:    ".text",
+		section: sec,
+		bind:    elf.STB_LOCAL,
+		typ:     elf.STT_SECTION,
+	})
+	return sec
+}
+
+func (ew *elfWriter) symbol(sym elfSymbol) {
+	ew.symbols = append(ew.symbols, sym)
+}
+
+// addMaps adds global data as data sections and all other maps as BTF map definitions to the .maps section.
+func (ew *elfWriter) addMaps(spec *ebpf.CollectionSpec) error {
+	mapNames := make([]string, 0, len(spec.Maps))
+	for name := range spec.Maps {
+		mapNames = append(mapNames, name)
+	}
+	sort.Strings(mapNames)
+
+	var mapsSec *elfSection
+	for _, name := range mapNames {
+		m := spec.Maps[name]
+
+		// Global data is stored in maps named after their section
+		if strings.HasPrefix(name, ".") {
+			flags := elf.SHF_ALLOC | elf.SHF_WRITE
+			if strings.HasPrefix(name, ".rodata") {
+				flags = elf.SHF_ALLOC
+			}
+
+			sec := ew.section(name, elf.SHT_PROGBITS, flags)
+			if len(m.Contents) > 0 {
+				data, ok := m.Contents[0].Value.([]byte)
+				if !ok {
+					return fmt.Errorf("data section '%s': unexpected contents", name)
+				}
+				sec.data.Write(data)
+			} else {
+				sec.typ = elf.SHT_NOBITS
+				sec.size = uint64(m.ValueSize)
+			}
+
+			ew.symbol(elfSymbol{
+				name:    name,
+				section: sec,
+				bind:    elf.STB_LOCAL,
+				typ:     elf.STT_SECTION,
+			})
+
+			// Loaders find the variables of the BTF of the section by their symbols
+			if ds, ok := m.Value.(*btf.Datasec); ok {
+				ew.datasecs = append(ew.datasecs, ds)
+				for _, vs := range ds.Vars {
+					v, ok := vs.Type.(*btf.Var)
+					if !ok {
+						continue
+					}
+
+					bind := elf.STB_LOCAL
+					if v.Linkage == btf.GlobalVar {
+						bind = elf.STB_GLOBAL
+					}
+					ew.symbol(elfSymbol{
+						name:    v.Name,
+						section: sec,
+						bind:    bind,
+						typ:     elf.STT_OBJECT,
+						value:   uint64(vs.Offset),
+						size:    uint64(vs.Size),
+					})
+				}
+			}
+			continue
+		}
+
+		if len(m.Contents) > 0 {
+			return fmt.Errorf("map '%s': initial map contents are not supported", name)
+		}
+
+		if mapsSec == nil {
+			mapsSec = ew.section(".maps", elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_WRITE)
+		}
+
+		off := uint64(mapsSec.data.Len())
+		size := ew.btfMaps.add(name, m, uint32(off))
+		mapsSec.data.Write(make([]byte, size))
+
+		ew.symbol(elfSymbol{
+			name:    name,
+			section: mapsSec,
+			bind:    elf.STB_GLOBAL,
+			typ:     elf.STT_OBJECT,
+			value:   off,
+			size:    uint64(size),
+		})
+	}
+
+	return nil
+}
+
+// addBTF adds the .BTF section with the BTF of the map definitions, global data and functions, and the .BTF.ext section
+// with the func and line info of the programs.
+func (ew *elfWriter) addBTF() error {
+	if ew.btfMaps.datasec == nil && ew.extInfo.sections == nil {
+		return nil
+	}
+
+	btfSec := ew.section(".BTF", elf.SHT_PROGBITS, 0)
+
+	var b btf.Builder
+	for _, ds := range ew.datasecs {
+		if _, err := b.Add(ds); err != nil {
+			return fmt.Errorf("add BTF of '%s': %w", ds.Name, err)
+		}
+	}
+	if ew.btfMaps.datasec != nil {
+		if _, err := b.Add(ew.btfMaps.datasec); err != nil {
+			return fmt.Errorf("add BTF map definitions: %w", err)
+		}
+	}
+
+	funcIDs := make(map[*btf.Func]btf.TypeID)
+	for _, fn := range ew.extInfo.funcs() {
+		id, err := b.Add(fn)
+		if err != nil {
+			return fmt.Errorf("add BTF of '%s': %w", fn.Name, err)
+		}
+		funcIDs[fn] = id
+	}
+
+	raw, err := b.Marshal(nil, &btf.MarshalOptions{Order: ew.bo})
+	if err != nil {
+		return fmt.Errorf("marshal BTF: %w", err)
+	}
+
+	// The string table is placed after the types, the strings of the line info are appended to it.
+	var header btfHeader
+	if err = binary.Read(bytes.NewReader(raw), ew.bo, &header); err != nil {
+		return fmt.Errorf("read BTF header: %w", err)
+	}
+	stringsStart := header.HdrLen + header.StringOff
+	if header.StringOff < header.TypeOff+header.TypeLen || int(stringsStart+header.StringLen) != len(raw) {
+		return errors.New("marshalled BTF doesn't end with its string table")
+	}
+
+	var strtab stringTable
+	strtab.seed(raw[stringsStart:])
+
+	if ew.extInfo.sections != nil {
+		extSec := ew.section(".BTF.ext", elf.SHT_PROGBITS, 0)
+		if err = ew.extInfo.marshal(&extSec.data, ew.bo, funcIDs, &strtab); err != nil {
+			return fmt.Errorf("BTF ext info: %w", err)
+		}
+	}
+
+	strs := strtab.bytes()
+	header.StringLen = uint32(len(strs))
+	if err = binary.Write(&btfSec.data, ew.bo, header); err != nil {
+		return err
+	}
+	btfSec.data.Write(raw[binary.Size(header):stringsStart])
+	btfSec.data.Write(strs)
+
+	return nil
+}
+
+// addProgram adds the instructions of a program, the main function goes in the section of the program, BPF-to-BPF
+// functions in .text.
+func (ew *elfWriter) addProgram(prog *ebpf.ProgramSpec, spec *ebpf.CollectionSpec) error {
+	insns := prog.Instructions
+	if len(insns) == 0 {
+		return errors.New("program has no instructions")
+	}
+
+	funcRefs := functionReferences(insns)
+	funcInfo := hasFuncInfo(prog)
+
+	// Local function name -> global symbol name
+	funcSyms := map[string]string{}
+	for sym := range funcRefs {
+		funcSyms[sym] = prog.Name + "__" + strings.ReplaceAll(sym, "-", "_")
+	}
+
+	// Offsets of the functions in .text, needed to reference functions by their offset in .text
+	funcOffsets := map[string]int64{}
+	var (
+		textStart   asm.RawInstructionOffset
+		textStarted bool
+	)
+	iter := insns.Iterate()
+	for iter.Next() {
+		if funcRefs[iter.Ins.Symbol()] && iter.Index != 0 {
+			if !textStarted {
+				textStart = iter.Offset
+				textStarted = true
+			}
+			funcOffsets[iter.Ins.Symbol()] = int64(ew.textSection().data.Len()) + int64((iter.Offset - textStart).Bytes())
+		}
+	}
+
+	var (
+		sec   = ew.section(prog.SectionName, elf.SHT_PROGBITS, elf.SHF_ALLOC|elf.SHF_EXECINSTR)
+		fnSym *elfSymbol
+	)
+	finishFunc := func() {
+		if fnSym != nil {
+			fnSym.size = uint64(fnSym.section.data.Len()) - fnSym.value
+			ew.symbol(*fnSym)
+		}
+	}
+
+	for i, ins := range insns {
+		if i == 0 || funcRefs[ins.Symbol()] {
+			finishFunc()
+
+			name := prog.Name
+			if i != 0 {
+				sec = ew.textSection()
+				name = funcSyms[ins.Symbol()]
+			}
+
+			fnSym = &elfSymbol{
+				name:    name,
+				section: sec,
+				bind:    elf.STB_GLOBAL,
+				typ:     elf.STT_FUNC,
+				value:   uint64(sec.data.Len()),
+			}
+		}
+
+		if ins.OpCode.IsDWordLoad() || ins.IsFunctionCall() {
+			if ref := ins.Reference(); ref != "" {
+				rel := elfRel{offset: uint64(sec.data.Len()), symbol: ref, typ: rBPF64_64}
+
+				switch {
+				case ins.IsFunctionCall():
+					rel.symbol = funcSyms[ref]
+					rel.typ = rBPF64_32
+					ins.Constant = -1
+
+				case ins.Src == asm.PseudoFunc:
+					// Loaders disagree on the meaning of the constant when referencing a function symbol, so
+					// reference the .text section with the offset of the function as constant.
+					if _, ok := funcOffsets[ref]; !ok {
+						return fmt.Errorf("instruction %d: reference to unknown function '%s'", i, ref)
+					}
+					rel.symbol = ".text"
+					ins.Constant = funcOffsets[ref]
+
+				case ins.Src == asm.PseudoMapValue:
+					// The offset into the data section is stored in the first half of the instruction
+					ins.Constant = ins.Constant >> 32
+
+				case ins.IsLoadFromMap():
+					ins.Constant = 0
+
+				default:
+					return fmt.Errorf("instruction %d: unsupported reference to '%s'", i, ref)
+				}
+
+				if rel.symbol == "" || (!ins.IsFunctionCall() && ins.Src != asm.PseudoFunc && spec.Maps[ref] == nil) {
+					return fmt.Errorf("instruction %d: reference to unknown symbol '%s'", i, ref)
+				}
+
+				sec.rels = append(sec.rels, rel)
+			}
+		}
+
+		if funcInfo {
+			ew.extInfo.add(sec.name, uint32(sec.data.Len()), &ins)
+		}
+
+		if _, err := ins.Marshal(&sec.data, ew.bo); err != nil {
+			return fmt.Errorf("instruction %d: %w", i, err)
+		}
+	}
+	finishFunc()
+
+	return nil
+}
+
+// write writes the ELF header, the contents of all sections, the relocation and symbol tables and the section
+// headers.
+func (ew *elfWriter) write(w io.Writer) error {
+	// Relocation sections are added after the sections they relocate
+	sections := []*elfSection{{}}
+	sections = append(sections, ew.sections...)
+	strtabSec := &elfSection{name: ".strtab", typ: elf.SHT_STRTAB}
+	symtabSec := &elfSection{name: ".symtab", typ: elf.SHT_SYMTAB, entsize: 24}
+	for _, sec := range ew.sections {
+		if len(sec.rels) == 0 {
+			continue
+		}
+
+		sections = append(sections, &elfSection{
+			name:    ".rel" + sec.name,
+			typ:     elf.SHT_REL,
+			info:    uint32(indexOf(ew.sections, sec) + 1),
+			entsize: 16,
+			rels:    sec.rels,
+		})
+	}
+	sections = append(sections, symtabSec, strtabSec)
+	for i, sec := range sections {
+		sec.index = uint16(i)
+	}
+
+	// Local symbols must come before global symbols
+	sort.SliceStable(ew.symbols, func(i, j int) bool {
+		return ew.symbols[i].bind == elf.STB_LOCAL && ew.symbols[j].bind != elf.STB_LOCAL
+	})
+
+	symIndex := map[string]int{}
+	symtabSec.data.Write(make([]byte, 24))
+	for i, sym := range ew.symbols {
+		symIndex[sym.name] = i + 1
+		if sym.bind == elf.STB_LOCAL {
+			symtabSec.info = uint32(i + 2)
+		}
+
+		var name uint32
+		if sym.typ != elf.STT_SECTION {
+			name = ew.strtab.add(sym.name)
+		}
+
+		_ = binary.Write(&symtabSec.data, ew.bo, elf.Sym64{
+			Name:  name,
+			Info:  elf.ST_INFO(sym.bind, sym.typ),
+			Shndx: sym.section.index,
+			Value: sym.value,
+			Size:  sym.size,
+		})
+	}
+	if symtabSec.info == 0 {
+		symtabSec.info = 1
+	}
+	symtabSec.link = uint32(strtabSec.index)
+
+	for _, sec := range sections {
+		if sec.typ != elf.SHT_REL {
+			continue
+		}
+
+		sec.link = uint32(symtabSec.index)
+		for _, rel := range sec.rels {
+			idx, ok := symIndex[rel.symbol]
+			if !ok {
+				return fmt.Errorf("relocation against unknown symbol '%s'", rel.symbol)
+			}
+
+			_ = binary.Write(&sec.data, ew.bo, elf.Rel64{
+				Off:  rel.offset,
+				Info: elf.R_INFO(uint32(idx), rel.typ),
+			})
+		}
+	}
+
+	headers := make([]elf.Section64, len(sections))
+	for i, sec := range sections[1:] {
+		headers[i+1].Name = ew.strtab.add(sec.name)
+	}
+	strtabSec.data.Write(ew.strtab.bytes())
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, binary.Size(elf.Header64{})))
+	for i, sec := range sections[1:] {
+		for buf.Len()%8 != 0 {
+			buf.WriteByte(0)
+		}
+
+		size := uint64(sec.data.Len())
+		if sec.typ == elf.SHT_NOBITS {
+			size = sec.size
+		}
+
+		headers[i+1] = elf.Section64{
+			Name:      headers[i+1].Name,
+			Type:      uint32(sec.typ),
+			Flags:     uint64(sec.flags),
+			Off:       uint64(buf.Len()),
+			Size:      size,
+			Link:      sec.link,
+			Info:      sec.info,
+			Addralign: 8,
+			Entsize:   sec.entsize,
+		}
+		if sec.typ == elf.SHT_STRTAB {
+			headers[i+1].Addralign = 1
+		}
+
+		if sec.typ != elf.SHT_NOBITS {
+			buf.Write(sec.data.Bytes())
+		}
+	}
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	shOff := buf.Len()
+	for _, hdr := range headers {
+		_ = binary.Write(&buf, ew.bo, hdr)
+	}
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_BPF),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shOff),
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  strtabSec.index,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	if ew.bo == binary.BigEndian {
+		header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	out := buf.Bytes()
+	var hdrBuf bytes.Buffer
+	_ = binary.Write(&hdrBuf, ew.bo, header)
+	copy(out, hdrBuf.Bytes())
+
+	_, err := w.Write(out)
+	return err
+}
+
+func indexOf(sections []*elfSection, sec *elfSection) int {
+	for i, s := range sections {
+		if s == sec {
+			return i
+		}
+	}
+	return -1
+}
+
+// stringTable builds a table of NUL terminated strings as used by ELF and BTF
+type stringTable struct {
+	buf     bytes.Buffer
+	offsets map[string]uint32
+}
+
+func (st *stringTable) add(s string) uint32 {
+	if st.offsets == nil {
+		st.offsets = map[string]uint32{"": 0}
+		st.buf.WriteByte(0)
+	}
+
+	if off, ok := st.offsets[s]; ok {
+		return off
+	}
+
+	off := uint32(st.buf.Len())
+	st.buf.WriteString(s)
+	st.buf.WriteByte(0)
+	st.offsets[s] = off
+	return off
+}
+
+// seed starts the table with the strings of an existing table, like the strings of a BTF blob
+func (st *stringTable) seed(strs []byte) {
+	st.buf.Reset()
+	st.buf.Write(strs)
+	st.offsets = map[string]uint32{"": 0}
+}
+
+func (st *stringTable) bytes() []byte {
+	st.add("")
+	return st.buf.Bytes()
+}
@@ -0,0 +1,200 @@
+package capctx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/mimic"
+)
+
+// The test objects are those of the ELF reader tests of cilium/ebpf
+var elfTestObjects = []string{
+	"testdata/subprog_reloc-el.elf",
+	"testdata/raw_tracepoint-el.elf",
+	"testdata/map_spin_lock-el.elf",
+}
+
+// TestWriteELF instruments the test objects, with and without sampling, writes them and checks that the programs,
+// maps and func and line info of the written ELF match the instrumented collection.
+func TestWriteELF(t *testing.T) {
+	defer func() { flagSample = "" }()
+
+	for _, sample := range []string{"", "1/4"} {
+		flagSample = sample
+		for _, file := range elfTestObjects {
+			t.Run(file+" sample="+sample, func(t *testing.T) {
+				testWriteELF(t, file)
+			})
+		}
+	}
+}
+
+func testWriteELF(t *testing.T, file string) {
+	want, err := ebpf.LoadCollectionSpec(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = instrumentCollection(want); err != nil {
+		t.Fatal(err)
+	}
+	if err = rewriteBTF(want); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = writeELF(&buf, want, mimic.GetNativeEndianness()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Programs) != len(want.Programs) {
+		t.Errorf("got %d programs, want %d", len(got.Programs), len(want.Programs))
+	}
+	for name, wantProg := range want.Programs {
+		gotProg := got.Programs[name]
+		if gotProg == nil {
+			t.Errorf("program '%s' is missing", name)
+			continue
+		}
+
+		compareProgram(t, gotProg, wantProg)
+	}
+
+	types, err := btf.LoadSpecFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Maps) != len(want.Maps) {
+		t.Errorf("got %d maps, want %d", len(got.Maps), len(want.Maps))
+	}
+	for name, wantMap := range want.Maps {
+		gotMap := got.Maps[name]
+		if gotMap == nil {
+			t.Errorf("map '%s' is missing", name)
+			continue
+		}
+
+		compareMap(t, name, gotMap, wantMap)
+
+		// All maps except global data are written as BTF map definitions
+		var v *btf.Var
+		if !strings.HasPrefix(name, ".") && types.TypeByName(name, &v) != nil {
+			t.Errorf("map '%s': no BTF map definition", name)
+		}
+	}
+}
+
+func compareProgram(t *testing.T, got, want *ebpf.ProgramSpec) {
+	t.Helper()
+
+	if got.Type != want.Type || got.AttachTo != want.AttachTo || got.License != want.License {
+		t.Errorf("program '%s': got %s %q %q, want %s %q %q", want.Name,
+			got.Type, got.AttachTo, got.License, want.Type, want.AttachTo, want.License)
+	}
+
+	if len(got.Instructions) != len(want.Instructions) {
+		t.Errorf("program '%s': got %d instructions, want %d", want.Name, len(got.Instructions), len(want.Instructions))
+		return
+	}
+
+	// BPF-to-BPF functions are written as global symbols prefixed with the program name
+	funcSym := func(sym string) string {
+		if sym == "" || sym == want.Name {
+			return sym
+		}
+		return want.Name + "__" + strings.ReplaceAll(sym, "-", "_")
+	}
+
+	funcRefs := functionReferences(want.Instructions)
+	for i := range want.Instructions {
+		g, w := &got.Instructions[i], &want.Instructions[i]
+
+		if g.OpCode != w.OpCode || g.Dst != w.Dst || g.Src != w.Src || g.Offset != w.Offset {
+			t.Errorf("program '%s' instruction %d: got %v, want %v", want.Name, i, g, w)
+			continue
+		}
+
+		// Jumps are written with their offsets, only calls and loads reference symbols
+		var wantRef string
+		if w.IsFunctionCall() || w.OpCode.IsDWordLoad() {
+			wantRef = w.Reference()
+		}
+		if funcRefs[wantRef] {
+			wantRef = funcSym(wantRef)
+		}
+		if g.Reference() != wantRef {
+			t.Errorf("program '%s' instruction %d: got reference %q, want %q", want.Name, i, g.Reference(), wantRef)
+		}
+		if wantRef == "" && g.Constant != w.Constant {
+			t.Errorf("program '%s' instruction %d: got constant %d, want %d", want.Name, i, g.Constant, w.Constant)
+		}
+
+		if wantSym := w.Symbol(); i != 0 && funcRefs[wantSym] && g.Symbol() != funcSym(wantSym) {
+			t.Errorf("program '%s' instruction %d: got symbol %q, want %q", want.Name, i, g.Symbol(), funcSym(wantSym))
+		}
+
+		var gotFn, wantFn string
+		if fn := btf.FuncMetadata(g); fn != nil {
+			gotFn = fn.Name
+		}
+		if fn := btf.FuncMetadata(w); fn != nil {
+			wantFn = fn.Name
+		}
+		if gotFn != wantFn {
+			t.Errorf("program '%s' instruction %d: got func info %q, want %q", want.Name, i, gotFn, wantFn)
+		}
+
+		gotLine, _ := g.Source().(*btf.Line)
+		wantLine, _ := w.Source().(*btf.Line)
+		if (gotLine == nil) != (wantLine == nil) {
+			t.Errorf("program '%s' instruction %d: got line info %v, want %v", want.Name, i, gotLine, wantLine)
+			continue
+		}
+		if wantLine != nil && (gotLine.FileName() != wantLine.FileName() || gotLine.Line() != wantLine.Line() ||
+			gotLine.LineNumber() != wantLine.LineNumber() || gotLine.LineColumn() != wantLine.LineColumn()) {
+			t.Errorf("program '%s' instruction %d: got line info %s:%d:%d, want %s:%d:%d", want.Name, i,
+				gotLine.FileName(), gotLine.LineNumber(), gotLine.LineColumn(),
+				wantLine.FileName(), wantLine.LineNumber(), wantLine.LineColumn())
+		}
+	}
+}
+
+func compareMap(t *testing.T, name string, got, want *ebpf.MapSpec) {
+	t.Helper()
+
+	if got.Type != want.Type || got.KeySize != want.KeySize || got.ValueSize != want.ValueSize ||
+		got.Flags != want.Flags || got.Pinning != want.Pinning {
+		t.Errorf("map '%s': got %s key %d value %d flags %d pinning %d, want %s key %d value %d flags %d pinning %d",
+			name, got.Type, got.KeySize, got.ValueSize, got.Flags, got.Pinning,
+			want.Type, want.KeySize, want.ValueSize, want.Flags, want.Pinning)
+	}
+
+	// The max entries of perf event arrays are set by the loader if 0
+	if got.MaxEntries != want.MaxEntries && !(want.Type == ebpf.PerfEventArray && want.MaxEntries == 0) {
+		t.Errorf("map '%s': got %d max entries, want %d", name, got.MaxEntries, want.MaxEntries)
+	}
+
+	if want.Type == ebpf.Array && strings.HasPrefix(name, ".") {
+		if len(got.Contents) != len(want.Contents) {
+			t.Errorf("map '%s': got %d entries, want %d", name, len(got.Contents), len(want.Contents))
+		} else if len(want.Contents) > 0 &&
+			!bytes.Equal(got.Contents[0].Value.([]byte), want.Contents[0].Value.([]byte)) {
+			t.Errorf("map '%s': got contents %x, want %x", name, got.Contents[0].Value, want.Contents[0].Value)
+		}
+	}
+
+	if (got.InnerMap == nil) != (want.InnerMap == nil) {
+		t.Errorf("map '%s': got inner map %v, want %v", name, got.InnerMap != nil, want.InnerMap != nil)
+	} else if want.InnerMap != nil {
+		compareMap(t, name+" inner", got.InnerMap, want.InnerMap)
+	}
+}
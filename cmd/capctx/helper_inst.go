@@ -3,6 +3,7 @@ package capctx
 import (
 	"fmt"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
 	"github.com/dylandreimerink/edb/pkg/helperdata"
 )
@@ -14,92 +15,84 @@ type helperInstructions struct {
 	post []asm.Instruction
 }
 
-var helperInstr map[asm.BuiltinFunc]helperInstructions
-
-func helperInstrumentation(fpOff, primarySaveOff int16) map[asm.BuiltinFunc]helperInstructions {
-	if len(helperInstr) > 0 {
-		return helperInstr
+// helperInstrumentation returns the instructions which send the params and results of a call to the given helper.
+// The instructions are generated for every call, since the offsets differ per function and every snippet uses its own
+// labels. mapValueSize is the value size of the map passed to the helper, or 0 if unknown.
+func helperInstrumentation(fn asm.BuiltinFunc, mapValueSize uint32, fpOff, primarySaveOff int16) helperInstructions {
+	helper, ok := helperdata.Signatures[fn]
+	if !ok {
+		return helperInstructions{}
 	}
 
-	helperInstr = make(map[asm.BuiltinFunc]helperInstructions)
-	for fn, helper := range helperdata.Signatures {
-		var inst helperInstructions
-
-		// Send all input params
-		inst.pre = sendRInScalars(len(helper.Params), fpOff, primarySaveOff)
+	var inst helperInstructions
 
-		// Send return value if not void
-		if helper.RetType.Name != "void" {
-			inst.post = sendROutScalar(asm.R0, fpOff)
-		}
+	// Send all input params
+	inst.pre = sendRInScalars(len(helper.Params), fpOff, primarySaveOff)
 
-		helperInstr[fn] = inst
+	// Send return value if not void. Pointers are sent as well, their value doesn't mean anything outside the kernel,
+	// but the program will check them against NULL.
+	if helper.Ret != helperdata.RetVoid {
+		inst.post = sendROutScalar(asm.R0, fpOff)
 	}
 
-	customInstr := map[asm.BuiltinFunc]helperInstructions{
-		asm.FnProbeRead:       singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnGetCurrentComm:  singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkbGetTunnelKey: singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkbLoadBytes:    singleDataReturnInstr(asm.R3, asm.R4, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkbGetTunnelOpt: singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnGetCurrentTask
-		asm.FnProbeReadStr:         singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnPerfEventReadValue:   singleDataReturnInstr(asm.R3, asm.R4, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnPerfProgReadValue:    singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnGetStack:             singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkbLoadBytesRelative: singleDataReturnInstr(asm.R3, asm.R4, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnFibLookup:            singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkLookupTcp:          singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSkLookupUdp:          singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnSkRelease
-		// TODO asm.FnSkFullsock
-		// TODO asm.FnSkTcpSock
-		// TODO asm.FnSkbEcnSetCe
-		// TODO asm.FnGetListenerSock
-		// TODO asm.FnSkcLookupTcp
-		asm.FnSysctlGetName:         singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSysctlGetCurrentValue: singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnSysctlGetNewValue:     singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnProbeReadUser:         singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnProbeReadKernel:       singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnProbeReadUserStr:      singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnProbeReadKernelStr:    singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnReadBranchRecords:     singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnGetNsCurrentPidTgid:   singleDataReturnInstr(asm.R3, asm.R4, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnSkcToTcp6Sock
-		// TODO asm.FnSkcToTcpSock
-		// TODO asm.FnSkcToTcpTimewaitSock
-		// TODO asm.FnSkcToTcpRequestSock
-		// TODO asm.FnSkcToUdp6Sock
-		asm.FnGetTaskStack: singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnLoadHdrOpt:   singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnDPath:        singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		asm.FnCopyFromUser: singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnPerCpuPtr
-		// TODO asm.FnThisCpuPtr
-		// TODO asm.FnGetCurrentTaskBtf
-		asm.FnImaInodeHash: singleDataReturnInstr(asm.R2, asm.R3, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnSockFromFile
-		asm.FnSnprintf: singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO asm.FnTaskPtRegs
-		// bpf_get_branch_snapshot
-		asm.BuiltinFunc(176): singleDataReturnInstr(asm.R1, asm.R2, defaultMaxSize, fpOff, primarySaveOff),
-		// TODO bpf_get_func_arg
-		// TODO bpf_get_func_ret
-	}
+	// Send the memory written by the helper. We only have room to save 2 registers, which is enough for one output,
+	// no helper has more than one.
+	if len(helper.Outputs) > 0 {
+		out := helper.Outputs[0]
+		ptr := asm.R1 + asm.Register(out.Param)
 
-	for k, v := range customInstr {
-		inst := helperInstr[k]
-		inst.pre = append(inst.pre, v.pre...)
-		inst.post = append(inst.post, v.post...)
-		helperInstr[k] = inst
+		var outInst helperInstructions
+		switch out.Kind {
+		case helperdata.OutputFixed:
+			outInst = fixedDataReturnInstr(ptr, int32(out.Size), defaultMaxSize, fpOff, primarySaveOff)
+		case helperdata.OutputMapValue:
+			// Without the value size, we don't know how much memory may be read
+			if mapValueSize != 0 {
+				outInst = fixedDataReturnInstr(ptr, int32(mapValueSize), defaultMaxSize, fpOff, primarySaveOff)
+			}
+		default:
+			size := asm.R1 + asm.Register(out.SizeParam)
+			outInst = singleDataReturnInstr(ptr, size, defaultMaxSize, fpOff, primarySaveOff)
+		}
+
+		inst.pre = append(inst.pre, outInst.pre...)
+		inst.post = append(inst.post, outInst.post...)
 	}
 
-	return helperInstr
+	return inst
 }
 
 const defaultMaxSize = 128
 
+// helperMapValueSize returns the value size of the map loaded into R1 before the helper call at index i, or 0 if the
+// map can't be determined. Compilers load the map pointer right before the call, so only the instructions since the
+// start of the basic block are considered, jump targets are labeled at this point.
+func helperMapValueSize(insns asm.Instructions, i int, maps map[string]*ebpf.MapSpec) uint32 {
+	for j := i - 1; j >= 0; j-- {
+		ins := insns[j]
+
+		if ins.IsLoadFromMap() && ins.Src == asm.PseudoMapFD && ins.Dst == asm.R1 {
+			if m := maps[ins.Reference()]; m != nil {
+				return m.ValueSize
+			}
+			return 0
+		}
+
+		if ins.OpCode.JumpOp() != asm.InvalidJumpOp || ins.Symbol() != "" {
+			return 0
+		}
+
+		switch ins.OpCode.Class() {
+		case asm.LdClass, asm.LdXClass, asm.ALUClass, asm.ALU64Class:
+			if ins.Dst == asm.R1 {
+				return 0
+			}
+		}
+	}
+
+	return 0
+}
+
 func singleDataReturnInstr(ptr, size asm.Register, max uint16, fpOff, primarySaveOff int16) helperInstructions {
 	return helperInstructions{
 		pre: saveRegs(primarySaveOff, ptr, size),
@@ -110,6 +103,65 @@ func singleDataReturnInstr(ptr, size asm.Register, max uint16, fpOff, primarySav
 	}
 }
 
+func fixedDataReturnInstr(ptr asm.Register, size int32, max uint16, fpOff, primarySaveOff int16) helperInstructions {
+	// Any register other than `ptr` can hold the size, since the helper call clobbered them
+	sizeReg := asm.R1
+	if ptr == sizeReg {
+		sizeReg = asm.R2
+	}
+
+	return helperInstructions{
+		pre: saveRegs(primarySaveOff, ptr),
+		post: merge(
+			restoreRegs(primarySaveOff, ptr),
+			[]asm.Instruction{asm.Mov.Imm(sizeReg, size)},
+			sendRoutData(ptr, sizeReg, max, fpOff),
+		),
+	}
+}
+
+var sampledOnlyCount = 0
+
+// sampledOnly returns the instrumentation of a helper call, which skips the instructions before and after the call if
+// the execution isn't sampled.
+func sampledOnly(pre []asm.Instruction, call asm.Instruction, post []asm.Instruction, fpOff int16) []asm.Instruction {
+	// Increment the global counter var when we are done
+	defer func() { sampledOnlyCount++ }()
+	callLabel := fmt.Sprintf("edb-sampled-call-%d", sampledOnlyCount)
+	doneLabel := fmt.Sprintf("edb-sampled-done-%d", sampledOnlyCount)
+
+	insts := merge(
+		[]asm.Instruction{
+			// Get fp0, the symbol of the call moves to the first instruction, so jumps to the call still check the
+			// sample decision.
+			asm.LoadMem(asm.R0, asm.R10, fpOff, asm.DWord).WithSymbol(call.Symbol()),
+			// Skip to the call if this execution isn't sampled, R0 is clobbered by the call anyway
+			asm.LoadMem(asm.R0, asm.R0, sampleOff, asm.DWord),
+			asm.JNE.Imm(asm.R0, 0, callLabel),
+		},
+		pre,
+		[]asm.Instruction{call.WithSymbol(callLabel)},
+	)
+	if len(post) == 0 {
+		return insts
+	}
+
+	return merge(
+		insts,
+		[]asm.Instruction{
+			// Skip the results if this execution isn't sampled, R1 is clobbered by the call
+			asm.LoadMem(asm.R1, asm.R10, fpOff, asm.DWord),
+			asm.LoadMem(asm.R1, asm.R1, sampleOff, asm.DWord),
+			asm.JNE.Imm(asm.R1, 0, doneLabel),
+		},
+		post,
+		[]asm.Instruction{
+			// No-op as jump target, the next instruction might already be the target of a jump
+			asm.Mov.Reg(asm.R0, asm.R0).WithSymbol(doneLabel),
+		},
+	)
+}
+
 func merge(slices ...[]asm.Instruction) []asm.Instruction {
 	cnt := 0
 	for _, slice := range slices {
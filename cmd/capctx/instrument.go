@@ -0,0 +1,191 @@
+package capctx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/mimic"
+	"github.com/spf13/cobra"
+)
+
+func InstrumentCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "instrument {ELF file} {output ELF file}",
+		Short: "Write an instrumented ELF file",
+		Long: "This command adds the same instrumentation as 'capture-context' to all programs of the input ELF " +
+			"file and writes them to a new ELF file, without loading anything. The output can be loaded by any " +
+			"loader which supports BTF map definitions, like libbpf, so contexts can be captured on hosts where edb " +
+			"can't run.\n\n" +
+			"Besides the original maps, the output contains the '" + feedbackMap + "' perf event array and the '" +
+			bufferMap + "' per-CPU array. The loader should read the perf event array and write the raw samples, " +
+			"as read from the perf buffer, one after the other to a file. 'edb decode-capture' turns such a file " +
+			"into a context file.\n\n" +
+			"The BTF of the programs is written to the output with their func and line info, but not their CO-RE " +
+			"relocations, so these have to be resolved beforehand, against the BTF of the kernel of the target host, " +
+			"given with --kernel-btf.",
+		RunE: instrumentRun,
+		Args: cobra.ExactArgs(2),
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&flagKernelBTF, "kernel-btf", "", "Path to the BTF of the target kernel (/sys/kernel/btf/vmlinux) "+
+		"used to resolve CO-RE relocations")
+	f.BoolVar(&flagPlainProg, "plain-program", false, "Print the program instruction before instrumenting")
+	f.BoolVar(&flagInstProg, "instrumented-program", false, "Print the program instruction after instrumenting")
+	f.BoolVar(&flagDebugAnalysis, "debug-analysis", false, "Print program analysis debug info")
+	addInstrumentFlags(f)
+
+	return cmd
+}
+
+var flagKernelBTF string
+
+func instrumentRun(cmd *cobra.Command, args []string) error {
+	spec, err := ebpf.LoadCollectionSpec(args[0])
+	if err != nil {
+		return fmt.Errorf("load collection: %w", err)
+	}
+
+	err = instrumentCollection(spec)
+	if err != nil {
+		return err
+	}
+
+	var kernelBTF *btf.Spec
+	if flagKernelBTF != "" {
+		f, err := os.Open(flagKernelBTF)
+		if err != nil {
+			return fmt.Errorf("open kernel BTF: %w", err)
+		}
+		defer f.Close()
+
+		kernelBTF, err = btf.LoadSpecFromReader(f)
+		if err != nil {
+			return fmt.Errorf("load kernel BTF: %w", err)
+		}
+	}
+
+	for name, prog := range spec.Programs {
+		if kernelBTF == nil {
+			for i := range prog.Instructions {
+				if btf.CORERelocationMetadata(&prog.Instructions[i]) != nil {
+					return fmt.Errorf("program '%s' contains CO-RE relocations, use --kernel-btf to resolve them", name)
+				}
+			}
+		} else if err = applyCORERelocations(prog.Instructions, kernelBTF); err != nil {
+			return fmt.Errorf("program '%s': CO-RE relocations: %w", name, err)
+		}
+
+		if flagInstProg {
+			fmt.Println(name, " instrumented:")
+			fmt.Println(prog.Instructions)
+		}
+	}
+
+	err = rewriteBTF(spec)
+	if err != nil {
+		return fmt.Errorf("rewrite BTF: %w", err)
+	}
+
+	var out bytes.Buffer
+	err = writeELF(&out, spec, mimic.GetNativeEndianness())
+	if err != nil {
+		return fmt.Errorf("write ELF: %w", err)
+	}
+
+	err = os.WriteFile(args[1], out.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("write output file: %w", err)
+	}
+
+	return nil
+}
+
+func DecodeCaptureCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decode-capture {capture file} {ctx file}",
+		Short: "Convert the raw samples of an instrumented program into a context file",
+		Long: "This command converts the raw samples sent by a program instrumented with 'edb instrument' into a " +
+			"context file. The capture file contains the raw samples as read from the '" + feedbackMap + "' perf " +
+			"event array, one after the other.\n\n" +
+			"The kernel pads raw samples to 8 bytes, edb reads samples with this padding unless --unpadded is given, " +
+			"for loaders which only write the data of each sample.",
+		RunE: decodeCaptureRun,
+		Args: cobra.ExactArgs(2),
+	}
+
+	cmd.Flags().BoolVar(&flagUnpadded, "unpadded", false, "The raw samples in the capture file are not padded")
+
+	return cmd
+}
+
+var flagUnpadded bool
+
+func decodeCaptureRun(cmd *cobra.Command, args []string) error {
+	capture, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("read capture file: %w", err)
+	}
+
+	ne := mimic.GetNativeEndianness()
+
+	var ctxs []mimic.Context
+	for off := 0; off < len(capture); {
+		if len(capture)-off < 4 {
+			return fmt.Errorf("offset %d: truncated sample", off)
+		}
+
+		// Every sample starts with its size, excluding padding
+		size := int(ne.Uint32(capture[off:]))
+		if size < 4 {
+			return fmt.Errorf("offset %d: invalid sample size %d", off, size)
+		}
+
+		sampleSize := size
+		if !flagUnpadded {
+			// The kernel pads the size of the sample, including its 4 byte size header, to 8 bytes.
+			sampleSize = (size+4+7)/8*8 - 4
+		}
+		if sampleSize > len(capture)-off {
+			// The last sample might not be padded
+			if size > len(capture)-off {
+				return fmt.Errorf("offset %d: truncated sample", off)
+			}
+			sampleSize = len(capture) - off
+		}
+
+		ctx, err := decodeFeedback(capture[off : off+sampleSize])
+		if err != nil {
+			return fmt.Errorf("offset %d: decode feedback: %w", off, err)
+		}
+
+		ctx.SetName(fmt.Sprint(len(ctxs)))
+		ctxs = append(ctxs, ctx)
+
+		off += sampleSize
+	}
+
+	if len(ctxs) == 0 {
+		return errors.New("capture file contains no samples")
+	}
+
+	ctxFile, err := os.Create(args[1])
+	if err != nil {
+		return fmt.Errorf("create context file: %w", err)
+	}
+	defer ctxFile.Close()
+
+	err = ctxutil.Encode(ctxFile, ctxs)
+	if err != nil {
+		return fmt.Errorf("encode contexts: %w", err)
+	}
+
+	fmt.Printf("%d contexts decoded\n", len(ctxs))
+
+	return nil
+}
@@ -17,8 +17,13 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	rootCmd.AddCommand(
 		debug.DebugCmd(),
-		pcapToCtxCommand,
+		pcapToCtxCommand(),
+		ctxToPCAPCommand(),
+		genCtxCommand(),
+		ctxCommand(),
 		capctx.Command(),
+		capctx.InstrumentCommand(),
+		capctx.DecodeCaptureCommand(),
 		graphCommand(),
 	)
 
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/spf13/cobra"
+)
+
+func ctxCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ctx",
+		Short: "Context file related commands",
+	}
+
+	cmd.AddCommand(
+		ctxValidateCommand(),
+		ctxSchemaCommand(),
+	)
+
+	return cmd
+}
+
+func ctxValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate {.json/.jsonl ctx file}...",
+		Short: "Check context files for errors",
+		Long: "This command checks context files for errors without loading a program. Besides the JSON syntax and " +
+			"types, every memory object, pointer target, struct field and register reference is checked. All " +
+			"problems are reported with the JSON path of the offending value. The debugger performs the same " +
+			"checks when loading a context file.",
+		RunE: runCtxValidate,
+		Args: cobra.MinimumNArgs(1),
+	}
+}
+
+func runCtxValidate(cmd *cobra.Command, args []string) error {
+	invalid := 0
+	for _, file := range args {
+		data, err := ctxutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		err = ctxutil.Validate(data)
+		if err == nil {
+			fmt.Printf("%s: ok\n", file)
+			continue
+		}
+
+		invalid++
+
+		var validationErrs ctxutil.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return err
+		}
+		for _, e := range validationErrs {
+			fmt.Printf("%s: %s\n", file, e)
+		}
+	}
+
+	if invalid > 0 {
+		// Don't print usage, the problems are reported above
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d context files are invalid", invalid, len(args))
+	}
+
+	return nil
+}
+
+func ctxSchemaCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of context files",
+		Long: "This command prints the JSON Schema of context files. Editors can use it to validate and " +
+			"autocomplete context files, for example in VS Code by adding it to the 'json.schemas' setting with " +
+			"'fileMatch' set to '*.ctx.json'.",
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Stdout.Write(ctxutil.Schema())
+		},
+		Args: cobra.NoArgs,
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/pcapng"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/spf13/cobra"
+)
+
+func ctxToPCAPCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ctx-to-pcap {.json ctx input} {.pcap output}",
+		Short: "Convert the packets in a context file into a PCAP(packet capture) file",
+		Long: "This command writes the packet of every context in the context file to a PCAP file, so it can be " +
+			"inspected with tools like Wireshark. If the output file has a .pcapng extension a PCAPNG file is " +
+			"written with the context name as packet comment. Contexts without packet are skipped.\n" +
+			"\n" +
+			"To export packets as they are after program execution, including changes made by the program, use " +
+			"'continue-all --pcap-out {file}' in the debugger.",
+		RunE: runCtxToPCAP,
+		Args: cobra.ExactArgs(2),
+	}
+
+	return cmd
+}
+
+func runCtxToPCAP(cmd *cobra.Command, args []string) error {
+	ctxs, err := ctxutil.DecodeFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(args[1])
+	if err != nil {
+		return fmt.Errorf("create pcap file: %w", err)
+	}
+	defer out.Close()
+
+	var writePacket func(pkt []byte, comment string) error
+	if filepath.Ext(args[1]) == ".pcapng" {
+		ng, err := pcapng.NewWriter(out, "edb", layers.LinkTypeEthernet)
+		if err != nil {
+			return err
+		}
+
+		writePacket = func(pkt []byte, comment string) error {
+			return ng.WritePacket(time.Now(), pkt, comment)
+		}
+	} else {
+		w := pcapgo.NewWriter(out)
+		if err = w.WriteFileHeader(0, layers.LinkTypeEthernet); err != nil {
+			return fmt.Errorf("write pcap header: %w", err)
+		}
+
+		writePacket = func(pkt []byte, _ string) error {
+			return w.WritePacket(gopacket.CaptureInfo{
+				Timestamp:     time.Now(),
+				CaptureLength: len(pkt),
+				Length:        len(pkt),
+			}, pkt)
+		}
+	}
+
+	written := 0
+	for i, ctx := range ctxs {
+		pkt, err := ctxutil.Packet(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "context %d: %s, skipping\n", i, err)
+			continue
+		}
+
+		err = writePacket(pkt, fmt.Sprintf("context %d: %s", i, ctx.GetName()))
+		if err != nil {
+			return fmt.Errorf("write packet: %w", err)
+		}
+		written++
+	}
+
+	fmt.Printf("Wrote %d packets of %d contexts\n", written, len(ctxs))
+
+	return nil
+}
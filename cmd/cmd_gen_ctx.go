@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/pktspec"
+	"github.com/dylandreimerink/mimic"
+	"github.com/spf13/cobra"
+)
+
+func genCtxCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gen-ctx {packet spec|description file}... {.json ctx output}",
+		Short: "Generate a context file from textual packet specs or register descriptions",
+		Long: "This command generates contexts without capturing them from a running kernel. The --type flag " +
+			"determines the kind of context:\n" +
+			"  xdp        - A 'struct xdp_md' for XDP programs, built from packet specs\n" +
+			"  skb        - A 'struct __sk_buff' for TC, socket filter and cGroup SKB programs, built from packet specs\n" +
+			"  pt_regs    - The x86_64 'struct pt_regs' for kprobe programs, built from description files\n" +
+			"  perf_event - A 'struct bpf_perf_event_data' for perf event programs, built from description files\n" +
+			"  tracepoint - A tracepoint record with the layout of the tracefs format file given with --format, " +
+			"built from description files\n" +
+			"\n" +
+			"A packet spec is a list of layers separated by '/', each with optional key=value arguments, for example:\n" +
+			"  'eth(dst=02:00:00:00:00:02)/ipv4(src=10.0.0.1,dst=10.0.0.2)/tcp(dport=80,flags=S)/payload(\"GET\")'\n" +
+			"\n" +
+			"Supported layers and arguments:\n" +
+			"  eth(src, dst, type)\n" +
+			"  vlan(id, prio, type)\n" +
+			"  arp(op, hwsrc, psrc, hwdst, pdst)\n" +
+			"  ipv4(src, dst, ttl, tos, id, proto, flags, frag)\n" +
+			"  ipv6(src, dst, hlim, tc, fl, nh)\n" +
+			"  tcp(sport, dport, seq, ack, flags, window, urg)\n" +
+			"  udp(sport, dport)\n" +
+			"  icmp(type, code, id, seq)\n" +
+			"  icmp6(type, code, id, seq)\n" +
+			"  payload(data, len)\n" +
+			"\n" +
+			"TCP flags are a combination of FSRPAUEC, IPv4 flags are DF, MF or DF+MF, ARP op is request, reply or " +
+			"a number. Payload data is a quoted string or hex/base64 bytes, given as data=... or without key, like " +
+			"payload(\"GET\"), len pads the payload with zeros. " +
+			"Type and protocol fields are derived from the next layer unless given, lengths and checksums are " +
+			"always computed.\n" +
+			"\n" +
+			"A description file is a JSON object, an array of JSON objects or a flat YAML mapping(multiple " +
+			"documents separated by '---'), which maps field names to values. Each object or document becomes a " +
+			"context, the 'name' key sets the context name. For example:\n" +
+			"  {\"name\": \"write(1, buf, 10)\", \"di\": 1, \"si\": \"0x7ffd1000\", \"dx\": 10}\n" +
+			"Registers can also be named rdi, rsi, ... or parm1-parm6 and rc like the PT_REGS_* macros. Fields of " +
+			"tracepoints are named as in the format file, char arrays and __data_loc fields take text. If no " +
+			"description files are given, a single context with all fields set to zero is generated.",
+		RunE: runGenCtx,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	f := cmd.Flags()
+
+	f.StringVarP(&genCtxType, "type", "t", "xdp", "The context type: xdp, skb, pt_regs, perf_event or tracepoint")
+	f.IntVar(&genCtxIfindex, "ifindex", 0, "The ingress interface index of xdp and skb contexts")
+	f.StringVar(&genCtxFormat, "format", "", "The tracefs format file of the tracepoint, "+
+		"like /sys/kernel/tracing/events/syscalls/sys_enter_write/format")
+
+	return cmd
+}
+
+var (
+	genCtxType    string
+	genCtxIfindex int
+	genCtxFormat  string
+)
+
+func runGenCtx(cmd *cobra.Command, args []string) error {
+	inputs := args[:len(args)-1]
+	output := args[len(args)-1]
+
+	var (
+		ctxs []mimic.Context
+		err  error
+	)
+	switch genCtxType {
+	case "xdp", "skb":
+		if len(inputs) == 0 {
+			return fmt.Errorf("at least one packet spec is required for %s contexts", genCtxType)
+		}
+
+		ctxs, err = genPacketCtxs(inputs)
+
+	case "pt_regs", "perf_event", "tracepoint":
+		ctxs, err = genDescribedCtxs(inputs)
+
+	default:
+		return fmt.Errorf("invalid context type '%s', pick from: xdp, skb, pt_regs, perf_event, tracepoint",
+			genCtxType)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctxFile, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("create context file: %w", err)
+	}
+	defer ctxFile.Close()
+
+	err = ctxutil.Encode(ctxFile, ctxs)
+	if err != nil {
+		return fmt.Errorf("json encode context: %w", err)
+	}
+
+	fmt.Printf("Generated %d contexts\n", len(ctxs))
+
+	return nil
+}
+
+func genPacketCtxs(specs []string) ([]mimic.Context, error) {
+	var ctxs []mimic.Context
+	for i, spec := range specs {
+		pkt, err := pktspec.Build(spec)
+		if err != nil {
+			return nil, fmt.Errorf("spec %d: %w", i, err)
+		}
+
+		// The spec describes the packet better than any name we could come up with
+		switch genCtxType {
+		case "xdp":
+			ctxs = append(ctxs, ctxutil.NewXDP(spec, pkt, genCtxIfindex))
+		case "skb":
+			ctxs = append(ctxs, ctxutil.NewSKBuff(spec, pkt, genCtxIfindex))
+		}
+	}
+
+	return ctxs, nil
+}
+
+func genDescribedCtxs(files []string) ([]mimic.Context, error) {
+	var format *ctxutil.TracepointFormat
+	if genCtxType == "tracepoint" {
+		if genCtxFormat == "" {
+			return nil, fmt.Errorf("--format is required for tracepoint contexts")
+		}
+
+		f, err := os.Open(genCtxFormat)
+		if err != nil {
+			return nil, fmt.Errorf("open format file: %w", err)
+		}
+		defer f.Close()
+
+		format, err = ctxutil.ParseTracepointFormat(f)
+		if err != nil {
+			return nil, fmt.Errorf("parse format file: %w", err)
+		}
+	}
+
+	// Without descriptions, generate a single context with all fields zero
+	descs := []ctxutil.Description{{}}
+	if len(files) > 0 {
+		descs = nil
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read description file: %w", err)
+		}
+
+		fileDescs, err := ctxutil.ParseDescriptions(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		descs = append(descs, fileDescs...)
+	}
+
+	var ctxs []mimic.Context
+	for i, desc := range descs {
+		name := desc.Name
+		if name == "" {
+			name = fmt.Sprintf("%s %d", genCtxType, i)
+		}
+
+		ctx, err := ctxutil.NewDescribed(genCtxType, name, format, desc.Values)
+		if err != nil {
+			return nil, fmt.Errorf("context %d: %w", i, err)
+		}
+		ctxs = append(ctxs, ctx)
+	}
+
+	return ctxs, nil
+}
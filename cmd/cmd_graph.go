@@ -146,7 +146,10 @@ func runGraph(cmd *cobra.Command, args []string) error {
 }
 
 func ProgramToGraph(prog *ebpf.ProgramSpec) *dot.Graph {
-	functions := prog.Instructions.FunctionReferences()
+	functions := make(map[string]bool)
+	for _, ref := range prog.Instructions.FunctionReferences() {
+		functions[ref] = true
+	}
 
 	blocks := analyse.ProgramBlocks(prog.Instructions)
 
@@ -1,12 +1,14 @@
 package cmd
 
 import (
-	"encoding/json"
+	"bufio"
+	"encoding/binary"
 	"fmt"
 	"io"
-	"net"
 	"os"
 
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/pktfilter"
 	"github.com/dylandreimerink/mimic"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -14,31 +16,80 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var pcapToCtxCommand = &cobra.Command{
-	Use:   "pcap-to-ctx {.pcap input} {.json ctx output}",
-	Short: "Convert a PCAP(packet capture) file into a context file which can be passed to a XDP eBPF program",
-	RunE:  runPCAPToCtx,
-	Args:  cobra.ExactArgs(2),
+func pcapToCtxCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pcap-to-ctx {.pcap input} {.json ctx output}",
+		Short: "Convert a PCAP(packet capture) file into a context file which can be passed to a XDP or SKB eBPF program",
+		Long: "This command converts every packet in the PCAP or PCAPNG file into a context. The --type flag " +
+			"determines the kind of context:\n" +
+			"  xdp          - A 'struct xdp_md' for XDP programs\n" +
+			"  skb          - A 'struct __sk_buff' for TC, socket filter and cGroup SKB programs. The len, protocol, " +
+			"pkt_type, ifindex, ingress_ifindex, data, data_end, hash, vlan and tstamp fields are populated from the " +
+			"packet and capture info\n" +
+			"  skb-emulated - An emulated socket buffer, required for programs which use legacy packet access " +
+			"instructions(LD_ABS/LD_IND) like 'load_byte', only the packet and ifindex are taken from the capture\n" +
+			"\n" +
+			"eBPF programs expect ethernet packets, packets captured with other link types(Linux cooked capture " +
+			"SLL/SLL2, raw IP, BSD loopback) get a synthesized ethernet header.\n" +
+			"\n" +
+			"The --filter flag takes a tcpdump style filter expression, for example 'tcp and host 10.0.0.1 and port " +
+			"80'. Supported are host, net, port, portrange, ether host, vlan, proto, less, greater and the protocols " +
+			"ether, ip, ip6, arp, tcp, udp, sctp, icmp and icmp6, combined with and, or, not and parentheses. The " +
+			"--skip and --count flags are applied to the packets which match the filter.",
+		RunE: runPCAPToCtx,
+		Args: cobra.ExactArgs(2),
+	}
+
+	f := cmd.Flags()
+
+	f.StringVarP(&pcapToCtxType, "type", "t", "xdp", "The context type: xdp, skb or skb-emulated")
+	f.Uint32Var(&pcapToCtxMark, "mark", 0, "The value of the mark field of skb contexts")
+	f.StringVarP(&pcapToCtxFilter, "filter", "f", "", "Only convert packets matching this tcpdump style filter")
+	f.IntVar(&pcapToCtxSkip, "skip", 0, "Skip the first N matching packets")
+	f.IntVarP(&pcapToCtxCount, "count", "c", 0, "Convert at most N packets, 0 for no limit")
+
+	return cmd
 }
 
+var (
+	pcapToCtxType   string
+	pcapToCtxMark   uint32
+	pcapToCtxFilter string
+	pcapToCtxSkip   int
+	pcapToCtxCount  int
+)
+
 func runPCAPToCtx(cmd *cobra.Command, args []string) error {
+	switch pcapToCtxType {
+	case "xdp", "skb", "skb-emulated":
+	default:
+		return fmt.Errorf("invalid context type '%s', pick from: xdp, skb, skb-emulated", pcapToCtxType)
+	}
+
+	filter, err := pktfilter.Compile(pcapToCtxFilter)
+	if err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+
 	pcap, err := os.Open(args[0])
 	if err != nil {
 		return fmt.Errorf("open pcap file: %w", err)
 	}
 	defer pcap.Close()
 
-	r, err := pcapgo.NewReader(pcap)
+	src, err := newPacketSource(pcap)
 	if err != nil {
-		return fmt.Errorf("new ng reader: %w", err)
+		return err
 	}
 
-	lt := r.LinkType()
-
-	var ctxs []mimic.Context
+	var (
+		ctxs    []mimic.Context
+		matched int
+		total   int
+	)
 
-	for i := 0; true; i++ {
-		data, ci, err := r.ReadPacketData()
+	for i := 0; pcapToCtxCount == 0 || len(ctxs) < pcapToCtxCount; i++ {
+		data, ci, err := src.ReadPacketData()
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -46,168 +97,64 @@ func runPCAPToCtx(cmd *cobra.Command, args []string) error {
 
 			return fmt.Errorf("read packet: %w", err)
 		}
+		total++
 
 		// XDP expects to always get ethernet packets. PCAPs don't nesseserely start at the ethernet level.
-		// If we are missing data, mock it as best we can, and notify the user that part of the data is fake.
-		// If we can't convert the data to valid XDP contexts, just don't and inform the user.
-
-		// Use the CaptureInfo interface index by default
-		InterfaceIndex := ci.InterfaceIndex
-
-		pkt := gopacket.NewPacket(data, lt, gopacket.Default)
-		buf := gopacket.NewSerializeBuffer()
-
-		switch lt {
-		case layers.LinkTypeLinuxSLL, layers.LinkTypeLinuxSLL2:
-			// If the PCAP contains linux cooked packets, replace the SLL header with a fake ethernet header
-			pktLayers := pkt.Layers()
-
-			switch lt {
-			case layers.LinkTypeLinuxSLL:
-				sll, ok := pktLayers[0].(*layers.LinuxSLL)
-				if !ok {
-					continue
-				}
-
-				pktLayers[0] = &layers.Ethernet{
-					SrcMAC:       sll.Addr,
-					DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 0},
-					EthernetType: sll.EthernetType,
-					BaseLayer: layers.BaseLayer{
-						Payload: sll.Payload,
-					},
-				}
-
-			case layers.LinkTypeLinuxSLL2:
-				sll2, ok := pktLayers[0].(*layers.LinuxSLL2)
-				if !ok {
-					continue
-				}
-
-				pktLayers[0] = &layers.Ethernet{
-					SrcMAC:       sll2.Addr,
-					DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 0},
-					EthernetType: sll2.ProtocolType,
-					BaseLayer: layers.BaseLayer{
-						Payload: sll2.Payload,
-					},
-				}
-
-				// SLL2 has interface index info per packet
-				InterfaceIndex = int(sll2.InterfaceIndex)
-			}
+		// If we are missing data, mock it as best we can. If we can't convert the data to valid contexts, just don't
+		// and inform the user.
+		frame, err := toEthernet(data, src.linkType(ci))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "packet %d: %s, skipping\n", i, err)
+			continue
+		}
 
-			serializeable := make([]gopacket.SerializableLayer, 0, len(pktLayers))
-			for _, l := range pktLayers {
-				sl, ok := l.(gopacket.SerializableLayer)
-				if !ok {
-					continue
-				}
-				serializeable = append(serializeable, sl)
-			}
+		if !filter.MatchEthernet(frame.data) {
+			continue
+		}
 
-			err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, serializeable...)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
+		matched++
+		if matched <= pcapToCtxSkip {
+			continue
+		}
 
-			data = buf.Bytes()
+		// Use the CaptureInfo interface index by default
+		ifindex := ci.InterfaceIndex
+		if frame.ifindex != -1 {
+			ifindex = frame.ifindex
+		}
 
-		case layers.LinkTypeEthernet:
-			// Already an ethernet packet, nothing to do here
+		name := ci.Timestamp.String()
+		if ifaceName := src.interfaceName(ci); ifaceName != "" {
+			name = fmt.Sprintf("%s (%s)", name, ifaceName)
 		}
 
-		ctx := &mimic.GenericContext{
-			Name: ci.Timestamp.String(),
-			Registers: mimic.GenericContextRegisters{
-				R1: "xdp_md",
-			},
-			Memory: []mimic.GenericContextMemory{
-				{
-					Name: "pkt",
-					Block: &mimic.GenericContextMemoryBlock{
-						Value: data,
-						// TODO determine endianness of pcap
-					},
-				},
-				{
-					Name: "data",
-					Pointer: &mimic.GenericContextPointer{
-						Memory: "pkt",
-						Offset: 0,
-						Size:   32,
-					},
-				},
-				{
-					Name: "data_end",
-					Pointer: &mimic.GenericContextPointer{
-						Memory: "pkt",
-						Offset: len(data),
-						Size:   32,
-					},
-				},
-				{
-					Name: "data_meta",
-					Pointer: &mimic.GenericContextPointer{
-						Memory: "pkt",
-						Offset: 0,
-						Size:   32,
-					},
-				},
-				{
-					Name: "ingress_ifindex",
-					Int: &mimic.GenericContextInt{
-						Value: int64(InterfaceIndex),
-						Size:  32,
-					},
-				},
-				{
-					Name: "rx_queue_index",
-					Int: &mimic.GenericContextInt{
-						// PCAP files don't contain rx_queue_index info
-						Size: 32,
-					},
-				},
-				{
-					Name: "egress_ifindex",
-					Int: &mimic.GenericContextInt{
-						Value: 0,
-						Size:  32,
-					},
-				},
-				{
-					Name: "xdp_md",
-					Struct: &mimic.GenericContextStruct{
-						Fields: []mimic.GenericContextStructField{
-							{
-								Name:   "data",
-								Memory: "data",
-							},
-							{
-								Name:   "data_end",
-								Memory: "data_end",
-							},
-							{
-								Name:   "data_meta",
-								Memory: "data_meta",
-							},
-							{
-								Name:   "ingress_ifindex",
-								Memory: "ingress_ifindex",
-							},
-							{
-								Name:   "rx_queue_index",
-								Memory: "rx_queue_index",
-							},
-							{
-								Name:   "egress_ifindex",
-								Memory: "egress_ifindex",
-							},
-						},
-					},
+		var ctx mimic.Context
+		switch pcapToCtxType {
+		case "xdp":
+			ctx = ctxutil.NewXDP(name, frame.data, ifindex)
+
+		case "skb":
+			skb := ctxutil.NewSKBuff(name, frame.data, ifindex)
+			// Errors are impossible, all fields exist in a new __sk_buff
+			if frame.pktType != -1 {
+				_ = ctxutil.SetInt(skb, "pkt_type", int64(frame.pktType))
+			}
+			if ci.Length > ci.CaptureLength {
+				// The packet was truncated during capture
+				_ = ctxutil.SetInt(skb, "wire_len", int64(ci.Length))
+			}
+			_ = ctxutil.SetInt(skb, "mark", int64(pcapToCtxMark))
+			_ = ctxutil.SetInt(skb, "tstamp", ci.Timestamp.UnixNano())
+			ctx = skb
+
+		case "skb-emulated":
+			ctx = &mimic.LinuxContextSKBuff{
+				Name:   name,
+				Packet: frame.data,
+				Dev: &mimic.NetDev{
+					IFIndex: uint32(ifindex),
 				},
-			},
+			}
 		}
 
 		ctxs = append(ctxs, ctx)
@@ -219,12 +166,180 @@ func runPCAPToCtx(cmd *cobra.Command, args []string) error {
 	}
 	defer ctxFile.Close()
 
-	jsonEncoder := json.NewEncoder(ctxFile)
-	jsonEncoder.SetIndent("", "  ")
-	err = jsonEncoder.Encode(ctxs)
+	err = ctxutil.Encode(ctxFile, ctxs)
 	if err != nil {
 		return fmt.Errorf("json encode context: %w", err)
 	}
 
+	fmt.Printf("Converted %d of %d read packets into contexts\n", len(ctxs), total)
+
 	return nil
 }
+
+// packetSource reads packets from a PCAP or PCAPNG file
+type packetSource struct {
+	gopacket.PacketDataSource
+
+	// Only set for PCAPNG files
+	ng *pcapgo.NgReader
+	// Link type of all packets in PCAP files
+	lt layers.LinkType
+}
+
+// The magic number at the start of a PCAPNG file, the type of the section header block
+const pcapngMagic = 0x0A0D0D0A
+
+func newPacketSource(r io.Reader) (*packetSource, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("read magic number: %w", err)
+	}
+
+	if binary.BigEndian.Uint32(magic) == pcapngMagic {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.NgReaderOptions{
+			// Every interface in a PCAPNG can have a different link type
+			WantMixedLinkType: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("new ng reader: %w", err)
+		}
+
+		return &packetSource{PacketDataSource: ng, ng: ng}, nil
+	}
+
+	pr, err := pcapgo.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("new reader: %w", err)
+	}
+
+	return &packetSource{PacketDataSource: pr, lt: pr.LinkType()}, nil
+}
+
+// linkType returns the link type of the interface on which the packet was captured
+func (s *packetSource) linkType(ci gopacket.CaptureInfo) layers.LinkType {
+	if s.ng != nil && len(ci.AncillaryData) > 0 {
+		if lt, ok := ci.AncillaryData[0].(layers.LinkType); ok {
+			return lt
+		}
+	}
+
+	return s.lt
+}
+
+// interfaceName returns the name of the interface on which the packet was captured, if known
+func (s *packetSource) interfaceName(ci gopacket.CaptureInfo) string {
+	if s.ng == nil {
+		return ""
+	}
+
+	iface, err := s.ng.Interface(ci.InterfaceIndex)
+	if err != nil {
+		return ""
+	}
+
+	return iface.Name
+}
+
+// ethernetFrame is a packet converted to an ethernet frame
+type ethernetFrame struct {
+	data []byte
+	// The interface index from the link layer header, -1 if not known
+	ifindex int
+	// The packet type from the link layer header, -1 if not known
+	pktType int
+}
+
+// toEthernet converts a packet of the given link type into an ethernet frame. If the link layer has no ethernet
+// header, a header with a zero destination MAC is synthesized.
+func toEthernet(data []byte, lt layers.LinkType) (ethernetFrame, error) {
+	frame := ethernetFrame{
+		data:    data,
+		ifindex: -1,
+		pktType: -1,
+	}
+
+	var (
+		srcMAC    []byte
+		etherType layers.EthernetType
+		payload   []byte
+	)
+
+	switch lt {
+	case layers.LinkTypeEthernet:
+		// Already an ethernet packet, nothing to do here
+		return frame, nil
+
+	case layers.LinkTypeLinuxSLL:
+		pkt := gopacket.NewPacket(data, lt, gopacket.Lazy)
+		sll, ok := pkt.LinkLayer().(*layers.LinuxSLL)
+		if !ok {
+			return frame, fmt.Errorf("invalid linux cooked capture header")
+		}
+
+		frame.pktType = int(sll.PacketType)
+		srcMAC = sll.Addr
+		etherType = sll.EthernetType
+		payload = sll.Payload
+
+	case layers.LinkTypeLinuxSLL2:
+		pkt := gopacket.NewPacket(data, lt, gopacket.Lazy)
+		sll2, ok := pkt.LinkLayer().(*layers.LinuxSLL2)
+		if !ok {
+			return frame, fmt.Errorf("invalid linux cooked capture v2 header")
+		}
+
+		// SLL2 has interface index info per packet
+		frame.ifindex = int(sll2.InterfaceIndex)
+		frame.pktType = int(sll2.PacketType)
+		srcMAC = sll2.Addr
+		etherType = sll2.ProtocolType
+		payload = sll2.Payload
+
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+		if len(data) == 0 {
+			return frame, fmt.Errorf("empty raw IP packet")
+		}
+
+		payload = data
+		switch data[0] >> 4 {
+		case 4:
+			etherType = layers.EthernetTypeIPv4
+		case 6:
+			etherType = layers.EthernetTypeIPv6
+		default:
+			return frame, fmt.Errorf("raw packet with unknown IP version %d", data[0]>>4)
+		}
+
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		// BSD loopback, a 4 byte address family in host(Null) or network(Loop) byte order. Only one of the bytes is
+		// non-zero for all families we care about, so the byte order doesn't matter.
+		if len(data) < 4 {
+			return frame, fmt.Errorf("loopback header too short")
+		}
+
+		payload = data[4:]
+		switch data[0] | data[3] {
+		case 2:
+			etherType = layers.EthernetTypeIPv4
+		case 10, 24, 28, 30:
+			// AF_INET6 has a different value on Linux, NetBSD/OpenBSD, FreeBSD and Darwin
+			etherType = layers.EthernetTypeIPv6
+		default:
+			return frame, fmt.Errorf("loopback packet with unknown address family %d", data[0]|data[3])
+		}
+
+	default:
+		return frame, fmt.Errorf("unsupported link type '%s'", lt)
+	}
+
+	// Destination MAC is all zero, the source MAC is the link layer address if we know it.
+	eth := make([]byte, 14, 14+len(payload))
+	if len(srcMAC) >= 6 {
+		copy(eth[6:12], srcMAC[:6])
+	}
+	binary.BigEndian.PutUint16(eth[12:14], uint16(etherType))
+	frame.data = append(eth, payload...)
+
+	return frame, nil
+}
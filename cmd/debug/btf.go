@@ -148,7 +148,10 @@ func btfBytesToCValue(sb *strings.Builder, t btf.Type, val []byte, depth int, fo
 
 	case *btf.Enum:
 		// TODO are enums always 32 bit?
-		enumVal := int32(binary.LittleEndian.Uint32(val[:4]))
+		enumVal := uint64(binary.LittleEndian.Uint32(val[:4]))
+		if t.Signed {
+			enumVal = uint64(int64(int32(enumVal)))
+		}
 		for _, v := range t.Values {
 			if v.Value == enumVal {
 				fmt.Fprint(sb, v.Name)
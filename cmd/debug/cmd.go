@@ -57,6 +57,10 @@ func init() {
 			Aliases: []string{"q", "quit"},
 			Summary: "Exits the debugger",
 			Exec: func(args []string) {
+				// Give external processes the chance to exit cleanly
+				for fn := range externHelpers {
+					stopExternHelper(fn)
+				}
 				os.Exit(0)
 			},
 		},
@@ -77,6 +81,7 @@ func init() {
 		cmdStep,
 		cmdList,
 		cmdMap,
+		cmdGlobals,
 		cmdLocals,
 		cmdMemory,
 		cmdBreakpoint,
@@ -84,6 +89,13 @@ func init() {
 		cmdContinueAll,
 		cmdMacro,
 		cmdCallsStack,
+		cmdStack,
+		cmdReplay,
+		cmdMock,
+		cmdExtern,
+		cmdEnv,
+		cmdSymbols,
+		cmdCORERelos,
 		// TODO add `files` command to list all source files of all or a specific program
 	}
 }
@@ -195,6 +207,10 @@ func startProcess() error {
 
 	var err error
 	process, err = vm.NewProcess(entrypoint, ctx)
+	if process != nil {
+		resetStackState()
+		ctxAddr = uint32(process.Registers.R1)
+	}
 	if err != nil {
 		return err
 	}
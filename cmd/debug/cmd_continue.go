@@ -18,7 +18,7 @@ func continueExec(args []string) {
 	//   	current line (1 line can take up multiple instructions)
 
 	for {
-		stop, err := process.Step()
+		stop, err := stepProcess()
 		if err != nil {
 			printRed("%s\n", err)
 			break
@@ -29,6 +29,11 @@ func continueExec(args []string) {
 			return
 		}
 
+		if replayDiverged() {
+			listLinesExec(nil)
+			return
+		}
+
 		for i, bp := range breakpoints {
 			if !bp.ShouldBreak(process) {
 				continue
@@ -1,6 +1,11 @@
 package debug
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+)
 
 var cmdContinueAll = Command{
 	Name:    "continue-all",
@@ -8,11 +13,35 @@ var cmdContinueAll = Command{
 	Summary: "Continue execution of the program for all contexts",
 	Description: "This command will continue execution of the program, if the program exits, the VM will be reset " +
 		"and the next context loaded, just like a real program would. Execution halts when no more contexts are " +
-		"available or a breakpoint is hit",
+		"available or a breakpoint is hit.\n" +
+		"With '--pcap-out {file}' the packet of each context is written to a file after the program exits, " +
+		"including changes made by the program like bpf_xdp_adjust_head/tail. If the file has a .pcapng extension " +
+		"all packets are written to it with the verdict as packet comment, otherwise the packets are split by " +
+		"verdict into '{file}.{verdict}.pcap' files, for example 'out.xdp_pass.pcap'.",
 	Exec: continueAllExec,
+	Args: []CmdArg{{
+		Name:     "--pcap-out file",
+		Required: false,
+	}},
 }
 
 func continueAllExec(args []string) {
+	pcapPath, err := parsePCAPOutArgs(args)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	var pcapOut *pcapOutput
+	if pcapPath != "" {
+		pcapOut, err = newPCAPOutput(pcapPath)
+		if err != nil {
+			printRed("%s\n", err)
+			return
+		}
+		defer pcapOut.close()
+	}
+
 	if process == nil {
 		cmdReset.Exec(nil)
 	}
@@ -21,13 +50,17 @@ func continueAllExec(args []string) {
 	//   	current line (1 line can take up multiple instructions)
 
 	for {
-		stop, err := process.Step()
+		stop, err := stepProcess()
 		if err != nil {
 			printRed("%s\n", err)
 			break
 		}
 
 		if stop {
+			if pcapOut != nil {
+				writeCurrentPacket(pcapOut)
+			}
+
 			if curCtx+1 < len(contexts) {
 				err = process.Cleanup()
 				if err != nil {
@@ -36,14 +69,7 @@ func continueAllExec(args []string) {
 				}
 
 				curCtx++
-				process, err = vm.NewProcess(entrypoint, contexts[curCtx])
-				if err != nil {
-					printRed("%s\n", err)
-					break
-				}
-
-				// TODO make the current CPU ID configurable
-				err = process.SetCPUID(0)
+				err = startProcess()
 				if err != nil {
 					printRed("%s\n", err)
 					break
@@ -57,6 +83,11 @@ func continueAllExec(args []string) {
 			return
 		}
 
+		if replayDiverged() {
+			listLinesExec(nil)
+			return
+		}
+
 		for i, bp := range breakpoints {
 			if !bp.ShouldBreak(process) {
 				continue
@@ -75,3 +106,45 @@ func continueAllExec(args []string) {
 		}
 	}
 }
+
+// parsePCAPOutArgs parses the '--pcap-out file' or '--pcap-out=file' argument
+func parsePCAPOutArgs(args []string) (string, error) {
+	var path string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--pcap-out":
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing file after '--pcap-out'")
+			}
+			i++
+			path = args[i]
+
+		case strings.HasPrefix(args[i], "--pcap-out="):
+			path = strings.TrimPrefix(args[i], "--pcap-out=")
+
+		default:
+			return "", fmt.Errorf("unexpected argument '%s'", args[i])
+		}
+	}
+
+	return path, nil
+}
+
+// writeCurrentPacket writes the packet of the exited process to the output, labeled with the verdict of the program
+func writeCurrentPacket(out *pcapOutput) {
+	name := ""
+	if curCtx < len(contexts) {
+		name = contexts[curCtx].GetName()
+	}
+
+	pkt, err := currentPacket()
+	if err != nil {
+		printRed("context %d: %s, not written to pcap\n", curCtx, err)
+		return
+	}
+
+	verdict := ctxutil.Verdict(process.Program.Type, process.Registers.R0)
+	if err = out.writePacket(verdict, curCtx, name, pkt); err != nil {
+		printRed("context %d: %s\n", curCtx, err)
+	}
+}
@@ -0,0 +1,118 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/edb/pkg/corerelo"
+)
+
+var cmdCORERelos = Command{
+	Name:    "core-relos",
+	Summary: "List the CO-RE relocations of programs",
+	Description: "Lists the CO-RE relocations of all programs, or of the given program. Every relocation shows the " +
+		"instruction index, the kind of relocation, the accessed type or field, the access string generated by the " +
+		"compiler and the value of the instruction, which is an offset, size or constant depending on the kind.\n" +
+		"\n" +
+		"If the programs were loaded with '--kernel-btf', the value after relocation against the kernel BTF is " +
+		"shown as well. Relocations which fail or have no match in the kernel BTF are shown in " + red("red") + ". " +
+		"Instructions of relocations without match are poisoned like libbpf does, they are replaced with a call to " +
+		"an invalid helper, so the program fails if it executes them.",
+	Exec: coreRelosExec,
+	Args: []CmdArg{{
+		Name:     "program index|program name",
+		Required: false,
+	}},
+}
+
+// progCORERelos are the CO-RE relocations of each program, by program name
+var progCORERelos = map[string][]corerelo.Relocation{}
+
+// relocateProgram applies the CO-RE relocations of the program against the kernel BTF, if not nil, and records the
+// relocations of the program.
+func relocateProgram(prog *ebpf.ProgramSpec, kernelBTF *btf.Spec) {
+	if kernelBTF == nil {
+		progCORERelos[prog.Name] = corerelo.List(prog.Instructions)
+		return
+	}
+
+	relos := corerelo.Relocate(prog.Instructions, kernelBTF)
+	progCORERelos[prog.Name] = relos
+	if len(relos) == 0 {
+		return
+	}
+
+	failed := 0
+	for _, r := range relos {
+		if r.Err != nil || r.Poisoned {
+			failed++
+		}
+	}
+
+	fmt.Printf("applied %d CO-RE relocations to '%s'\n", len(relos), prog.Name)
+	if failed > 0 {
+		printRed("%d CO-RE relocations of '%s' failed, see 'core-relos %s'\n", failed, prog.Name, prog.Name)
+	}
+}
+
+func coreRelosExec(args []string) {
+	programs := vm.GetPrograms()
+	if len(programs) == 0 {
+		printRed("No programs loaded\n")
+		return
+	}
+
+	if len(args) >= 1 {
+		nameOrID := args[0]
+		if id, err := strconv.Atoi(nameOrID); err == nil {
+			if len(programs) <= id {
+				printRed("No program with id '%d' exists, use 'programs list' to see valid options\n", id)
+				return
+			}
+
+			printCORERelos(programs[id].Name)
+			return
+		}
+
+		for _, prog := range programs {
+			if prog.Name == nameOrID {
+				printCORERelos(prog.Name)
+				return
+			}
+		}
+
+		printRed("No program with name '%s' exists, use 'programs list' to see valid options\n", nameOrID)
+		return
+	}
+
+	for _, prog := range programs {
+		printCORERelos(prog.Name)
+	}
+}
+
+func printCORERelos(progName string) {
+	relos := progCORERelos[progName]
+
+	fmt.Printf("%s:\n", green(progName))
+	if len(relos) == 0 {
+		fmt.Println("  No CO-RE relocations")
+		return
+	}
+
+	relocated := false
+	for _, r := range relos {
+		str := r.String()
+		if r.Err != nil || r.Poisoned {
+			str = red(str)
+		}
+
+		fmt.Printf("  %s %s\n", blue(fmt.Sprintf("%4d", r.Index)), str)
+		relocated = relocated || r.Relocated || r.Err != nil
+	}
+
+	if !relocated {
+		fmt.Println(gray("  Not relocated, load the program with '--kernel-btf' to relocate against a kernel"))
+	}
+}
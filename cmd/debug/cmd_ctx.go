@@ -1,13 +1,20 @@
 package debug
 
 import (
-	"bytes"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 
+	prompt "github.com/c-bata/go-prompt"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/mapdump"
+	"github.com/dylandreimerink/edb/pkg/pktspec"
 	"github.com/dylandreimerink/mimic"
+	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
 var cmdCtx = Command{
@@ -32,7 +39,42 @@ var cmdCtx = Command{
 				"Since this debugger runs the eBPF program in the userspace emulator, we need to pass our own context " +
 				"to the program. Using this command we can load JSON files containing context data into the debugger.\n" +
 				"\n" +
-				"TODO: describe the JSON format here",
+				"A context file is a JSON array of contexts, each with a 'name', a 'type' and a type specific 'ctx' " +
+				"object. Files with the .jsonl extension contain one context per line instead, as written by " +
+				"'edb capture-context --jsonl'. The following types exist:\n" +
+				"  xdp_md   - A 'struct xdp_md' with a base64 'packet', 'headroom', 'tailroom', 'ingress_ifidx', " +
+				"'rx_queue_idx' and 'egress_ifidx'\n" +
+				"  sk_buff  - A 'struct __sk_buff' with a base64 'packet' and optional 'sock', 'dev' and 'flowKeys' " +
+				"objects\n" +
+				"  captured - A context captured with 'edb capture-context', containing the actual context in " +
+				"'subContext' and the results of helper calls in 'helperCalls'\n" +
+				"  generic  - A context built from named memory objects, which can describe any context\n" +
+				"\n" +
+				"Generic contexts have a 'memory' array and a 'registers' object which names the memory objects " +
+				"loaded into R1-R5. Each memory object has a unique 'name', a 'type' and a 'value':\n" +
+				"  block  - {\"value\": base64 bytes, \"byteorder\": \"le\"|\"be\"}, passed as pointer\n" +
+				"  int    - {\"value\": number, \"size\": 8|16|32|64}\n" +
+				"  ptr    - {\"memory\": name of a block or struct, \"offset\": bytes, \"size\": 32|64}\n" +
+				"  struct - [{\"name\": field name, \"memory\": name of an int or ptr}, ...], passed as pointer\n" +
+				"\n" +
+				"For example, a context with a struct of two pointers to the start and end of a 4 byte packet:\n" +
+				"  [{\"name\": \"example\", \"type\": \"generic\", \"ctx\": {\n" +
+				"    \"registers\": {\"r1\": \"md\"},\n" +
+				"    \"memory\": [\n" +
+				"      {\"name\": \"pkt\", \"type\": \"block\", \"value\": {\"value\": \"AAECAw==\", " +
+				"\"byteorder\": \"be\"}},\n" +
+				"      {\"name\": \"data\", \"type\": \"ptr\", \"value\": {\"memory\": \"pkt\", \"offset\": 0, " +
+				"\"size\": 32}},\n" +
+				"      {\"name\": \"data_end\", \"type\": \"ptr\", \"value\": {\"memory\": \"pkt\", " +
+				"\"offset\": 4, \"size\": 32}},\n" +
+				"      {\"name\": \"md\", \"type\": \"struct\", \"value\": [{\"name\": \"data\", " +
+				"\"memory\": \"data\"}, {\"name\": \"data_end\", \"memory\": \"data_end\"}]}\n" +
+				"    ]\n" +
+				"  }}]\n" +
+				"\n" +
+				"Context files are validated before they are loaded, if anything is wrong no contexts are loaded and " +
+				"every problem is reported with its JSON path. Run 'edb ctx schema' for the JSON Schema of context " +
+				"files, which editors can use to validate and autocomplete them.",
 			Aliases:          []string{"ld"},
 			Exec:             loadCtxExec,
 			CustomCompletion: fileCompletion,
@@ -50,6 +92,114 @@ var cmdCtx = Command{
 			}},
 			// TODO add custom suggestions, list contexts
 		},
+		{
+			Name:    "show",
+			Summary: "Show the contents of a context",
+			Description: "This command decodes a context according to the type of the entrypoint program and shows " +
+				"its fields. For XDP and socket buffer programs, the packet is dissected into its layers and all " +
+				"pointers into the packet, the 'data' field and registers, are marked. The current context is shown " +
+				"as it is in the memory of the running program, so changes made by the program are visible. " +
+				"Without argument, the current context is shown.",
+			Exec: showCtxExec,
+			Args: []CmdArg{{
+				Name:     "context index",
+				Required: false,
+			}},
+		},
+		{
+			Name:    "new",
+			Summary: "Create a new context",
+			Description: "This command creates a new context of the given type and makes it the current context. " +
+				"The following types are supported:\n" +
+				"  xdp        - A 'struct xdp_md' for XDP programs\n" +
+				"  skb        - A 'struct __sk_buff' for TC, socket filter and cGroup SKB programs\n" +
+				"  pt_regs    - The x86_64 'struct pt_regs' for kprobes\n" +
+				"  perf_event - A 'struct bpf_perf_event_data' for perf event programs\n" +
+				"  tracepoint - A tracepoint record, the path to the tracefs format file of the tracepoint must be " +
+				"given, like /sys/kernel/tracing/events/syscalls/sys_enter_write/format\n" +
+				"\n" +
+				"For xdp and skb contexts, a packet can be given as hex string or base64. The packet should start with " +
+				"an ethernet header. Without a packet, the context contains an empty packet which can be changed with " +
+				"'context edit'.\n" +
+				"Instead of raw bytes, the packet can be built from a spec with '--packet {spec}', for example " +
+				"'--packet eth()/ipv4(src=10.0.0.1,dst=10.0.0.2)/tcp(dport=80,flags=S)/payload('GET')'. See " +
+				"'edb gen-ctx --help' for all supported layers and arguments.\n" +
+				"\n" +
+				"For pt_regs, perf_event and tracepoint contexts, fields are zero unless a description file is given. " +
+				"This is a JSON or flat YAML file mapping field names to values, see 'edb gen-ctx --help' for " +
+				"details. A context is created for each description in the file.",
+			Exec: newCtxExec,
+			Args: []CmdArg{
+				{
+					Name:     "xdp|skb|pt_regs|perf_event|tracepoint",
+					Required: true,
+				},
+				{
+					Name:     "packet|--packet spec|format file|description file",
+					Required: false,
+				},
+				{
+					Name:     "description file",
+					Required: false,
+				},
+			},
+			CustomCompletion: newCtxCompletion,
+		},
+		{
+			Name:    "edit",
+			Summary: "Change a field or the packet of the current context",
+			Description: "This command changes the memory of the current context, only generic contexts can be " +
+				"edited. Without arguments, all memory of the current context is listed.\n" +
+				"\n" +
+				"The value of an int is a decimal number or a hex number prefixed with '0x'. The value of a pointer is " +
+				"the offset into the memory it points to. The value of a block(like the packet) is a hex string or " +
+				"base64 which replaces the whole block, pointers to the end of the block(like 'data_end') are updated " +
+				"to the new size. Part of a block can be changed by adding an offset to the name, for example " +
+				"'context edit pkt+14 45'.",
+			Exec: editCtxExec,
+			Args: []CmdArg{
+				{
+					Name:     "field",
+					Required: false,
+				},
+				{
+					Name:     "value",
+					Required: false,
+				},
+			},
+			CustomCompletion: editCtxCompletion,
+		},
+		{
+			Name:             "save",
+			Summary:          "Save all contexts to a context JSON file",
+			Description:      "This command writes all contexts, including changes, to a file which can be loaded again.",
+			Exec:             saveCtxExec,
+			CustomCompletion: fileCompletion,
+			Args: []CmdArg{{
+				Name:     "file",
+				Required: true,
+			}},
+		},
+		{
+			Name:    "delete",
+			Summary: "Delete a context",
+			Aliases: []string{"del", "rm"},
+			Exec:    deleteCtxExec,
+			Args: []CmdArg{{
+				Name:     "context index",
+				Required: false,
+			}},
+		},
+		{
+			Name:        "dup",
+			Summary:     "Duplicate a context",
+			Description: "This command appends a copy of the given context, or the current context if none is given.",
+			Exec:        dupCtxExec,
+			Args: []CmdArg{{
+				Name:     "context index",
+				Required: false,
+			}},
+		},
 	},
 }
 
@@ -87,7 +237,12 @@ func setCtxExec(args []string) {
 	curCtx = id
 	fmt.Printf("Switched current context to '%d' (%s)\n", id, contexts[id].GetName())
 
-	// If we are not in the middle of program execution, reset the VM.
+	reloadCtx()
+}
+
+// reloadCtx resets the VM so changes to the current context take effect, unless we are in the middle of program
+// execution.
+func reloadCtx() {
 	if process == nil || process.Registers.PC == 0 {
 		if process != nil {
 			cmdReset.Exec(nil)
@@ -101,39 +256,481 @@ func setCtxExec(args []string) {
 
 func loadCtxExec(args []string) {
 	if len(args) < 1 {
-		printRed("Missing required argument 'program index|program name'\n")
+		printRed("Missing required argument 'context file'\n")
 		return
 	}
 
-	f, err := os.Open(args[0])
+	ctxs, err := ctxutil.DecodeFile(args[0])
 	if err != nil {
-		printRed("error opening file: %s\n", err)
+		var validationErrs ctxutil.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			printRed("Context file is invalid, no contexts were loaded:\n")
+			for _, e := range validationErrs {
+				printRed("  %s\n", e)
+			}
+			return
+		}
+
+		printRed("error decoding context file: %s\n", err)
 		return
 	}
 
-	var ctxs []json.RawMessage
+	contexts = append(contexts, ctxs...)
+
+	fmt.Printf("%d contexts were loaded\n", len(ctxs))
+
+	if dumpPath := mapdump.PathForContext(args[0]); dumpPath != args[0] {
+		if _, err := os.Stat(dumpPath); err == nil {
+			fmt.Printf("The contexts have a map dump, use 'map load %s' to load it\n", dumpPath)
+		}
+	}
+
+	// If we are not in the middle of program execution, reset the VM.
+	if process != nil && process.Registers.PC == 0 {
+		cmdReset.Exec(nil)
+	}
+}
+
+// ctxIndexArg returns the context index given as first argument, or the current context if no argument was given.
+func ctxIndexArg(args []string) (int, bool) {
+	if len(args) < 1 {
+		if len(contexts) <= curCtx {
+			printRed("No contexts loaded\n")
+			return 0, false
+		}
 
-	dec := json.NewDecoder(f)
-	err = dec.Decode(&ctxs)
+		return curCtx, true
+	}
+
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		printRed("error decoding context file: %s\n", err)
+		printRed("%s\n", err)
+		return 0, false
+	}
+
+	if id < 0 || len(contexts) <= id {
+		printRed("No context with id '%d' exists, use 'context list' to see valid options\n", id)
+		return 0, false
+	}
+
+	return id, true
+}
+
+var newCtxTypes = []string{"xdp", "skb", "pt_regs", "perf_event", "tracepoint"}
+
+func newCtxExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument '%s'\n", strings.Join(newCtxTypes, "|"))
+		return
+	}
+
+	name := fmt.Sprintf("%s %d", args[0], len(contexts))
+
+	var newCtxs []mimic.Context
+	switch args[0] {
+	case "xdp", "skb":
+		pkt, spec, ok := newCtxPacket(args[1:])
+		if !ok {
+			return
+		}
+		if spec != "" {
+			name = spec
+		}
+
+		if args[0] == "xdp" {
+			newCtxs = append(newCtxs, ctxutil.NewXDP(name, pkt, 0))
+		} else {
+			newCtxs = append(newCtxs, ctxutil.NewSKBuff(name, pkt, 0))
+		}
+
+	case "pt_regs", "perf_event", "tracepoint":
+		var ok bool
+		newCtxs, ok = newDescribedCtxs(args[0], name, args[1:])
+		if !ok {
+			return
+		}
+
+	default:
+		printRed("Unknown context type '%s', valid options are: %s\n", args[0], strings.Join(newCtxTypes, ", "))
 		return
 	}
 
-	for i, ctx := range ctxs {
-		context, err := mimic.UnmarshalContextJSON(bytes.NewReader(ctx))
+	curCtx = len(contexts)
+	contexts = append(contexts, newCtxs...)
+	for i, ctx := range newCtxs {
+		fmt.Printf("Created context '%d' (%s)\n", curCtx+i, ctx.GetName())
+	}
+
+	reloadCtx()
+}
+
+// newCtxPacket returns the packet given as hex/base64 or built from a '--packet {spec}' argument. If the packet was
+// built from a spec, the spec is returned as well.
+func newCtxPacket(args []string) ([]byte, string, bool) {
+	if len(args) == 0 {
+		return nil, "", true
+	}
+
+	if args[0] == "--packet" {
+		if len(args) < 2 {
+			printRed("Missing packet spec after '--packet'\n")
+			return nil, "", false
+		}
+
+		// The spec may have been split on spaces
+		spec := strings.Join(args[1:], " ")
+		pkt, err := pktspec.Build(spec)
 		if err != nil {
-			printRed("error decoding context %d in context file: %s\n", i, err)
+			printRed("Invalid packet spec: %s\n", err)
+			return nil, "", false
+		}
+
+		return pkt, spec, true
+	}
+
+	pkt, err := ctxutil.ParseBytes(args[0])
+	if err != nil {
+		printRed("Invalid packet: %s\n", err)
+		return nil, "", false
+	}
+
+	return pkt, "", true
+}
+
+// newDescribedCtxs creates pt_regs, perf_event or tracepoint contexts. Tracepoints require the path to a tracefs
+// format file as first argument. The optional description file can describe multiple contexts.
+func newDescribedCtxs(ctxType, name string, args []string) ([]mimic.Context, bool) {
+	var format *ctxutil.TracepointFormat
+	if ctxType == "tracepoint" {
+		if len(args) < 1 {
+			printRed("Missing required argument 'format file'\n")
+			return nil, false
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			printRed("error opening format file: %s\n", err)
+			return nil, false
+		}
+		defer f.Close()
+
+		format, err = ctxutil.ParseTracepointFormat(f)
+		if err != nil {
+			printRed("error parsing format file: %s\n", err)
+			return nil, false
+		}
+		args = args[1:]
+	}
+
+	descs := []ctxutil.Description{{Name: name}}
+	if len(args) >= 1 {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			printRed("error reading description file: %s\n", err)
+			return nil, false
+		}
+
+		descs, err = ctxutil.ParseDescriptions(data)
+		if err != nil {
+			printRed("error parsing description file: %s\n", err)
+			return nil, false
+		}
+	}
+
+	var ctxs []mimic.Context
+	for i, desc := range descs {
+		ctxName := desc.Name
+		if ctxName == "" {
+			ctxName = fmt.Sprintf("%s %d", ctxType, len(contexts)+i)
+		}
+
+		ctx, err := ctxutil.NewDescribed(ctxType, ctxName, format, desc.Values)
+		if err != nil {
+			printRed("error creating context %d: %s\n", i, err)
+			return nil, false
+		}
+		ctxs = append(ctxs, ctx)
+	}
+
+	return ctxs, true
+}
+
+func newCtxCompletion(args []string) []prompt.Suggest {
+	if len(args) > 1 {
+		// Format and description files
+		switch args[0] {
+		case "pt_regs", "perf_event", "tracepoint":
+			return fileCompletion(args[len(args)-1:])
+		}
+		return nil
+	}
+
+	var suggestion []prompt.Suggest
+	for _, t := range newCtxTypes {
+		if len(args) == 0 || strings.HasPrefix(t, args[0]) {
+			suggestion = append(suggestion, prompt.Suggest{Text: t})
+		}
+	}
+
+	return suggestion
+}
+
+// currentGenericCtx returns the current context if it is a generic context, or a generic context wrapped by a
+// captured context.
+func currentGenericCtx() *mimic.GenericContext {
+	if len(contexts) <= curCtx {
+		return nil
+	}
+
+	ctx := contexts[curCtx]
+	if captured, ok := ctx.(*mimic.CapturedContext); ok {
+		ctx = captured.Sub
+	}
+
+	generic, _ := ctx.(*mimic.GenericContext)
+	return generic
+}
+
+func editCtxExec(args []string) {
+	if len(contexts) <= curCtx {
+		printRed("No contexts loaded\n")
+		return
+	}
+
+	ctx := currentGenericCtx()
+	if ctx == nil {
+		printRed("Current context is of type '%T', only generic contexts can be edited\n", contexts[curCtx])
+		return
+	}
+
+	if len(args) < 1 {
+		listCtxMemory(ctx)
+		return
+	}
+
+	if len(args) < 2 {
+		printRed("Missing required argument 'value'\n")
+		return
+	}
+
+	name := args[0]
+	off := -1
+	if i := strings.Index(name, "+"); i != -1 {
+		o, err := strconv.ParseInt(name[i+1:], 0, 32)
+		if err != nil || o < 0 {
+			printRed("Invalid offset '%s'\n", name[i+1:])
 			return
 		}
+		name = name[:i]
+		off = int(o)
+	}
 
-		contexts = append(contexts, context)
+	mem := ctxutil.Memory(ctx, name)
+	if mem == nil {
+		printRed("Current context has no memory named '%s', use 'context edit' to see valid options\n", name)
+		return
 	}
 
-	fmt.Printf("%d contexts were loaded\n", len(ctxs))
+	if off != -1 && mem.Block == nil {
+		printRed("Offsets can only be used on block memory\n")
+		return
+	}
 
-	// If we are not in the middle of program execution, reset the VM.
-	if process != nil && process.Registers.PC == 0 {
-		cmdReset.Exec(nil)
+	switch {
+	case mem.Int != nil:
+		val, err := strconv.ParseInt(args[1], 0, 64)
+		if err != nil {
+			printRed("Invalid int value: %s\n", err)
+			return
+		}
+		mem.Int.Value = val
+
+	case mem.Pointer != nil:
+		val, err := strconv.ParseInt(args[1], 0, 32)
+		if err != nil || val < 0 {
+			printRed("Invalid pointer offset '%s'\n", args[1])
+			return
+		}
+		mem.Pointer.Offset = int(val)
+
+	case mem.Block != nil:
+		val, err := ctxutil.ParseBytes(args[1])
+		if err != nil {
+			printRed("Invalid block value: %s\n", err)
+			return
+		}
+
+		if off != -1 {
+			// Grow the block if the new bytes don't fit
+			block := mem.Block.Value
+			if off+len(val) > len(block) {
+				block = make([]byte, off+len(val))
+				copy(block, mem.Block.Value)
+			} else {
+				block = append([]byte(nil), block...)
+			}
+			copy(block[off:], val)
+			val = block
+		}
+
+		err = ctxutil.SetBlock(ctx, name, val)
+		if err != nil {
+			printRed("%s\n", err)
+			return
+		}
+
+	default:
+		printRed("Memory '%s' is of type '%s', which can't be edited directly, edit its fields instead\n",
+			name,
+			mem.Type,
+		)
+		return
+	}
+
+	fmt.Printf("%s = %s\n", name, ctxMemoryValue(mem))
+
+	reloadCtx()
+}
+
+// listCtxMemory prints all memory of a generic context and their values
+func listCtxMemory(ctx *mimic.GenericContext) {
+	namePadSize := 0
+	for _, mem := range ctx.Memory {
+		if len(mem.Name) > namePadSize {
+			namePadSize = len(mem.Name)
+		}
+	}
+
+	for _, mem := range ctx.Memory {
+		memType := "struct"
+		switch {
+		case mem.Int != nil:
+			memType = fmt.Sprintf("u%d", mem.Int.Size)
+		case mem.Pointer != nil:
+			memType = "ptr"
+		case mem.Block != nil:
+			memType = "block"
+		}
+
+		fmt.Printf("%-*s %s %s\n", namePadSize, mem.Name, blue(fmt.Sprintf("%-6s", memType)), ctxMemoryValue(&mem))
+	}
+}
+
+// ctxMemoryValue returns a human readable representation of the value of generic context memory
+func ctxMemoryValue(mem *mimic.GenericContextMemory) string {
+	switch {
+	case mem.Int != nil:
+		return yellow(fmt.Sprintf("%d (0x%X)", mem.Int.Value, mem.Int.Value))
+	case mem.Pointer != nil:
+		return yellow(fmt.Sprintf("%s+%d", mem.Pointer.Memory, mem.Pointer.Offset))
+	case mem.Block != nil:
+		str := hex.EncodeToString(mem.Block.Value)
+		if len(str) > 64 {
+			str = str[:64] + "..."
+		}
+		return yellow(fmt.Sprintf("%d bytes %s", len(mem.Block.Value), str))
+	case mem.Struct != nil:
+		fields := make([]string, 0, len(mem.Struct.Fields))
+		for _, f := range mem.Struct.Fields {
+			fields = append(fields, f.Name)
+		}
+		return gray("{" + strings.Join(fields, ", ") + "}")
+	}
+
+	return ""
+}
+
+func editCtxCompletion(args []string) []prompt.Suggest {
+	ctx := currentGenericCtx()
+	if ctx == nil || len(args) > 1 {
+		return nil
+	}
+
+	var names []string
+	for _, mem := range ctx.Memory {
+		if mem.Struct == nil {
+			names = append(names, mem.Name)
+		}
+	}
+
+	if len(args) == 0 {
+		var suggestion []prompt.Suggest
+		for _, name := range names {
+			suggestion = append(suggestion, prompt.Suggest{Text: name})
+		}
+		return suggestion
+	}
+
+	ranks := fuzzy.RankFind(args[0], names)
+	sort.Sort(ranks)
+
+	var suggestion []prompt.Suggest
+	for _, rank := range ranks {
+		suggestion = append(suggestion, prompt.Suggest{Text: rank.Target})
+	}
+
+	return suggestion
+}
+
+func saveCtxExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'file'\n")
+		return
 	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		printRed("error creating file: %s\n", err)
+		return
+	}
+	defer f.Close()
+
+	err = ctxutil.Encode(f, contexts)
+	if err != nil {
+		printRed("error encoding contexts: %s\n", err)
+		return
+	}
+
+	fmt.Printf("%d contexts were saved to '%s'\n", len(contexts), args[0])
+}
+
+func deleteCtxExec(args []string) {
+	id, ok := ctxIndexArg(args)
+	if !ok {
+		return
+	}
+
+	name := contexts[id].GetName()
+	contexts = append(contexts[:id], contexts[id+1:]...)
+	fmt.Printf("Deleted context '%d' (%s)\n", id, name)
+
+	// Keep the same context selected, unless we deleted the current context.
+	if id < curCtx {
+		curCtx--
+		return
+	}
+
+	if id == curCtx {
+		if curCtx >= len(contexts) && curCtx > 0 {
+			curCtx--
+		}
+		reloadCtx()
+	}
+}
+
+func dupCtxExec(args []string) {
+	id, ok := ctxIndexArg(args)
+	if !ok {
+		return
+	}
+
+	ctx, err := ctxutil.Clone(contexts[id])
+	if err != nil {
+		printRed("error copying context: %s\n", err)
+		return
+	}
+	ctx.SetName(ctx.GetName() + " (copy)")
+
+	contexts = append(contexts, ctx)
+	fmt.Printf("Created context '%d' (%s)\n", len(contexts)-1, ctx.GetName())
 }
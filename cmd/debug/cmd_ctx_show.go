@@ -0,0 +1,351 @@
+package debug
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/mimic"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ctxLayout returns the layout and C type name of the context passed to programs of the given type, or nil if we
+// don't know how to decode it.
+func ctxLayout(progType ebpf.ProgramType) ([]ctxutil.Field, string) {
+	switch progType {
+	case ebpf.XDP:
+		return ctxutil.XDPMDLayout(), "struct xdp_md"
+	case ebpf.SocketFilter, ebpf.SchedCLS, ebpf.SchedACT, ebpf.CGroupSKB, ebpf.LWTIn, ebpf.LWTOut, ebpf.LWTXmit,
+		ebpf.LWTSeg6Local, ebpf.SkSKB, ebpf.FlowDissector:
+		return ctxutil.SKBuffLayout(), "struct __sk_buff"
+	case ebpf.Kprobe:
+		return ctxutil.PTRegsLayout(), "struct pt_regs"
+	case ebpf.PerfEvent:
+		return ctxutil.PerfEventDataLayout(), "struct bpf_perf_event_data"
+	}
+
+	return nil, ""
+}
+
+// The pt_regs fields used to pass arguments to kernel functions on x86_64
+var ptRegsParams = map[string]string{
+	"di": "PARM1",
+	"si": "PARM2",
+	"dx": "PARM3",
+	"cx": "PARM4",
+	"r8": "PARM5",
+	"r9": "PARM6",
+	"ax": "RC",
+	"sp": "SP",
+	"ip": "IP",
+}
+
+var skbPktTypes = []string{"PACKET_HOST", "PACKET_BROADCAST", "PACKET_MULTICAST", "PACKET_OTHERHOST", "PACKET_OUTGOING"}
+
+func showCtxExec(args []string) {
+	id, ok := ctxIndexArg(args)
+	if !ok {
+		return
+	}
+
+	progs := vm.GetPrograms()
+	if len(progs) <= entrypoint {
+		printRed("No program loaded, the program type is required to decode a context\n")
+		return
+	}
+	progType := progs[entrypoint].Type
+
+	// The current context is shown as it is in the memory of the current process. Other contexts are loaded into a
+	// temporary process so we can decode them in the same way.
+	addr := ctxAddr
+	live := process != nil && process.Context == contexts[id]
+	if !live {
+		tmp, err := vm.NewProcess(entrypoint, contexts[id])
+		if tmp != nil {
+			defer tmp.Cleanup()
+		}
+		if err != nil {
+			printRed("error loading context: %s\n", err)
+			return
+		}
+		addr = uint32(tmp.Registers.R1)
+	}
+
+	layout, typeName := ctxLayout(progType)
+	fmt.Printf("Context %d: %s", id, green(contexts[id].GetName()))
+	if typeName != "" {
+		fmt.Printf(" (%s)", blue(typeName))
+	}
+	fmt.Print("\n")
+
+	entry, off, found := vm.MemoryController.GetEntry(addr)
+	if !found {
+		printRed("No memory at context address 0x%08X\n", addr)
+		return
+	}
+
+	vmMem, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		printRed("Memory of context '%s' is not virtual memory\n", entry.Name)
+		return
+	}
+
+	if layout == nil {
+		fmt.Printf("Decoding contexts of %s programs is not supported, raw memory:\n", progType)
+		mem := make([]byte, entry.Size-off)
+		if err := vmMem.Read(off, mem); err != nil {
+			printRed("%s\n", err)
+			return
+		}
+		hexdump(entry.Addr+off, mem, -1, 0)
+		return
+	}
+
+	namePadSize := 0
+	for _, f := range layout {
+		if len(f.Name) > namePadSize {
+			namePadSize = len(f.Name)
+		}
+	}
+
+	values := make(map[string]uint64)
+	for _, f := range layout {
+		fmt.Printf("  %-*s = ", namePadSize, f.Name)
+
+		val, err := loadCtxField(vmMem, off+f.Offset, f.Size)
+		if err != nil {
+			fmt.Println(gray("<unavailable>"))
+			continue
+		}
+		values[f.Name] = val
+
+		fmt.Println(ctxFieldValue(f, val))
+	}
+
+	dataVal, hasData := values["data"]
+	dataEndVal, hasDataEnd := values["data_end"]
+	if !hasData || !hasDataEnd {
+		return
+	}
+
+	pointers := []ctxPointer{{name: "data", addr: uint32(dataVal)}}
+	if meta, ok := values["data_meta"]; ok && meta != dataVal {
+		pointers = append(pointers, ctxPointer{name: "data_meta", addr: uint32(meta)})
+	}
+	// Register values only mean something for the context which is actually being executed
+	if live {
+		for i := asm.R0; i < asm.R10; i++ {
+			pointers = append(pointers, ctxPointer{name: i.String(), addr: uint32(process.Registers.Get(i))})
+		}
+	}
+
+	showCtxPacket(uint32(dataVal), uint32(dataEndVal), pointers)
+}
+
+// loadCtxField loads a single field from context memory. Some context memory types emulate kernel field access
+// and may panic on fields they don't implement, so those panics are turned into errors.
+func loadCtxField(vmMem mimic.VMMem, off uint32, size asm.Size) (val uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("load field: %v", r)
+		}
+	}()
+
+	return vmMem.Load(off, size)
+}
+
+// ctxFieldValue formats the value of a context field for display
+func ctxFieldValue(f ctxutil.Field, val uint64) string {
+	if f.Pointer {
+		str := yellow(fmt.Sprintf("0x%08X", val))
+		if entry, off, found := vm.MemoryController.GetEntry(uint32(val)); found {
+			str += gray(fmt.Sprintf(" (%s+%d)", entry.Name, off))
+		}
+		return str
+	}
+
+	if f.Size == asm.DWord {
+		str := yellow(fmt.Sprintf("0x%016X", val))
+		if param := ptRegsParams[f.Name]; param != "" {
+			str += gray(fmt.Sprintf(" (%s)", param))
+		}
+		if sym := ksymString(val); sym != "" {
+			str += gray(fmt.Sprintf(" <%s>", sym))
+		}
+		return str
+	}
+
+	str := yellow(fmt.Sprintf("%d (0x%X)", val, val))
+	switch f.Name {
+	case "protocol", "vlan_proto":
+		if val == 0 {
+			break
+		}
+
+		// Stored in network byte order
+		b := make([]byte, 2)
+		mimic.GetNativeEndianness().PutUint16(b, uint16(val))
+		str += gray(fmt.Sprintf(" (%s)", layers.EthernetType(uint16(b[0])<<8|uint16(b[1]))))
+	case "pkt_type":
+		if val < uint64(len(skbPktTypes)) {
+			str += gray(fmt.Sprintf(" (%s)", skbPktTypes[val]))
+		}
+	case "ifindex", "ingress_ifindex", "egress_ifindex":
+		if name := ifindexName(val); name != "" {
+			str += gray(fmt.Sprintf(" (%s)", name))
+		}
+	case "remote_ip4", "local_ip4":
+		b := make([]byte, 4)
+		mimic.GetNativeEndianness().PutUint32(b, uint32(val))
+		str += gray(fmt.Sprintf(" (%s)", net.IP(b)))
+	}
+
+	return str
+}
+
+// ctxPointer is a named pointer which might point into the packet
+type ctxPointer struct {
+	name string
+	addr uint32
+}
+
+// showCtxPacket dissects the packet between data and data_end and shows where the given pointers point.
+func showCtxPacket(data, dataEnd uint32, pointers []ctxPointer) {
+	pktEntry, dataOff, found := vm.MemoryController.GetEntry(data)
+	if !found {
+		printRed("No memory at data address 0x%08X\n", data)
+		return
+	}
+
+	pktMem, ok := pktEntry.Object.(mimic.VMMem)
+	if !ok {
+		printRed("Memory of packet '%s' is not virtual memory\n", pktEntry.Name)
+		return
+	}
+
+	mem := make([]byte, pktEntry.Size)
+	if err := pktMem.Read(0, mem); err != nil {
+		printRed("error reading packet: %s\n", err)
+		return
+	}
+
+	endOff := int(dataEnd) - int(pktEntry.Addr)
+	if endOff < int(dataOff) || endOff > len(mem) {
+		printRed("data_end 0x%08X is outside of the packet memory\n", dataEnd)
+		return
+	}
+	pkt := mem[dataOff:endOff]
+
+	fmt.Printf("\nPacket: %d bytes, data at %s+%d\n", len(pkt), pktEntry.Name, dataOff)
+
+	type layerRange struct {
+		name       string
+		start, end int
+	}
+	var ranges []layerRange
+
+	decoded := gopacket.NewPacket(pkt, layers.LayerTypeEthernet, gopacket.Default)
+	start := 0
+	for _, l := range decoded.Layers() {
+		size := len(l.LayerContents())
+		name := l.LayerType().String()
+		ranges = append(ranges, layerRange{name: name, start: start, end: start + size})
+
+		fmt.Printf("  %s %s %s\n",
+			green(fmt.Sprintf("%-14s", name)),
+			gray(fmt.Sprintf("%4d-%-4d", start, start+size-1)),
+			describeLayer(l),
+		)
+		start += size
+	}
+	if errLayer := decoded.ErrorLayer(); errLayer != nil {
+		printRed("  %s\n", errLayer.Error())
+	}
+
+	fmt.Println("\nPointers into the packet:")
+	for _, ptr := range pointers {
+		if ptr.addr < pktEntry.Addr || ptr.addr > pktEntry.Addr+pktEntry.Size {
+			continue
+		}
+
+		rel := int(ptr.addr) - int(data)
+		where := ""
+		switch {
+		case rel < 0:
+			where = "headroom"
+		case rel == len(pkt):
+			where = "data_end"
+		case rel > len(pkt):
+			where = "tailroom"
+		default:
+			for _, r := range ranges {
+				if rel >= r.start && rel < r.end {
+					where = fmt.Sprintf("%s+%d", r.name, rel-r.start)
+					break
+				}
+			}
+		}
+
+		fmt.Printf("  %s -> %s %s\n",
+			blue(fmt.Sprintf("%-9s", ptr.name)),
+			yellow(fmt.Sprintf("%s+%d", pktEntry.Name, ptr.addr-pktEntry.Addr)),
+			gray(where),
+		)
+	}
+
+	fmt.Print("\n")
+	hexdump(pktEntry.Addr, mem, int(dataOff), len(pkt))
+}
+
+// describeLayer returns a one line summary of the most important fields of a packet layer
+func describeLayer(l gopacket.Layer) string {
+	switch l := l.(type) {
+	case *layers.Ethernet:
+		return fmt.Sprintf("%s > %s, %s", l.SrcMAC, l.DstMAC, l.EthernetType)
+	case *layers.Dot1Q:
+		return fmt.Sprintf("vlan %d, prio %d, %s", l.VLANIdentifier, l.Priority, l.Type)
+	case *layers.ARP:
+		op := "request"
+		if l.Operation == layers.ARPReply {
+			op = "reply"
+		}
+		return fmt.Sprintf("%s, %s > %s", op, net.IP(l.SourceProtAddress), net.IP(l.DstProtAddress))
+	case *layers.IPv4:
+		return fmt.Sprintf("%s > %s, %s, ttl %d, len %d", l.SrcIP, l.DstIP, l.Protocol, l.TTL, l.Length)
+	case *layers.IPv6:
+		return fmt.Sprintf("%s > %s, %s, hop limit %d, len %d", l.SrcIP, l.DstIP, l.NextHeader, l.HopLimit, l.Length)
+	case *layers.TCP:
+		var flags []string
+		for _, f := range []struct {
+			set  bool
+			name string
+		}{
+			{l.SYN, "SYN"}, {l.ACK, "ACK"}, {l.FIN, "FIN"}, {l.RST, "RST"},
+			{l.PSH, "PSH"}, {l.URG, "URG"}, {l.ECE, "ECE"}, {l.CWR, "CWR"},
+		} {
+			if f.set {
+				flags = append(flags, f.name)
+			}
+		}
+		return fmt.Sprintf("%d > %d, [%s], seq %d, ack %d, win %d",
+			l.SrcPort,
+			l.DstPort,
+			strings.Join(flags, " "),
+			l.Seq,
+			l.Ack,
+			l.Window,
+		)
+	case *layers.UDP:
+		return fmt.Sprintf("%d > %d, len %d", l.SrcPort, l.DstPort, l.Length)
+	case *layers.ICMPv4:
+		return l.TypeCode.String()
+	case *layers.ICMPv6:
+		return l.TypeCode.String()
+	}
+
+	return fmt.Sprintf("%d bytes", len(l.LayerContents()))
+}
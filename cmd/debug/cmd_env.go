@@ -0,0 +1,155 @@
+package debug
+
+import (
+	"fmt"
+
+	"github.com/dylandreimerink/edb/pkg/netenv"
+)
+
+var cmdEnv = Command{
+	Name:    "environment",
+	Aliases: []string{"env"},
+	Summary: "Network environment related commands",
+	Description: "Helpers like bpf_fib_lookup, bpf_redirect_map and bpf_sk_lookup_tcp depend on the network state of " +
+		"the kernel: interfaces, routes, neighbours and sockets. A network environment describes this state so " +
+		"these helpers can be emulated. Without an environment, the emulator is used, which replays results " +
+		"captured with the context. When an environment is loaded, 'ctx show' also shows the names of interfaces.",
+	Subcommands: []Command{
+		{
+			Name:    "load",
+			Summary: "Load a network environment file",
+			Description: "An environment file is a JSON object with the following sections, all optional:\n" +
+				"  interfaces - {\"name\", \"ifindex\", \"mac\", \"mtu\", \"addrs\": [\"ip/prefix\", ...], " +
+				"\"forwarding\"}, the MTU defaults to 1500 and forwarding to true. Addresses add routes to their " +
+				"subnet\n" +
+				"  routes     - {\"dst\": \"ip/prefix\" or \"default\", \"gateway\", \"dev\", \"metric\", \"type\"}, " +
+				"the type is unicast(default), blackhole, unreachable or prohibit. The dev can be left out if the " +
+				"gateway is on a connected network\n" +
+				"  neighbours - {\"ip\", \"mac\", \"dev\"}\n" +
+				"  sockets    - {\"proto\": \"tcp\"|\"udp\", \"state\": \"listen\"|\"established\", " +
+				"\"local\": \"ip:port\", \"remote\": \"ip:port\", \"dev\"}, IPv6 addresses are written as " +
+				"[ip]:port\n" +
+				"\n" +
+				"For example:\n" +
+				"  {\n" +
+				"    \"interfaces\": [{\"name\": \"eth0\", \"ifindex\": 2, \"mac\": \"02:00:00:00:00:01\", " +
+				"\"addrs\": [\"10.0.0.1/24\"]}],\n" +
+				"    \"routes\": [{\"dst\": \"default\", \"gateway\": \"10.0.0.254\"}],\n" +
+				"    \"neighbours\": [{\"ip\": \"10.0.0.254\", \"mac\": \"02:00:00:00:00:fe\", \"dev\": \"eth0\"}],\n" +
+				"    \"sockets\": [{\"proto\": \"tcp\", \"state\": \"listen\", \"local\": \"0.0.0.0:80\"}]\n" +
+				"  }\n" +
+				"\n" +
+				"The environment is used by bpf_fib_lookup, bpf_sk_lookup_tcp, bpf_skc_lookup_tcp, " +
+				"bpf_sk_lookup_udp and bpf_redirect_map, which only redirects to devmap entries of interfaces which " +
+				"exist in the environment. The file can also be given with the --env flag of 'edb debug'.",
+			Exec: loadEnvExec,
+			Args: []CmdArg{{
+				Name:     "file path",
+				Required: true,
+			}},
+			CustomCompletion: fileCompletion,
+		},
+		{
+			Name:    "show",
+			Summary: "Show the loaded network environment",
+			Exec:    showEnvExec,
+		},
+		{
+			Name:    "clear",
+			Summary: "Unload the network environment",
+			Exec:    clearEnvExec,
+		},
+	},
+}
+
+// netEnv is the network environment used by network helpers, nil if none is loaded
+var netEnv *netenv.Env
+
+func loadEnvExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'file path'\n")
+		return
+	}
+
+	env, err := netenv.Load(args[0])
+	if err != nil {
+		printRed("Error while loading environment: %s\n", err)
+		return
+	}
+
+	netEnv = env
+	fmt.Printf("Loaded %d interfaces, %d routes, %d neighbours and %d sockets\n",
+		len(env.Interfaces), len(env.Routes), len(env.Neighbours), len(env.Sockets))
+}
+
+func showEnvExec(args []string) {
+	if netEnv == nil {
+		fmt.Println("No network environment loaded")
+		return
+	}
+
+	fmt.Println("Interfaces:")
+	for _, iface := range netEnv.Interfaces {
+		fmt.Printf("  %s %s mac %s mtu %d", yellow(fmt.Sprintf("%3d", iface.Ifindex)), green(iface.Name), iface.MAC,
+			iface.MTU)
+		for _, addr := range iface.Addrs {
+			ones, _ := addr.Net.Mask.Size()
+			fmt.Printf(" %s/%d", addr.IP, ones)
+		}
+		if !iface.Forwarding {
+			fmt.Print(gray(" (forwarding disabled)"))
+		}
+		fmt.Print("\n")
+	}
+
+	fmt.Println("Routes:")
+	for _, route := range netEnv.Routes {
+		fmt.Printf("  %s", route.Dst)
+		if route.Type != netenv.RouteUnicast {
+			fmt.Printf(" %s", route.Type)
+		}
+		if route.Gateway != nil {
+			fmt.Printf(" via %s", route.Gateway)
+		}
+		if route.Dev != nil {
+			fmt.Printf(" dev %s", route.Dev.Name)
+		}
+		if route.Metric != 0 {
+			fmt.Printf(" metric %d", route.Metric)
+		}
+		fmt.Print("\n")
+	}
+
+	fmt.Println("Neighbours:")
+	for _, neigh := range netEnv.Neighbours {
+		fmt.Printf("  %s lladdr %s dev %s\n", neigh.IP, neigh.MAC, neigh.Dev.Name)
+	}
+
+	fmt.Println("Sockets:")
+	for _, sock := range netEnv.Sockets {
+		fmt.Printf("  %s", sock)
+		if sock.Dev != nil {
+			fmt.Printf(" dev %s", sock.Dev.Name)
+		}
+		fmt.Print("\n")
+	}
+}
+
+func clearEnvExec(args []string) {
+	netEnv = nil
+	fmt.Println("Network environment unloaded")
+}
+
+// ifindexName returns the name of the interface with the given ifindex in the network environment, or "" if unknown
+func ifindexName(ifindex uint64) string {
+	if netEnv == nil {
+		return ""
+	}
+
+	iface := netEnv.InterfaceByIndex(int(ifindex))
+	if iface == nil {
+		return ""
+	}
+
+	return iface.Name
+}
@@ -0,0 +1,236 @@
+package debug
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/exthelper"
+	"github.com/dylandreimerink/edb/pkg/helperdata"
+	"github.com/dylandreimerink/mimic"
+)
+
+var cmdExtern = Command{
+	Name:    "extern",
+	Summary: "Implement helper functions with external processes",
+	Description: "Some helper functions depend on the environment the program runs in, like FIB or socket " +
+		"lookups, and can't be modeled by the emulator. Such helpers can be implemented by an external process, " +
+		"written in any language, which is started by edb and receives every call to the helpers on stdin and " +
+		"answers on stdout, as one line of JSON per call.\n" +
+		"\n" +
+		"A request looks like:\n" +
+		"  {\"id\": 1, \"helper\": 69, \"name\": \"bpf_fib_lookup\", \"args\": [r1, r2, r3, r4, r5],\n" +
+		"   \"memory\": [{\"arg\": 1, \"data\": \"base64\"}, {\"arg\": 2, \"map\": \"map name\"}]}\n" +
+		"\n" +
+		"'memory' holds the memory the pointer args point to, from the pointer to the end of the memory object with " +
+		"at most 4096 bytes, or the name of the map for pointers to maps. The process must answer with the same " +
+		"id, the return value and optionally memory writes relative to the pointer args:\n" +
+		"  {\"id\": 1, \"r0\": 0, \"writes\": [{\"arg\": 2, \"offset\": 14, \"data\": \"base64\"}]}\n" +
+		"\n" +
+		"An 'error' in the answer stops the program with that error. Anything the process writes to stderr is " +
+		"shown. Mocks take precedence over external processes.",
+	Subcommands: []Command{
+		{
+			Name:    "start",
+			Summary: "Start an external process which implements the given helper functions",
+			Description: "Helpers are given as a comma separated list of names, like " +
+				"'bpf_fib_lookup,bpf_sk_lookup_tcp', or numbers. The rest of the arguments is the command which " +
+				"starts the process, for example:\n" +
+				"  extern start bpf_fib_lookup python3 ./fib.py --routes routes.txt",
+			Exec: startExternExec,
+			Args: []CmdArg{
+				{
+					Name:     "helpers",
+					Required: true,
+				},
+				{
+					Name:     "command",
+					Required: true,
+				},
+				{
+					Name:     "args",
+					Required: false,
+				},
+			},
+			CustomCompletion: mockHelperCompletion,
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Summary: "List all external processes and the helper functions they implement",
+			Exec:    listExternExec,
+		},
+		{
+			Name:    "stop",
+			Summary: "Stop using an external process for a helper function, or stop all processes",
+			Description: "If a process doesn't implement any helper anymore, it is stopped. Without argument all " +
+				"processes are stopped.",
+			Exec: stopExternExec,
+			Args: []CmdArg{{
+				Name:     "helper",
+				Required: false,
+			}},
+			CustomCompletion: mockHelperCompletion,
+		},
+	},
+}
+
+// externHelpers are the helper functions implemented by external processes
+var externHelpers = map[asm.BuiltinFunc]*exthelper.Process{}
+
+// externHelper returns an implementation of the helper which calls the external process
+func externHelper(fn asm.BuiltinFunc, proc *exthelper.Process) func(p *mimic.Process) error {
+	return func(p *mimic.Process) error {
+		sig := helperdata.Signatures[fn]
+		req := exthelper.Request{
+			Helper: int(fn),
+			Name:   sig.Name,
+			Args:   make([]uint64, 5),
+		}
+		for i := range req.Args {
+			req.Args[i] = p.Registers.Get(asm.R1 + asm.Register(i))
+		}
+
+		for i, param := range sig.Params {
+			if !param.Type.Ptr || i >= len(req.Args) {
+				continue
+			}
+
+			entry, off, found := p.VM.MemoryController.GetEntry(uint32(req.Args[i]))
+			if !found {
+				continue
+			}
+
+			switch obj := entry.Object.(type) {
+			case mimic.LinuxMap:
+				req.Memory = append(req.Memory, exthelper.Memory{Arg: i + 1, Map: entry.Name})
+
+			case mimic.VMMem:
+				size := entry.Size - off
+				if size > exthelper.MaxMemory {
+					size = exthelper.MaxMemory
+				}
+
+				data := make([]byte, size)
+				if err := obj.Read(off, data); err != nil {
+					return fmt.Errorf("read memory of arg %d: %w", i+1, err)
+				}
+				req.Memory = append(req.Memory, exthelper.Memory{Arg: i + 1, Data: data})
+			}
+		}
+
+		resp, err := proc.Call(req)
+		if err != nil {
+			return fmt.Errorf("external process for %s: %w", sig.Name, err)
+		}
+
+		for _, write := range resp.Writes {
+			if write.Arg < 1 || write.Arg > len(req.Args) {
+				return fmt.Errorf("external process for %s: write to invalid arg %d", sig.Name, write.Arg)
+			}
+
+			mem, off, err := helperOutputMem(req.Args[write.Arg-1] + uint64(write.Offset))
+			if err == nil {
+				err = mem.Write(off, write.Data)
+			}
+			if err != nil {
+				return fmt.Errorf("external process for %s: write to arg %d: %w", sig.Name, write.Arg, err)
+			}
+		}
+
+		p.Registers.R0 = uint64(resp.R0)
+		return nil
+	}
+}
+
+func startExternExec(args []string) {
+	if len(args) < 2 {
+		printRed("Missing required arguments 'helpers' and 'command'\n")
+		return
+	}
+
+	var fns []asm.BuiltinFunc
+	for _, name := range strings.Split(args[0], ",") {
+		fn, found := helperdata.Lookup(name)
+		if !found {
+			printRed("Unknown helper function '%s'\n", name)
+			return
+		}
+		fns = append(fns, fn)
+	}
+
+	proc, err := exthelper.Start(args[1], args[2:]...)
+	if err != nil {
+		printRed("Error while starting external process: %s\n", err)
+		return
+	}
+
+	for _, fn := range fns {
+		stopExternHelper(fn)
+		externHelpers[fn] = proc
+		fmt.Printf("%s: %s\n", helperdata.Signatures[fn].Name, proc)
+	}
+}
+
+// stopExternHelper stops using the external process for the helper and stops the process if it isn't used anymore.
+func stopExternHelper(fn asm.BuiltinFunc) {
+	proc := externHelpers[fn]
+	if proc == nil {
+		return
+	}
+	delete(externHelpers, fn)
+
+	for _, other := range externHelpers {
+		if other == proc {
+			return
+		}
+	}
+
+	if err := proc.Close(); err != nil {
+		printRed("External process '%s' exited with: %s\n", proc, err)
+	}
+}
+
+func listExternExec(args []string) {
+	if len(externHelpers) == 0 {
+		fmt.Println("No external processes")
+		return
+	}
+
+	fns := make([]asm.BuiltinFunc, 0, len(externHelpers))
+	for fn := range externHelpers {
+		fns = append(fns, fn)
+	}
+	sort.Slice(fns, func(i, j int) bool {
+		return fns[i] < fns[j]
+	})
+
+	for _, fn := range fns {
+		fmt.Printf("%s: %s\n", helperdata.Signatures[fn].Name, externHelpers[fn])
+	}
+}
+
+func stopExternExec(args []string) {
+	if len(args) == 0 {
+		for fn := range externHelpers {
+			stopExternHelper(fn)
+		}
+		fmt.Println("All external processes stopped")
+		return
+	}
+
+	fn, found := helperdata.Lookup(args[0])
+	if !found {
+		printRed("Unknown helper function '%s'\n", args[0])
+		return
+	}
+
+	if externHelpers[fn] == nil {
+		printRed("'%s' isn't implemented by an external process\n", args[0])
+		return
+	}
+
+	stopExternHelper(fn)
+	fmt.Printf("'%s' no longer implemented by an external process\n", helperdata.Signatures[fn].Name)
+}
@@ -0,0 +1,222 @@
+package debug
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	prompt "github.com/c-bata/go-prompt"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/mimic"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+var cmdGlobals = Command{
+	Name:    "globals",
+	Aliases: []string{"global", "g"},
+	Summary: "Show or modify global variables",
+	Description: "Global variables are stored in the .data, .rodata and .bss maps. This command uses the BTF of these " +
+		"maps to show each global variable with its name, type and current value.",
+	Exec: globalsListExec,
+	Subcommands: []Command{
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Summary: "Lists all global variables and their values",
+			Exec:    globalsListExec,
+		},
+		{
+			Name:    "set",
+			Summary: "Set the value of a global variable",
+			Description: "Set the value of a global variable. The value can be a decimal number or a hex string " +
+				"prefixed with '0x'. Decimal numbers can only be used for variables of 1, 2, 4 or 8 bytes.",
+			Exec: globalsSetExec,
+			Args: []CmdArg{
+				{
+					Name:     "variable name",
+					Required: true,
+				},
+				{
+					Name:     "value",
+					Required: true,
+				},
+			},
+			CustomCompletion: globalCompletion,
+		},
+	},
+}
+
+// globalVar describes a single global variable within a data section map
+type globalVar struct {
+	mapName string
+	m       mimic.LinuxMap
+	v       *btf.Var
+	offset  uint32
+	size    uint32
+}
+
+// globalVars returns all global variables of all loaded maps which have a BTF Datasec as value type.
+func globalVars() []globalVar {
+	mapNames := make([]string, 0, len(vmEmulator.Maps))
+	for name := range vmEmulator.Maps {
+		mapNames = append(mapNames, name)
+	}
+	sort.Strings(mapNames)
+
+	var vars []globalVar
+	for _, name := range mapNames {
+		m := vmEmulator.Maps[name]
+		ds, ok := m.GetSpec().Value.(*btf.Datasec)
+		if !ok {
+			continue
+		}
+
+		for _, vsi := range ds.Vars {
+			v, ok := vsi.Type.(*btf.Var)
+			if !ok {
+				continue
+			}
+
+			vars = append(vars, globalVar{
+				mapName: name,
+				m:       m,
+				v:       v,
+				offset:  vsi.Offset,
+				size:    vsi.Size,
+			})
+		}
+	}
+
+	return vars
+}
+
+// globalVarMem returns the virtual memory in which the data section of the variable is stored and the offset of
+// the variable within that memory.
+func globalVarMem(gv globalVar) (mimic.VMMem, uint32, error) {
+	// Data section maps are single element arrays, so the whole section is stored at key 0
+	key := make([]byte, gv.m.GetSpec().KeySize)
+	valPtr, err := gv.m.Lookup(key, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("lookup map: %w", err)
+	}
+
+	entry, off, found := vm.MemoryController.GetEntry(valPtr)
+	if !found {
+		return nil, 0, fmt.Errorf("no memory entry for value pointer 0x%08X", valPtr)
+	}
+
+	vmMem, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, 0, fmt.Errorf("value of map '%s' is not stored in virtual memory", gv.mapName)
+	}
+
+	return vmMem, off + gv.offset, nil
+}
+
+func globalsListExec(args []string) {
+	vars := globalVars()
+	if len(vars) == 0 {
+		fmt.Println("No global variables")
+		return
+	}
+
+	lastMap := ""
+	for _, gv := range vars {
+		if gv.mapName != lastMap {
+			fmt.Printf("%s:\n", green(gv.mapName))
+			lastMap = gv.mapName
+		}
+
+		vStr := gray("<unavailable>")
+		vmMem, off, err := globalVarMem(gv)
+		if err == nil {
+			val := make([]byte, gv.size)
+			if err = vmMem.Read(off, val); err == nil {
+				vStr = BtfBytesToCValue(gv.v.Type, val, 0, false)
+			}
+		}
+
+		fmt.Printf("  %s %s = %s\n",
+			blue(strings.TrimSpace(BtfToCDef(gv.v.Type, 0))),
+			gv.v.Name,
+			yellow(vStr),
+		)
+	}
+}
+
+func globalsSetExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'variable name'\n")
+		return
+	}
+
+	if len(args) < 2 {
+		printRed("Missing required argument 'value'\n")
+		return
+	}
+
+	var (
+		gv    globalVar
+		found bool
+	)
+	for _, v := range globalVars() {
+		if v.v.Name == args[0] {
+			gv = v
+			found = true
+			break
+		}
+	}
+	if !found {
+		printRed("No global variable with name '%s' exists, use 'globals' to see valid options\n", args[0])
+		return
+	}
+
+	val, err := valueFromString(args[1], int(gv.size))
+	if err != nil {
+		printRed("Error parsing value: %s\n", err)
+		return
+	}
+
+	vmMem, off, err := globalVarMem(gv)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	err = vmMem.Write(off, val)
+	if err != nil {
+		printRed("Error writing global variable: %s\n", err)
+		return
+	}
+
+	fmt.Printf("%s = %s\n", gv.v.Name, yellow(BtfBytesToCValue(gv.v.Type, val, 0, false)))
+}
+
+func globalCompletion(args []string) []prompt.Suggest {
+	var varNames []string
+	for _, gv := range globalVars() {
+		varNames = append(varNames, gv.v.Name)
+	}
+
+	if len(args) == 0 {
+		var suggestion []prompt.Suggest
+		for _, name := range varNames {
+			suggestion = append(suggestion, prompt.Suggest{
+				Text: name,
+			})
+		}
+		return suggestion
+	}
+
+	ranks := fuzzy.RankFind(args[0], varNames)
+	sort.Sort(ranks)
+
+	var suggestion []prompt.Suggest
+	for _, rank := range ranks {
+		suggestion = append(suggestion, prompt.Suggest{
+			Text: rank.Target,
+		})
+	}
+
+	return suggestion
+}
@@ -3,23 +3,42 @@ package debug
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
 	"github.com/dylandreimerink/edb/elf"
 	"github.com/dylandreimerink/mimic"
 )
 
 var cmdLoad = Command{
-	Name:        "load",
-	Aliases:     nil,
-	Summary:     "Load an ELF file",
-	Description: "This command parses the ELF file and loads all programs and maps contained within",
-	Exec:        loadExec,
+	Name:    "load",
+	Aliases: nil,
+	Summary: "Load an ELF file",
+	Description: "This command parses the ELF file and loads all programs and maps contained within.\n" +
+		"Constants in .rodata(const volatile variables) can be rewritten before loading by adding one or more " +
+		"'--const name=value' arguments. Constants set in the 'constants' section of a macro file are applied as " +
+		"well, arguments take precedence over the macro file.\n" +
+		"CO-RE programs access kernel types with the offsets of the headers they were compiled with. Adding " +
+		"'--kernel-btf {path}' applies the CO-RE relocations of the programs against the BTF of a target kernel, " +
+		"like a loader would when loading the programs into that kernel. The path can be a raw BTF file, like " +
+		"/sys/kernel/btf/vmlinux, or an ELF file with a .BTF section. Use 'core-relos' to list the relocations " +
+		"and their results. BTF with 64-bit enums, which pahole generates for kernels since 6.0, isn't supported " +
+		"yet.",
+	Exec: loadExec,
 	Args: []CmdArg{
 		{
 			Name:     "ELF file path",
 			Required: true,
 		},
+		{
+			Name:     "--const name=value",
+			Required: false,
+		},
+		{
+			Name:     "--kernel-btf path",
+			Required: false,
+		},
 	},
 	CustomCompletion: fileCompletion,
 }
@@ -31,13 +50,35 @@ func loadExec(args []string) {
 		return
 	}
 
-	coll, err := ebpf.LoadCollectionSpec(args[0])
+	path := args[0]
+	la, err := parseLoadArgs(args[1:])
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	coll, err := ebpf.LoadCollectionSpec(path)
 	if err != nil {
 		printRed("load collection: %s\n", err)
 		return
 	}
 
-	ef, err := elf.Open(args[0])
+	err = rewriteConstants(coll, la.consts)
+	if err != nil {
+		printRed("rewrite constants: %s\n", err)
+		return
+	}
+
+	var kernelBTF *btf.Spec
+	if la.kernelBTF != "" {
+		kernelBTF, err = btf.LoadSpec(la.kernelBTF)
+		if err != nil {
+			printRed("load kernel BTF: %s\n", err)
+			return
+		}
+	}
+
+	ef, err := elf.Open(path)
 	if err != nil {
 		printRed("elf new file: %s\n", err)
 		return
@@ -66,6 +107,12 @@ func loadExec(args []string) {
 			return
 		}
 
+		err = setMapContents(m, spec)
+		if err != nil {
+			printRed("error set initial map contents: %s\n", err)
+			return
+		}
+
 		fmt.Printf("loaded map '%s'\n", name)
 	}
 
@@ -80,6 +127,8 @@ func loadExec(args []string) {
 	for _, name := range elfProgNames {
 		prog := coll.Programs[name]
 
+		relocateProgram(prog, kernelBTF)
+
 		progIndex, err := vm.AddProgram(prog)
 		if err != nil {
 			printRed("vm add program: %s\n", err)
@@ -93,6 +142,7 @@ func loadExec(args []string) {
 		}
 
 		progDwarf[name] = det
+		progBTF[name] = coll.Types
 
 		fmt.Printf("Loaded program '%s' at program index %d\n", name, progIndex)
 	}
@@ -103,3 +153,156 @@ func loadExec(args []string) {
 		cmdReset.Exec(nil)
 	}
 }
+
+// sessionConstants are constants set by a macro file, they are applied to every ELF file loaded after.
+var sessionConstants = map[string]string{}
+
+// loadArgs are the optional arguments of the load command
+type loadArgs struct {
+	consts map[string]string
+	// The path of the BTF to apply CO-RE relocations against
+	kernelBTF string
+}
+
+// parseLoadArgs parses '--const name=value' and '--const=name=value' arguments into a map of names and values, and
+// the '--kernel-btf path' or '--kernel-btf=path' argument.
+func parseLoadArgs(args []string) (loadArgs, error) {
+	la := loadArgs{consts: make(map[string]string)}
+	for i := 0; i < len(args); i++ {
+		var kv string
+		switch {
+		case args[i] == "--const":
+			if i+1 >= len(args) {
+				return la, fmt.Errorf("missing name=value after '--const'")
+			}
+			i++
+			kv = args[i]
+
+		case strings.HasPrefix(args[i], "--const="):
+			kv = strings.TrimPrefix(args[i], "--const=")
+
+		case args[i] == "--kernel-btf":
+			if i+1 >= len(args) {
+				return la, fmt.Errorf("missing path after '--kernel-btf'")
+			}
+			i++
+			la.kernelBTF = args[i]
+			continue
+
+		case strings.HasPrefix(args[i], "--kernel-btf="):
+			la.kernelBTF = strings.TrimPrefix(args[i], "--kernel-btf=")
+			continue
+
+		default:
+			return la, fmt.Errorf("unexpected argument '%s'", args[i])
+		}
+
+		name, value, found := strings.Cut(kv, "=")
+		if !found || name == "" {
+			return la, fmt.Errorf("invalid constant '%s', expected name=value", kv)
+		}
+
+		la.consts[name] = value
+	}
+
+	return la, nil
+}
+
+// rewriteConstants rewrites the values of constants in the .rodata sections of the collection. Session constants
+// are only applied if the collection contains them, explicitly passed constants must exist.
+func rewriteConstants(coll *ebpf.CollectionSpec, args map[string]string) error {
+	sizes := make(map[string]uint32)
+	for name, spec := range coll.Maps {
+		if !strings.HasPrefix(name, ".rodata") {
+			continue
+		}
+
+		ds, ok := spec.Value.(*btf.Datasec)
+		if !ok {
+			continue
+		}
+
+		for _, v := range ds.Vars {
+			sizes[v.Type.TypeName()] = v.Size
+		}
+	}
+
+	values := make(map[string]string)
+	for name, value := range sessionConstants {
+		if _, found := sizes[name]; found {
+			values[name] = value
+		}
+	}
+	for name, value := range args {
+		values[name] = value
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	consts := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		size, found := sizes[name]
+		if !found {
+			return fmt.Errorf("no constant with name '%s' exists", name)
+		}
+
+		b, err := valueFromString(value, int(size))
+		if err != nil {
+			return fmt.Errorf("parse value of '%s': %w", name, err)
+		}
+
+		consts[name] = b
+	}
+
+	err := coll.RewriteConstants(consts)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		fmt.Printf("rewrote constant '%s' = %s\n", name, value)
+	}
+
+	return nil
+}
+
+// setMapContents writes the initial contents of a map as specified in the ELF. The emulator doesn't do this itself,
+// this is mainly important for data sections(.data, .rodata) which hold the initial values of global variables.
+func setMapContents(m mimic.LinuxMap, spec *ebpf.MapSpec) error {
+	if len(spec.Contents) == 0 {
+		return nil
+	}
+
+	mu, ok := m.(mimic.LinuxMapUpdater)
+	if !ok {
+		return nil
+	}
+
+	for _, kv := range spec.Contents {
+		// Only raw values can be set directly, values which refer to programs or maps by name are left to the user.
+		value, ok := kv.Value.([]byte)
+		if !ok {
+			continue
+		}
+
+		var key []byte
+		switch k := kv.Key.(type) {
+		case uint32:
+			key = make([]byte, 4)
+			mimic.GetNativeEndianness().PutUint32(key, k)
+		case []byte:
+			key = k
+		default:
+			return fmt.Errorf("unsupported key type '%T'", kv.Key)
+		}
+
+		err := mu.Update(key, value, 0, 0)
+		if err != nil {
+			return fmt.Errorf("update map: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -60,28 +60,19 @@ func listLocalVarsExec(args []string) {
 
 		fmt.Print(blue(dwarfTypeName(child)), " = ")
 
-		attrLoc := det.AttrField(e, dwarf.AttrLocation)
-		if attrLoc == nil {
+		if det.AttrField(e, dwarf.AttrLocation) == nil {
 			fmt.Println(cyan("inlined"))
 			continue
 		}
 
-		var instr []byte
-		switch attrLoc.Class {
-		case dwarf.ClassLocListPtr:
-			lle, err := det.LocListReader.Find(int(attrLoc.Val.(int64)), 0, 0, uint64(process.Registers.PC*8), nil)
-			if err != nil {
-				fmt.Println(red(err.Error()))
-				continue
-			}
-			if lle == nil {
-				fmt.Println(gray("not available"))
-				continue
-			}
-
-			instr = lle.Instr
-		case dwarf.ClassExprLoc:
-			instr = attrLoc.Val.([]byte)
+		instr, err := dwarfLocationInstr(det, e, process.Registers.PC)
+		if err != nil {
+			fmt.Println(red(err.Error()))
+			continue
+		}
+		if instr == nil {
+			fmt.Println(gray("not available"))
+			continue
 		}
 
 		// We don't have some registers, but still need to provide them
@@ -150,6 +141,32 @@ func listLocalVarsExec(args []string) {
 	}
 }
 
+// dwarfLocationInstr returns the DWARF location expression of a variable or parameter which is valid at the given PC.
+// nil is returned if the variable has no location at the given PC.
+func dwarfLocationInstr(det *DET, e *dwarf.Entry, pc int) ([]byte, error) {
+	attrLoc := det.AttrField(e, dwarf.AttrLocation)
+	if attrLoc == nil {
+		return nil, nil
+	}
+
+	switch attrLoc.Class {
+	case dwarf.ClassLocListPtr:
+		lle, err := det.LocListReader.Find(int(attrLoc.Val.(int64)), 0, 0, uint64(pc*8), nil)
+		if err != nil {
+			return nil, err
+		}
+		if lle == nil {
+			return nil, nil
+		}
+
+		return lle.Instr, nil
+	case dwarf.ClassExprLoc:
+		return attrLoc.Val.([]byte), nil
+	}
+
+	return nil, nil
+}
+
 func dwarfRegisters(r mimic.Registers) []*op.DwarfRegister {
 	var dregs []*op.DwarfRegister
 	regs := []uint64{
@@ -225,7 +242,12 @@ func DwarfToBTF(node *EntryNode) (btf.Type, error) {
 		}
 
 		var err error
-		ty, err := process.Program.BTF.AnyTypeByName(name.(string))
+		types := progBTF[process.Program.Name]
+		if types == nil {
+			return nil, fmt.Errorf("program '%s' has no BTF", process.Program.Name)
+		}
+
+		ty, err := types.AnyTypeByName(name.(string))
 		if err != nil {
 			return nil, err
 		}
@@ -254,6 +254,12 @@ func runMacroExec(args []string) {
 		return
 	}
 
+	err = mf.applyConstants()
+	if err != nil {
+		printRed("Error while applying constants: %s\n", err)
+		return
+	}
+
 	for _, m := range mf.Macros() {
 		runMacro(&Macro{
 			File:     filePath,
@@ -588,6 +594,12 @@ func loadMacroExec(args []string) {
 		return
 	}
 
+	err = mf.applyConstants()
+	if err != nil {
+		printRed("Error while applying constants: %s\n", err)
+		return
+	}
+
 	for _, m := range mf.Macros() {
 		existingMacro, exists := macroState.loadedMacros[m.Name]
 		if exists && !existingMacro.Saved {
@@ -677,6 +689,65 @@ func (fm *macroDefinition) MacroString() string {
 	return sb.String()
 }
 
+// The name of the special section in a macro file which holds constants instead of commands
+const macroConstantsName = "constants"
+
+// macroConstants represents the constants section of a macro file. Each line is a name=value pair or a comment.
+// The constants are used to rewrite .rodata constants of any ELF file loaded after the macro file.
+type macroConstants struct {
+	Lines []string
+}
+
+func (mc *macroConstants) MacroString() string {
+	md := macroDefinition{
+		Name:     macroConstantsName,
+		Commands: mc.Lines,
+	}
+	return md.MacroString()
+}
+
+// Constants returns the name value pairs of the section, skipping comments.
+func (mc *macroConstants) Constants() (map[string]string, error) {
+	consts := make(map[string]string)
+	for _, line := range mc.Lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid constant '%s', expected name=value", line)
+		}
+
+		consts[name] = strings.TrimSpace(value)
+	}
+
+	return consts, nil
+}
+
+// applyConstants adds the constants of all constant sections in the file to the session constants.
+func (mf *macroFile) applyConstants() error {
+	for _, p := range mf.Parts {
+		mc, ok := p.(*macroConstants)
+		if !ok {
+			continue
+		}
+
+		consts, err := mc.Constants()
+		if err != nil {
+			return err
+		}
+
+		for name, value := range consts {
+			sessionConstants[name] = value
+			fmt.Printf("Constant '%s' set to %s\n", name, value)
+		}
+	}
+
+	return nil
+}
+
 // Macro comment is a line of comments, starting with a # or //, though only the # version is written back.
 // Empty comments are allowed to add spacing of a sort
 type macroComment string
@@ -691,6 +762,17 @@ func parseMacroFile(r io.Reader) (*macroFile, error) {
 	var macroFile macroFile
 	var curMacroDef *macroDefinition
 	firstLine := true
+
+	// submit adds the current macro definition to the file, the constants section is parsed like a macro, but
+	// added as its own part.
+	submit := func() {
+		if curMacroDef.Name == macroConstantsName {
+			macroFile.Parts = append(macroFile.Parts, &macroConstants{Lines: curMacroDef.Commands})
+		} else {
+			macroFile.Parts = append(macroFile.Parts, curMacroDef)
+		}
+		curMacroDef = nil
+	}
 	for {
 		line, _, err := br.ReadLine()
 		if err != nil {
@@ -719,8 +801,7 @@ func parseMacroFile(r io.Reader) (*macroFile, error) {
 		if lineStr == "" {
 			// If there is a current macro, submit it
 			if curMacroDef != nil {
-				macroFile.Parts = append(macroFile.Parts, curMacroDef)
-				curMacroDef = nil
+				submit()
 			}
 
 			continue
@@ -749,7 +830,7 @@ func parseMacroFile(r io.Reader) (*macroFile, error) {
 		if strings.HasSuffix(lineStr, ":") {
 			// If there is a current macro, submit it
 			if curMacroDef != nil {
-				macroFile.Parts = append(macroFile.Parts, curMacroDef)
+				submit()
 			}
 
 			// Make new part with new name
@@ -768,7 +849,7 @@ func parseMacroFile(r io.Reader) (*macroFile, error) {
 
 	// If there still is a pending macro, submit it
 	if curMacroDef != nil {
-		macroFile.Parts = append(macroFile.Parts, curMacroDef)
+		submit()
 	}
 
 	return &macroFile, nil
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/cilium/ebpf"
+	"github.com/dylandreimerink/edb/pkg/mapdump"
 	"github.com/dylandreimerink/mimic"
 )
 
@@ -65,6 +66,27 @@ var cmdMap = Command{
 					Required: true,
 				},
 			},
+			Description: "Set a value at a particular spot in a map.\n" +
+				"For map-in-map types the value is the name of a map, the address of which will be stored.\n" +
+				"For program arrays the value is the name or index of a program, as shown by 'programs list'.",
+		},
+		{
+			Name:    "create-inner",
+			Summary: "Create a new inner map and insert it into a map-in-map",
+			Description: "This command creates a new map from the inner map specification of a map-in-map and stores it " +
+				"in the outer map at the given key. The new map is named after the outer map and key, the name is " +
+				"printed so the inner map can be populated with 'map set'.",
+			Exec: mapCreateInnerExec,
+			Args: []CmdArg{
+				{
+					Name:     "outer map name",
+					Required: true,
+				},
+				{
+					Name:     "key",
+					Required: true,
+				},
+			},
 		},
 		{
 			Name:    "del",
@@ -109,6 +131,22 @@ var cmdMap = Command{
 				},
 			},
 		},
+		{
+			Name:    "load",
+			Summary: "Set map contents from a map dump file",
+			Description: "This command writes the entries of a map dump, as written by " +
+				"'edb capture-context --dump-maps', into the loaded maps with the same names. Entries which are not in " +
+				"the dump are kept. Per-CPU values are written to the CPUs of the emulator, values of CPUs beyond the " +
+				"CPUs of the emulator are ignored.",
+			Exec: mapLoadExec,
+			Args: []CmdArg{
+				{
+					Name:     "dump file",
+					Required: true,
+				},
+			},
+			CustomCompletion: fileCompletion,
+		},
 	},
 }
 
@@ -209,6 +247,10 @@ func mapGetExec(args []string) {
 					vStr = fmt.Sprintf("%s -> <%s>", vStr, green(entry.Name))
 				}
 
+			case ebpf.StackTrace:
+				// Stack trace values are arrays of instruction pointers
+				vStr = yellow(stackTraceString(vVal))
+
 			default:
 				// TODO format the bytes using BTF type
 			}
@@ -279,6 +321,8 @@ func mapReadAllExec(args []string) {
 					if found {
 						vStr = fmt.Sprintf("%s -> <%s>", vStr, green(entry.Name))
 					}
+				case ebpf.StackTrace:
+					vStr = yellow(stackTraceString(vVal))
 				default:
 					if spec.Value != nil {
 						vStr = yellow(BtfBytesToCValue(spec.Value, vVal, 0, false))
@@ -352,22 +396,23 @@ func mapSetExec(args []string) {
 		mimic.GetNativeEndianness().PutUint32(vv, entry.Addr)
 
 	case ebpf.ProgramArray:
-		for _, prog := range vm.GetPrograms() {
-			if prog.Name != args[2] {
-				continue
-			}
-
-			entry, found := vm.MemoryController.GetEntryByObject(prog)
-			if !found {
-				printRed("Error can't memory entry for program '%s'\n", args[2])
-				return
-			}
+		// For program arrays, the name or index of a program should be input as value.
+		// We will then actually set the addr of that program.
+		prog, err := nameOrIndexToProgram(args[2])
+		if err != nil {
+			printRed("%s\n", err)
+			return
+		}
 
-			vv = make([]byte, 4)
-			mimic.GetNativeEndianness().PutUint32(vv, entry.Addr)
-			break
+		entry, found := vm.MemoryController.GetEntryByObject(prog)
+		if !found {
+			printRed("Error can't memory entry for program '%s'\n", prog.Name)
+			return
 		}
 
+		vv = make([]byte, 4)
+		mimic.GetNativeEndianness().PutUint32(vv, entry.Addr)
+
 	default:
 		vv, err = valueFromString(args[2], int(valueSize))
 		if err != nil {
@@ -385,6 +430,89 @@ func mapSetExec(args []string) {
 	fmt.Println("Map value written")
 }
 
+func mapCreateInnerExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'outer map name'\n")
+		return
+	}
+
+	if len(args) < 2 {
+		printRed("Missing required argument 'key'\n")
+		return
+	}
+
+	outer, err := nameToMap(args[0])
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	outerSpec := outer.GetSpec()
+	if outerSpec.Type != ebpf.ArrayOfMaps && outerSpec.Type != ebpf.HashOfMaps {
+		printRed("Map '%s' is of type '%s', not a map-in-map\n", args[0], outerSpec.Type)
+		return
+	}
+
+	if outerSpec.InnerMap == nil {
+		printRed("Map '%s' has no inner map specification\n", args[0])
+		return
+	}
+
+	mu, ok := outer.(mimic.LinuxMapUpdater)
+	if !ok {
+		printRed("Can't update map of this type\n")
+		return
+	}
+
+	kv, err := valueFromString(args[1], int(outerSpec.KeySize))
+	if err != nil {
+		printRed("Error parsing key: %s\n", err)
+		return
+	}
+
+	// Map names must be unique within the emulator, so derive a name from the outer map and the key, and append a
+	// sequence number if the name is already taken(for example when a inner map is replaced).
+	name := fmt.Sprintf("%s-inner-%s", args[0], args[1])
+	for i := 1; ; i++ {
+		if _, found := vmEmulator.Maps[name]; !found {
+			break
+		}
+		name = fmt.Sprintf("%s-inner-%s-%d", args[0], args[1], i)
+	}
+
+	innerSpec := outerSpec.InnerMap.Copy()
+	innerSpec.Name = name
+
+	inner, err := mimic.MapSpecToLinuxMap(innerSpec)
+	if err != nil {
+		printRed("Error map spec to linux map: %s\n", err)
+		return
+	}
+
+	err = vmEmulator.AddMap(name, inner)
+	if err != nil {
+		printRed("Error add map to emulator: %s\n", err)
+		return
+	}
+
+	entry, found := vm.MemoryController.GetEntryByObject(inner)
+	if !found {
+		printRed("Error can't memory entry for map '%s'\n", name)
+		return
+	}
+
+	vv := make([]byte, 4)
+	mimic.GetNativeEndianness().PutUint32(vv, entry.Addr)
+
+	err = mu.Update(kv, vv, 0, 0)
+	if err != nil {
+		printRed("Error updating map: %s\n", err)
+		return
+	}
+
+	fmt.Printf("Created inner map '%s'\n", green(name))
+}
+
 func mapDelExec(args []string) {
 	if len(args) < 1 {
 		printRed("Missing required argument 'map name'\n")
@@ -530,6 +658,72 @@ func mapPopExec(args []string) {
 	fmt.Printf("%s\n", yellow(vStr))
 }
 
+func mapLoadExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'dump file'\n")
+		return
+	}
+
+	dump, err := mapdump.DecodeFile(args[0])
+	if err != nil {
+		printRed("Error reading map dump: %s\n", err)
+		return
+	}
+
+	for _, dm := range dump.Maps {
+		m, found := vmEmulator.Maps[dm.Name]
+		if !found {
+			printRed("Skipping map '%s', no map with this name is loaded\n", dm.Name)
+			continue
+		}
+
+		spec := m.GetSpec()
+		if spec.KeySize != dm.KeySize || spec.ValueSize != dm.ValueSize {
+			printRed("Skipping map '%s', key or value size differs from the loaded map\n", dm.Name)
+			continue
+		}
+
+		mu, ok := m.(mimic.LinuxMapUpdater)
+		if !ok {
+			printRed("Skipping map '%s', can't update map of type '%s'\n", dm.Name, spec.Type)
+			continue
+		}
+
+		err = setMapEntries(m, mu, dm.Entries)
+		if err != nil {
+			printRed("Error loading map '%s': %s\n", dm.Name, err)
+			continue
+		}
+
+		fmt.Printf("loaded %d entries into map '%s'\n", len(dm.Entries), dm.Name)
+	}
+}
+
+func setMapEntries(m mimic.LinuxMap, mu mimic.LinuxMapUpdater, entries []mapdump.Entry) error {
+	for _, e := range entries {
+		if e.Values == nil {
+			err := mu.Update(e.Key, e.Value, 0, 0)
+			if err != nil {
+				return fmt.Errorf("update key %X: %w", e.Key, err)
+			}
+			continue
+		}
+
+		for cpu, v := range e.Values {
+			if cpu >= m.Indices() {
+				break
+			}
+
+			err := mu.Update(e.Key, v, 0, cpu)
+			if err != nil {
+				return fmt.Errorf("update key %X, CPU %d: %w", e.Key, cpu, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func nameToMap(name string) (mimic.LinuxMap, error) {
 	m, found := vmEmulator.Maps[name]
 	if !found {
@@ -539,6 +733,28 @@ func nameToMap(name string) (mimic.LinuxMap, error) {
 	return m, nil
 }
 
+// nameOrIndexToProgram returns the program with the given name, or if no program has that name and the string is a
+// number, the program at that index.
+func nameOrIndexToProgram(str string) (*ebpf.ProgramSpec, error) {
+	programs := vm.GetPrograms()
+	for _, prog := range programs {
+		if prog.Name == str {
+			return prog, nil
+		}
+	}
+
+	index, err := strconv.Atoi(str)
+	if err != nil {
+		return nil, fmt.Errorf("No program with name '%s' exists, use 'programs list' to see valid options", str)
+	}
+
+	if index < 0 || index >= len(programs) {
+		return nil, fmt.Errorf("No program with index '%d' exists, use 'programs list' to see valid options", index)
+	}
+
+	return programs[index], nil
+}
+
 func valueFromString(str string, size int) ([]byte, error) {
 	if strings.HasPrefix(str, "0x") {
 		b, err := hex.DecodeString(strings.TrimPrefix(str, "0x"))
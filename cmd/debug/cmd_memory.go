@@ -1,10 +1,14 @@
 package debug
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
-	"math"
 	"strconv"
+	"strings"
 
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
 	"github.com/dylandreimerink/mimic"
 )
 
@@ -22,18 +26,44 @@ var cmdMemory = Command{
 		{
 			Name:    "read",
 			Summary: "Read the contents of a specific virtual address",
-			Args: []CmdArg{{
-				Name:     "memory block name|memory address",
-				Required: true,
-			}},
+			Description: "Read the contents of memory. The location can be a memory block name, memory address or register, " +
+				"optionally followed by an offset like 'xdp_md+4' or '0x1000+16'. If a length is given, only that many " +
+				"bytes are shown, otherwise the whole memory block is shown.\n" +
+				"Adding 'as <btf type>' decodes the memory as a type from the BTF of the current program, for " +
+				"example 'memory read r1 as struct xdp_md'. If both a length and type are given, the memory is " +
+				"decoded as an array of that type.",
+			Args: []CmdArg{
+				{
+					Name:     "memory block name|memory address|register[+offset]",
+					Required: true,
+				},
+				{
+					Name:     "length",
+					Required: false,
+				},
+				{
+					Name:     "as {btf type}",
+					Required: false,
+				},
+			},
 			Exec: readMemoryExec,
-			// TODO add second argument, allowing the user to specify a range of memory to inspect
 		},
 		{
 			Name:    "read-all",
 			Summary: "Read and show the whole contents of addressable memory",
 			Exec:    readAllMemoryExec,
 		},
+		{
+			Name:    "find",
+			Summary: "Search all memory for a byte pattern or string",
+			Description: "Search all memory for a pattern. A pattern starting with '0x' is interpreted as hex " +
+				"encoded bytes, any other pattern is searched for as string.",
+			Args: []CmdArg{{
+				Name:     "pattern",
+				Required: true,
+			}},
+			Exec: findMemoryExec,
+		},
 	},
 }
 
@@ -46,51 +76,114 @@ func listMemoryExec(args []string) {
 	}
 }
 
-func readMemoryExec(args []string) {
-	if len(args) < 1 {
-		printRed("missing required argument 'memory block name|memory address'\n")
-		return
-	}
-
+// parseMemoryLocation parses a memory location in the form of '<addr|name|register>[+off]' and returns the memory
+// entry and the offset within that entry. The returned bool is true if the user explicitly specified an offset.
+func parseMemoryLocation(loc string) (mimic.MemoryEntry, uint32, bool, error) {
+	base := loc
 	var (
-		entry  mimic.MemoryEntry
-		offset = uint32(math.MaxUint32)
+		extraOff uint32
+		hasOff   bool
 	)
+	if i := strings.LastIndex(loc, "+"); i > 0 {
+		if off, err := strconv.ParseUint(loc[i+1:], 0, 32); err == nil {
+			base = loc[:i]
+			extraOff = uint32(off)
+			hasOff = true
+		}
+	}
+
+	// Registers can be used as location as well, in which case their value is used as address
+	if process != nil && strings.HasPrefix(base, "r") {
+		if reg, err := strconv.Atoi(strings.TrimPrefix(base, "r")); err == nil && reg >= 0 && reg <= 10 {
+			base = strconv.FormatUint(process.Registers.Get(asm.Register(reg)), 10)
+		}
+	}
 
-	if num, err := strconv.ParseInt(args[0], 0, 64); err == nil {
-		fmt.Println(num)
-		var found bool
-		entry, offset, found = process.VM.MemoryController.GetEntry(uint32(num))
+	if num, err := strconv.ParseUint(base, 0, 32); err == nil {
+		entry, offset, found := vm.MemoryController.GetEntry(uint32(num) + extraOff)
 		if !found {
-			printRed("unable to find memory entry for '%s'\n", args[0])
-			return
+			return mimic.MemoryEntry{}, 0, false, fmt.Errorf("unable to find memory entry for '%s'", loc)
 		}
-	} else {
-		memoryEntries := vm.MemoryController.GetAllEntries()
 
-		for _, e := range memoryEntries {
-			if e.Name == args[0] {
-				entry = e
-				break
+		return entry, offset, hasOff, nil
+	}
+
+	for _, e := range vm.MemoryController.GetAllEntries() {
+		if e.Name == base {
+			if extraOff >= e.Size {
+				return mimic.MemoryEntry{}, 0, false, fmt.Errorf(
+					"offset %d is outside of memory entry '%s' of %d bytes", extraOff, e.Name, e.Size,
+				)
 			}
+
+			return e, extraOff, hasOff, nil
 		}
 	}
 
-	if entry.Object == nil {
-		printRed("unable to find memory entry for '%s'\n", args[0])
+	return mimic.MemoryEntry{}, 0, false, fmt.Errorf("unable to find memory entry for '%s'", loc)
+}
+
+func readMemoryExec(args []string) {
+	if len(args) < 1 {
+		printRed("missing required argument 'memory block name|memory address|register[+offset]'\n")
 		return
 	}
 
+	// Split off the 'as <type>' part of the arguments
+	var typeName string
+	for i, arg := range args {
+		if arg == "as" {
+			typeName = strings.Join(args[i+1:], " ")
+			if typeName == "" {
+				printRed("missing type name after 'as'\n")
+				return
+			}
+			args = args[:i]
+			break
+		}
+	}
+
+	entry, offset, explicitOff, err := parseMemoryLocation(args[0])
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	length := -1
+	if len(args) >= 2 {
+		l, err := strconv.ParseUint(args[1], 0, 32)
+		if err != nil {
+			printRed("invalid length '%s'\n", args[1])
+			return
+		}
+		length = int(l)
+	}
+
 	fmt.Printf("%s:\n", green(entry.Name))
-	fmt.Print(blue(fmt.Sprintf("0x%08X ", entry.Addr)))
 
-	// If obj implements stringer, print the string
-	if str, ok := entry.Object.(fmt.Stringer); ok {
-		fmt.Println(str)
+	vmMem, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		fmt.Print(blue(fmt.Sprintf("0x%08X ", entry.Addr)))
+
+		// If obj implements stringer, print the string
+		if str, ok := entry.Object.(fmt.Stringer); ok {
+			fmt.Println(str)
+			return
+		}
+
+		// Not a stringer, not VMMem, just print the type and pointer
+		fmt.Printf("-> (%T)(%p)\n\n", entry.Object, entry.Object)
+		return
+	}
+
+	if typeName != "" {
+		readMemoryAsType(vmMem, entry, offset, length, typeName)
 		return
 	}
 
-	if vmMem, ok := entry.Object.(mimic.VMMem); ok {
+	// If no length was given and the user didn't point within the entry, show the whole entry and highlight the
+	// 8 bytes at the offset, like we would for a pointer.
+	if length == -1 && !explicitOff {
 		mem := make([]byte, entry.Size)
 		err := vmMem.Read(0, mem)
 		if err != nil {
@@ -98,26 +191,162 @@ func readMemoryExec(args []string) {
 			return
 		}
 
-		for j := 0; j < len(mem); j++ {
-			// Color 8 bytes of the offset green
-			if j >= int(offset) && j < int(offset)+8 {
+		hexdump(entry.Addr, mem, int(offset), 8)
+		printMemorySymbols(entry, 0, mem)
+		fmt.Print("\n")
+		return
+	}
+
+	if length == -1 || offset+uint32(length) > entry.Size {
+		length = int(entry.Size - offset)
+	}
+
+	mem := make([]byte, length)
+	err = vmMem.Read(offset, mem)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	hexdump(entry.Addr+offset, mem, -1, 0)
+	printMemorySymbols(entry, offset, mem)
+	fmt.Print("\n")
+}
+
+// readMemoryAsType decodes memory as a BTF type from the current program.
+func readMemoryAsType(vmMem mimic.VMMem, entry mimic.MemoryEntry, offset uint32, length int, typeName string) {
+	t, err := btfTypeByName(typeName)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	size, err := btf.Sizeof(t)
+	if err != nil {
+		printRed("sizeof '%s': %s\n", typeName, err)
+		return
+	}
+	if size == 0 {
+		printRed("type '%s' has no size\n", typeName)
+		return
+	}
+
+	count := 1
+	if length > size {
+		count = length / size
+	}
+
+	for i := 0; i < count; i++ {
+		off := offset + uint32(i*size)
+		if off+uint32(size) > entry.Size {
+			printRed("%s at offset %d doesn't fit in memory entry of %d bytes\n", typeName, off, entry.Size)
+			return
+		}
+
+		mem := make([]byte, size)
+		err = vmMem.Read(off, mem)
+		if err != nil {
+			printRed("%s\n", err)
+			return
+		}
+
+		fmt.Print(blue(fmt.Sprintf("0x%08X ", entry.Addr+off)))
+		fmt.Println(yellow(BtfBytesToCValue(t, mem, 0, true)))
+	}
+}
+
+// btfTypeByName finds a type in the BTF of the current program, or the entrypoint if no program is running.
+// Names can be prefixed with 'struct', 'union' or 'enum' to disambiguate between types with the same name.
+func btfTypeByName(name string) (btf.Type, error) {
+	progs := vm.GetPrograms()
+	if len(progs) == 0 {
+		return nil, fmt.Errorf("no programs loaded")
+	}
+
+	prog := progs[entrypoint]
+	if process != nil {
+		prog = process.Program
+	}
+
+	types := progBTF[prog.Name]
+	if types == nil {
+		return nil, fmt.Errorf("program '%s' has no BTF", prog.Name)
+	}
+
+	var kind string
+	fields := strings.Fields(name)
+	if len(fields) == 2 {
+		kind = fields[0]
+		name = fields[1]
+	}
+
+	candidates, err := types.AnyTypesByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("find type '%s': %w", name, err)
+	}
+
+	for _, t := range candidates {
+		switch t.(type) {
+		case *btf.Struct:
+			if kind == "" || kind == "struct" {
+				return t, nil
+			}
+		case *btf.Union:
+			if kind == "" || kind == "union" {
+				return t, nil
+			}
+		case *btf.Enum:
+			if kind == "" || kind == "enum" {
+				return t, nil
+			}
+		case *btf.Func, *btf.FuncProto, *btf.Var, *btf.Datasec, *btf.Fwd:
+			// Not a type which can describe memory
+		default:
+			if kind == "" {
+				return t, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no type with name '%s' found in BTF of '%s'", name, prog.Name)
+}
+
+// hexdump prints memory in a xxd like format, with 16 bytes per line followed by an ASCII column. The bytes between
+// highlightStart and highlightStart+highlightLen are printed in green.
+func hexdump(addr uint32, mem []byte, highlightStart, highlightLen int) {
+	for i := 0; i < len(mem); i += 16 {
+		fmt.Print(blue(fmt.Sprintf("0x%08X ", addr+uint32(i))))
+
+		var ascii strings.Builder
+		for j := i; j < i+16; j++ {
+			if j >= len(mem) {
+				// Pad the last line so the ASCII column lines up
+				fmt.Print("   ")
+				if j%8 == 7 {
+					fmt.Print(" ")
+				}
+				continue
+			}
+
+			if j >= highlightStart && j < highlightStart+highlightLen {
 				fmt.Print(green(fmt.Sprintf("%02X ", mem[j])))
 			} else {
 				fmt.Printf("%02X ", mem[j])
 			}
 
-			if j%16 == 15 {
-				fmt.Printf("\n%s ", blue(fmt.Sprintf("0x%08X", entry.Addr+uint32(j))))
-			} else if j%8 == 7 {
+			if j%8 == 7 {
 				fmt.Print(" ")
 			}
+
+			if mem[j] >= 0x20 && mem[j] < 0x7F {
+				ascii.WriteByte(mem[j])
+			} else {
+				ascii.WriteByte('.')
+			}
 		}
-		fmt.Print("\n\n")
-		return
-	}
 
-	// Not a stringer, not VMMem, just print the type and pointer
-	fmt.Printf("-> (%T)(%p)\n\n", entry.Object, entry.Object)
+		fmt.Printf("|%s|\n", ascii.String())
+	}
 }
 
 func readAllMemoryExec(args []string) {
@@ -125,13 +354,6 @@ func readAllMemoryExec(args []string) {
 
 	for _, entry := range memoryEntries {
 		fmt.Printf("%s:\n", green(entry.Name))
-		fmt.Print(blue(fmt.Sprintf("0x%08X ", entry.Addr)))
-
-		// If obj implements stringer, print the string
-		if str, ok := entry.Object.(fmt.Stringer); ok {
-			fmt.Println(str)
-			continue
-		}
 
 		if vmMem, ok := entry.Object.(mimic.VMMem); ok {
 			mem := make([]byte, entry.Size)
@@ -141,15 +363,16 @@ func readAllMemoryExec(args []string) {
 				return
 			}
 
-			for j := 0; j < len(mem); j++ {
-				fmt.Printf("%02X ", mem[j])
-				if j%16 == 15 {
-					fmt.Printf("\n%s ", blue(fmt.Sprintf("0x%08X", entry.Addr+uint32(j))))
-				} else if j%8 == 7 {
-					fmt.Print(" ")
-				}
-			}
-			fmt.Print("\n\n")
+			hexdump(entry.Addr, mem, -1, 0)
+			fmt.Print("\n")
+			continue
+		}
+
+		fmt.Print(blue(fmt.Sprintf("0x%08X ", entry.Addr)))
+
+		// If obj implements stringer, print the string
+		if str, ok := entry.Object.(fmt.Stringer); ok {
+			fmt.Println(str)
 			continue
 		}
 
@@ -157,3 +380,69 @@ func readAllMemoryExec(args []string) {
 		fmt.Printf("-> (%T)(%p)\n\n", entry.Object, entry.Object)
 	}
 }
+
+func findMemoryExec(args []string) {
+	if len(args) < 1 || args[0] == "" {
+		printRed("missing required argument 'pattern'\n")
+		return
+	}
+
+	pattern := []byte(strings.Join(args, " "))
+	if strings.HasPrefix(args[0], "0x") {
+		var err error
+		pattern, err = hex.DecodeString(strings.TrimPrefix(args[0], "0x"))
+		if err != nil {
+			printRed("invalid hex pattern: %s\n", err)
+			return
+		}
+		if len(pattern) == 0 {
+			printRed("empty pattern\n")
+			return
+		}
+	}
+
+	matches := 0
+	for _, entry := range vm.MemoryController.GetAllEntries() {
+		vmMem, ok := entry.Object.(mimic.VMMem)
+		if !ok {
+			continue
+		}
+
+		mem := make([]byte, entry.Size)
+		err := vmMem.Read(0, mem)
+		if err != nil {
+			continue
+		}
+
+		for off := 0; off < len(mem); {
+			i := bytes.Index(mem[off:], pattern)
+			if i == -1 {
+				break
+			}
+			off += i
+			matches++
+
+			fmt.Printf("%s %s\n",
+				blue(fmt.Sprintf("0x%08X", entry.Addr+uint32(off))),
+				fmt.Sprintf("<%s+%d>", green(entry.Name), off),
+			)
+
+			// Show the line of memory containing the match, highlighting the match itself
+			lineStart := off - off%16
+			lineEnd := lineStart + 16
+			if lineEnd > len(mem) {
+				lineEnd = len(mem)
+			}
+			hexdump(entry.Addr+uint32(lineStart), mem[lineStart:lineEnd], off-lineStart, len(pattern))
+
+			off++
+		}
+	}
+
+	if matches == 0 {
+		fmt.Println("Pattern not found")
+		return
+	}
+
+	fmt.Printf("\n%d matches found\n", matches)
+}
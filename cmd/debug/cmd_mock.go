@@ -0,0 +1,699 @@
+package debug
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	prompt "github.com/c-bata/go-prompt"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/argexpr"
+	"github.com/dylandreimerink/edb/pkg/helperdata"
+	"github.com/dylandreimerink/mimic"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+var cmdMock = Command{
+	Name:    "mock",
+	Summary: "Mock the return values of helper functions",
+	Description: "Some helper functions return different values on every run, like bpf_ktime_get_ns, " +
+		"bpf_get_prandom_u32 or bpf_get_current_pid_tgid, which makes programs behave differently every time they " +
+		"are executed. Mocked helpers return user defined values instead, so runs, including 'continue-all' runs, " +
+		"are reproducible. Helpers are named by their C name, with or without 'bpf_' prefix, or by number.\n" +
+		"\n" +
+		"Mocks only set the return value, memory passed to the helper isn't written. Mocks are used instead of " +
+		"the emulator, so the results of helper calls in captured contexts are ignored for mocked helpers.",
+	Subcommands: []Command{
+		{
+			Name:    "set",
+			Summary: "Mock a helper function",
+			Description: "The following kinds of mocks exist:\n" +
+				"  const {value}                 - Always return the value\n" +
+				"  seq {value} [value...]        - Return the values in order, starting over after the last value\n" +
+				"  ctx {value} [value...]        - Return the Nth value for the Nth context, the last value for " +
+				"contexts beyond the list\n" +
+				"  expr {expression}             - Return the result of a C-like expression over the arguments\n" +
+				"  clock [start] [step] [ctx step] - Return a time in nanoseconds, which starts at 'start' for the " +
+				"first context and 'start' + N * 'ctx step' for the Nth context, and increases by 'step' every call. " +
+				"The defaults are 0, 1000 and 1000000\n" +
+				"  rng [seed]                    - Return pseudo random numbers, every context gets its own " +
+				"sequence which only depends on the seed and the index of the context. The default seed is 0\n" +
+				"  sym {symbol name}             - Return the address of a kernel symbol, which requires a symbol " +
+				"table, see 'help symbols load'. For example to mock bpf_get_func_ip for a kprobe\n" +
+				"\n" +
+				"Values are decimal, hex(0x), octal(0o) or binary(0b) numbers and can be negative. Expressions can use " +
+				"the arguments as r1-r5 and by their parameter names, 'ctx' for the index of the current context and " +
+				"'n' for the number of earlier calls to the helper in the current run. For example, to fail the " +
+				"lookup of bpf_fib_lookup unless the BPF_FIB_LOOKUP_DIRECT flag is set:\n" +
+				"  mock set bpf_fib_lookup expr \"flags & 1 ? 0 : 7\"",
+			Exec: setMockExec,
+			Args: []CmdArg{
+				{
+					Name:     "helper",
+					Required: true,
+				},
+				{
+					Name:     "const|seq|ctx|expr|clock|rng|sym",
+					Required: true,
+				},
+				{
+					Name:     "values",
+					Required: false,
+				},
+			},
+			CustomCompletion: mockHelperCompletion,
+		},
+		{
+			Name:    "clock",
+			Summary: "Use a deterministic clock for all bpf_ktime_get_*_ns helpers",
+			Description: "This is shorthand for 'mock set {helper} clock' for bpf_ktime_get_ns, bpf_ktime_get_boot_ns " +
+				"and bpf_ktime_get_coarse_ns. See 'help mock set' for the meaning of the arguments.",
+			Exec: clockMockExec,
+			Args: []CmdArg{
+				{
+					Name:     "start",
+					Required: false,
+				},
+				{
+					Name:     "step",
+					Required: false,
+				},
+				{
+					Name:     "ctx step",
+					Required: false,
+				},
+			},
+		},
+		{
+			Name:    "rng",
+			Summary: "Use a seeded random number generator for bpf_get_prandom_u32",
+			Description: "This is shorthand for 'mock set bpf_get_prandom_u32 rng'. See 'help mock set' for the " +
+				"meaning of the seed.",
+			Exec: rngMockExec,
+			Args: []CmdArg{{
+				Name:     "seed",
+				Required: false,
+			}},
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Summary: "List all mocked helper functions",
+			Exec:    listMockExec,
+		},
+		{
+			Name:    "clear",
+			Summary: "Remove the mock of a helper function, or all mocks if no helper is given",
+			Exec:    clearMockExec,
+			Args: []CmdArg{{
+				Name:     "helper",
+				Required: false,
+			}},
+			CustomCompletion: mockHelperCompletion,
+		},
+		{
+			Name:    "load",
+			Summary: "Load mocks from a file",
+			Description: "Mock files are JSON files with a 'mocks' section, which is an array of mocks. Each mock has " +
+				"a 'helper' name and one of the following:\n" +
+				"  \"const\": value\n" +
+				"  \"seq\": [value, ...]\n" +
+				"  \"ctx\": [value, ...]\n" +
+				"  \"expr\": \"expression\"\n" +
+				"  \"clock\": {\"start\": value, \"step\": value, \"ctxStep\": value}\n" +
+				"  \"rng\": {\"seed\": value}\n" +
+				"  \"sym\": \"symbol name\"\n" +
+				"\n" +
+				"Values are numbers or strings, so hex values like \"0xFF\" can be used. For example:\n" +
+				"  {\"mocks\": [\n" +
+				"    {\"helper\": \"bpf_get_smp_processor_id\", \"const\": 2},\n" +
+				"    {\"helper\": \"bpf_ktime_get_ns\", \"clock\": {\"start\": 1000000000, \"step\": 1000}},\n" +
+				"    {\"helper\": \"bpf_get_prandom_u32\", \"rng\": {\"seed\": 42}}\n" +
+				"  ]}\n" +
+				"\n" +
+				"The mocks of the file replace existing mocks of the same helpers. The file can also be given with " +
+				"the --mocks flag of 'edb debug'.",
+			Exec: loadMockExec,
+			Args: []CmdArg{{
+				Name:     "file path",
+				Required: true,
+			}},
+			CustomCompletion: fileCompletion,
+		},
+		{
+			Name:    "save",
+			Summary: "Save all mocks to a file",
+			Exec:    saveMockExec,
+			Args: []CmdArg{{
+				Name:     "file path",
+				Required: true,
+			}},
+			CustomCompletion: fileCompletion,
+		},
+	},
+}
+
+// mocks are the mocked helper functions, they take precedence over helperOverrides and the emulator
+var mocks = map[asm.BuiltinFunc]*helperMock{}
+
+// mockCalls counts the calls to mocked helpers of the current process, the counts are reset when a new process is
+// started.
+var mockCalls struct {
+	process *mimic.Process
+	counts  map[asm.BuiltinFunc]int
+}
+
+// mockFile is the format of mock files
+type mockFile struct {
+	Mocks []mockSpec `json:"mocks"`
+}
+
+// mockSpec describes a mock, exactly one of the mock kinds is set
+type mockSpec struct {
+	Helper string      `json:"helper"`
+	Const  *mockValue  `json:"const,omitempty"`
+	Seq    []mockValue `json:"seq,omitempty"`
+	Ctx    []mockValue `json:"ctx,omitempty"`
+	Expr   string      `json:"expr,omitempty"`
+	Clock  *mockClock  `json:"clock,omitempty"`
+	RNG    *mockRNG    `json:"rng,omitempty"`
+	Sym    string      `json:"sym,omitempty"`
+}
+
+type mockClock struct {
+	Start   mockValue `json:"start"`
+	Step    mockValue `json:"step"`
+	CtxStep mockValue `json:"ctxStep"`
+}
+
+// UnmarshalJSON decodes a clock, steps which are missing get the same defaults as clocks set with `mock set`.
+func (c *mockClock) UnmarshalJSON(b []byte) error {
+	// The alias has no UnmarshalJSON method, so decoding into it doesn't recurse
+	type clock mockClock
+	decoded := clock{Step: defaultClockStep, CtxStep: defaultClockCtxStep}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&decoded); err != nil {
+		return err
+	}
+
+	*c = mockClock(decoded)
+	return nil
+}
+
+type mockRNG struct {
+	Seed mockValue `json:"seed"`
+}
+
+// Default steps of the clock, 1µs per call and 1ms per context
+const (
+	defaultClockStep    = 1000
+	defaultClockCtxStep = 1000000
+)
+
+// mockValue is a value returned by a mock. In JSON it is a number, which can be negative, or a string holding a
+// number in any base strconv accepts.
+type mockValue uint64
+
+func parseMockValue(s string) (mockValue, error) {
+	if v, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return mockValue(v), nil
+	}
+
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+
+	return mockValue(v), nil
+}
+
+func (v mockValue) MarshalJSON() ([]byte, error) {
+	if int64(v) < 0 {
+		return []byte(strconv.FormatInt(int64(v), 10)), nil
+	}
+	return []byte(strconv.FormatUint(uint64(v), 10)), nil
+}
+
+func (v *mockValue) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	var err error
+	*v, err = parseMockValue(s)
+	return err
+}
+
+func (v mockValue) String() string {
+	if int64(v) < 0 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// helperMock is a mocked helper function
+type helperMock struct {
+	fn   asm.BuiltinFunc
+	spec mockSpec
+	expr *argexpr.Expr
+	rng  *rand.Rand
+}
+
+// newHelperMock validates the spec and creates a mock from it
+func newHelperMock(spec mockSpec) (*helperMock, error) {
+	fn, found := helperdata.Lookup(spec.Helper)
+	if !found {
+		return nil, fmt.Errorf("unknown helper function '%s'", spec.Helper)
+	}
+
+	m := &helperMock{fn: fn, spec: spec}
+	// Use the C name, even if the helper was given by number
+	m.spec.Helper = helperdata.Signatures[fn].Name
+
+	kinds := 0
+	for _, set := range []bool{
+		spec.Const != nil, spec.Seq != nil, spec.Ctx != nil, spec.Expr != "", spec.Clock != nil, spec.RNG != nil,
+		spec.Sym != "",
+	} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("mock of '%s' must have exactly one of 'const', 'seq', 'ctx', 'expr', 'clock', "+
+			"'rng' or 'sym'", spec.Helper)
+	}
+
+	if (spec.Seq != nil && len(spec.Seq) == 0) || (spec.Ctx != nil && len(spec.Ctx) == 0) {
+		return nil, fmt.Errorf("mock of '%s' has no values", spec.Helper)
+	}
+
+	if spec.Expr != "" {
+		var err error
+		m.expr, err = argexpr.Compile(spec.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("mock of '%s': %w", spec.Helper, err)
+		}
+	}
+
+	return m, nil
+}
+
+// call implements the helper by setting R0 to the value of the mock
+func (m *helperMock) call(p *mimic.Process) error {
+	if mockCalls.process != p {
+		mockCalls.process = p
+		mockCalls.counts = make(map[asm.BuiltinFunc]int)
+	}
+	n := mockCalls.counts[m.fn]
+	mockCalls.counts[m.fn] = n + 1
+
+	v, err := m.value(p, n)
+	if err != nil {
+		return fmt.Errorf("mock of %s: %w", m.spec.Helper, err)
+	}
+
+	p.Registers.R0 = v
+	return nil
+}
+
+// value returns the value of the mock, n is the number of earlier calls to the helper in the current process
+func (m *helperMock) value(p *mimic.Process, n int) (uint64, error) {
+	spec := m.spec
+	switch {
+	case spec.Const != nil:
+		return uint64(*spec.Const), nil
+
+	case spec.Seq != nil:
+		return uint64(spec.Seq[n%len(spec.Seq)]), nil
+
+	case spec.Ctx != nil:
+		if curCtx < len(spec.Ctx) {
+			return uint64(spec.Ctx[curCtx]), nil
+		}
+		return uint64(spec.Ctx[len(spec.Ctx)-1]), nil
+
+	case spec.Clock != nil:
+		c := spec.Clock
+		return uint64(c.Start) + uint64(curCtx)*uint64(c.CtxStep) + uint64(n)*uint64(c.Step), nil
+
+	case spec.RNG != nil:
+		// Every run starts a new sequence, so the values of a context don't depend on earlier runs
+		if n == 0 || m.rng == nil {
+			m.rng = rand.New(rand.NewSource(int64(spec.RNG.Seed) + int64(curCtx)))
+		}
+		return uint64(m.rng.Uint32()), nil
+
+	case spec.Sym != "":
+		// The symbol is resolved on every call, so mocks can be set before the symbol table is loaded
+		if ksyms == nil {
+			return 0, errNoSymbols
+		}
+		sym, found := ksyms.ByName(spec.Sym)
+		if !found {
+			return 0, fmt.Errorf("unknown symbol '%s'", spec.Sym)
+		}
+		return sym.Addr, nil
+
+	default:
+		vars := map[string]uint64{
+			"ctx": uint64(curCtx),
+			"n":   uint64(n),
+		}
+		for i, param := range helperdata.Signatures[m.fn].Params {
+			vars[param.Name] = p.Registers.Get(asm.R1 + asm.Register(i))
+		}
+		for i := 0; i < 5; i++ {
+			vars[fmt.Sprintf("r%d", i+1)] = p.Registers.Get(asm.R1 + asm.Register(i))
+		}
+
+		return m.expr.Eval(vars)
+	}
+}
+
+func (m *helperMock) String() string {
+	spec := m.spec
+	switch {
+	case spec.Const != nil:
+		return fmt.Sprintf("const %s", *spec.Const)
+
+	case spec.Seq != nil:
+		return fmt.Sprintf("seq %s", mockValuesString(spec.Seq))
+
+	case spec.Ctx != nil:
+		return fmt.Sprintf("ctx %s", mockValuesString(spec.Ctx))
+
+	case spec.Clock != nil:
+		return fmt.Sprintf("clock start=%s step=%s ctx step=%s", spec.Clock.Start, spec.Clock.Step,
+			spec.Clock.CtxStep)
+
+	case spec.RNG != nil:
+		return fmt.Sprintf("rng seed=%s", spec.RNG.Seed)
+
+	case spec.Sym != "":
+		return fmt.Sprintf("sym %s", spec.Sym)
+
+	default:
+		return fmt.Sprintf("expr \"%s\"", spec.Expr)
+	}
+}
+
+func mockValuesString(values []mockValue) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = v.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+func parseMockValues(args []string) ([]mockValue, error) {
+	values := make([]mockValue, len(args))
+	for i, arg := range args {
+		var err error
+		values[i], err = parseMockValue(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// parseClock parses the optional start, step and ctx step of a clock mock
+func parseClock(args []string) (*mockClock, error) {
+	values, err := parseMockValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > 3 {
+		return nil, errors.New("a clock has at most 3 values: start, step and ctx step")
+	}
+
+	clock := &mockClock{Step: defaultClockStep, CtxStep: defaultClockCtxStep}
+	for i, field := range []*mockValue{&clock.Start, &clock.Step, &clock.CtxStep} {
+		if i < len(values) {
+			*field = values[i]
+		}
+	}
+
+	return clock, nil
+}
+
+// parseMockSpec parses the arguments of 'mock set'
+func parseMockSpec(helper, kind string, args []string) (mockSpec, error) {
+	spec := mockSpec{Helper: helper}
+
+	var err error
+	switch kind {
+	case "const":
+		if len(args) != 1 {
+			return spec, errors.New("'const' requires exactly one value")
+		}
+		var v mockValue
+		v, err = parseMockValue(args[0])
+		spec.Const = &v
+
+	case "seq", "ctx":
+		if len(args) == 0 {
+			return spec, fmt.Errorf("'%s' requires at least one value", kind)
+		}
+		var values []mockValue
+		values, err = parseMockValues(args)
+		if kind == "seq" {
+			spec.Seq = values
+		} else {
+			spec.Ctx = values
+		}
+
+	case "expr":
+		if len(args) == 0 {
+			return spec, errors.New("'expr' requires an expression")
+		}
+		spec.Expr = strings.Join(args, " ")
+
+	case "clock":
+		spec.Clock, err = parseClock(args)
+
+	case "rng":
+		if len(args) > 1 {
+			return spec, errors.New("'rng' has at most one value: the seed")
+		}
+		spec.RNG = &mockRNG{}
+		if len(args) == 1 {
+			spec.RNG.Seed, err = parseMockValue(args[0])
+		}
+
+	case "sym":
+		if len(args) != 1 {
+			return spec, errors.New("'sym' requires exactly one symbol name")
+		}
+		spec.Sym = args[0]
+
+	default:
+		return spec, fmt.Errorf("unknown mock kind '%s', expected const, seq, ctx, expr, clock, rng or sym", kind)
+	}
+
+	return spec, err
+}
+
+func setMock(spec mockSpec) error {
+	m, err := newHelperMock(spec)
+	if err != nil {
+		return err
+	}
+
+	mocks[m.fn] = m
+	fmt.Printf("%s: %s\n", m.spec.Helper, m)
+	return nil
+}
+
+func setMockExec(args []string) {
+	if len(args) < 2 {
+		printRed("Missing required arguments 'helper' and 'const|seq|ctx|expr|clock|rng|sym'\n")
+		return
+	}
+
+	spec, err := parseMockSpec(args[0], args[1], args[2:])
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	if err = setMock(spec); err != nil {
+		printRed("%s\n", err)
+	}
+}
+
+func clockMockExec(args []string) {
+	clock, err := parseClock(args)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	for _, fn := range []asm.BuiltinFunc{asm.FnKtimeGetNs, asm.FnKtimeGetBootNs, asm.FnKtimeGetCoarseNs} {
+		err = setMock(mockSpec{Helper: helperdata.Signatures[fn].Name, Clock: clock})
+		if err != nil {
+			printRed("%s\n", err)
+			return
+		}
+	}
+}
+
+func rngMockExec(args []string) {
+	spec, err := parseMockSpec(helperdata.Signatures[asm.FnGetPrandomU32].Name, "rng", args)
+	if err != nil {
+		printRed("%s\n", err)
+		return
+	}
+
+	if err = setMock(spec); err != nil {
+		printRed("%s\n", err)
+	}
+}
+
+// sortedMocks returns the mocks sorted by helper number
+func sortedMocks() []*helperMock {
+	list := make([]*helperMock, 0, len(mocks))
+	for _, m := range mocks {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].fn < list[j].fn
+	})
+	return list
+}
+
+func listMockExec(args []string) {
+	if len(mocks) == 0 {
+		fmt.Println("No mocked helper functions")
+		return
+	}
+
+	for _, m := range sortedMocks() {
+		fmt.Printf("%s: %s\n", m.spec.Helper, m)
+	}
+}
+
+func clearMockExec(args []string) {
+	if len(args) == 0 {
+		mocks = map[asm.BuiltinFunc]*helperMock{}
+		fmt.Println("All mocks removed")
+		return
+	}
+
+	fn, found := helperdata.Lookup(args[0])
+	if !found {
+		printRed("Unknown helper function '%s'\n", args[0])
+		return
+	}
+
+	if _, mocked := mocks[fn]; !mocked {
+		printRed("'%s' isn't mocked\n", args[0])
+		return
+	}
+
+	delete(mocks, fn)
+	fmt.Printf("Mock of '%s' removed\n", helperdata.Signatures[fn].Name)
+}
+
+// loadMockFile loads the mocks of a mock file, either all mocks of the file are loaded or none.
+func loadMockFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var file mockFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&file); err != nil {
+		return 0, fmt.Errorf("decode: %w", err)
+	}
+
+	loaded := make([]*helperMock, len(file.Mocks))
+	for i, spec := range file.Mocks {
+		loaded[i], err = newHelperMock(spec)
+		if err != nil {
+			return 0, fmt.Errorf("mocks[%d]: %w", i, err)
+		}
+	}
+
+	for _, m := range loaded {
+		mocks[m.fn] = m
+	}
+
+	return len(loaded), nil
+}
+
+func loadMockExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'file path'\n")
+		return
+	}
+
+	n, err := loadMockFile(args[0])
+	if err != nil {
+		printRed("Error while loading mocks: %s\n", err)
+		return
+	}
+
+	fmt.Printf("%d mocks loaded\n", n)
+}
+
+func saveMockExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'file path'\n")
+		return
+	}
+
+	file := mockFile{Mocks: []mockSpec{}}
+	for _, m := range sortedMocks() {
+		file.Mocks = append(file.Mocks, m.spec)
+	}
+
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		printRed("Error while encoding mocks: %s\n", err)
+		return
+	}
+
+	if err = os.WriteFile(args[0], append(b, '\n'), 0644); err != nil {
+		printRed("Error while writing mocks: %s\n", err)
+		return
+	}
+
+	fmt.Printf("%d mocks saved to '%s'\n", len(file.Mocks), args[0])
+}
+
+func mockHelperCompletion(args []string) []prompt.Suggest {
+	if len(args) > 1 {
+		return nil
+	}
+
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	ranks := fuzzy.RankFind(prefix, helperdata.Names())
+	sort.Sort(ranks)
+
+	var suggestions []prompt.Suggest
+	for _, rank := range ranks {
+		suggestions = append(suggestions, prompt.Suggest{
+			Text: rank.Target,
+		})
+	}
+
+	return suggestions
+}
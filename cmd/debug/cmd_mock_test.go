@@ -0,0 +1,84 @@
+package debug
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+func TestMockClockDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want mockClock
+	}{
+		{
+			name: "empty",
+			json: `{}`,
+			want: mockClock{Step: defaultClockStep, CtxStep: defaultClockCtxStep},
+		},
+		{
+			name: "start only",
+			json: `{"start": "0x1000"}`,
+			want: mockClock{Start: 0x1000, Step: defaultClockStep, CtxStep: defaultClockCtxStep},
+		},
+		{
+			name: "all fields",
+			json: `{"start": 1, "step": 2, "ctxStep": 3}`,
+			want: mockClock{Start: 1, Step: 2, CtxStep: 3},
+		},
+		{
+			name: "explicit zero",
+			json: `{"step": 0, "ctxStep": 0}`,
+			want: mockClock{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got mockClock
+			if err := json.Unmarshal([]byte(test.json), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	var clock mockClock
+	if err := json.Unmarshal([]byte(`{"steps": 1}`), &clock); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestLoadMockFileClock(t *testing.T) {
+	defer func(saved map[asm.BuiltinFunc]*helperMock) { mocks = saved }(mocks)
+	mocks = map[asm.BuiltinFunc]*helperMock{}
+
+	path := filepath.Join(t.TempDir(), "mocks.json")
+	file := `{"mocks": [{"helper": "bpf_ktime_get_ns", "clock": {"start": 5}}]}`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := loadMockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("loaded %d mocks, want 1", n)
+	}
+
+	m := mocks[asm.FnKtimeGetNs]
+	if m == nil || m.spec.Clock == nil {
+		t.Fatal("no clock mock for bpf_ktime_get_ns")
+	}
+	want := mockClock{Start: 5, Step: defaultClockStep, CtxStep: defaultClockCtxStep}
+	if *m.spec.Clock != want {
+		t.Errorf("got %+v, want %+v", *m.spec.Clock, want)
+	}
+}
@@ -51,6 +51,8 @@ func registersExec(args []string) {
 					fmt.Print("...)")
 				}
 			}
+		} else if str := ksymString(value); str != "" {
+			fmt.Printf(" -> <%s>", green(str))
 		}
 
 		fmt.Print("\n")
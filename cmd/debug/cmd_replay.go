@@ -0,0 +1,378 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/helperdata"
+	"github.com/dylandreimerink/mimic"
+)
+
+var cmdReplay = Command{
+	Name:    "replay",
+	Summary: "Compare helper calls with the calls recorded in captured contexts",
+	Description: "Contexts captured with 'edb capture-context' contain the calls the program made to helper " +
+		"functions, with their params and results. While a captured context is executed, every helper call is " +
+		"compared to the recorded calls, the Nth call to a helper with the Nth recorded call to the same helper. " +
+		"The first call which differs is reported with its source line and 'continue' and 'continue-all' stop " +
+		"there, like at a breakpoint. If the program makes fewer calls than were recorded, this is reported when " +
+		"the program exits.\n" +
+		"\n" +
+		"Pointers passed to and returned by helpers differ between the kernel and the emulator, so pointer params " +
+		"are not compared and of pointer results only whether they are NULL. The memory written by helpers, like " +
+		"the buffer of bpf_probe_read, is compared up to the recorded size, unless the call failed and the helper " +
+		"only writes on success, like bpf_map_pop_elem. Helpers which the emulator replays " +
+		"from the capture always match, unless the program makes more calls than were recorded.",
+	Subcommands: []Command{
+		{
+			Name:    "status",
+			Summary: "Show the amount of compared helper calls and the first divergence",
+			Exec:    replayStatusExec,
+		},
+		{
+			Name:    "force",
+			Summary: "Force the recorded results of helper calls",
+			Description: "With 'on', the return value and the memory written by every helper call are replaced with " +
+				"the recorded results after the call is emulated. The program then takes the same path it took in " +
+				"the kernel, even if the emulator implements a helper differently, which tells inaccuracies of the " +
+				"emulator apart from bugs in the program. A NULL pointer can be forced, a valid pointer can't since " +
+				"the recorded pointer doesn't exist in the emulator.",
+			Exec: replayForceExec,
+			Args: []CmdArg{{
+				Name:     "on|off",
+				Required: true,
+			}},
+		},
+	},
+}
+
+// helperReplay is the state of the comparison between the helper calls of the current process and the calls recorded
+// in its context.
+var helperReplay struct {
+	// The process of which the calls are compared, the state is reset when a new process is started
+	process *mimic.Process
+	// The amount of calls made per helper
+	counts map[asm.BuiltinFunc]int
+	// The amount of compared calls
+	compared int
+	// The first divergence, empty if no divergence was found
+	divergence string
+	// True if a divergence was found during the last step
+	diverged bool
+	// If true, the recorded results are forced
+	force bool
+}
+
+// replayCall is a helper call which is in progress
+type replayCall struct {
+	pc       int
+	fn       asm.BuiltinFunc
+	helper   helperdata.HelperFunc
+	recorded *mimic.CapturedContextHelperCall
+	// The values of R1-R5 before the call
+	params [5]uint64
+}
+
+// recordedCalls returns the recorded helper calls of the current process, or nil if its context isn't captured.
+func recordedCalls() map[string][]mimic.CapturedContextHelperCall {
+	if process == nil {
+		return nil
+	}
+
+	cc, ok := process.Context.(*mimic.CapturedContext)
+	if !ok {
+		return nil
+	}
+
+	if helperReplay.process != process {
+		helperReplay.process = process
+		helperReplay.counts = make(map[asm.BuiltinFunc]int)
+		helperReplay.compared = 0
+		helperReplay.divergence = ""
+		helperReplay.diverged = false
+	}
+
+	return cc.HelperCalls
+}
+
+// startReplayCall is called before the helper call instruction is executed, it returns nil if the call isn't
+// compared.
+func startReplayCall(inst asm.Instruction, pc int) *replayCall {
+	calls := recordedCalls()
+	if calls == nil {
+		return nil
+	}
+
+	call := &replayCall{
+		pc:     pc,
+		fn:     asm.BuiltinFunc(inst.Constant),
+		helper: helperdata.Signatures[asm.BuiltinFunc(inst.Constant)],
+	}
+	for i := range call.params {
+		call.params[i] = process.Registers.Get(asm.R1 + asm.Register(i))
+	}
+
+	n := helperReplay.counts[call.fn]
+	helperReplay.counts[call.fn] = n + 1
+
+	recorded := calls[strconv.Itoa(int(call.fn))]
+	if n < len(recorded) {
+		call.recorded = &recorded[n]
+	}
+
+	return call
+}
+
+// finishReplayCall is called after the helper call is executed, it compares the results of the call to the recorded
+// results and forces the recorded results if requested.
+func finishReplayCall(call *replayCall) {
+	if call.recorded == nil {
+		n := helperReplay.counts[call.fn]
+		diverge(call.pc, fmt.Sprintf("call %d to %s wasn't recorded, the capture has %d calls", n, call.fn, n-1))
+		return
+	}
+
+	helperReplay.compared++
+
+	var diffs []string
+	for _, param := range call.recorded.Params {
+		i := int(param.Reg) - int(asm.R1)
+		if i < 0 || i >= len(call.params) || i >= len(call.helper.Params) || call.helper.Params[i].Type.Ptr {
+			continue
+		}
+
+		if call.params[i] != param.Scalar {
+			diffs = append(diffs, fmt.Sprintf("%s is 0x%X, the capture has 0x%X", param.Reg, call.params[i],
+				param.Scalar))
+		}
+	}
+
+	written := outputWritten(call)
+	for _, result := range call.recorded.Result {
+		if result.Data != nil {
+			if !written {
+				continue
+			}
+			if diff := compareOutput(call, result); diff != "" {
+				diffs = append(diffs, diff)
+			}
+			continue
+		}
+
+		if result.Reg != asm.R0 || call.helper.Ret == helperdata.RetVoid {
+			continue
+		}
+
+		r0 := process.Registers.R0
+		if call.helper.Ret.IsPtr() {
+			if (r0 == 0) != (result.Scalar == 0) {
+				diffs = append(diffs, fmt.Sprintf("R0 is %s, the capture has %s", nullString(r0),
+					nullString(result.Scalar)))
+			}
+		} else if r0 != result.Scalar {
+			diffs = append(diffs, fmt.Sprintf("R0 is %d, the capture has %d", int64(r0), int64(result.Scalar)))
+		}
+	}
+
+	if len(diffs) > 0 {
+		diverge(call.pc, fmt.Sprintf("call %d to %s: %s", helperReplay.counts[call.fn], call.fn,
+			strings.Join(diffs, ", ")))
+	}
+
+	if helperReplay.force {
+		forceRecorded(call)
+	}
+}
+
+// outputWritten returns false if the recorded call failed and the helper only writes its output on success, like
+// bpf_map_pop_elem and bpf_strtol. The capture then holds whatever the memory contained, which isn't compared.
+func outputWritten(call *replayCall) bool {
+	if len(call.helper.Outputs) == 0 || call.helper.Outputs[0].Kind == helperdata.OutputSizeParam {
+		return true
+	}
+
+	for _, result := range call.recorded.Result {
+		if result.Reg == asm.R0 && result.Data == nil {
+			return int64(result.Scalar) >= 0
+		}
+	}
+
+	return true
+}
+
+// compareOutput compares memory written by the helper to the recorded memory, the pointer is taken from the register
+// before the call since the call clobbers R1-R5.
+func compareOutput(call *replayCall, result mimic.CapturedContextRegisterData) string {
+	i := int(result.Reg) - int(asm.R1)
+	if i < 0 || i >= len(call.params) {
+		return ""
+	}
+
+	mem, off, err := helperOutputMem(call.params[i])
+	if err != nil {
+		return fmt.Sprintf("memory at %s: %s", result.Reg, err)
+	}
+
+	emulated := make([]byte, len(result.Data))
+	if err = mem.Read(off, emulated); err != nil {
+		return fmt.Sprintf("memory at %s: %s", result.Reg, err)
+	}
+
+	if !bytes.Equal(emulated, result.Data) {
+		return fmt.Sprintf("memory at %s is %X, the capture has %X", result.Reg, emulated, result.Data)
+	}
+
+	return ""
+}
+
+// forceRecorded sets R0 and the memory written by the helper to the recorded results
+func forceRecorded(call *replayCall) {
+	written := outputWritten(call)
+	for _, result := range call.recorded.Result {
+		if result.Data != nil {
+			i := int(result.Reg) - int(asm.R1)
+			if !written || i < 0 || i >= len(call.params) {
+				continue
+			}
+
+			mem, off, err := helperOutputMem(call.params[i])
+			if err == nil {
+				err = mem.Write(off, result.Data)
+			}
+			if err != nil {
+				printRed("Can't force memory at %s of %s: %s\n", result.Reg, call.fn, err)
+			}
+			continue
+		}
+
+		if result.Reg != asm.R0 || call.helper.Ret == helperdata.RetVoid {
+			continue
+		}
+
+		if !call.helper.Ret.IsPtr() {
+			process.Registers.R0 = result.Scalar
+			continue
+		}
+
+		if result.Scalar == 0 {
+			process.Registers.R0 = 0
+		} else if process.Registers.R0 == 0 {
+			printRed("Can't force R0 of %s, the capture has a pointer which doesn't exist in the emulator\n", call.fn)
+		}
+	}
+}
+
+func helperOutputMem(addr uint64) (mimic.VMMem, uint32, error) {
+	entry, off, found := vm.MemoryController.GetEntry(uint32(addr))
+	if !found {
+		return nil, 0, fmt.Errorf("0x%08X isn't a valid address", addr)
+	}
+
+	mem, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, 0, fmt.Errorf("0x%08X doesn't point to VM memory", addr)
+	}
+
+	return mem, off, nil
+}
+
+// finishReplay is called when the program exits, it reports recorded calls which the program didn't make.
+func finishReplay() {
+	calls := recordedCalls()
+	if calls == nil {
+		return
+	}
+
+	fns := make([]int, 0, len(calls))
+	for fnStr := range calls {
+		fnNr, err := strconv.Atoi(fnStr)
+		if err != nil {
+			continue
+		}
+		fns = append(fns, fnNr)
+	}
+	sort.Ints(fns)
+
+	for _, fnNr := range fns {
+		fn := asm.BuiltinFunc(fnNr)
+		recorded := calls[strconv.Itoa(fnNr)]
+		if n := helperReplay.counts[fn]; n < len(recorded) {
+			diverge(process.Registers.PC, fmt.Sprintf("the program exited after %d calls to %s, the capture has %d "+
+				"calls", n, fn, len(recorded)))
+			return
+		}
+	}
+}
+
+// diverge records and reports the first divergence between the emulated and recorded helper calls
+func diverge(pc int, msg string) {
+	if helperReplay.divergence != "" {
+		return
+	}
+
+	report := fmt.Sprintf("PC %d: %s", pc, msg)
+	if line := getBTFLine(process.Program, pc); line != "" {
+		report = fmt.Sprintf("PC %d (%s:%d): %s\n    %s", pc, getBTFFilename(process.Program, pc),
+			getBTFLineNumber(process.Program, pc), msg, strings.TrimSpace(line))
+	}
+
+	helperReplay.divergence = report
+	helperReplay.diverged = true
+
+	printRed("Helper call diverges from capture at %s\n", report)
+}
+
+// replayDiverged returns true once after a divergence was found, so continue commands can stop.
+func replayDiverged() bool {
+	diverged := helperReplay.diverged
+	helperReplay.diverged = false
+	return diverged
+}
+
+func nullString(ptr uint64) string {
+	if ptr == 0 {
+		return "NULL"
+	}
+	return "non-NULL"
+}
+
+func replayStatusExec(args []string) {
+	if recordedCalls() == nil {
+		fmt.Println("The current context isn't a captured context")
+		return
+	}
+
+	fmt.Printf("Compared helper calls: %d\n", helperReplay.compared)
+	if helperReplay.divergence == "" {
+		fmt.Println("No divergence found")
+	} else {
+		fmt.Printf("First divergence: %s\n", helperReplay.divergence)
+	}
+
+	if helperReplay.force {
+		fmt.Println("Recorded results are forced")
+	}
+}
+
+func replayForceExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'on|off'\n")
+		return
+	}
+
+	switch args[0] {
+	case "on":
+		helperReplay.force = true
+	case "off":
+		helperReplay.force = false
+	default:
+		printRed("Invalid argument '%s', expected 'on' or 'off'\n", args[0])
+		return
+	}
+
+	fmt.Printf("Forcing recorded helper results: %s\n", args[0])
+}
@@ -0,0 +1,299 @@
+package debug
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/mimic"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+var cmdStack = Command{
+	Name:    "stack",
+	Aliases: []string{"st"},
+	Summary: "Show the stack of the current or a caller frame",
+	Description: "This command shows the stack frame of the current function relative to R10. Each 8 byte slot is " +
+		"annotated with the variables which the DWARF debug info places at that location. Bytes which have not been " +
+		"written to during this run are shown in gray. The optional frame number selects a caller frame of a " +
+		"BPF-to-BPF function call, 0 being the current frame, 1 the caller of the current frame and so on.",
+	Exec: stackExec,
+	Args: []CmdArg{{
+		Name:     "frame",
+		Required: false,
+	}},
+}
+
+// The stack frame size of the VM, this is the default value of mimic, which can't be changed via the VM options.
+const stackFrameSize = 256
+
+// stackFrame is saved each time a BPF-to-BPF function call is made
+type stackFrame struct {
+	// The program and PC of the call instruction
+	program *ebpf.ProgramSpec
+	pc      int
+	// The frame pointer of the caller
+	r10 uint64
+}
+
+// stackState tracks information about the stack of the current process which the VM doesn't keep for us.
+var stackState = struct {
+	// A flag for each byte of the stack, true if it was written to during the current run
+	written []bool
+	// The frames of the callers, the last element is the direct caller of the current function
+	frames []stackFrame
+
+	// Information about the instruction being executed, collected before and used after stepping
+	storeAddr uint32
+	storeSize int
+	snapshot  []byte
+}{}
+
+// resetStackState resets the tracked stack information, must be called each time a new process is started.
+func resetStackState() {
+	stackState.written = make([]bool, len(process.Stack.Backing))
+	stackState.frames = nil
+	stackState.storeSize = 0
+	stackState.snapshot = nil
+}
+
+// stackBeforeStep collects the information needed to track the stack after the given instruction is executed.
+func stackBeforeStep(inst asm.Instruction, pc int) {
+	if len(stackState.written) != len(process.Stack.Backing) {
+		resetStackState()
+	}
+
+	stackState.storeSize = 0
+	stackState.snapshot = nil
+
+	class := inst.OpCode.Class()
+	switch {
+	case (class == asm.StClass || class == asm.StXClass) &&
+		(inst.OpCode.Mode() == asm.MemMode || inst.OpCode.Mode() == asm.XAddMode):
+
+		stackState.storeAddr = uint32(process.Registers.Get(inst.Dst) + uint64(inst.Offset))
+		stackState.storeSize = inst.OpCode.Size().Sizeof()
+
+	case inst.OpCode.JumpOp() == asm.Call && inst.Src == asm.PseudoCall:
+		stackState.frames = append(stackState.frames, stackFrame{
+			program: process.Program,
+			pc:      pc,
+			r10:     process.Registers.R10,
+		})
+
+	case inst.OpCode.JumpOp() == asm.Call:
+		// Helper functions can write to the stack via pointers, we don't know exactly where, so take a snapshot and
+		// compare after the call.
+		stackState.snapshot = make([]byte, len(process.Stack.Backing))
+		copy(stackState.snapshot, process.Stack.Backing)
+	}
+}
+
+// stackAfterStep updates the written stack slots and call frames after the given instruction has been executed.
+func stackAfterStep(inst asm.Instruction) {
+	if inst.OpCode.JumpOp() == asm.Exit && len(stackState.frames) > 0 {
+		stackState.frames = stackState.frames[:len(stackState.frames)-1]
+	}
+
+	stackEntry, found := vm.MemoryController.GetEntryByObject(&process.Stack)
+	if !found {
+		return
+	}
+
+	if stackState.storeSize > 0 && stackState.storeAddr >= stackEntry.Addr {
+		off := int(stackState.storeAddr - stackEntry.Addr)
+		for i := off; i < off+stackState.storeSize && i < len(stackState.written); i++ {
+			stackState.written[i] = true
+		}
+	}
+
+	if stackState.snapshot != nil {
+		for i := range stackState.snapshot {
+			if stackState.snapshot[i] != process.Stack.Backing[i] {
+				stackState.written[i] = true
+			}
+		}
+	}
+}
+
+func stackExec(args []string) {
+	if process == nil {
+		printRed("No program loaded\n")
+		return
+	}
+
+	frameNr := 0
+	if len(args) > 0 {
+		var err error
+		frameNr, err = strconv.Atoi(args[0])
+		if err != nil || frameNr < 0 {
+			printRed("Invalid frame number '%s'\n", args[0])
+			return
+		}
+	}
+
+	if frameNr > len(stackState.frames) {
+		printRed("Frame %d doesn't exist, the current call depth is %d\n", frameNr, len(stackState.frames))
+		return
+	}
+
+	// Frame 0 is the current function, frame 1 the caller, etc.
+	prog := process.Program
+	pc := process.Registers.PC
+	r10 := process.Registers.R10
+	if frameNr > 0 {
+		frame := stackState.frames[len(stackState.frames)-frameNr]
+		prog = frame.program
+		pc = frame.pc
+		r10 = frame.r10
+	}
+
+	stackEntry, found := vm.MemoryController.GetEntryByObject(&process.Stack)
+	if !found {
+		printRed("Can't find the memory entry of the stack\n")
+		return
+	}
+
+	frameStart := uint32(r10) - stackFrameSize
+	if frameStart < stackEntry.Addr || uint32(r10) > stackEntry.Addr+stackEntry.Size {
+		printRed("Frame pointer 0x%08X is outside of the stack\n", r10)
+		return
+	}
+	stackOff := int(frameStart - stackEntry.Addr)
+
+	fmt.Printf("Frame %d: %s", frameNr, green(prog.Name))
+	if line := getBTFLine(prog, pc); line != "" {
+		fmt.Printf(" %s", gray(strings.TrimSpace(line)))
+	}
+	fmt.Printf(" (R10 = 0x%08X)\n", r10)
+
+	annotations := stackAnnotations(prog, pc, r10)
+
+	// slotUnused returns true if no byte of the slot has been written and no variable is placed in the slot
+	slotUnused := func(off int) bool {
+		for i := 0; i < 8; i++ {
+			if stackState.written[stackOff+off+i] {
+				return false
+			}
+		}
+		return len(annotations[frameStart+uint32(off)]) == 0
+	}
+
+	for off := 0; off < stackFrameSize; off += 8 {
+		// Collapse long runs of unused slots into a single line, so the interesting parts of the stack stand out
+		run := 0
+		for off+run*8 < stackFrameSize && slotUnused(off+run*8) {
+			run++
+		}
+		if run >= 3 {
+			fmt.Println(gray(fmt.Sprintf(
+				"fp-%d .. fp-%d  (%d slots never written)",
+				stackFrameSize-off,
+				stackFrameSize-(off+(run-1)*8),
+				run,
+			)))
+			off += (run - 1) * 8
+			continue
+		}
+
+		slotAddr := frameStart + uint32(off)
+		fmt.Print(blue(fmt.Sprintf("%-7s", fmt.Sprintf("fp-%d", stackFrameSize-off))))
+		fmt.Print(gray(fmt.Sprintf(" 0x%08X  ", slotAddr)))
+
+		for i := 0; i < 8; i++ {
+			b := process.Stack.Backing[stackOff+off+i]
+			if stackState.written[stackOff+off+i] {
+				fmt.Print(yellow(fmt.Sprintf("%02X ", b)))
+			} else {
+				fmt.Print(gray(fmt.Sprintf("%02X ", b)))
+			}
+		}
+
+		if names := annotations[slotAddr]; len(names) > 0 {
+			fmt.Printf(" %s", green(strings.Join(names, ", ")))
+		}
+
+		fmt.Print("\n")
+	}
+}
+
+// stackAnnotations returns the names of the variables in scope at the given PC, indexed by the address of the
+// 8 byte stack slots they occupy.
+func stackAnnotations(prog *ebpf.ProgramSpec, pc int, r10 uint64) map[uint32][]string {
+	annotations := make(map[uint32][]string)
+
+	det := progDwarf[prog.Name]
+	if det == nil {
+		return annotations
+	}
+
+	programScopes := det.PCToScope[prog.Name]
+	if pc >= len(programScopes) || programScopes[pc] == nil {
+		return annotations
+	}
+
+	scope := programScopes[pc]
+	fb := inferFrameBase(det, scope, r10)
+
+	// We only know the actual register values of the current frame, for callers we only know the frame pointer.
+	regs := process.Registers
+	regs.R10 = r10
+
+	// Walk up from the current scope to the subprogram, so variables of enclosing lexical blocks are included.
+	for node := scope; node != nil; node = node.Parent {
+		for _, child := range node.Children {
+			e := child.Entry
+			if e.Tag != dwarf.TagVariable && e.Tag != dwarf.TagFormalParameter {
+				continue
+			}
+
+			name, ok := det.Val(e, dwarf.AttrName).(string)
+			if !ok {
+				continue
+			}
+
+			instr, err := dwarfLocationInstr(det, e, pc)
+			if err != nil || instr == nil {
+				continue
+			}
+
+			const na = 12
+			dwarfRegs := op.NewDwarfRegisters(0, dwarfRegisters(regs), mimic.GetNativeEndianness(), 11, na, na, na)
+			dwarfRegs.FrameBase = fb
+			addr, pieces, err := op.ExecuteStackProgram(*dwarfRegs, instr, 8, func(b []byte, u uint64) (int, error) {
+				return 0, fmt.Errorf("memory reads not supported")
+			})
+			if err != nil || len(pieces) > 0 {
+				continue
+			}
+
+			// Only annotate variables which live within this stack frame
+			if addr < int64(r10)-stackFrameSize || addr >= int64(r10) {
+				continue
+			}
+
+			size := DWARFGetByteSize(det, child)
+			if size <= 0 {
+				size = 1
+			}
+
+			for slot := addr - addr%8; slot < addr+size; slot += 8 {
+				annotations[uint32(slot)] = append(annotations[uint32(slot)], name)
+			}
+		}
+
+		if node.Entry.Tag == dwarf.TagSubprogram {
+			break
+		}
+	}
+
+	for slot := range annotations {
+		sort.Strings(annotations[slot])
+	}
+
+	return annotations
+}
@@ -16,7 +16,7 @@ func stepExec(args []string) {
 
 	startLine := getCurBTFLine()
 	for {
-		stop, err := process.Step()
+		stop, err := stepProcess()
 		if err != nil {
 			printRed("%s\n", err)
 			break
@@ -16,7 +16,7 @@ func stepInstructionExec(args []string) {
 		cmdReset.Exec(nil)
 	}
 
-	stop, err := process.Step()
+	stop, err := stepProcess()
 	if err != nil {
 		printRed("%s\n", err)
 	}
@@ -0,0 +1,212 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/ksym"
+	"github.com/dylandreimerink/mimic"
+)
+
+var cmdSymbols = Command{
+	Name:    "symbols",
+	Aliases: []string{"syms"},
+	Summary: "Kernel symbol related commands",
+	Description: "Kprobes and stack trace helpers deal in kernel addresses. When a kernel symbol table is loaded, " +
+		"these addresses are shown as 'symbol+offset' by 'registers', 'memory read', 'ctx show' and the 'map' " +
+		"commands for stack trace maps. The symbol table is also used to emulate bpf_get_func_ip.",
+	Subcommands: []Command{
+		{
+			Name:    "load",
+			Summary: "Load a kernel symbol table",
+			Description: "Loads the symbols of a kallsyms dump, made with 'cat /proc/kallsyms > kallsyms' as root, or " +
+				"of a vmlinux ELF file with a symbol table. The format is detected from the contents of the file. " +
+				"The symbol table should be from the same machine and boot as the captured contexts, since kernel " +
+				"addresses are randomized at boot. The file can also be given with the --symbols flag of 'edb debug'.",
+			Exec: loadSymbolsExec,
+			Args: []CmdArg{{
+				Name:     "file path",
+				Required: true,
+			}},
+			CustomCompletion: fileCompletion,
+		},
+		{
+			Name:    "lookup",
+			Summary: "Lookup the symbol of an address, or the address of a symbol",
+			Exec:    lookupSymbolExec,
+			Args: []CmdArg{{
+				Name:     "address|symbol name",
+				Required: true,
+			}},
+		},
+		{
+			Name:    "clear",
+			Summary: "Unload the kernel symbol table",
+			Exec:    clearSymbolsExec,
+		},
+	},
+}
+
+// ksyms is the kernel symbol table, nil if none is loaded
+var ksyms *ksym.Table
+
+// errNoSymbols is returned by helpers which need a kernel symbol table if none is loaded
+var errNoSymbols = errors.New("helper requires a kernel symbol table, load one with 'symbols load'")
+
+func loadSymbolsExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'file path'\n")
+		return
+	}
+
+	table, err := ksym.Load(args[0])
+	if err != nil {
+		printRed("Error while loading symbols: %s\n", err)
+		return
+	}
+
+	ksyms = table
+	fmt.Printf("Loaded %d symbols\n", table.Len())
+}
+
+func lookupSymbolExec(args []string) {
+	if len(args) < 1 {
+		printRed("Missing required argument 'address|symbol name'\n")
+		return
+	}
+
+	if ksyms == nil {
+		printRed("No symbol table loaded, load one with 'symbols load'\n")
+		return
+	}
+
+	if addr, err := strconv.ParseUint(args[0], 0, 64); err == nil {
+		str := ksymString(addr)
+		if str == "" {
+			fmt.Printf("0x%016X isn't part of a known symbol\n", addr)
+			return
+		}
+
+		fmt.Printf("%s = %s\n", yellow(fmt.Sprintf("0x%016X", addr)), green(str))
+		return
+	}
+
+	sym, found := ksyms.ByName(args[0])
+	if !found {
+		printRed("No symbol with name '%s'\n", args[0])
+		return
+	}
+
+	fmt.Printf("%s = %s", green(sym.Name), yellow(fmt.Sprintf("0x%016X", sym.Addr)))
+	if sym.Size != 0 {
+		fmt.Printf(" (%d bytes)", sym.Size)
+	}
+	if sym.Module != "" {
+		fmt.Printf(" [%s]", sym.Module)
+	}
+	fmt.Print("\n")
+}
+
+func clearSymbolsExec(args []string) {
+	ksyms = nil
+	fmt.Println("Symbol table unloaded")
+}
+
+// ksymString returns the address as 'symbol+offset', or "" if no symbol table is loaded or the address isn't part of
+// a known symbol.
+func ksymString(addr uint64) string {
+	if ksyms == nil {
+		return ""
+	}
+
+	return ksyms.Format(addr)
+}
+
+// printMemorySymbols prints the values of the memory which are kernel addresses, like return addresses on a kernel
+// stack or function pointers. mem is read from the given offset of the entry, values are 8 byte aligned relative to the
+// start of the entry.
+func printMemorySymbols(entry mimic.MemoryEntry, offset uint32, mem []byte) {
+	if ksyms == nil {
+		return
+	}
+
+	ne := mimic.GetNativeEndianness()
+	for i := int((8 - offset%8) % 8); i+8 <= len(mem); i += 8 {
+		val := ne.Uint64(mem[i:])
+		if str := ksymString(val); str != "" {
+			fmt.Printf("%s %s <%s>\n",
+				blue(fmt.Sprintf("0x%08X", entry.Addr+offset+uint32(i))),
+				yellow(fmt.Sprintf("0x%016X", val)),
+				green(str),
+			)
+		}
+	}
+}
+
+// stackTraceString formats the value of a stack trace map, which is an array of instruction pointers terminated by a
+// zero if the stack is shorter than the array.
+func stackTraceString(val []byte) string {
+	ne := mimic.GetNativeEndianness()
+
+	var ips []string
+	for i := 0; i+8 <= len(val); i += 8 {
+		ip := ne.Uint64(val[i:])
+		if ip == 0 {
+			break
+		}
+
+		if str := ksymString(ip); str != "" {
+			ips = append(ips, str)
+		} else {
+			ips = append(ips, fmt.Sprintf("0x%X", ip))
+		}
+	}
+
+	return "[" + strings.Join(ips, ", ") + "]"
+}
+
+// helperGetFuncIP implements bpf_get_func_ip for kprobes on function entry, by returning the start of the symbol
+// which contains the instruction pointer of the pt_regs context.
+func helperGetFuncIP(p *mimic.Process) error {
+	if ksyms == nil {
+		return errNoSymbols
+	}
+
+	if p.Program.Type != ebpf.Kprobe {
+		return fmt.Errorf("only supported for kprobe programs, not %s", p.Program.Type)
+	}
+
+	entry, off, found := p.VM.MemoryController.GetEntry(uint32(p.Registers.R1))
+	if !found {
+		return fmt.Errorf("no memory at context address 0x%08X", p.Registers.R1)
+	}
+
+	regs, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		return fmt.Errorf("context memory '%s' is not virtual memory", entry.Name)
+	}
+
+	var ipField ctxutil.Field
+	for _, f := range ctxutil.PTRegsLayout() {
+		if f.Name == "ip" {
+			ipField = f
+		}
+	}
+
+	ip, err := regs.Load(off+ipField.Offset, ipField.Size)
+	if err != nil {
+		return fmt.Errorf("load pt_regs ip: %w", err)
+	}
+
+	sym, _, found := ksyms.Lookup(ip)
+	if !found {
+		return fmt.Errorf("ip 0x%016X isn't part of a known symbol", ip)
+	}
+
+	p.Registers.R0 = sym.Addr
+	return nil
+}
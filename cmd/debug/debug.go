@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	prompt "github.com/c-bata/go-prompt"
+	"github.com/cilium/ebpf/btf"
 	"github.com/dylandreimerink/mimic"
 	"github.com/spf13/cobra"
 )
@@ -15,9 +16,13 @@ var (
 
 	curCtx   int
 	contexts []mimic.Context
+	// The address of the current context as passed to the entrypoint in R1
+	ctxAddr uint32
 
 	entrypoint int = 0
 	progDwarf      = map[string]*DET{}
+	// The BTF of each program, by program name, nil if the ELF file has no BTF
+	progBTF = map[string]*btf.Spec{}
 
 	breakpoints []Breakpoint
 )
@@ -25,6 +30,9 @@ var (
 func DebugCmd() *cobra.Command {
 	var (
 		macroPath string
+		mocksPath string
+		envPath   string
+		symsPath  string
 	)
 
 	debugCmd := &cobra.Command{
@@ -34,6 +42,22 @@ func DebugCmd() *cobra.Command {
 			vmEmulator = mimic.NewLinuxEmulator()
 			vm = mimic.NewVM(mimic.VMOptEmulator(vmEmulator))
 
+			if mocksPath != "" {
+				if n, err := loadMockFile(mocksPath); err != nil {
+					printRed("Error while loading mocks: %s\n", err)
+				} else {
+					fmt.Printf("%d mocks loaded\n", n)
+				}
+			}
+
+			if envPath != "" {
+				loadEnvExec([]string{envPath})
+			}
+
+			if symsPath != "" {
+				loadSymbolsExec([]string{symsPath})
+			}
+
 			if macroPath != "" {
 				runMacroExec([]string{macroPath})
 			}
@@ -55,6 +79,9 @@ func DebugCmd() *cobra.Command {
 
 	f := debugCmd.Flags()
 	f.StringVar(&macroPath, "macro", "", "Path to a macro file which will be executed to setup the session")
+	f.StringVar(&mocksPath, "mocks", "", "Path to a file with helper function mocks, see 'help mock load'")
+	f.StringVar(&envPath, "env", "", "Path to a network environment file, see 'help env load'")
+	f.StringVar(&symsPath, "symbols", "", "Path to a kallsyms dump or vmlinux file, see 'help symbols load'")
 
 	return debugCmd
 }
@@ -0,0 +1,197 @@
+package debug
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/mimic"
+)
+
+// helperOverrides are helper function implementations which are used instead of those of the emulator. mimic either
+// doesn't implement them or only supports them for some context types.
+var helperOverrides = map[asm.BuiltinFunc]func(p *mimic.Process) error{
+	asm.FnXdpAdjustHead: helperXDPAdjustHead,
+	asm.FnXdpAdjustTail: helperXDPAdjustTail,
+	asm.FnGetFuncIp:     helperGetFuncIP,
+}
+
+// netHelperOverrides are helper function implementations which use the network environment. They are only used when
+// a network environment is loaded, otherwise the emulator is used so results captured with the context are replayed.
+var netHelperOverrides = map[asm.BuiltinFunc]func(p *mimic.Process) error{
+	asm.FnFibLookup:    helperFibLookup,
+	asm.FnRedirectMap:  helperRedirectMap,
+	asm.FnSkLookupTcp:  helperSkLookupTCP,
+	asm.FnSkcLookupTcp: helperSkLookupTCP,
+	asm.FnSkLookupUdp:  helperSkLookupUDP,
+	asm.FnSkRelease:    helperSkRelease,
+}
+
+// helperOverride returns the implementation which is used instead of the emulator for the given helper, or nil if the
+// emulator should be used. Mocks take precedence over external processes, which take precedence over helperOverrides
+// and netHelperOverrides.
+func helperOverride(fn asm.BuiltinFunc) func(p *mimic.Process) error {
+	if m := mocks[fn]; m != nil {
+		return m.call
+	}
+
+	if proc := externHelpers[fn]; proc != nil {
+		return externHelper(fn, proc)
+	}
+
+	// Sockets returned by lookups in the network environment must still be released if it is unloaded in between
+	if netEnv != nil || (fn == asm.FnSkRelease && len(envSockets.addrs) > 0) {
+		if h := netHelperOverrides[fn]; h != nil {
+			return h
+		}
+	}
+
+	return helperOverrides[fn]
+}
+
+// The minimum size of a XDP packet, the kernel doesn't allow shrinking a packet below the ethernet header size.
+const xdpMinPacketSize = 14
+
+// Offsets of the pointers in struct xdp_md
+const (
+	xdpMDData     = 0
+	xdpMDDataEnd  = 4
+	xdpMDDataMeta = 8
+)
+
+// helperErr returns the negative error number helpers return on failure
+func helperErr(errNo syscall.Errno) uint64 {
+	return uint64(-int64(errNo))
+}
+
+// xdpPacket is the state of a XDP packet as described by the xdp_md context
+type xdpPacket struct {
+	// The xdp_md memory and the offset of the xdp_md within it
+	xdpMD mimic.VMMem
+	off   uint32
+
+	pktEntry mimic.MemoryEntry
+	pktMem   mimic.VMMem
+
+	data, dataEnd, dataMeta uint32
+}
+
+// loadXDPPacket resolves the xdp_md pointed to by R1 and the memory of the packet it points to.
+func loadXDPPacket(p *mimic.Process) (*xdpPacket, error) {
+	entry, off, found := p.VM.MemoryController.GetEntry(uint32(p.Registers.R1))
+	if !found {
+		return nil, fmt.Errorf("no memory at context address 0x%08X", p.Registers.R1)
+	}
+
+	xdpMD, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, fmt.Errorf("context memory '%s' is not virtual memory", entry.Name)
+	}
+
+	pkt := &xdpPacket{xdpMD: xdpMD, off: off}
+	for _, field := range []struct {
+		off uint32
+		val *uint32
+	}{
+		{xdpMDData, &pkt.data},
+		{xdpMDDataEnd, &pkt.dataEnd},
+		{xdpMDDataMeta, &pkt.dataMeta},
+	} {
+		val, err := xdpMD.Load(off+field.off, asm.Word)
+		if err != nil {
+			return nil, fmt.Errorf("load xdp_md field at offset %d: %w", field.off, err)
+		}
+		*field.val = uint32(val)
+	}
+
+	pkt.pktEntry, _, found = p.VM.MemoryController.GetEntry(pkt.data)
+	if !found {
+		return nil, fmt.Errorf("no memory at data address 0x%08X", pkt.data)
+	}
+
+	pkt.pktMem, ok = pkt.pktEntry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, fmt.Errorf("packet memory '%s' is not virtual memory", pkt.pktEntry.Name)
+	}
+
+	return pkt, nil
+}
+
+// helperXDPAdjustHead implements bpf_xdp_adjust_head. The packet can only grow into headroom which already exists in
+// the packet memory of the context.
+func helperXDPAdjustHead(p *mimic.Process) error {
+	delta := int64(int32(p.Registers.R2))
+
+	pkt, err := loadXDPPacket(p)
+	if err != nil {
+		p.Registers.R0 = helperErr(syscall.EINVAL)
+		return nil
+	}
+
+	// No meta data is indicated by data_meta pointing at data
+	metaLen := int64(0)
+	if pkt.dataMeta < pkt.data && pkt.dataMeta >= pkt.pktEntry.Addr {
+		metaLen = int64(pkt.data) - int64(pkt.dataMeta)
+	}
+
+	newData := int64(pkt.data) + delta
+	if newData-metaLen < int64(pkt.pktEntry.Addr) || newData > int64(pkt.dataEnd)-xdpMinPacketSize {
+		p.Registers.R0 = helperErr(syscall.EINVAL)
+		return nil
+	}
+
+	// The meta data is located directly in front of the packet data, so it moves along with it
+	newMeta := newData
+	if metaLen > 0 {
+		meta := make([]byte, metaLen)
+		if err = pkt.pktMem.Read(pkt.dataMeta-pkt.pktEntry.Addr, meta); err != nil {
+			return fmt.Errorf("read meta data: %w", err)
+		}
+
+		newMeta = newData - metaLen
+		if err = pkt.pktMem.Write(uint32(newMeta)-pkt.pktEntry.Addr, meta); err != nil {
+			return fmt.Errorf("write meta data: %w", err)
+		}
+	}
+
+	if err = pkt.xdpMD.Store(pkt.off+xdpMDData, uint64(newData), asm.Word); err != nil {
+		return fmt.Errorf("store data: %w", err)
+	}
+	if err = pkt.xdpMD.Store(pkt.off+xdpMDDataMeta, uint64(newMeta), asm.Word); err != nil {
+		return fmt.Errorf("store data_meta: %w", err)
+	}
+
+	p.Registers.R0 = 0
+	return nil
+}
+
+// helperXDPAdjustTail implements bpf_xdp_adjust_tail. The packet can only grow into tailroom which already exists in
+// the packet memory of the context, grown bytes are zeroed.
+func helperXDPAdjustTail(p *mimic.Process) error {
+	delta := int64(int32(p.Registers.R2))
+
+	pkt, err := loadXDPPacket(p)
+	if err != nil {
+		p.Registers.R0 = helperErr(syscall.EINVAL)
+		return nil
+	}
+
+	newEnd := int64(pkt.dataEnd) + delta
+	if newEnd > int64(pkt.pktEntry.Addr)+int64(pkt.pktEntry.Size) || newEnd-int64(pkt.data) < xdpMinPacketSize {
+		p.Registers.R0 = helperErr(syscall.EINVAL)
+		return nil
+	}
+
+	if delta > 0 {
+		if err = pkt.pktMem.Write(pkt.dataEnd-pkt.pktEntry.Addr, make([]byte, delta)); err != nil {
+			return fmt.Errorf("zero tailroom: %w", err)
+		}
+	}
+
+	if err = pkt.xdpMD.Store(pkt.off+xdpMDDataEnd, uint64(newEnd), asm.Word); err != nil {
+		return fmt.Errorf("store data_end: %w", err)
+	}
+
+	p.Registers.R0 = 0
+	return nil
+}
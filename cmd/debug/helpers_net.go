@@ -0,0 +1,353 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/edb/pkg/netenv"
+	"github.com/dylandreimerink/mimic"
+)
+
+// errNoNetEnv is returned by helpers which need a network environment if none is loaded
+var errNoNetEnv = errors.New("helper requires a network environment, load one with 'env load'")
+
+// Offsets of the fields in struct bpf_fib_lookup
+const (
+	fibFamily    = 0
+	fibTotLen    = 6 // Union with mtu_result
+	fibIfindex   = 8
+	fibRTMetric  = 12 // Union with tos and flowinfo
+	fibIPv4Dst   = 32 // Union with ipv6_dst
+	fibSMAC      = 52
+	fibDMAC      = 58
+	fibParamsLen = 64
+)
+
+// Flags of bpf_fib_lookup
+const (
+	fibLookupOutput = 1 << 1
+)
+
+// helperFibLookup implements bpf_fib_lookup by doing the lookup in the network environment.
+func helperFibLookup(p *mimic.Process) error {
+	if netEnv == nil {
+		return errNoNetEnv
+	}
+
+	if p.Registers.R3 < fibParamsLen {
+		p.Registers.R0 = helperErr(syscall.EINVAL)
+		return nil
+	}
+
+	mem, off, err := helperOutputMem(p.Registers.R2)
+	if err != nil {
+		return fmt.Errorf("params: %w", err)
+	}
+
+	params := make([]byte, fibParamsLen)
+	if err = mem.Read(off, params); err != nil {
+		return fmt.Errorf("read params: %w", err)
+	}
+
+	ne := mimic.GetNativeEndianness()
+
+	lookup := netenv.FibLookup{
+		Output: p.Registers.R4&fibLookupOutput != 0,
+		TotLen: int(ne.Uint16(params[fibTotLen:])),
+	}
+
+	switch params[fibFamily] {
+	case syscall.AF_INET:
+		lookup.Dst = net.IP(params[fibIPv4Dst : fibIPv4Dst+net.IPv4len])
+	case syscall.AF_INET6:
+		lookup.Dst = net.IP(params[fibIPv4Dst : fibIPv4Dst+net.IPv6len])
+	default:
+		p.Registers.R0 = helperErr(syscall.EAFNOSUPPORT)
+		return nil
+	}
+	// The params are overwritten below, so the destination needs its own copy
+	lookup.Dst = append(net.IP(nil), lookup.Dst...)
+
+	lookup.Dev = netEnv.InterfaceByIndex(int(ne.Uint32(params[fibIfindex:])))
+	if lookup.Dev == nil {
+		p.Registers.R0 = helperErr(syscall.ENODEV)
+		return nil
+	}
+
+	result := netEnv.FibLookup(&lookup)
+
+	// Like the kernel, fill in the params as far as the lookup got
+	switch result {
+	case netenv.FibFragNeeded:
+		ne.PutUint16(params[fibTotLen:], uint16(lookup.Route.Dev.MTU))
+
+	case netenv.FibSuccess, netenv.FibNoNeighbour:
+		ne.PutUint32(params[fibIfindex:], uint32(lookup.Route.Dev.Ifindex))
+		ne.PutUint32(params[fibRTMetric:], lookup.Route.Metric)
+		if ip4 := lookup.NextHop.To4(); ip4 != nil {
+			copy(params[fibIPv4Dst:], ip4)
+		} else {
+			copy(params[fibIPv4Dst:], lookup.NextHop.To16())
+		}
+
+		if lookup.Neighbour != nil {
+			copy(params[fibSMAC:], lookup.Route.Dev.MAC)
+			copy(params[fibDMAC:], lookup.Neighbour.MAC)
+		}
+	}
+
+	if err = mem.Write(off, params); err != nil {
+		return fmt.Errorf("write params: %w", err)
+	}
+
+	p.Registers.R0 = uint64(result)
+	return nil
+}
+
+// XDP_REDIRECT, returned by bpf_redirect_map on success
+const xdpRedirect = 4
+
+// helperRedirectMap implements bpf_redirect_map. The redirect succeeds if the key exists in the map, for devmaps the
+// interface must also exist in the network environment. On failure the lower two bits of the flags
+// are returned, which programs use to pass a fallback action.
+func helperRedirectMap(p *mimic.Process) error {
+	if netEnv == nil {
+		return errNoNetEnv
+	}
+
+	entry, _, found := p.VM.MemoryController.GetEntry(uint32(p.Registers.R1))
+	if !found {
+		return fmt.Errorf("invalid map pointer 0x%08X", p.Registers.R1)
+	}
+
+	lm, ok := entry.Object.(mimic.LinuxMap)
+	if !ok {
+		return fmt.Errorf("'%s' is not a map", entry.Name)
+	}
+
+	ne := mimic.GetNativeEndianness()
+	key := make([]byte, 4)
+	ne.PutUint32(key, uint32(p.Registers.R2))
+
+	fallback := p.Registers.R3 & 0x3
+
+	valPtr, err := lm.Lookup(key, p.CPUID())
+	if err != nil || valPtr == 0 {
+		p.Registers.R0 = fallback
+		return nil
+	}
+
+	typ := lm.GetSpec().Type
+	if typ == ebpf.DevMap || typ == ebpf.DevMapHash {
+		// The value is the ifindex, optionally followed by a program fd
+		mem, off, err := helperOutputMem(uint64(valPtr))
+		if err != nil {
+			return fmt.Errorf("devmap value: %w", err)
+		}
+
+		ifindex, err := mem.Load(off, asm.Word)
+		if err != nil {
+			return fmt.Errorf("devmap value: %w", err)
+		}
+
+		// The kernel doesn't allow devmaps to hold interfaces which don't exist
+		if netEnv.InterfaceByIndex(int(ifindex)) == nil {
+			p.Registers.R0 = fallback
+			return nil
+		}
+	}
+
+	p.Registers.R0 = xdpRedirect
+	return nil
+}
+
+// Offsets of the fields in struct bpf_sock
+const (
+	bpfSockBoundDevIf = 0
+	bpfSockFamily     = 4
+	bpfSockType       = 8
+	bpfSockProtocol   = 12
+	bpfSockSrcIP4     = 24
+	bpfSockSrcIP6     = 28
+	bpfSockSrcPort    = 44
+	bpfSockDstPort    = 48
+	bpfSockDstIP4     = 52
+	bpfSockDstIP6     = 56
+	bpfSockState      = 72
+	bpfSockRxQueue    = 76
+	bpfSockSize       = 80
+)
+
+// TCP states as used in struct bpf_sock
+const (
+	tcpEstablished = 1
+	tcpClose       = 7
+	tcpListen      = 10
+)
+
+// Sizes of the ipv4 and ipv6 variants of struct bpf_sock_tuple
+const (
+	sockTupleIPv4Len = 12
+	sockTupleIPv6Len = 36
+)
+
+// envSockets are the bpf_sock structs allocated by socket lookups of the current process, they are freed when
+// released by the program or when a new process is started.
+var envSockets struct {
+	process *mimic.Process
+	addrs   map[uint32]bool
+}
+
+func helperSkLookupTCP(p *mimic.Process) error {
+	return skLookup(p, "tcp")
+}
+
+func helperSkLookupUDP(p *mimic.Process) error {
+	return skLookup(p, "udp")
+}
+
+// skLookup implements bpf_sk_lookup_tcp, bpf_skc_lookup_tcp and bpf_sk_lookup_udp by looking up the socket in the
+// network environment. The returned pointer points to a struct bpf_sock describing the socket.
+func skLookup(p *mimic.Process, proto string) error {
+	if netEnv == nil {
+		return errNoNetEnv
+	}
+
+	if envSockets.process != p {
+		freeEnvSockets()
+		envSockets.process = p
+	}
+
+	// The kernel returns NULL for unknown flags and invalid tuples
+	p.Registers.R0 = 0
+	if p.Registers.R5 != 0 {
+		return nil
+	}
+
+	var ipLen int
+	switch p.Registers.R3 {
+	case sockTupleIPv4Len:
+		ipLen = net.IPv4len
+	case sockTupleIPv6Len:
+		ipLen = net.IPv6len
+	default:
+		return nil
+	}
+
+	mem, off, err := helperOutputMem(p.Registers.R2)
+	if err != nil {
+		return fmt.Errorf("tuple: %w", err)
+	}
+
+	tuple := make([]byte, p.Registers.R3)
+	if err = mem.Read(off, tuple); err != nil {
+		return fmt.Errorf("read tuple: %w", err)
+	}
+
+	// The tuple is from the perspective of the packet, so the source is the remote end of the socket
+	src := netenv.SockAddr{
+		IP:   append(net.IP(nil), tuple[:ipLen]...),
+		Port: uint16(tuple[2*ipLen])<<8 | uint16(tuple[2*ipLen+1]),
+	}
+	dst := netenv.SockAddr{
+		IP:   append(net.IP(nil), tuple[ipLen:2*ipLen]...),
+		Port: uint16(tuple[2*ipLen+2])<<8 | uint16(tuple[2*ipLen+3]),
+	}
+
+	sock := netEnv.LookupSocket(proto, src, dst)
+	if sock == nil {
+		return nil
+	}
+
+	sockMem := &mimic.PlainMemory{
+		Backing:   make([]byte, bpfSockSize),
+		ByteOrder: mimic.GetNativeEndianness(),
+	}
+	fillBPFSock(sockMem.Backing, sock)
+
+	entry, err := p.VM.MemoryController.AddEntry(sockMem, bpfSockSize, "sock "+sock.String())
+	if err != nil {
+		return fmt.Errorf("add socket memory: %w", err)
+	}
+
+	if envSockets.addrs == nil {
+		envSockets.addrs = make(map[uint32]bool)
+	}
+	envSockets.addrs[entry.Addr] = true
+
+	p.Registers.R0 = uint64(entry.Addr)
+	return nil
+}
+
+// fillBPFSock fills a struct bpf_sock with the properties of the socket
+func fillBPFSock(b []byte, sock *netenv.Socket) {
+	ne := mimic.GetNativeEndianness()
+
+	if sock.Dev != nil {
+		ne.PutUint32(b[bpfSockBoundDevIf:], uint32(sock.Dev.Ifindex))
+	}
+
+	if local4 := sock.Local.IP.To4(); local4 != nil {
+		ne.PutUint32(b[bpfSockFamily:], syscall.AF_INET)
+		copy(b[bpfSockSrcIP4:], local4)
+		if remote4 := sock.Remote.IP.To4(); remote4 != nil {
+			copy(b[bpfSockDstIP4:], remote4)
+		}
+	} else {
+		ne.PutUint32(b[bpfSockFamily:], syscall.AF_INET6)
+		copy(b[bpfSockSrcIP6:], sock.Local.IP.To16())
+		copy(b[bpfSockDstIP6:], sock.Remote.IP.To16())
+	}
+
+	state := uint32(tcpEstablished)
+	if sock.Proto == "tcp" {
+		ne.PutUint32(b[bpfSockType:], syscall.SOCK_STREAM)
+		ne.PutUint32(b[bpfSockProtocol:], syscall.IPPROTO_TCP)
+		if sock.State == netenv.SocketListen {
+			state = tcpListen
+		}
+	} else {
+		ne.PutUint32(b[bpfSockType:], syscall.SOCK_DGRAM)
+		ne.PutUint32(b[bpfSockProtocol:], syscall.IPPROTO_UDP)
+		if sock.State == netenv.SocketListen {
+			state = tcpClose
+		}
+	}
+	ne.PutUint32(b[bpfSockState:], state)
+
+	// The source port is in host byte order, the destination port in network byte order
+	ne.PutUint32(b[bpfSockSrcPort:], uint32(sock.Local.Port))
+	b[bpfSockDstPort] = byte(sock.Remote.Port >> 8)
+	b[bpfSockDstPort+1] = byte(sock.Remote.Port)
+
+	// No RX queue is recorded
+	ne.PutUint32(b[bpfSockRxQueue:], 0xFFFFFFFF)
+}
+
+// helperSkRelease implements bpf_sk_release for sockets returned by skLookup
+func helperSkRelease(p *mimic.Process) error {
+	addr := uint32(p.Registers.R1)
+	if !envSockets.addrs[addr] {
+		return fmt.Errorf("0x%08X is not a socket returned by a socket lookup", addr)
+	}
+
+	delete(envSockets.addrs, addr)
+	if err := p.VM.MemoryController.DelEntryByAddr(addr); err != nil {
+		return fmt.Errorf("free socket memory: %w", err)
+	}
+
+	p.Registers.R0 = 0
+	return nil
+}
+
+// freeEnvSockets frees the sockets which were not released by the previous process
+func freeEnvSockets() {
+	for addr := range envSockets.addrs {
+		_ = vm.MemoryController.DelEntryByAddr(addr)
+	}
+	envSockets.addrs = nil
+}
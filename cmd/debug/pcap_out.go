@@ -0,0 +1,190 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/dylandreimerink/edb/pkg/pcapng"
+	"github.com/dylandreimerink/mimic"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapOutput writes the packets of executed contexts to a PCAPNG file with the verdict as packet comment, or to one
+// PCAP file per verdict.
+type pcapOutput struct {
+	path string
+
+	// Only set when writing PCAPNG
+	ng *pcapng.Writer
+	// PCAP writers per verdict
+	split map[string]*pcapgo.Writer
+
+	files []*os.File
+	count map[string]int
+}
+
+// newPCAPOutput creates a PCAPNG output if path has a .pcapng extension, otherwise the output is split by verdict
+// into files named '<path without extension>.<verdict>.pcap'.
+func newPCAPOutput(path string) (*pcapOutput, error) {
+	out := &pcapOutput{
+		path:  path,
+		split: make(map[string]*pcapgo.Writer),
+		count: make(map[string]int),
+	}
+
+	if filepath.Ext(path) != ".pcapng" {
+		return out, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create pcapng file: %w", err)
+	}
+	out.files = append(out.files, f)
+
+	out.ng, err = pcapng.NewWriter(f, "edb", layers.LinkTypeEthernet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// splitPath returns the path of the PCAP file for the given verdict
+func (out *pcapOutput) splitPath(verdict string) string {
+	base := strings.TrimSuffix(out.path, filepath.Ext(out.path))
+	return fmt.Sprintf("%s.%s.pcap", base, strings.ToLower(verdict))
+}
+
+// writePacket writes the packet of a context with the given verdict
+func (out *pcapOutput) writePacket(verdict string, ctxID int, ctxName string, pkt []byte) error {
+	ts := time.Now()
+
+	if out.ng != nil {
+		comment := fmt.Sprintf("verdict: %s, context %d: %s", verdict, ctxID, ctxName)
+		if err := out.ng.WritePacket(ts, pkt, comment); err != nil {
+			return fmt.Errorf("write packet: %w", err)
+		}
+		out.count[verdict]++
+		return nil
+	}
+
+	w := out.split[verdict]
+	if w == nil {
+		f, err := os.Create(out.splitPath(verdict))
+		if err != nil {
+			return fmt.Errorf("create pcap file: %w", err)
+		}
+		out.files = append(out.files, f)
+
+		w = pcapgo.NewWriter(f)
+		if err = w.WriteFileHeader(0, layers.LinkTypeEthernet); err != nil {
+			return fmt.Errorf("write pcap header: %w", err)
+		}
+		out.split[verdict] = w
+	}
+
+	err := w.WritePacket(gopacket.CaptureInfo{
+		Timestamp:     ts,
+		CaptureLength: len(pkt),
+		Length:        len(pkt),
+	}, pkt)
+	if err != nil {
+		return fmt.Errorf("write packet: %w", err)
+	}
+	out.count[verdict]++
+
+	return nil
+}
+
+// close closes all files and prints a summary of the written packets
+func (out *pcapOutput) close() {
+	for _, f := range out.files {
+		if err := f.Close(); err != nil {
+			printRed("error closing '%s': %s\n", f.Name(), err)
+		}
+	}
+
+	verdicts := make([]string, 0, len(out.count))
+	for verdict := range out.count {
+		verdicts = append(verdicts, verdict)
+	}
+	sort.Strings(verdicts)
+
+	for _, verdict := range verdicts {
+		n := out.count[verdict]
+		path := out.path
+		if out.ng == nil {
+			path = out.splitPath(verdict)
+		}
+		fmt.Printf("Wrote %d %s packets to '%s'\n", n, verdict, path)
+	}
+}
+
+// currentPacket reads the packet of the current process between the data and data_end fields of the context.
+func currentPacket() ([]byte, error) {
+	layout, _ := ctxLayout(process.Program.Type)
+
+	var dataField, dataEndField *ctxutil.Field
+	for i := range layout {
+		switch layout[i].Name {
+		case "data":
+			dataField = &layout[i]
+		case "data_end":
+			dataEndField = &layout[i]
+		}
+	}
+	if dataField == nil || dataEndField == nil {
+		return nil, fmt.Errorf("the context of %s programs has no packet", process.Program.Type)
+	}
+
+	entry, off, found := vm.MemoryController.GetEntry(ctxAddr)
+	if !found {
+		return nil, fmt.Errorf("no memory at context address 0x%08X", ctxAddr)
+	}
+
+	vmMem, ok := entry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, fmt.Errorf("memory of context '%s' is not virtual memory", entry.Name)
+	}
+
+	data, err := loadCtxField(vmMem, off+dataField.Offset, dataField.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	dataEnd, err := loadCtxField(vmMem, off+dataEndField.Offset, dataEndField.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	pktEntry, dataOff, found := vm.MemoryController.GetEntry(uint32(data))
+	if !found {
+		return nil, fmt.Errorf("no memory at data address 0x%08X", data)
+	}
+
+	pktMem, ok := pktEntry.Object.(mimic.VMMem)
+	if !ok {
+		return nil, fmt.Errorf("memory of packet '%s' is not virtual memory", pktEntry.Name)
+	}
+
+	endOff := int64(dataEnd) - int64(pktEntry.Addr)
+	if endOff < int64(dataOff) || endOff > int64(pktEntry.Size) {
+		return nil, fmt.Errorf("data_end 0x%08X is outside of the packet memory", dataEnd)
+	}
+
+	pkt := make([]byte, endOff-int64(dataOff))
+	if err = pktMem.Read(dataOff, pkt); err != nil {
+		return nil, fmt.Errorf("read packet: %w", err)
+	}
+
+	return pkt, nil
+}
@@ -0,0 +1,51 @@
+package debug
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// stepProcess executes the next instruction of the current process. All commands should use this instead of calling
+// process.Step directly, so written stack slots and BPF-to-BPF call frames are tracked, helper calls are recorded for
+// replays and overridden helpers are called instead of the emulated ones.
+func stepProcess() (bool, error) {
+	var inst asm.Instruction
+	pc := process.Registers.PC
+	if pc < len(process.Program.Instructions) {
+		inst = process.Program.Instructions[pc]
+	}
+
+	stackBeforeStep(inst, pc)
+
+	helperCall := inst.OpCode.JumpOp() == asm.Call && inst.Src != asm.PseudoCall
+
+	var replay *replayCall
+	if helperCall {
+		replay = startReplayCall(inst, pc)
+	}
+
+	// Mocks, extern helpers and the network environment take precedence over the emulated helpers
+	if override := helperOverride(asm.BuiltinFunc(inst.Constant)); helperCall && override != nil {
+		if err := override(process); err != nil {
+			return true, fmt.Errorf("inst at PC(%d): %w", pc, err)
+		}
+		process.Registers.PC++
+	} else {
+		stop, err := process.Step()
+		if stop && err == nil {
+			finishReplay()
+		}
+		if err != nil || stop {
+			return stop, err
+		}
+	}
+
+	if replay != nil {
+		finishReplayCall(replay)
+	}
+
+	stackAfterStep(inst)
+
+	return false, nil
+}
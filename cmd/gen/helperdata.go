@@ -60,15 +60,16 @@ func main() {
 	for _, match := range fnRegexp.FindAllSubmatch(contents, -1) {
 		parsedFunc := parsedFunc{
 			RetType: strToCtype(strings.TrimSpace(string(match[1]))),
+			Name:    string(match[2]),
 		}
 
-		num, err := strconv.Atoi(string(match[3]))
+		num, err := strconv.Atoi(string(match[4]))
 		if err != nil {
 			panic(err)
 		}
 		parsedFunc.FnNum = asm.BuiltinFunc(num)
 
-		for _, param := range strings.Split(string(match[2]), ", ") {
+		for _, param := range strings.Split(string(match[3]), ", ") {
 			name := paramRegexp.FindString(param)
 			typ := strings.TrimSuffix(param, name)
 
@@ -83,6 +84,9 @@ func main() {
 			})
 		}
 
+		parsedFunc.Ret = retKind(parsedFunc)
+		parsedFunc.Outputs = outputs(parsedFunc)
+
 		parsedFuncs = append(parsedFuncs, parsedFunc)
 	}
 
@@ -98,15 +102,155 @@ func main() {
 }
 
 var (
-	fnRegexp    = regexp.MustCompile(`static (.+)\(\*[a-zA-Z0-9_]+\)\(([^;\n]*)\) = \(void \*\) ([0-9]+);\n`)
+	fnRegexp    = regexp.MustCompile(`static (.+)\(\*([a-zA-Z0-9_]+)\)\(([^;\n]*)\) = \(void \*\) ?([0-9]+);\n`)
 	cTypeRegexp = regexp.MustCompile(`(const)? ?(struct)? ?([a-zA-Z_0-9\.]+)? ?(\*)?`)
 	paramRegexp = regexp.MustCompile(`([a-zA-Z0-9_]+)$`)
+	sizeRegexp  = regexp.MustCompile(`(size|len|sz)`)
 )
 
+var (
+	// Helpers which return a pointer to a map value
+	mapValueReturns = map[string]bool{
+		"bpf_map_lookup_elem":   true,
+		"bpf_get_local_storage": true,
+		"bpf_sk_storage_get":    true,
+		"bpf_inode_storage_get": true,
+		"bpf_task_storage_get":  true,
+	}
+
+	// Helpers which are declared to return a value, but which don't set R0 according to the verifier
+	voidReturns = map[string]bool{
+		"bpf_tail_call":   true,
+		"bpf_spin_lock":   true,
+		"bpf_spin_unlock": true,
+	}
+
+	// Helpers which return a pointer to a kernel object, which can't be derived from the return type
+	kernelPtrReturns = map[string]bool{
+		"bpf_per_cpu_ptr":  true,
+		"bpf_this_cpu_ptr": true,
+		"bpf_task_pt_regs": true,
+	}
+
+	// Params which look like output buffers, a non-const pointer followed by a size, but which are read by the helper
+	// or are the context or a map. Keyed by '<helper>.<param>'
+	inputBuffers = map[string]bool{
+		"bpf_skb_change_tail.skb":        true,
+		"bpf_skb_pull_data.skb":          true,
+		"bpf_skb_change_head.skb":        true,
+		"bpf_skb_adjust_room.skb":        true,
+		"bpf_reserve_hdr_opt.skops":      true,
+		"bpf_ringbuf_reserve.ringbuf":    true,
+		"bpf_bind.addr":                  true,
+		"bpf_tcp_check_syncookie.th":     true,
+		"bpf_tcp_gen_syncookie.th":       true,
+		"bpf_redirect_neigh.params":      true,
+		"bpf_sys_bpf.attr":               true,
+		"bpf_skb_set_tunnel_key.key":     true,
+		"bpf_skb_set_tunnel_opt.opt":     true,
+		"bpf_perf_event_output.data":     true,
+		"bpf_setsockopt.optval":          true,
+		"bpf_lwt_push_encap.hdr":         true,
+		"bpf_lwt_seg6_action.param":      true,
+		"bpf_sk_lookup_tcp.tuple":        true,
+		"bpf_sk_lookup_udp.tuple":        true,
+		"bpf_skc_lookup_tcp.tuple":       true,
+		"bpf_tcp_check_syncookie.iph":    true,
+		"bpf_tcp_gen_syncookie.iph":      true,
+		"bpf_skb_output.data":            true,
+		"bpf_xdp_output.data":            true,
+		"bpf_ringbuf_output.data":        true,
+		"bpf_seq_printf_btf.ptr":         true,
+		"bpf_snprintf_btf.ptr":           true,
+		"bpf_snprintf.data":              true,
+		"bpf_btf_find_by_name_kind.name": true,
+		"bpf_xdp_store_bytes.buf":        true,
+		"bpf_csum_diff.from":             true,
+		"bpf_csum_diff.to":               true,
+	}
+
+	// Params which point to fixed size output buffers, keyed by '<helper>.<param>', the value is the size in bytes
+	fixedOutputs = map[string]int{
+		"bpf_check_mtu.mtu_len":  4,
+		"bpf_get_func_arg.value": 8,
+		"bpf_get_func_ret.value": 8,
+		"bpf_strtol.res":         8,
+		"bpf_strtoul.res":        8,
+	}
+
+	// Params which point to output buffers the size of the value of the map in the first param, keyed by
+	// '<helper>.<param>'
+	mapValueOutputs = map[string]bool{
+		"bpf_map_peek_elem.value": true,
+		"bpf_map_pop_elem.value":  true,
+	}
+)
+
+// retKind returns the name of the helperdata.RetKind of the return value of the helper
+func retKind(fn parsedFunc) string {
+	switch {
+	case voidReturns[fn.Name]:
+		return "RetVoid"
+	case kernelPtrReturns[fn.Name]:
+		return "RetKernelPtr"
+	case !fn.RetType.Ptr:
+		if fn.RetType.Name == "void" {
+			return "RetVoid"
+		}
+		return "RetScalar"
+	case mapValueReturns[fn.Name]:
+		return "RetMapValue"
+	case fn.RetType.Struct:
+		return "RetKernelPtr"
+	default:
+		return "RetMem"
+	}
+}
+
+// outputs returns the params through which the helper returns data. These are the non-const pointers followed by a
+// size param and the params listed in fixedOutputs and mapValueOutputs.
+func outputs(fn parsedFunc) []parsedOutput {
+	var outs []parsedOutput
+	for i, param := range fn.Params {
+		key := fn.Name + "." + param.Name
+		if size, ok := fixedOutputs[key]; ok {
+			outs = append(outs, parsedOutput{Kind: "OutputFixed", Param: i, SizeParam: -1, Size: size})
+			continue
+		}
+
+		if mapValueOutputs[key] {
+			outs = append(outs, parsedOutput{Kind: "OutputMapValue", Param: i, SizeParam: -1})
+			continue
+		}
+
+		if !param.Typ.Ptr || param.Typ.Const || inputBuffers[key] || i+1 >= len(fn.Params) {
+			continue
+		}
+
+		size := fn.Params[i+1]
+		if size.Typ.Ptr || size.Typ.Struct || !sizeRegexp.MatchString(size.Name) {
+			continue
+		}
+
+		outs = append(outs, parsedOutput{Param: i, SizeParam: i + 1})
+	}
+	return outs
+}
+
 type parsedFunc struct {
+	Name    string
 	RetType parsedCType
 	Params  []parsedParam
 	FnNum   asm.BuiltinFunc
+	Ret     string
+	Outputs []parsedOutput
+}
+
+type parsedOutput struct {
+	Kind      string
+	Param     int
+	SizeParam int
+	Size      int
 }
 
 type parsedParam struct {
@@ -163,8 +307,60 @@ import (
 
 // HelperFunc describes the signature of a helper function
 type HelperFunc struct {
+	// Name is the name of the helper in C, like bpf_map_lookup_elem
+	Name    string
 	RetType CType
 	Params  []HelperParam
+	// Ret describes what the return value of the helper is
+	Ret RetKind
+	// Outputs lists the params which point to memory written by the helper
+	Outputs []HelperOutput
+}
+
+// RetKind describes what the return value of a helper function is
+type RetKind int
+
+const (
+	// RetScalar is a number, like a size, an ID or an error code
+	RetScalar RetKind = iota
+	// RetVoid means the helper doesn't return a value
+	RetVoid
+	// RetMapValue is a pointer to a map value, or NULL
+	RetMapValue
+	// RetMem is a pointer to memory which isn't a map value, like a reserved ringbuffer record, or NULL
+	RetMem
+	// RetKernelPtr is a pointer to a kernel object, like a socket or a task, or NULL
+	RetKernelPtr
+)
+
+// IsPtr returns true if the return value is a pointer, these are only meaningful within the kernel which returned
+// them, except for comparisons against NULL.
+func (r RetKind) IsPtr() bool {
+	return r == RetMapValue || r == RetMem || r == RetKernelPtr
+}
+
+// OutputKind describes how the size of the memory written by a helper is determined
+type OutputKind int
+
+const (
+	// OutputSizeParam memory has the size given by another param of the helper
+	OutputSizeParam OutputKind = iota
+	// OutputFixed memory has a fixed size
+	OutputFixed
+	// OutputMapValue memory has the value size of the map passed as first param, like the value of
+	// bpf_map_peek_elem
+	OutputMapValue
+)
+
+// HelperOutput describes a param which points to memory written by the helper
+type HelperOutput struct {
+	Kind OutputKind
+	// The index of the pointer param
+	Param int
+	// The index of the param which holds the size of the memory, or -1 if the size isn't given by a param
+	SizeParam int
+	// The size of the memory if it is fixed
+	Size int
 }
 
 // HelperParam describes a parameter of a helper function
@@ -203,11 +399,17 @@ func (c CType) String() string {
 // Signatures is a map of eBPF helper function signatures keyed by asm.BuiltinFunc
 var Signatures = map[asm.BuiltinFunc]HelperFunc{ {{ range . }}
 asm.{{.FnNum}}: {
+	Name: "{{.Name}}",
 	RetType: {{.RetType}},
 	Params: []HelperParam{
 		{{ range .Params }}{Type: {{.Typ}}, Name: "{{.Name}}"},
 		{{end}}
-    },
+    },{{ if ne .Ret "RetScalar" }}
+	Ret: {{.Ret}},{{end}}{{ if .Outputs }}
+	Outputs: []HelperOutput{
+		{{ range .Outputs }}{ {{- if .Kind }}Kind: {{.Kind}}, {{end}}Param: {{.Param}}, SizeParam: {{.SizeParam}}{{ if .Size }}, Size: {{.Size}}{{end}}},
+		{{end}}
+	},{{end}}
 },{{end}}
 }
 `
@@ -0,0 +1,78 @@
+// Package ciliumcompat gives access to the parts of cilium/ebpf which edb needs but cilium/ebpf doesn't export. It
+// mirrors unexported types, so it only works with the version of cilium/ebpf it is written for. The size of the
+// mirrored types is checked at compile time and the version of cilium/ebpf the binary is built with at runtime.
+package ciliumcompat
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"unsafe"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+// Version is the version of cilium/ebpf the mirrored types are written for
+const Version = "v0.11.0"
+
+const modulePath = "github.com/cilium/ebpf"
+
+// coreRelocation mirrors btf.CORERelocation
+type coreRelocation struct {
+	typ      btf.Type
+	accessor []int
+	kind     uint32
+	id       btf.TypeID
+}
+
+// These fail to compile if the size of the mirror differs from the size of the original
+var (
+	_ = [1]struct{}{}[unsafe.Sizeof(btf.CORERelocation{})-unsafe.Sizeof(coreRelocation{})]
+	_ = [1]struct{}{}[unsafe.Sizeof(coreRelocation{})-unsafe.Sizeof(btf.CORERelocation{})]
+)
+
+var (
+	versionOnce sync.Once
+	versionErr  error
+)
+
+// CheckVersion returns an error if the binary is built with another version of cilium/ebpf than Version. Binaries
+// built without module information are assumed to use the right version.
+func CheckVersion() error {
+	versionOnce.Do(func() {
+		versionErr = checkVersion(debug.ReadBuildInfo())
+	})
+	return versionErr
+}
+
+func checkVersion(info *debug.BuildInfo, ok bool) error {
+	if !ok {
+		return nil
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Version != Version {
+			return fmt.Errorf("built with %s %s, edb only supports %s", modulePath, dep.Version, Version)
+		}
+	}
+
+	return nil
+}
+
+// CORERelocation returns the local type, the accessor and the kind of a CO-RE relocation, the kind is a value of
+// enum bpf_core_relo_kind.
+func CORERelocation(relo *btf.CORERelocation) (typ btf.Type, accessor []int, kind uint32, err error) {
+	if err = CheckVersion(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	mirror := (*coreRelocation)(unsafe.Pointer(relo))
+	return mirror.typ, mirror.accessor, mirror.kind, nil
+}
@@ -0,0 +1,63 @@
+package ciliumcompat
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+)
+
+func TestCheckVersion(t *testing.T) {
+	if err := CheckVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &debug.BuildInfo{Deps: []*debug.Module{{Path: modulePath, Version: "v0.9.0"}}}
+	if err := checkVersion(info, true); err == nil {
+		t.Error("expected error for another version")
+	}
+
+	info.Deps[0].Replace = &debug.Module{Path: modulePath, Version: Version}
+	if err := checkVersion(info, true); err != nil {
+		t.Errorf("replaced version: %s", err)
+	}
+
+	if err := checkVersion(nil, false); err != nil {
+		t.Errorf("no build info: %s", err)
+	}
+}
+
+// TestCORERelocation checks the mirror against the relocations of the CO-RE tests of cilium/ebpf, the first
+// relocation of the program reads member 'a' of 'struct s'.
+func TestCORERelocation(t *testing.T) {
+	spec, err := ebpf.LoadCollectionSpec("../../pkg/corerelo/testdata/relocs_read-el.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var relo *btf.CORERelocation
+	for _, ins := range spec.Programs["reads"].Instructions {
+		if relo = btf.CORERelocationMetadata(&ins); relo != nil {
+			break
+		}
+	}
+	if relo == nil {
+		t.Fatal("program has no CO-RE relocations")
+	}
+
+	typ, accessor, kind, err := CORERelocation(relo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, ok := typ.(*btf.Struct); !ok || s.Name != "s" {
+		t.Errorf("got type %v, want struct s", typ)
+	}
+	if len(accessor) != 2 || accessor[0] != 0 || accessor[1] != 1 {
+		t.Errorf("got accessor %v, want [0 1]", accessor)
+	}
+	if kind != 0 {
+		t.Errorf("got kind %d, want 0 (byte_off)", kind)
+	}
+}
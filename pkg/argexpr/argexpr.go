@@ -0,0 +1,387 @@
+// Package argexpr implements C-like integer expressions over named variables, used to compute the results of mocked
+// helper functions from their arguments.
+//
+// Expressions consist of numbers, in decimal, hex(0x), octal(0o) or binary(0b), variables, parentheses and the
+// operators of C with their C precedence:
+//
+//	unary:  - ~ !
+//	binary: * / % + - << >> < <= > >= == != & ^ | && ||
+//	ternary: cond ? a : b
+//
+// All arithmetic is done on unsigned 64-bit integers and wraps around, like in eBPF. Division or modulo by zero
+// results in 0, comparisons and logical operators result in 0 or 1.
+package argexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression, vars holds the values of the variables. An error is returned if the expression uses
+// a variable which isn't in vars.
+func (e *Expr) Eval(vars map[string]uint64) (uint64, error) {
+	return e.root.eval(vars)
+}
+
+type node interface {
+	eval(vars map[string]uint64) (uint64, error)
+}
+
+type numNode uint64
+
+func (n numNode) eval(vars map[string]uint64) (uint64, error) { return uint64(n), nil }
+
+type varNode string
+
+func (n varNode) eval(vars map[string]uint64) (uint64, error) {
+	v, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("unknown variable '%s'", string(n))
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op    string
+	inner node
+}
+
+func (n *unaryNode) eval(vars map[string]uint64) (uint64, error) {
+	v, err := n.inner.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case "-":
+		return -v, nil
+	case "~":
+		return ^v, nil
+	default: // "!"
+		return boolVal(v == 0), nil
+	}
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(vars map[string]uint64) (uint64, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	// Like in C, the right side of logical operators is only evaluated if needed
+	switch n.op {
+	case "&&":
+		if l == 0 {
+			return 0, nil
+		}
+	case "||":
+		if l != 0 {
+			return 1, nil
+		}
+	}
+
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, nil
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return 0, nil
+		}
+		return l % r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "<<":
+		return l << (r & 63), nil
+	case ">>":
+		return l >> (r & 63), nil
+	case "<":
+		return boolVal(l < r), nil
+	case "<=":
+		return boolVal(l <= r), nil
+	case ">":
+		return boolVal(l > r), nil
+	case ">=":
+		return boolVal(l >= r), nil
+	case "==":
+		return boolVal(l == r), nil
+	case "!=":
+		return boolVal(l != r), nil
+	case "&":
+		return l & r, nil
+	case "^":
+		return l ^ r, nil
+	case "|":
+		return l | r, nil
+	default: // "&&", "||"
+		return boolVal(r != 0), nil
+	}
+}
+
+type ternaryNode struct {
+	cond, then, els node
+}
+
+func (n *ternaryNode) eval(vars map[string]uint64) (uint64, error) {
+	c, err := n.cond.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	if c != 0 {
+		return n.then.eval(vars)
+	}
+	return n.els.eval(vars)
+}
+
+func boolVal(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// The binary operators per precedence level, from lowest to highest
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type token struct {
+	text string
+	pos  int
+}
+
+// Operators, multi character operators first so they take precedence over their single character prefix
+var operators = []string{
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*", "/", "%", "+", "-", "<", ">", "&", "^", "|", "~", "!", "?", ":", "(", ")",
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+
+		if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{text: src[start:i], pos: start})
+			continue
+		}
+
+		op := ""
+		for _, candidate := range operators {
+			if strings.HasPrefix(src[i:], candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+		}
+
+		tokens = append(tokens, token{text: op, pos: i})
+		i += len(op)
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+func (p *parser) parseTernary() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != "?" {
+		return cond, nil
+	}
+	p.pos++
+
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() != ":" {
+		return nil, p.expected("':'")
+	}
+	p.pos++
+
+	els, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ternaryNode{cond: cond, then: then, els: els}, nil
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryOps) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		if !contains(binaryOps[level], op) {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch op := p.peek(); op {
+	case "-", "~", "!":
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, inner: inner}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	if tok.text == "(" {
+		inner, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, p.expected("')'")
+		}
+		p.pos++
+
+		return inner, nil
+	}
+
+	c := rune(tok.text[0])
+	if unicode.IsDigit(c) {
+		num, err := strconv.ParseUint(tok.text, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+		}
+		return numNode(num), nil
+	}
+
+	if c == '_' || unicode.IsLetter(c) {
+		return varNode(tok.text), nil
+	}
+
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
+
+func (p *parser) expected(what string) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("expected %s at end of expression", what)
+	}
+	return fmt.Errorf("expected %s at position %d, got '%s'", what, p.tokens[p.pos].pos, p.tokens[p.pos].text)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package argexpr
+
+import (
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]uint64{
+		"r1":    0x1234,
+		"r2":    3,
+		"flags": 0,
+	}
+
+	tests := []struct {
+		expr string
+		want uint64
+	}{
+		{"42", 42},
+		{"0x10 + 0o10 + 0b10", 26},
+		{"r1 & 0xff", 0x34},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"r1 >> 8 | r2 << 16", 0x30012},
+		{"-1", 0xFFFFFFFFFFFFFFFF},
+		{"~0 == -1", 1},
+		{"!flags", 1},
+		{"r2 / 0", 0},
+		{"r2 % 0", 0},
+		{"r2 > 2 && r2 < 4", 1},
+		{"flags || r2", 1},
+		{"flags && unknown", 0},
+		{"r2 == 3 ? 10 : 20", 10},
+		{"r2 != 3 ? 10 : r2 == 4 ? 20 : 30", 30},
+		{"10 - 3 - 2", 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			expr, err := Compile(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := expr.Eval(vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "expected ')' at end of expression"},
+		{"1 ? 2", "expected ':' at end of expression"},
+		{"1 2", "unexpected '2' at position 2"},
+		{"1 $ 2", "unexpected character '$' at position 2"},
+		{"0xZZ", "invalid number '0xZZ' at position 0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := Compile(test.expr)
+			if err == nil || err.Error() != test.err {
+				t.Errorf("got error '%v', want '%s'", err, test.err)
+			}
+		})
+	}
+}
+
+func TestUnknownVariable(t *testing.T) {
+	expr, err := Compile("r1 + r6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = expr.Eval(map[string]uint64{"r1": 1})
+	if err == nil || err.Error() != "unknown variable 'r6'" {
+		t.Errorf("got error '%v', want unknown variable error", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Package corerelo resolves the CO-RE relocations of programs against the BTF of a target kernel, while keeping track
+// of the result of every relocation so they can be inspected.
+package corerelo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/edb/internal/ciliumcompat"
+	"github.com/dylandreimerink/mimic"
+)
+
+// Kind is the kind of a CO-RE relocation, as in enum bpf_core_relo_kind
+type Kind uint32
+
+const (
+	FieldByteOffset Kind = iota
+	FieldByteSize
+	FieldExists
+	FieldSigned
+	FieldLShiftU64
+	FieldRShiftU64
+	TypeIDLocal
+	TypeIDTarget
+	TypeExists
+	TypeSize
+	EnumvalExists
+	EnumvalValue
+)
+
+// The names libbpf uses for the relocation kinds
+var kindNames = []string{
+	FieldByteOffset: "byte_off",
+	FieldByteSize:   "byte_sz",
+	FieldExists:     "field_exists",
+	FieldSigned:     "signed",
+	FieldLShiftU64:  "lshift_u64",
+	FieldRShiftU64:  "rshift_u64",
+	TypeIDLocal:     "local_type_id",
+	TypeIDTarget:    "target_type_id",
+	TypeExists:      "type_exists",
+	TypeSize:        "type_size",
+	EnumvalExists:   "enumval_exists",
+	EnumvalValue:    "enumval_value",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(k))
+}
+
+// The helper number libbpf and cilium/ebpf use to poison instructions of relocations which can't be resolved
+const poisonHelper = 0xbad2310
+
+// Relocation is a CO-RE relocation of an instruction
+type Relocation struct {
+	// The index of the relocated instruction in the program
+	Index int
+	Kind  Kind
+	// The local type and the accessor, which is the list of member and array indices from the type to the field or
+	// the index of the enum value.
+	Type     btf.Type
+	Accessor []int
+
+	// The value of the instruction as compiled and after relocation, this is an offset, size or constant depending
+	// on the kind of relocation.
+	Local, Target int64
+	// Relocated is true if the relocation was resolved against a target, Target is only valid if it is set
+	Relocated bool
+	// Poisoned is true if the target has no matching type or field. Like libbpf, the instruction is replaced with a
+	// call to an invalid helper, which fails when executed.
+	Poisoned bool
+	// Err is set if the relocation failed, the instruction is left as is
+	Err error
+
+	relo *btf.CORERelocation
+}
+
+// AccessString returns the accessor in the format used by LLVM, like '0:1:2'
+func (r *Relocation) AccessString() string {
+	strs := make([]string, len(r.Accessor))
+	for i, idx := range r.Accessor {
+		strs[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(strs, ":")
+}
+
+// Path returns a C-like description of what is relocated, like 'struct task_struct.pid', 'enum e::VALUE' or
+// 'struct sk_buff'.
+func (r *Relocation) Path() string {
+	var b strings.Builder
+	b.WriteString(typeName(r.Type))
+
+	switch r.Kind {
+	case TypeIDLocal, TypeIDTarget, TypeExists, TypeSize:
+		return b.String()
+
+	case EnumvalExists, EnumvalValue:
+		if e, ok := btf.UnderlyingType(r.Type).(*btf.Enum); ok && len(r.Accessor) == 1 && r.Accessor[0] < len(e.Values) {
+			fmt.Fprintf(&b, "::%s", e.Values[r.Accessor[0]].Name)
+		}
+		return b.String()
+	}
+
+	if len(r.Accessor) == 0 {
+		return b.String()
+	}
+
+	// The first index is an array index on the pointer to the type
+	if r.Accessor[0] != 0 {
+		fmt.Fprintf(&b, "[%d]", r.Accessor[0])
+	}
+
+	t := r.Type
+	for _, idx := range r.Accessor[1:] {
+		var members []btf.Member
+		switch v := btf.UnderlyingType(t).(type) {
+		case *btf.Struct:
+			members = v.Members
+		case *btf.Union:
+			members = v.Members
+		case *btf.Array:
+			fmt.Fprintf(&b, "[%d]", idx)
+			t = v.Type
+			continue
+		default:
+			// Can't happen for valid accessors, show what is left of it
+			fmt.Fprintf(&b, ":%d", idx)
+			continue
+		}
+
+		if idx >= len(members) {
+			fmt.Fprintf(&b, ":%d", idx)
+			continue
+		}
+
+		// Members of anonymous structs and unions are accessed as if they are members of the parent
+		if members[idx].Name != "" {
+			fmt.Fprintf(&b, ".%s", members[idx].Name)
+		}
+		t = members[idx].Type
+	}
+
+	return b.String()
+}
+
+func (r *Relocation) String() string {
+	str := fmt.Sprintf("%s %s (%s)", r.Kind, r.Path(), r.AccessString())
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("%s: %d, failed: %s", str, r.Local, r.Err)
+	case r.Poisoned:
+		return fmt.Sprintf("%s: %d, no match in target, instruction poisoned", str, r.Local)
+	case r.Relocated:
+		return fmt.Sprintf("%s: %d -> %d", str, r.Local, r.Target)
+	default:
+		return fmt.Sprintf("%s: %d", str, r.Local)
+	}
+}
+
+// typeName returns the name of a type as it would be written in C
+func typeName(t btf.Type) string {
+	if t == nil {
+		return "(unknown)"
+	}
+
+	name := t.TypeName()
+	if name == "" {
+		name = "(anon)"
+	}
+
+	switch t.(type) {
+	case *btf.Struct:
+		return "struct " + name
+	case *btf.Union:
+		return "union " + name
+	case *btf.Enum:
+		return "enum " + name
+	default:
+		return name
+	}
+}
+
+// List returns the CO-RE relocations of the instructions, without resolving them.
+func List(insns asm.Instructions) []Relocation {
+	var relos []Relocation
+	for i := range insns {
+		relo := btf.CORERelocationMetadata(&insns[i])
+		if relo == nil {
+			continue
+		}
+
+		typ, accessor, kind, err := ciliumcompat.CORERelocation(relo)
+		relos = append(relos, Relocation{
+			Index:    i,
+			Kind:     Kind(kind),
+			Type:     typ,
+			Accessor: accessor,
+			Local:    insValue(&insns[i]),
+			Err:      err,
+			relo:     relo,
+		})
+	}
+
+	return relos
+}
+
+// Relocate resolves the CO-RE relocations of the instructions against the target BTF and applies them to the
+// instructions. If target is nil, the BTF of the running kernel is used. Relocations are resolved per local type, like
+// libbpf does. If the relocations of a type can't be resolved, all relocations of that type get an error and their
+// instructions are left as is.
+func Relocate(insns asm.Instructions, target *btf.Spec) []Relocation {
+	relos := List(insns)
+
+	// Group the relocations by local type, in the order the types are first used
+	var types []btf.Type
+	groups := make(map[btf.Type][]int)
+	for i, r := range relos {
+		// The relocation couldn't be read
+		if r.Err != nil {
+			continue
+		}
+
+		if _, found := groups[r.Type]; !found {
+			types = append(types, r.Type)
+		}
+		groups[r.Type] = append(groups[r.Type], i)
+	}
+
+	for _, typ := range types {
+		group := groups[typ]
+
+		coreRelos := make([]*btf.CORERelocation, len(group))
+		for i, idx := range group {
+			coreRelos[i] = relos[idx].relo
+		}
+
+		fixups, err := btf.CORERelocate(coreRelos, target, mimic.GetNativeEndianness())
+		if err != nil {
+			for _, idx := range group {
+				relos[idx].Err = err
+			}
+			continue
+		}
+
+		for i, idx := range group {
+			r := &relos[idx]
+			ins := &insns[r.Index]
+
+			if err = fixups[i].Apply(ins); err != nil {
+				r.Err = fmt.Errorf("apply fixup %s: %w", &fixups[i], err)
+				continue
+			}
+
+			r.Relocated = true
+			if ins.IsBuiltinCall() && ins.Constant == poisonHelper {
+				r.Poisoned = true
+				continue
+			}
+			r.Target = insValue(ins)
+		}
+	}
+
+	return relos
+}
+
+// insValue returns the value of an instruction which is changed by CO-RE relocations
+func insValue(ins *asm.Instruction) int64 {
+	switch ins.OpCode.Class() {
+	case asm.LdXClass, asm.StClass, asm.StXClass:
+		return int64(ins.Offset)
+	default:
+		return ins.Constant
+	}
+}
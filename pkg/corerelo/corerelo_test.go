@@ -0,0 +1,168 @@
+package corerelo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/dylandreimerink/mimic"
+)
+
+// The test programs are those of the CO-RE tests of cilium/ebpf, the fields of the structs in the program are in a
+// different order than in the target.
+func loadTestProgram(t *testing.T) *ebpf.ProgramSpec {
+	t.Helper()
+
+	spec, err := ebpf.LoadCollectionSpec("testdata/relocs_read-el.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spec.Programs["reads"]
+}
+
+// runProgram runs the program in the emulator and returns R0
+func runProgram(t *testing.T, prog *ebpf.ProgramSpec) uint64 {
+	t.Helper()
+
+	vm := mimic.NewVM(mimic.VMOptEmulator(mimic.NewLinuxEmulator()))
+	if _, err := vm.AddProgram(prog); err != nil {
+		t.Fatal(err)
+	}
+
+	process, err := vm.NewProcess(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		exited, err := process.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exited {
+			return process.Registers.R0
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	prog := loadTestProgram(t)
+
+	relos := List(prog.Instructions)
+	if len(relos) != 47 {
+		t.Fatalf("got %d relocations, want 47", len(relos))
+	}
+
+	for _, r := range relos {
+		if r.Relocated {
+			t.Errorf("relocation at %d is relocated", r.Index)
+		}
+	}
+
+	want := "byte_off struct s.a (0:1): 1"
+	if got := relos[0].String(); got != want {
+		t.Errorf("got '%s', want '%s'", got, want)
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	prog := loadTestProgram(t)
+
+	target, err := btf.LoadSpec("testdata/relocs_read_tgt-el.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relos := Relocate(prog.Instructions, target)
+
+	want := map[int]string{
+		7:   "byte_off struct s.a (0:1): 1 -> 0",
+		12:  "byte_off struct s.b (0:0): 0 -> 1",
+		20:  "byte_sz struct bits.a (0:1): 4 -> 1",
+		151: "byte_off struct bits.f (0:6): 4 -> 2",
+		206: "type_exists struct nonexist (0): 1 -> 0",
+		209: "field_exists struct nonexist.non_exist (0:0): 1 -> 0",
+		211: "enumval_exists enum nonexist_enum::NON_EXIST (0): 1 -> 0",
+	}
+
+	for _, r := range relos {
+		if r.Err != nil {
+			t.Errorf("relocation at %d: %s", r.Index, r.Err)
+		}
+
+		if str, found := want[r.Index]; found {
+			if got := r.String(); got != str {
+				t.Errorf("relocation at %d: got '%s', want '%s'", r.Index, got, str)
+			}
+			delete(want, r.Index)
+		}
+	}
+
+	for index := range want {
+		t.Errorf("no relocation at %d", index)
+	}
+
+	// The program returns the line of the first failed check
+	if ret := runProgram(t, prog); ret != 0 {
+		t.Errorf("check on line %d failed", ret)
+	}
+}
+
+// intOnlyBTF returns a raw BTF blob which only contains an int type
+func intOnlyBTF() []byte {
+	var buf bytes.Buffer
+	ne := mimic.GetNativeEndianness()
+
+	// struct btf_header
+	_ = binary.Write(&buf, ne, struct {
+		Magic                                    uint16
+		Version, Flags                           uint8
+		HdrLen, TypeOff, TypeLen, StrOff, StrLen uint32
+	}{0xeB9F, 1, 0, 24, 0, 16, 16, 5})
+	// INT 'int' size=4 bits=32
+	_ = binary.Write(&buf, ne, []uint32{1, 1 << 24, 4, 32})
+	buf.WriteString("\x00int\x00")
+
+	return buf.Bytes()
+}
+
+func TestRelocatePoison(t *testing.T) {
+	prog := loadTestProgram(t)
+
+	target, err := btf.LoadSpecFromReader(bytes.NewReader(intOnlyBTF()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relos := Relocate(prog.Instructions, target)
+
+	for _, r := range relos {
+		if r.Err != nil {
+			t.Errorf("relocation at %d: %s", r.Index, r.Err)
+		}
+
+		// Existence checks can't be poisoned, they are resolved to 0
+		if r.Kind == FieldExists || r.Kind == TypeExists || r.Kind == EnumvalExists {
+			if r.Poisoned || r.Target != 0 {
+				t.Errorf("existence check at %d: %s", r.Index, &r)
+			}
+			continue
+		}
+
+		if !r.Poisoned {
+			t.Errorf("relocation at %d isn't poisoned: %s", r.Index, &r)
+		}
+	}
+
+	want := "byte_off struct s.a (0:1): 1, no match in target, instruction poisoned"
+	if got := relos[0].String(); got != want {
+		t.Errorf("got '%s', want '%s'", got, want)
+	}
+
+	if !prog.Instructions[relos[0].Index].IsBuiltinCall() {
+		t.Errorf("poisoned instruction isn't replaced with a call: %s", prog.Instructions[relos[0].Index])
+	}
+}
@@ -0,0 +1,344 @@
+// Package ctxutil contains helpers to construct, encode and modify the contexts which are passed to eBPF programs
+// when they are executed in the emulator.
+package ctxutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+// protoCtx is the wrapper in which every context is encoded, this is the format mimic.UnmarshalContextJSON expects.
+type protoCtx struct {
+	Name string          `json:"name"`
+	Type string          `json:"type"`
+	Ctx  json.RawMessage `json:"ctx"`
+}
+
+// Marshal encodes a context into JSON which can be decoded again with mimic.UnmarshalContextJSON. Not all context
+// types of mimic implement json.Marshaler, this function fills in the gaps.
+func Marshal(ctx mimic.Context) (json.RawMessage, error) {
+	var (
+		ctxType string
+		inner   interface{}
+	)
+
+	switch ctx := ctx.(type) {
+	case *mimic.LinuxContextXDP:
+		ctxType = "xdp_md"
+		inner = ctx
+
+	case *mimic.LinuxContextSKBuff:
+		ctxType = "sk_buff"
+		inner = ctx
+
+	case *mimic.CapturedContext:
+		// The captured context marshals its sub context with json.Marshal, which doesn't work for the sub context
+		// types handled above, so we have to do it ourselves.
+		sub, err := Marshal(ctx.Sub)
+		if err != nil {
+			return nil, fmt.Errorf("marshal sub context: %w", err)
+		}
+
+		ctxType = "captured"
+		inner = struct {
+			RawSub      json.RawMessage                              `json:"subContext"`
+			HelperCalls map[string][]mimic.CapturedContextHelperCall `json:"helperCalls"`
+		}{
+			RawSub:      sub,
+			HelperCalls: ctx.HelperCalls,
+		}
+
+	case json.Marshaler:
+		return ctx.MarshalJSON()
+
+	default:
+		return nil, fmt.Errorf("can't marshal context of type '%T'", ctx)
+	}
+
+	b, err := json.Marshal(inner)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(protoCtx{
+		Name: ctx.GetName(),
+		Type: ctxType,
+		Ctx:  b,
+	})
+}
+
+// Encode writes the given contexts as an indented JSON array to w. The output can be loaded again with the
+// 'ctx load' command of the debugger.
+func Encode(w io.Writer, ctxs []mimic.Context) error {
+	raw := make([]json.RawMessage, 0, len(ctxs))
+	for i, ctx := range ctxs {
+		b, err := Marshal(ctx)
+		if err != nil {
+			return fmt.Errorf("marshal context %d: %w", i, err)
+		}
+		raw = append(raw, b)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(raw)
+}
+
+// Decode reads a JSON array of contexts, as written by Encode, from r. The contexts are validated first, if they
+// are invalid a ValidationErrors error is returned.
+func Decode(r io.Reader) ([]mimic.Context, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read context file: %w", err)
+	}
+
+	if err = Validate(data); err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode context file: %w", err)
+	}
+
+	ctxs := make([]mimic.Context, 0, len(raw))
+	for i, b := range raw {
+		ctx, err := mimic.UnmarshalContextJSON(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("decode context %d: %w", i, err)
+		}
+
+		ctxs = append(ctxs, ctx)
+	}
+
+	return ctxs, nil
+}
+
+// ReadFile reads a context file. Files with the .jsonl extension contain a context per line, these are converted
+// into a JSON array so they can be passed to Validate and Decode.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read context file: %w", err)
+	}
+
+	if filepath.Ext(path) == ".jsonl" {
+		data = jsonLinesToArray(data)
+	}
+
+	return data, nil
+}
+
+// DecodeFile reads and decodes a context file, see ReadFile and Decode.
+func DecodeFile(path string) ([]mimic.Context, error) {
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(bytes.NewReader(data))
+}
+
+// jsonLinesToArray turns JSON lines into a JSON array. Elements are separated by a comma at the start of the line,
+// so line numbers in syntax errors still match the original.
+func jsonLinesToArray(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	first := true
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			buf.Write(line)
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes()
+}
+
+// StreamEncoder writes contexts one at a time, so they don't have to be kept in memory. Contexts are written as the
+// elements of a JSON array, in the same format as Encode, or as JSON lines.
+type StreamEncoder struct {
+	w     io.Writer
+	lines bool
+	n     int
+}
+
+// NewStreamEncoder returns a stream encoder writing to w, if lines is true contexts are written as JSON lines.
+func NewStreamEncoder(w io.Writer, lines bool) *StreamEncoder {
+	return &StreamEncoder{w: w, lines: lines}
+}
+
+// Encode writes a single context
+func (e *StreamEncoder) Encode(ctx mimic.Context) error {
+	b, err := Marshal(ctx)
+	if err != nil {
+		return fmt.Errorf("marshal context %d: %w", e.n, err)
+	}
+
+	var buf bytes.Buffer
+	if e.lines {
+		buf.Write(b)
+		buf.WriteByte('\n')
+	} else {
+		if e.n == 0 {
+			buf.WriteString("[\n  ")
+		} else {
+			buf.WriteString(",\n  ")
+		}
+		if err = json.Indent(&buf, b, "  ", "  "); err != nil {
+			return err
+		}
+	}
+	e.n++
+
+	_, err = e.w.Write(buf.Bytes())
+	return err
+}
+
+// Close terminates the JSON array, it doesn't close the underlying writer.
+func (e *StreamEncoder) Close() error {
+	if e.lines {
+		return nil
+	}
+
+	end := "\n]\n"
+	if e.n == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// Clone returns a deep copy of the given context. The copy is not loaded into any process, even if the original is.
+func Clone(ctx mimic.Context) (mimic.Context, error) {
+	b, err := Marshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return mimic.UnmarshalContextJSON(bytes.NewReader(b))
+}
+
+// Memory returns the memory object with the given name from a generic context, or nil if no such memory exists.
+func Memory(ctx *mimic.GenericContext, name string) *mimic.GenericContextMemory {
+	for i := range ctx.Memory {
+		if ctx.Memory[i].Name == name {
+			return &ctx.Memory[i]
+		}
+	}
+
+	return nil
+}
+
+// SetInt sets the value of the int memory object with the given name.
+func SetInt(ctx *mimic.GenericContext, name string, value int64) error {
+	mem := Memory(ctx, name)
+	if mem == nil {
+		return fmt.Errorf("context has no memory named '%s'", name)
+	}
+
+	if mem.Int == nil {
+		return fmt.Errorf("memory '%s' is not an int", name)
+	}
+
+	mem.Int.Value = value
+	return nil
+}
+
+// SetBlock replaces the contents of the block memory object with the given name. Pointers into the block which
+// pointed at the end of the old contents, like 'data_end', are moved to the end of the new contents. If the old contents
+// were empty, the start and end of the block are the same, so only end pointers, those with a name ending in '_end',
+// are moved.
+func SetBlock(ctx *mimic.GenericContext, name string, value []byte) error {
+	mem := Memory(ctx, name)
+	if mem == nil {
+		return fmt.Errorf("context has no memory named '%s'", name)
+	}
+
+	if mem.Block == nil {
+		return fmt.Errorf("memory '%s' is not a block", name)
+	}
+
+	oldLen := len(mem.Block.Value)
+	mem.Block.Value = value
+
+	for _, m := range ctx.Memory {
+		if m.Pointer == nil || m.Pointer.Memory != name || m.Pointer.Offset != oldLen {
+			continue
+		}
+
+		if oldLen == 0 && !strings.HasSuffix(m.Name, "_end") {
+			continue
+		}
+
+		m.Pointer.Offset = len(value)
+	}
+
+	return nil
+}
+
+// newInt returns an int memory object
+func newInt(name string, size int, value int64) mimic.GenericContextMemory {
+	return mimic.GenericContextMemory{
+		Name: name,
+		Type: "int",
+		Int: &mimic.GenericContextInt{
+			Value: value,
+			Size:  size,
+		},
+	}
+}
+
+// newPtr returns a 32-bit pointer memory object
+func newPtr(name, memory string, offset int) mimic.GenericContextMemory {
+	return mimic.GenericContextMemory{
+		Name: name,
+		Type: "ptr",
+		Pointer: &mimic.GenericContextPointer{
+			Memory: memory,
+			Offset: offset,
+			Size:   32,
+		},
+	}
+}
+
+// newBlock returns a block memory object
+func newBlock(name string, value []byte) mimic.GenericContextMemory {
+	return mimic.GenericContextMemory{
+		Name: name,
+		Type: "block",
+		Block: &mimic.GenericContextMemoryBlock{
+			Value: value,
+		},
+	}
+}
+
+// newStruct returns a struct memory object, each field refers to the memory object with the same name.
+func newStruct(name string, fields []string) mimic.GenericContextMemory {
+	s := &mimic.GenericContextStruct{}
+	for _, f := range fields {
+		s.Fields = append(s.Fields, mimic.GenericContextStructField{
+			Name:   f,
+			Memory: f,
+		})
+	}
+
+	return mimic.GenericContextMemory{
+		Name:   name,
+		Type:   "struct",
+		Struct: s,
+	}
+}
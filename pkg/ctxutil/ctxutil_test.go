@@ -0,0 +1,108 @@
+package ctxutil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+func TestStreamEncoder(t *testing.T) {
+	ctxs := []mimic.Context{
+		NewXDP("xdp", []byte{1, 2, 3}, 1),
+		NewSKBuff("skb", []byte{4, 5, 6}, 2),
+		NewPTRegs("pt_regs"),
+	}
+
+	var want bytes.Buffer
+	if err := Encode(&want, ctxs); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	enc := NewStreamEncoder(&got, false)
+	for _, ctx := range ctxs {
+		if err := enc.Encode(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.String() != want.String() {
+		t.Errorf("stream encoder output differs from Encode, got:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+
+	var empty bytes.Buffer
+	if err := NewStreamEncoder(&empty, false).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(empty.Bytes()); err != nil {
+		t.Errorf("empty stream: %s", err)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewStreamEncoder(&buf, true)
+	for _, ctx := range []mimic.Context{
+		NewXDP("a", []byte{1, 2, 3}, 1),
+		NewXDP("b", []byte{4, 5, 6}, 2),
+	} {
+		if err := enc.Encode(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctxs, err := DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctxs) != 2 || ctxs[0].GetName() != "a" || ctxs[1].GetName() != "b" {
+		t.Errorf("unexpected contexts: %v", ctxs)
+	}
+
+	// Syntax errors should point to the line in the original file
+	err = Validate(jsonLinesToArray([]byte("{\"type\": \"xdp_md\", \"ctx\": {}}\n\n{\"type\": }\n")))
+	if err == nil || !bytes.Contains([]byte(err.Error()), []byte("line 3")) {
+		t.Errorf("expected a syntax error on line 3, got '%v'", err)
+	}
+}
+
+func TestSetBlock(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pkt  []byte
+	}{
+		{name: "empty", pkt: nil},
+		{name: "non-empty", pkt: []byte{1, 2, 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := NewXDP("xdp", tc.pkt, 1)
+
+			pkt := []byte{4, 5, 6, 7, 8}
+			if err := SetBlock(ctx, "pkt", pkt); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]int{"data": 0, "data_meta": 0, "data_end": len(pkt)}
+			for name, off := range want {
+				mem := Memory(ctx, name)
+				if mem == nil || mem.Pointer == nil {
+					t.Fatalf("no pointer named '%s'", name)
+				}
+				if mem.Pointer.Offset != off {
+					t.Errorf("%s: got offset %d, want %d", name, mem.Pointer.Offset, off)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package ctxutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+// Description describes the values of the fields of a context, for example the registers of a `struct pt_regs`.
+type Description struct {
+	// Name of the context, optional
+	Name   string
+	Values map[string]string
+}
+
+// ParseDescriptions parses a JSON or YAML file with one or more context descriptions. A JSON file contains a single
+// object or an array of objects, a YAML file a single mapping or multiple documents separated by '---'. Only flat
+// mappings of field names to numbers or strings are supported, the optional 'name' key sets the context name:
+//
+//	{"name": "write(1, buf, 10)", "di": 1, "si": "0x7ffd1000", "dx": 10}
+//
+//	name: write(1, buf, 10)
+//	di: 1
+//	si: 0x7ffd1000
+//	dx: 10
+func ParseDescriptions(data []byte) ([]Description, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parseJSONDescriptions(trimmed)
+	}
+
+	return parseYAMLDescriptions(data)
+}
+
+func parseJSONDescriptions(data []byte) ([]Description, error) {
+	var objects []map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var err error
+	if data[0] == '[' {
+		err = dec.Decode(&objects)
+	} else {
+		var obj map[string]interface{}
+		err = dec.Decode(&obj)
+		objects = append(objects, obj)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+
+	var descs []Description
+	for i, obj := range objects {
+		desc := Description{Values: make(map[string]string)}
+		for k, v := range obj {
+			var str string
+			switch v := v.(type) {
+			case string:
+				str = v
+			case json.Number:
+				str = v.String()
+			case bool:
+				str = "0"
+				if v {
+					str = "1"
+				}
+			default:
+				return nil, fmt.Errorf("description %d: value of '%s' must be a number or string", i, k)
+			}
+
+			if k == "name" {
+				desc.Name = str
+				continue
+			}
+			desc.Values[k] = str
+		}
+		descs = append(descs, desc)
+	}
+
+	return descs, nil
+}
+
+func parseYAMLDescriptions(data []byte) ([]Description, error) {
+	var descs []Description
+	cur := Description{Values: make(map[string]string)}
+	empty := true
+
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	for lineNr := 1; scan.Scan(); lineNr++ {
+		line := scan.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if trimmed == "---" {
+			if !empty {
+				descs = append(descs, cur)
+			}
+			cur = Description{Values: make(map[string]string)}
+			empty = true
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: only flat mappings are supported", lineNr)
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", lineNr)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			// Quoted values end at the closing quote, anything after it can only be a comment
+			end := strings.IndexByte(value[1:], value[0])
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: missing closing quote", lineNr)
+			}
+			value = value[1 : end+1]
+		} else if i := strings.Index(value, " #"); i != -1 {
+			value = strings.TrimSpace(value[:i])
+		}
+
+		if key == "name" {
+			cur.Name = value
+		} else {
+			cur.Values[key] = value
+		}
+		empty = false
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+
+	if !empty {
+		descs = append(descs, cur)
+	}
+
+	if len(descs) == 0 {
+		return nil, fmt.Errorf("no descriptions found")
+	}
+
+	return descs, nil
+}
+
+// SetFields sets memory objects of a generic context to the given values. Int values are decimal, hex(0x), octal(0o)
+// or binary(0b) numbers and may be negative. Block values are text, or hex bytes when prefixed with '0x'. The x86_64
+// register names and the PARM1-6 and RC aliases of the PT_REGS_* macros can be used for pt_regs fields.
+func SetFields(ctx *mimic.GenericContext, values map[string]string) error {
+	// Set fields in a stable order, so errors are reproducible
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+
+		mem := Memory(ctx, key)
+		if mem == nil {
+			if alias, ok := ptRegsAliases[strings.ToLower(key)]; ok {
+				mem = Memory(ctx, alias)
+			}
+		}
+		if mem == nil {
+			return fmt.Errorf("context has no field '%s'", key)
+		}
+
+		switch {
+		case mem.Int != nil:
+			n, err := parseIntValue(value)
+			if err != nil {
+				return fmt.Errorf("field '%s': %w", key, err)
+			}
+			mem.Int.Value = n
+
+		case mem.Block != nil:
+			b := []byte(value)
+			if strings.HasPrefix(value, "0x") {
+				var err error
+				if b, err = ParseBytes(value); err != nil {
+					return fmt.Errorf("field '%s': %w", key, err)
+				}
+			}
+
+			if len(b) > len(mem.Block.Value) {
+				return fmt.Errorf("field '%s': value of %d bytes doesn't fit in %d bytes", key, len(b),
+					len(mem.Block.Value))
+			}
+			// Fixed size fields keep their size, the rest is zeroed
+			val := make([]byte, len(mem.Block.Value))
+			copy(val, b)
+			mem.Block.Value = val
+
+		default:
+			return fmt.Errorf("field '%s' can't be set", key)
+		}
+	}
+
+	return nil
+}
+
+// parseIntValue parses a signed or unsigned integer in any base Go supports
+func parseIntValue(str string) (int64, error) {
+	if n, err := strconv.ParseInt(str, 0, 64); err == nil {
+		return n, nil
+	}
+
+	n, err := strconv.ParseUint(str, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number '%s'", str)
+	}
+
+	return int64(n), nil
+}
+
+// NewDescribed returns a 'pt_regs', 'perf_event' or 'tracepoint' context with the given field values. The format
+// is only used for tracepoint contexts.
+func NewDescribed(
+	ctxType string,
+	name string,
+	format *TracepointFormat,
+	values map[string]string,
+) (*mimic.GenericContext, error) {
+	var ctx *mimic.GenericContext
+	switch ctxType {
+	case "pt_regs":
+		ctx = NewPTRegs(name)
+	case "perf_event":
+		ctx = NewPerfEventData(name)
+	case "tracepoint":
+		if format == nil {
+			return nil, fmt.Errorf("tracepoint contexts require a format")
+		}
+		return NewTracepoint(name, format, values)
+	default:
+		return nil, fmt.Errorf("unknown context type '%s'", ctxType)
+	}
+
+	if err := SetFields(ctx, values); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
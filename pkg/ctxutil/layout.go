@@ -0,0 +1,103 @@
+package ctxutil
+
+import "github.com/cilium/ebpf/asm"
+
+// Field describes a field of a context struct as seen by eBPF programs
+type Field struct {
+	Name   string
+	Offset uint32
+	Size   asm.Size
+	// Pointer is true if the field holds a 32-bit pointer into packet memory
+	Pointer bool
+}
+
+// XDPMDLayout returns the fields of `struct xdp_md`
+func XDPMDLayout() []Field {
+	var fields []Field
+	for i, name := range []string{
+		"data",
+		"data_end",
+		"data_meta",
+		"ingress_ifindex",
+		"rx_queue_index",
+		"egress_ifindex",
+	} {
+		fields = append(fields, Field{
+			Name:    name,
+			Offset:  uint32(i * 4),
+			Size:    asm.Word,
+			Pointer: i < 3,
+		})
+	}
+
+	return fields
+}
+
+// SKBuffLayout returns the fields of `struct __sk_buff`, arrays are split into one field per element.
+func SKBuffLayout() []Field {
+	var (
+		fields []Field
+		off    uint32
+	)
+	for _, f := range skbFields {
+		size := f.size
+		if size == 0 {
+			size = 32
+		}
+
+		if f.name != "pad" {
+			fields = append(fields, Field{
+				Name:    f.name,
+				Offset:  off,
+				Size:    bitsToSize(size),
+				Pointer: f.size == 0,
+			})
+		}
+
+		off += uint32(size / 8)
+	}
+
+	return fields
+}
+
+// PTRegsLayout returns the fields of the x86_64 `struct pt_regs`
+func PTRegsLayout() []Field {
+	var fields []Field
+	for i, name := range PTRegsFields {
+		fields = append(fields, Field{
+			Name:   name,
+			Offset: uint32(i * 8),
+			Size:   asm.DWord,
+		})
+	}
+
+	return fields
+}
+
+// PerfEventDataLayout returns the fields of `struct bpf_perf_event_data`
+func PerfEventDataLayout() []Field {
+	fields := PTRegsLayout()
+	for i, name := range PerfEventDataFields {
+		fields = append(fields, Field{
+			Name:   name,
+			Offset: uint32((len(PTRegsFields) + i) * 8),
+			Size:   asm.DWord,
+		})
+	}
+
+	return fields
+}
+
+// bitsToSize converts a size in bits to an asm.Size
+func bitsToSize(bits int) asm.Size {
+	switch bits {
+	case 8:
+		return asm.Byte
+	case 16:
+		return asm.Half
+	case 64:
+		return asm.DWord
+	default:
+		return asm.Word
+	}
+}
@@ -0,0 +1,66 @@
+package ctxutil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+// ParseBytes decodes a hex or base64 string into bytes. Hex strings may be prefixed with '0x' and may contain
+// spaces or colons between bytes. If the string is valid hex it is always interpreted as such.
+func ParseBytes(str string) ([]byte, error) {
+	h := strings.TrimPrefix(strings.TrimPrefix(str, "0x"), "0X")
+	h = strings.NewReplacer(" ", "", ":", "").Replace(h)
+	if b, err := hex.DecodeString(h); err == nil {
+		return b, nil
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(str); err == nil {
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("'%s' is not valid hex or base64", str)
+}
+
+// Packet returns the packet data of a context, the bytes between data and data_end. Packets of generic contexts are
+// found via their 'data' and 'data_end' pointers, which must point into the same block.
+func Packet(ctx mimic.Context) ([]byte, error) {
+	switch ctx := ctx.(type) {
+	case *mimic.GenericContext:
+		data := Memory(ctx, "data")
+		dataEnd := Memory(ctx, "data_end")
+		if data == nil || data.Pointer == nil || dataEnd == nil || dataEnd.Pointer == nil {
+			return nil, fmt.Errorf("context has no 'data' and 'data_end' pointers")
+		}
+
+		if data.Pointer.Memory != dataEnd.Pointer.Memory {
+			return nil, fmt.Errorf("'data' and 'data_end' point to different memory")
+		}
+
+		pkt := Memory(ctx, data.Pointer.Memory)
+		if pkt == nil || pkt.Block == nil {
+			return nil, fmt.Errorf("'data' doesn't point to a block")
+		}
+
+		start, end := data.Pointer.Offset, dataEnd.Pointer.Offset
+		if start < 0 || start > end || end > len(pkt.Block.Value) {
+			return nil, fmt.Errorf("'data' and 'data_end' are outside of the packet")
+		}
+
+		return pkt.Block.Value[start:end], nil
+
+	case *mimic.LinuxContextXDP:
+		return ctx.Packet, nil
+
+	case *mimic.LinuxContextSKBuff:
+		return ctx.Packet, nil
+
+	case *mimic.CapturedContext:
+		return Packet(ctx.Sub)
+	}
+
+	return nil, fmt.Errorf("contexts of type '%T' have no packet", ctx)
+}
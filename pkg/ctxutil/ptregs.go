@@ -0,0 +1,72 @@
+package ctxutil
+
+import "github.com/dylandreimerink/mimic"
+
+// PTRegsFields are the names of the fields of the x86_64 `struct pt_regs`, in order. Each field is 64 bits.
+var PTRegsFields = []string{
+	"r15", "r14", "r13", "r12", "bp", "bx", "r11", "r10", "r9", "r8",
+	"ax", "cx", "dx", "si", "di", "orig_ax", "ip", "cs", "flags", "sp", "ss",
+}
+
+// NewPTRegs returns a generic context with the memory layout of the x86_64 `struct pt_regs` which is passed to
+// kprobe programs. All registers are zero and can be changed with SetInt.
+func NewPTRegs(name string) *mimic.GenericContext {
+	ctx := &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: "pt_regs",
+		},
+	}
+
+	for _, reg := range PTRegsFields {
+		ctx.Memory = append(ctx.Memory, newInt(reg, 64, 0))
+	}
+	ctx.Memory = append(ctx.Memory, newStruct("pt_regs", PTRegsFields))
+
+	return ctx
+}
+
+// ptRegsAliases maps alternative names of x86_64 registers to the field names of `struct pt_regs`. The PARM and RC
+// names are those of the PT_REGS_* macros in bpf_tracing.h.
+var ptRegsAliases = map[string]string{
+	"parm1":  "di",
+	"parm2":  "si",
+	"parm3":  "dx",
+	"parm4":  "cx",
+	"parm5":  "r8",
+	"parm6":  "r9",
+	"rc":     "ax",
+	"ret":    "ax",
+	"rax":    "ax",
+	"rbx":    "bx",
+	"rcx":    "cx",
+	"rdx":    "dx",
+	"rsi":    "si",
+	"rdi":    "di",
+	"rbp":    "bp",
+	"rsp":    "sp",
+	"rip":    "ip",
+	"eflags": "flags",
+}
+
+// PerfEventDataFields are the fields of `struct bpf_perf_event_data` which follow the registers
+var PerfEventDataFields = []string{"sample_period", "addr"}
+
+// NewPerfEventData returns a generic context with the memory layout of `struct bpf_perf_event_data` which is passed
+// to perf event programs. It consists of the x86_64 `struct pt_regs` followed by the sample period and address.
+func NewPerfEventData(name string) *mimic.GenericContext {
+	ctx := &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: "bpf_perf_event_data",
+		},
+	}
+
+	fields := append(append([]string{}, PTRegsFields...), PerfEventDataFields...)
+	for _, f := range fields {
+		ctx.Memory = append(ctx.Memory, newInt(f, 64, 0))
+	}
+	ctx.Memory = append(ctx.Memory, newStruct("bpf_perf_event_data", fields))
+
+	return ctx
+}
@@ -0,0 +1,202 @@
+package ctxutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+
+	"github.com/dylandreimerink/mimic"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// skbFields are the fields of `struct __sk_buff` in the order and with the sizes(in bits) of the kernel UAPI
+// definition. Arrays are split into one field per element. Fields with a size of 0 are pointers into the packet.
+var skbFields = []struct {
+	name string
+	size int
+}{
+	{"len", 32},
+	{"pkt_type", 32},
+	{"mark", 32},
+	{"queue_mapping", 32},
+	{"protocol", 32},
+	{"vlan_present", 32},
+	{"vlan_tci", 32},
+	{"vlan_proto", 32},
+	{"priority", 32},
+	{"ingress_ifindex", 32},
+	{"ifindex", 32},
+	{"tc_index", 32},
+	{"cb0", 32},
+	{"cb1", 32},
+	{"cb2", 32},
+	{"cb3", 32},
+	{"cb4", 32},
+	{"hash", 32},
+	{"tc_classid", 32},
+	{"data", 0},
+	{"data_end", 0},
+	{"napi_id", 32},
+	{"family", 32},
+	{"remote_ip4", 32},
+	{"local_ip4", 32},
+	{"remote_ip6_0", 32},
+	{"remote_ip6_1", 32},
+	{"remote_ip6_2", 32},
+	{"remote_ip6_3", 32},
+	{"local_ip6_0", 32},
+	{"local_ip6_1", 32},
+	{"local_ip6_2", 32},
+	{"local_ip6_3", 32},
+	{"remote_port", 32},
+	{"local_port", 32},
+	{"data_meta", 0},
+	{"flow_keys", 64},
+	{"tstamp", 64},
+	{"wire_len", 32},
+	{"gso_segs", 32},
+	{"sk", 64},
+	{"gso_size", 32},
+	{"tstamp_type", 8},
+	{"pad", 8},
+	{"pad", 8},
+	{"pad", 8},
+	{"hwtstamp", 64},
+}
+
+// Values of the pkt_type field
+const (
+	PacketHost      = 0
+	PacketBroadcast = 1
+	PacketMulticast = 2
+	PacketOtherHost = 3
+	PacketOutgoing  = 4
+)
+
+// NewSKBuff returns a generic context with the memory layout of a `struct __sk_buff` for a packet received on the
+// interface with the given index. The packet is assumed to start with an ethernet header. The fields which the
+// kernel derives from the packet itself are populated:
+//   - len and wire_len are the length of the packet, wire_len includes a removed VLAN tag
+//   - protocol is the ethertype
+//   - pkt_type is based on the destination MAC, PACKET_HOST for unicast packets
+//   - An outer VLAN tag is removed from the packet and stored in vlan_present, vlan_tci and vlan_proto, like the
+//     kernel does for received packets
+//   - hash is a symmetric hash of the network and transport layer flow. This is not the same hash the kernel
+//     calculates, but packets of the same flow always get the same value.
+//
+// All other fields are zero and can be changed with SetInt.
+func NewSKBuff(name string, pkt []byte, ifindex int) *mimic.GenericContext {
+	ne := mimic.GetNativeEndianness()
+
+	wireLen := len(pkt)
+
+	var vlanTCI, vlanProto int64
+	if len(pkt) >= 18 {
+		switch layers.EthernetType(binary.BigEndian.Uint16(pkt[12:14])) {
+		case layers.EthernetTypeDot1Q, layers.EthernetTypeQinQ:
+			// vlan_proto is in network byte order, vlan_tci in host byte order
+			vlanProto = int64(ne.Uint16(pkt[12:14]))
+			vlanTCI = int64(binary.BigEndian.Uint16(pkt[14:16]))
+
+			untagged := make([]byte, 0, len(pkt)-4)
+			untagged = append(untagged, pkt[:12]...)
+			pkt = append(untagged, pkt[16:]...)
+		}
+	}
+
+	ctx := &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: "__sk_buff",
+		},
+		Memory: []mimic.GenericContextMemory{
+			newBlock("pkt", pkt),
+		},
+	}
+
+	skb := &mimic.GenericContextStruct{}
+	seen := make(map[string]bool)
+	for _, f := range skbFields {
+		skb.Fields = append(skb.Fields, mimic.GenericContextStructField{
+			Name:   f.name,
+			Memory: f.name,
+		})
+
+		if seen[f.name] {
+			continue
+		}
+		seen[f.name] = true
+
+		switch f.name {
+		case "data", "data_meta":
+			ctx.Memory = append(ctx.Memory, newPtr(f.name, "pkt", 0))
+		case "data_end":
+			ctx.Memory = append(ctx.Memory, newPtr(f.name, "pkt", len(pkt)))
+		default:
+			ctx.Memory = append(ctx.Memory, newInt(f.name, f.size, 0))
+		}
+	}
+
+	ctx.Memory = append(ctx.Memory, mimic.GenericContextMemory{
+		Name:   "__sk_buff",
+		Type:   "struct",
+		Struct: skb,
+	})
+
+	// Errors are impossible since we just created all fields
+	_ = SetInt(ctx, "len", int64(len(pkt)))
+	_ = SetInt(ctx, "wire_len", int64(wireLen))
+	_ = SetInt(ctx, "ifindex", int64(ifindex))
+	_ = SetInt(ctx, "ingress_ifindex", int64(ifindex))
+	if vlanProto != 0 {
+		_ = SetInt(ctx, "vlan_present", 1)
+		_ = SetInt(ctx, "vlan_tci", vlanTCI)
+		_ = SetInt(ctx, "vlan_proto", vlanProto)
+	}
+	if len(pkt) >= 14 {
+		// The protocol is in network byte order, so we read the bytes in the native order to get the same value
+		// the kernel would give
+		_ = SetInt(ctx, "protocol", int64(ne.Uint16(pkt[12:14])))
+		_ = SetInt(ctx, "pkt_type", int64(pktType(pkt[0:6])))
+		_ = SetInt(ctx, "hash", int64(flowHash(pkt)))
+	}
+
+	return ctx
+}
+
+// pktType returns the pkt_type of a received packet based on its destination MAC address
+func pktType(dst net.HardwareAddr) int {
+	if bytes.Equal(dst, layers.EthernetBroadcast) {
+		return PacketBroadcast
+	}
+
+	if dst[0]&1 != 0 {
+		return PacketMulticast
+	}
+
+	return PacketHost
+}
+
+// flowHash returns a symmetric hash of the network and transport flow of a packet, or 0 if the packet has no
+// network layer.
+func flowHash(pkt []byte) uint32 {
+	decoded := gopacket.NewPacket(pkt, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	netLayer := decoded.NetworkLayer()
+	if netLayer == nil {
+		return 0
+	}
+
+	hash := netLayer.NetworkFlow().FastHash()
+	if transport := decoded.TransportLayer(); transport != nil {
+		hash = hash*31 + transport.TransportFlow().FastHash()
+	}
+
+	// Like the kernel, never use 0 as hash, since that indicates no hash was calculated
+	if uint32(hash) == 0 {
+		return 1
+	}
+
+	return uint32(hash)
+}
@@ -0,0 +1,284 @@
+package ctxutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+// TracepointFormat is the description of a tracepoint record as found in the tracefs
+// 'events/{category}/{name}/format' file.
+type TracepointFormat struct {
+	Name   string
+	ID     int
+	Fields []TracepointField
+}
+
+// TracepointField is a single field of a tracepoint record
+type TracepointField struct {
+	Name string
+	// The C type of the field, array sizes are part of the type, like 'char[16]'
+	Type   string
+	Offset int
+	Size   int
+	Signed bool
+}
+
+// DataLoc returns true if the field is a __data_loc field, which holds the offset and length of dynamically sized
+// data located after the fixed fields of the record.
+func (f TracepointField) DataLoc() bool {
+	return strings.HasPrefix(f.Type, "__data_loc ")
+}
+
+// ParseTracepointFormat parses a tracefs tracepoint format file
+func ParseTracepointFormat(r io.Reader) (*TracepointFormat, error) {
+	format := &TracepointFormat{}
+
+	scan := bufio.NewScanner(r)
+	for lineNr := 1; scan.Scan(); lineNr++ {
+		line := strings.TrimSpace(scan.Text())
+
+		switch {
+		case strings.HasPrefix(line, "name:"):
+			format.Name = strings.TrimSpace(strings.TrimPrefix(line, "name:"))
+
+		case strings.HasPrefix(line, "ID:"):
+			id, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "ID:")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ID: %w", lineNr, err)
+			}
+			format.ID = id
+
+		case strings.HasPrefix(line, "field:"):
+			field, err := parseTracepointField(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNr, err)
+			}
+			format.Fields = append(format.Fields, field)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(format.Fields) == 0 {
+		return nil, fmt.Errorf("no fields found, not a tracepoint format file")
+	}
+
+	sort.Slice(format.Fields, func(i, j int) bool {
+		return format.Fields[i].Offset < format.Fields[j].Offset
+	})
+
+	return format, nil
+}
+
+// parseTracepointField parses a field line like
+// 'field:char prev_comm[16];	offset:8;	size:16;	signed:0;'
+func parseTracepointField(line string) (TracepointField, error) {
+	var field TracepointField
+
+	for _, part := range strings.Split(line, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "field":
+			field.Name, field.Type, err = splitTracepointDecl(value)
+		case "offset":
+			field.Offset, err = strconv.Atoi(value)
+		case "size":
+			field.Size, err = strconv.Atoi(value)
+		case "signed":
+			field.Signed = value == "1"
+		}
+		if err != nil {
+			return field, fmt.Errorf("invalid %s '%s': %w", key, value, err)
+		}
+	}
+
+	if field.Name == "" || field.Size == 0 {
+		return field, fmt.Errorf("invalid field '%s'", line)
+	}
+
+	return field, nil
+}
+
+// splitTracepointDecl splits a C declaration like 'const char * buf' or 'char comm[16]' into a name and type
+func splitTracepointDecl(decl string) (string, string, error) {
+	decl = strings.TrimSpace(decl)
+
+	var array string
+	if i := strings.Index(decl, "["); i != -1 && strings.HasSuffix(decl, "]") {
+		array = decl[i:]
+		decl = strings.TrimSpace(decl[:i])
+	}
+
+	i := strings.LastIndexAny(decl, " *")
+	if i == -1 {
+		return "", "", fmt.Errorf("no type in declaration")
+	}
+
+	name := decl[i+1:]
+	typ := strings.TrimSpace(decl[:i+1]) + array
+	if name == "" {
+		return "", "", fmt.Errorf("no name in declaration")
+	}
+
+	return name, typ, nil
+}
+
+// NewTracepoint returns a generic context with a single block of memory holding the given tracepoint record, R1
+// points to the start of the block. Fields are set to the given values: numbers for fields of 1, 2, 4 or 8 bytes, text
+// or hex bytes prefixed with '0x' for arrays and other fields. The values of __data_loc fields are stored after the fixed
+// fields, text values are terminated with a NULL byte. If no value is given for 'common_type', it is set to the ID of
+// the format, like the kernel does.
+func NewTracepoint(name string, format *TracepointFormat, values map[string]string) (*mimic.GenericContext, error) {
+	blockName := format.Name
+	if blockName == "" {
+		blockName = "tracepoint"
+	}
+
+	var size int
+	for _, f := range format.Fields {
+		if end := f.Offset + f.Size; end > size {
+			size = end
+		}
+	}
+	record := make([]byte, size)
+
+	if _, found := format.field("common_type"); found && format.ID != 0 {
+		if _, set := values["common_type"]; !set {
+			withType := map[string]string{"common_type": strconv.Itoa(format.ID)}
+			for k, v := range values {
+				withType[k] = v
+			}
+			values = withType
+		}
+	}
+
+	// Set fields in a stable order, so errors are reproducible and dynamic data is always placed the same way
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ne := mimic.GetNativeEndianness()
+	for _, key := range keys {
+		value := values[key]
+
+		field, found := format.field(key)
+		if !found {
+			return nil, fmt.Errorf("tracepoint '%s' has no field '%s'", format.Name, key)
+		}
+
+		b := []byte(value)
+		if strings.HasPrefix(value, "0x") && (field.DataLoc() || !field.scalar()) {
+			var err error
+			if b, err = ParseBytes(value); err != nil {
+				return nil, fmt.Errorf("field '%s': %w", key, err)
+			}
+		} else if field.DataLoc() {
+			b = append(b, 0)
+		}
+
+		dst := record[field.Offset : field.Offset+field.Size]
+		switch {
+		case field.DataLoc():
+			// The upper 16 bits hold the length, the lower 16 bits the offset from the start of the record
+			ne.PutUint32(dst, uint32(len(b))<<16|uint32(len(record)))
+			record = append(record, b...)
+
+		case field.scalar():
+			n, err := parseIntValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", key, err)
+			}
+
+			switch field.Size {
+			case 1:
+				dst[0] = byte(n)
+			case 2:
+				ne.PutUint16(dst, uint16(n))
+			case 4:
+				ne.PutUint32(dst, uint32(n))
+			case 8:
+				ne.PutUint64(dst, uint64(n))
+			}
+
+		default:
+			if len(b) > len(dst) {
+				return nil, fmt.Errorf("field '%s': value of %d bytes doesn't fit in %d bytes", key, len(b), len(dst))
+			}
+			copy(dst, b)
+		}
+	}
+
+	return &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: blockName,
+		},
+		Memory: []mimic.GenericContextMemory{
+			newBlock(blockName, record),
+		},
+	}, nil
+}
+
+// field returns the field with the given name
+func (tf *TracepointFormat) field(name string) (TracepointField, bool) {
+	for _, f := range tf.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return TracepointField{}, false
+}
+
+// scalar returns true if the field can be loaded as a single value, arrays like 'char comm[4]' are not scalar even if
+// their size is
+func (f TracepointField) scalar() bool {
+	if strings.HasSuffix(f.Type, "]") {
+		return false
+	}
+
+	switch f.Size {
+	case 1, 2, 4, 8:
+		return true
+	}
+	return false
+}
+
+// RawTracepointArgs is the max amount of args of `struct bpf_raw_tracepoint_args`, the max amount of arguments of
+// a traced function.
+const RawTracepointArgs = 12
+
+// NewRawTracepoint returns a generic context with the memory layout of `struct bpf_raw_tracepoint_args` which is
+// passed to raw tracepoint programs. The args are named 'args0' to 'args11', all are zero and can be changed with
+// SetInt.
+func NewRawTracepoint(name string) *mimic.GenericContext {
+	ctx := &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: "bpf_raw_tracepoint_args",
+		},
+	}
+
+	fields := make([]string, RawTracepointArgs)
+	for i := range fields {
+		fields[i] = "args" + strconv.Itoa(i)
+		ctx.Memory = append(ctx.Memory, newInt(fields[i], 64, 0))
+	}
+	ctx.Memory = append(ctx.Memory, newStruct("bpf_raw_tracepoint_args", fields))
+
+	return ctx
+}
@@ -0,0 +1,248 @@
+package ctxutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/dylandreimerink/mimic"
+)
+
+const schedProcessExecFormat = `name: sched_process_exec
+ID: 312
+format:
+	field:unsigned short common_type;	offset:0;	size:2;	signed:0;
+	field:unsigned char common_flags;	offset:2;	size:1;	signed:0;
+	field:unsigned char common_preempt_count;	offset:3;	size:1;	signed:0;
+	field:int common_pid;	offset:4;	size:4;	signed:1;
+
+	field:__data_loc char[] filename;	offset:8;	size:4;	signed:1;
+	field:pid_t pid;	offset:12;	size:4;	signed:1;
+	field:char comm[16];	offset:20;	size:16;	signed:0;
+	field:const char * ptr;	offset:40;	size:8;	signed:0;
+
+print fmt: "filename=%s pid=%d", __get_str(filename), REC->pid
+`
+
+func TestParseTracepointFormat(t *testing.T) {
+	format, err := ParseTracepointFormat(strings.NewReader(schedProcessExecFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format.Name != "sched_process_exec" || format.ID != 312 {
+		t.Errorf("name = %s, id = %d", format.Name, format.ID)
+	}
+
+	want := []TracepointField{
+		{Name: "common_type", Type: "unsigned short", Offset: 0, Size: 2},
+		{Name: "common_flags", Type: "unsigned char", Offset: 2, Size: 1},
+		{Name: "common_preempt_count", Type: "unsigned char", Offset: 3, Size: 1},
+		{Name: "common_pid", Type: "int", Offset: 4, Size: 4, Signed: true},
+		{Name: "filename", Type: "__data_loc char[]", Offset: 8, Size: 4, Signed: true},
+		{Name: "pid", Type: "pid_t", Offset: 12, Size: 4, Signed: true},
+		{Name: "comm", Type: "char[16]", Offset: 20, Size: 16},
+		{Name: "ptr", Type: "const char *", Offset: 40, Size: 8},
+	}
+	if len(format.Fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(format.Fields), len(want))
+	}
+	for i := range want {
+		if format.Fields[i] != want[i] {
+			t.Errorf("field %d = %+v, want %+v", i, format.Fields[i], want[i])
+		}
+	}
+}
+
+func TestNewTracepoint(t *testing.T) {
+	format, err := ParseTracepointFormat(strings.NewReader(schedProcessExecFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := NewTracepoint("exec", format, map[string]string{
+		"common_pid": "42",
+		"pid":        "-1",
+		"comm":       "bash",
+		"filename":   "/bin/ls",
+		"ptr":        "0xffff888000001000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := loadCtx(t, ebpf.TracePoint, ctx)
+
+	ne := mimic.GetNativeEndianness()
+	if typ := ne.Uint16(rec[0:]); typ != 312 {
+		t.Errorf("common_type = %d, want the format ID 312", typ)
+	}
+	if pid := ne.Uint32(rec[4:]); pid != 42 {
+		t.Errorf("common_pid = %d, want 42", pid)
+	}
+	if pid := int32(ne.Uint32(rec[12:])); pid != -1 {
+		t.Errorf("pid = %d, want -1", pid)
+	}
+	if comm := rec[20:36]; !bytes.Equal(comm, append([]byte("bash"), make([]byte, 12)...)) {
+		t.Errorf("comm = %q", comm)
+	}
+	if ptr := ne.Uint64(rec[40:]); ptr != 0xffff888000001000 {
+		t.Errorf("ptr = 0x%X", ptr)
+	}
+
+	// The filename is stored after the fixed fields
+	loc := ne.Uint32(rec[8:])
+	off, size := loc&0xFFFF, loc>>16
+	if off != 48 || int(off+size) > len(rec) {
+		t.Fatalf("filename data_loc offset %d, size %d, record %d bytes", off, size, len(rec))
+	}
+	if filename := rec[off : off+size]; string(filename) != "/bin/ls\x00" {
+		t.Errorf("filename = %q", filename)
+	}
+}
+
+func TestNewTracepointArrays(t *testing.T) {
+	format, err := ParseTracepointFormat(strings.NewReader(`name: arrays
+ID: 7
+format:
+	field:unsigned short common_type;	offset:0;	size:2;	signed:0;
+	field:char comm[4];	offset:2;	size:4;	signed:0;
+	field:u8 flags[2];	offset:6;	size:2;	signed:0;
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := NewTracepoint("arrays", format, map[string]string{
+		"common_type": "9",
+		"comm":        "abc",
+		"flags":       "0x0102",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := loadCtx(t, ebpf.TracePoint, ctx)
+	if typ := mimic.GetNativeEndianness().Uint16(rec[0:]); typ != 9 {
+		t.Errorf("common_type = %d, want 9", typ)
+	}
+	if comm := rec[2:6]; !bytes.Equal(comm, []byte("abc\x00")) {
+		t.Errorf("comm = %q", comm)
+	}
+	if flags := rec[6:8]; !bytes.Equal(flags, []byte{1, 2}) {
+		t.Errorf("flags = %v", flags)
+	}
+}
+
+func TestNewPerfEventData(t *testing.T) {
+	ctx, err := NewDescribed("perf_event", "sample", nil, map[string]string{
+		"PARM1":         "1",
+		"rip":           "0xffffffff81000000",
+		"sample_period": "100",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := loadCtx(t, ebpf.PerfEvent, ctx)
+
+	ne := mimic.GetNativeEndianness()
+	for _, f := range PerfEventDataLayout() {
+		val := ne.Uint64(rec[f.Offset:])
+
+		want := map[string]uint64{"di": 1, "ip": 0xffffffff81000000, "sample_period": 100}[f.Name]
+		if val != want {
+			t.Errorf("%s = 0x%X, want 0x%X", f.Name, val, want)
+		}
+	}
+
+	if _, err = NewDescribed("pt_regs", "x", nil, map[string]string{"foo": "1"}); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestNewRawTracepoint(t *testing.T) {
+	ctx := NewRawTracepoint("raw")
+	if err := SetInt(ctx, "args1", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetInt(ctx, "args12", 1); err == nil {
+		t.Error("expected error for an arg beyond the max")
+	}
+
+	rec := loadCtx(t, ebpf.RawTracepoint, ctx)
+	if len(rec) != RawTracepointArgs*8 {
+		t.Fatalf("got %d bytes, want %d", len(rec), RawTracepointArgs*8)
+	}
+
+	ne := mimic.GetNativeEndianness()
+	for i := 0; i < RawTracepointArgs; i++ {
+		want := map[int]uint64{1: 5}[i]
+		if val := ne.Uint64(rec[i*8:]); val != want {
+			t.Errorf("args%d = %d, want %d", i, val, want)
+		}
+	}
+}
+
+func TestParseDescriptions(t *testing.T) {
+	jsonDescs, err := ParseDescriptions([]byte(`[{"name": "a", "di": 1, "si": "0x10"}, {"ax": -1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yamlDescs, err := ParseDescriptions([]byte("# comment\nname: a\ndi: 1\nsi: '0x10' # trailing\n---\nax: -1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, descs := range [][]Description{jsonDescs, yamlDescs} {
+		if len(descs) != 2 {
+			t.Fatalf("got %d descriptions, want 2", len(descs))
+		}
+		if descs[0].Name != "a" || descs[0].Values["di"] != "1" || descs[0].Values["si"] != "0x10" {
+			t.Errorf("unexpected first description %+v", descs[0])
+		}
+		if descs[1].Values["ax"] != "-1" {
+			t.Errorf("unexpected second description %+v", descs[1])
+		}
+	}
+
+	if _, err = ParseDescriptions([]byte("regs:\n  di: 1\n")); err == nil {
+		t.Error("expected error for nested YAML")
+	}
+}
+
+// loadCtx loads the context into a VM and returns the memory R1 points to
+func loadCtx(t *testing.T, progType ebpf.ProgramType, ctx mimic.Context) []byte {
+	t.Helper()
+
+	vm := mimic.NewVM(mimic.VMOptEmulator(mimic.NewLinuxEmulator()))
+	_, err := vm.AddProgram(&ebpf.ProgramSpec{
+		Name:         "prog",
+		Type:         progType,
+		Instructions: asm.Instructions{asm.Return()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	process, err := vm.NewProcess(0, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer process.Cleanup()
+
+	entry, off, found := vm.MemoryController.GetEntry(uint32(process.Registers.R1))
+	if !found {
+		t.Fatal("no memory at R1")
+	}
+
+	mem := make([]byte, entry.Size-off)
+	if err = entry.Object.(mimic.VMMem).Read(off, mem); err != nil {
+		t.Fatal(err)
+	}
+
+	return mem
+}
@@ -0,0 +1,732 @@
+package ctxutil
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+//go:embed context.schema.json
+var schema []byte
+
+// Schema returns the JSON Schema of context files, editors can use it to validate and autocomplete context files.
+func Schema() []byte {
+	return schema
+}
+
+// ValidationError is a problem found in a context file, Path is the JSON path of the offending value, like
+// '$[0].ctx.memory[2].value.memory'.
+type ValidationError struct {
+	Path string
+	Msg  string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationErrors are all problems found in a context file
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	lines := make([]string, 0, len(ve))
+	for _, e := range ve {
+		lines = append(lines, e.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks a context file. Contexts are not only checked for the correct JSON types, also every memory
+// object, pointer target, struct field and register reference of generic contexts is checked. If problems are found
+// a ValidationErrors error is returned which contains all of them, not just the first.
+func Validate(data []byte) error {
+	var root interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, col := lineCol(data, syntaxErr.Offset)
+			return ValidationErrors{{Path: "$", Msg: fmt.Sprintf("line %d, column %d: %s", line, col, err)}}
+		}
+		return ValidationErrors{{Path: "$", Msg: err.Error()}}
+	}
+
+	v := &validator{}
+
+	ctxs, ok := root.([]interface{})
+	if !ok {
+		v.errorf("$", "expected an array of contexts, got %s", jsonType(root))
+		return v.errs
+	}
+
+	for i, ctx := range ctxs {
+		v.context(fmt.Sprintf("$[%d]", i), ctx)
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	// The checks above should cover everything mimic checks, but just in case, attempt to decode as well.
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return ValidationErrors{{Path: "$", Msg: err.Error()}}
+	}
+	for i, b := range raw {
+		if _, err := mimic.UnmarshalContextJSON(bytes.NewReader(b)); err != nil {
+			v.errorf(fmt.Sprintf("$[%d]", i), "%s", err)
+		}
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	return nil
+}
+
+// lineCol converts a byte offset into a 1-based line and column
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+
+	return line, col
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// object checks that val is an object without keys other than the given keys
+func (v *validator) object(path string, val interface{}, keys ...string) (map[string]interface{}, bool) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		v.errorf(path, "expected an object, got %s", jsonType(val))
+		return nil, false
+	}
+
+	var unknown []string
+	for k := range obj {
+		found := false
+		for _, known := range keys {
+			if k == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		v.errorf(path+"."+k, "unknown field, expected one of: %s", strings.Join(keys, ", "))
+	}
+
+	return obj, true
+}
+
+func (v *validator) array(path string, val interface{}) ([]interface{}, bool) {
+	arr, ok := val.([]interface{})
+	if !ok {
+		v.errorf(path, "expected an array, got %s", jsonType(val))
+	}
+	return arr, ok
+}
+
+// str returns the string value of key, missing keys are only an error if required is true
+func (v *validator) str(path string, obj map[string]interface{}, key string, required bool) (string, bool) {
+	val, found := obj[key]
+	if !found {
+		if required {
+			v.errorf(path, "missing required field '%s'", key)
+		}
+		return "", false
+	}
+
+	str, ok := val.(string)
+	if !ok {
+		v.errorf(path+"."+key, "expected a string, got %s", jsonType(val))
+	}
+	return str, ok
+}
+
+// integer returns the integer value of key which has to be within min and max, missing keys are only an error if
+// required is true
+func (v *validator) integer(
+	path string,
+	obj map[string]interface{},
+	key string,
+	min, max int64,
+	required bool,
+) (int64, bool) {
+	val, found := obj[key]
+	if !found {
+		if required {
+			v.errorf(path, "missing required field '%s'", key)
+		}
+		return 0, false
+	}
+
+	keyPath := path + "." + key
+	num, ok := val.(json.Number)
+	if !ok {
+		v.errorf(keyPath, "expected a number, got %s", jsonType(val))
+		return 0, false
+	}
+
+	n, err := num.Int64()
+	if err != nil {
+		v.errorf(keyPath, "expected an integer between %d and %d, got %s", min, max, num)
+		return 0, false
+	}
+
+	if n < min || n > max {
+		v.errorf(keyPath, "%d is out of range, expected a value between %d and %d", n, min, max)
+		return 0, false
+	}
+
+	return n, true
+}
+
+// base64 returns the decoded value of a base64 encoded string
+func (v *validator) base64(path string, obj map[string]interface{}, key string, required bool) ([]byte, bool) {
+	str, ok := v.str(path, obj, key, required)
+	if !ok {
+		return nil, false
+	}
+
+	b, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		v.errorf(path+"."+key, "invalid base64: %s", err)
+		return nil, false
+	}
+
+	return b, true
+}
+
+// ip checks that key is an IP address string, if v4 is true the address has to be an IPv4 address
+func (v *validator) ip(path string, obj map[string]interface{}, key string, v4 bool) {
+	str, ok := v.str(path, obj, key, false)
+	if !ok || str == "" {
+		return
+	}
+
+	ip := net.ParseIP(str)
+	switch {
+	case ip == nil:
+		v.errorf(path+"."+key, "'%s' is not a valid IP address", str)
+	case v4 && ip.To4() == nil:
+		v.errorf(path+"."+key, "'%s' is not an IPv4 address", str)
+	}
+}
+
+var contextTypes = []string{"generic", "xdp_md", "sk_buff", "captured"}
+
+func (v *validator) context(path string, val interface{}) {
+	obj, ok := v.object(path, val, "name", "type", "ctx")
+	if !ok {
+		return
+	}
+
+	v.str(path, obj, "name", false)
+
+	ctxType, ok := v.str(path, obj, "type", true)
+	if !ok {
+		return
+	}
+
+	inner, found := obj["ctx"]
+	if !found {
+		v.errorf(path, "missing required field 'ctx'")
+		return
+	}
+
+	switch ctxType {
+	case "generic":
+		v.generic(path+".ctx", inner)
+	case "xdp_md":
+		v.xdp(path+".ctx", inner)
+	case "sk_buff":
+		v.skb(path+".ctx", inner)
+	case "captured":
+		v.captured(path+".ctx", inner)
+	default:
+		v.errorf(path+".type", "unknown context type '%s', expected one of: %s", ctxType,
+			strings.Join(contextTypes, ", "))
+	}
+}
+
+// genericMem is a memory object of a generic context as seen while validating
+type genericMem struct {
+	path  string
+	typ   string
+	value interface{}
+	// Size of a block, in bytes
+	size int
+}
+
+var memoryTypes = []string{"block", "ptr", "struct", "int"}
+
+func (v *validator) generic(path string, val interface{}) {
+	obj, ok := v.object(path, val, "registers", "memory", "emulator")
+	if !ok {
+		return
+	}
+
+	// First collect all memory objects, so references can be resolved regardless of order
+	mems := make(map[string]*genericMem)
+	var order []string
+	if memVal, found := obj["memory"]; found {
+		memArr, _ := v.array(path+".memory", memVal)
+		for i, memVal := range memArr {
+			memPath := fmt.Sprintf("%s.memory[%d]", path, i)
+			memObj, ok := v.object(memPath, memVal, "name", "type", "value")
+			if !ok {
+				continue
+			}
+
+			name, ok := v.str(memPath, memObj, "name", true)
+			if !ok {
+				continue
+			}
+			if name == "" {
+				v.errorf(memPath+".name", "memory name can't be empty")
+				continue
+			}
+			if prev, found := mems[name]; found {
+				v.errorf(memPath+".name", "duplicate memory name '%s', first defined at %s", name, prev.path)
+				continue
+			}
+
+			typ, ok := v.str(memPath, memObj, "type", true)
+			if !ok {
+				continue
+			}
+
+			value, found := memObj["value"]
+			if !found {
+				v.errorf(memPath, "missing required field 'value'")
+				continue
+			}
+
+			mem := &genericMem{path: memPath, typ: typ, value: value}
+			switch typ {
+			case "block":
+				mem.size = v.blockMem(memPath+".value", value)
+			case "int":
+				v.intMem(memPath+".value", value)
+			case "ptr", "struct":
+				// Checked once all memory is known
+			default:
+				v.errorf(memPath+".type", "unknown memory type '%s', expected one of: %s", typ,
+					strings.Join(memoryTypes, ", "))
+				continue
+			}
+
+			mems[name] = mem
+			order = append(order, name)
+		}
+	}
+
+	for _, name := range order {
+		mem := mems[name]
+		switch mem.typ {
+		case "ptr":
+			v.ptrMem(mem.path+".value", mem.value, mems)
+		case "struct":
+			v.structMem(mem.path+".value", mem.value, mems)
+		}
+	}
+
+	v.pointerCycles(order, mems)
+
+	if regVal, found := obj["registers"]; found {
+		regs, ok := v.object(path+".registers", regVal, "r1", "r2", "r3", "r4", "r5")
+		if ok {
+			for _, reg := range []string{"r1", "r2", "r3", "r4", "r5"} {
+				memName, ok := v.str(path+".registers", regs, reg, false)
+				if !ok || memName == "" {
+					continue
+				}
+
+				if _, found := mems[memName]; !found {
+					v.errorf(path+".registers."+reg, "refers to memory '%s' which doesn't exist", memName)
+				}
+			}
+		}
+	}
+
+	if emuVal, found := obj["emulator"]; found && emuVal != nil {
+		if _, ok := emuVal.(map[string]interface{}); !ok {
+			v.errorf(path+".emulator", "expected an object, got %s", jsonType(emuVal))
+		}
+	}
+}
+
+// blockMem validates a block memory value and returns its size
+func (v *validator) blockMem(path string, val interface{}) int {
+	obj, ok := v.object(path, val, "value", "byteorder")
+	if !ok {
+		return 0
+	}
+
+	b, _ := v.base64(path, obj, "value", true)
+
+	byteOrder, ok := v.str(path, obj, "byteorder", true)
+	if ok {
+		switch strings.ToLower(byteOrder) {
+		case "le", "littleendian", "little-endian", "be", "bigendian", "big-endian":
+		default:
+			v.errorf(path+".byteorder", "'%s' is not a valid byte order, expected one of: "+
+				"le, littleendian, little-endian, be, bigendian, big-endian", byteOrder)
+		}
+	}
+
+	return len(b)
+}
+
+func (v *validator) intMem(path string, val interface{}) {
+	obj, ok := v.object(path, val, "value", "size")
+	if !ok {
+		return
+	}
+
+	size, sizeOK := v.integer(path, obj, "size", 0, 64, true)
+	if sizeOK {
+		switch size {
+		case 8, 16, 32, 64:
+		default:
+			v.errorf(path+".size", "%d is not a valid int size, expected 8, 16, 32 or 64", size)
+			sizeOK = false
+		}
+	}
+
+	value, ok := v.integer(path, obj, "value", math.MinInt64, math.MaxInt64, false)
+	if ok && sizeOK && size < 64 {
+		// Allow both the signed and unsigned range
+		min, max := -(int64(1) << (size - 1)), int64(1)<<size-1
+		if value < min || value > max {
+			v.errorf(path+".value", "%d doesn't fit in a %d bit int", value, size)
+		}
+	}
+}
+
+func (v *validator) ptrMem(path string, val interface{}, mems map[string]*genericMem) {
+	obj, ok := v.object(path, val, "memory", "offset", "size")
+	if !ok {
+		return
+	}
+
+	if size, ok := v.integer(path, obj, "size", 0, 64, false); ok && size != 32 && size != 64 {
+		v.errorf(path+".size", "%d is not a valid pointer size, expected 32 or 64", size)
+	}
+
+	offset, offsetOK := v.integer(path, obj, "offset", 0, math.MaxUint32, false)
+
+	memName, ok := v.str(path, obj, "memory", true)
+	if !ok {
+		return
+	}
+
+	target, found := mems[memName]
+	if !found {
+		v.errorf(path+".memory", "refers to memory '%s' which doesn't exist", memName)
+		return
+	}
+
+	switch target.typ {
+	case "block":
+		// Pointing to the end of a block is allowed, this is what data_end pointers do
+		if offsetOK && offset > int64(target.size) {
+			v.errorf(path+".offset", "offset %d is outside of block '%s' which is %d bytes", offset, memName,
+				target.size)
+		}
+	case "struct":
+	default:
+		v.errorf(path+".memory", "refers to memory '%s' of type '%s', pointers can only point to blocks and "+
+			"structs", memName, target.typ)
+	}
+}
+
+func (v *validator) structMem(path string, val interface{}, mems map[string]*genericMem) {
+	fields, ok := v.array(path, val)
+	if !ok {
+		return
+	}
+
+	for i, fieldVal := range fields {
+		fieldPath := fmt.Sprintf("%s[%d]", path, i)
+		field, ok := v.object(fieldPath, fieldVal, "name", "memory")
+		if !ok {
+			continue
+		}
+
+		v.str(fieldPath, field, "name", false)
+
+		memName, ok := v.str(fieldPath, field, "memory", true)
+		if !ok {
+			continue
+		}
+
+		target, found := mems[memName]
+		if !found {
+			v.errorf(fieldPath+".memory", "refers to memory '%s' which doesn't exist", memName)
+			continue
+		}
+
+		if target.typ != "int" && target.typ != "ptr" {
+			v.errorf(fieldPath+".memory", "refers to memory '%s' of type '%s', only ints and pointers can be "+
+				"included in structs, use a pointer to include blocks and structs", memName, target.typ)
+		}
+	}
+}
+
+// pointerCycles reports structs which (indirectly) contain a pointer to themselves. The address of a struct is only
+// known after all of its fields are, so such structs can't be loaded.
+func (v *validator) pointerCycles(order []string, mems map[string]*genericMem) {
+	// The structs each struct depends on via pointer fields
+	deps := make(map[string][]string)
+	for _, name := range order {
+		mem := mems[name]
+		if mem.typ != "struct" {
+			continue
+		}
+
+		fields, _ := mem.value.([]interface{})
+		for _, fieldVal := range fields {
+			field, _ := fieldVal.(map[string]interface{})
+			memName, _ := field["memory"].(string)
+
+			ptr := mems[memName]
+			if ptr == nil || ptr.typ != "ptr" {
+				continue
+			}
+
+			ptrObj, _ := ptr.value.(map[string]interface{})
+			targetName, _ := ptrObj["memory"].(string)
+			if target := mems[targetName]; target != nil && target.typ == "struct" {
+				deps[name] = append(deps[name], targetName)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var visit func(name string, chain []string)
+	visit = func(name string, chain []string) {
+		switch state[name] {
+		case visiting:
+			v.errorf(mems[name].path, "struct '%s' contains a pointer to itself: %s", name,
+				strings.Join(append(chain, name), " -> "))
+			return
+		case done:
+			return
+		}
+
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			visit(dep, append(chain, name))
+		}
+		state[name] = done
+	}
+	for _, name := range order {
+		if mems[name].typ == "struct" {
+			visit(name, nil)
+		}
+	}
+}
+
+func (v *validator) xdp(path string, val interface{}) {
+	obj, ok := v.object(path, val,
+		"headroom", "tailroom", "packet", "ingress_ifidx", "rx_queue_idx", "egress_ifidx")
+	if !ok {
+		return
+	}
+
+	v.integer(path, obj, "headroom", 0, math.MaxInt32, false)
+	v.integer(path, obj, "tailroom", 0, math.MaxInt32, false)
+	v.base64(path, obj, "packet", false)
+	for _, key := range []string{"ingress_ifidx", "rx_queue_idx", "egress_ifidx"} {
+		v.integer(path, obj, key, math.MinInt32, math.MaxInt32, false)
+	}
+}
+
+func (v *validator) skb(path string, val interface{}) {
+	obj, ok := v.object(path, val, "packet", "sock", "dev", "flowKeys")
+	if !ok {
+		return
+	}
+
+	v.base64(path, obj, "packet", false)
+
+	if skVal, found := obj["sock"]; found && skVal != nil {
+		skPath := path + ".sock"
+		sk, ok := v.object(skPath, skVal,
+			"boundDevIF", "family", "sockType", "protocol", "mark", "priority", "srcIP4", "srcIP6", "srcPort",
+			"dstPort", "dstIP4", "dstIP6", "state", "rxQueueMapping")
+		if ok {
+			for _, key := range []string{
+				"boundDevIF", "family", "sockType", "protocol", "mark", "priority", "srcPort", "dstPort", "state",
+			} {
+				v.integer(skPath, sk, key, 0, math.MaxUint32, false)
+			}
+			v.integer(skPath, sk, "rxQueueMapping", math.MinInt32, math.MaxInt32, false)
+			v.ip(skPath, sk, "srcIP4", true)
+			v.ip(skPath, sk, "dstIP4", true)
+			v.ip(skPath, sk, "srcIP6", false)
+			v.ip(skPath, sk, "dstIP6", false)
+		}
+	}
+
+	if devVal, found := obj["dev"]; found && devVal != nil {
+		dev, ok := v.object(path+".dev", devVal, "ifIndex")
+		if ok {
+			v.integer(path+".dev", dev, "ifIndex", 0, math.MaxUint32, false)
+		}
+	}
+
+	if fkVal, found := obj["flowKeys"]; found && fkVal != nil {
+		fkPath := path + ".flowKeys"
+		fk, ok := v.object(fkPath, fkVal,
+			"nhoff", "thoff", "addrProto", "isFrag", "isFirstFrag", "isEncap", "ipProto", "nProto", "sport",
+			"dport", "ip", "flags", "flowLabel")
+		if ok {
+			for _, key := range []string{"nhoff", "thoff", "addrProto", "nProto", "sport", "dport"} {
+				v.integer(fkPath, fk, key, 0, math.MaxUint16, false)
+			}
+			for _, key := range []string{"isFrag", "isFirstFrag", "isEncap", "ipProto"} {
+				v.integer(fkPath, fk, key, 0, math.MaxUint8, false)
+			}
+			for _, key := range []string{"flags", "flowLabel"} {
+				v.integer(fkPath, fk, key, 0, math.MaxUint32, false)
+			}
+			v.ip(fkPath, fk, "ip", false)
+		}
+	}
+}
+
+func (v *validator) captured(path string, val interface{}) {
+	obj, ok := v.object(path, val, "subContext", "helperCalls")
+	if !ok {
+		return
+	}
+
+	if sub, found := obj["subContext"]; found {
+		v.context(path+".subContext", sub)
+	} else {
+		v.errorf(path, "missing required field 'subContext'")
+	}
+
+	callsVal, found := obj["helperCalls"]
+	if !found || callsVal == nil {
+		return
+	}
+
+	calls, ok := callsVal.(map[string]interface{})
+	if !ok {
+		v.errorf(path+".helperCalls", "expected an object, got %s", jsonType(callsVal))
+		return
+	}
+
+	keys := make([]string, 0, len(calls))
+	for k := range calls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := fmt.Sprintf("%s.helperCalls[%q]", path, key)
+		arr, ok := v.array(keyPath, calls[key])
+		if !ok {
+			continue
+		}
+
+		for i, callVal := range arr {
+			callPath := fmt.Sprintf("%s[%d]", keyPath, i)
+			call, ok := v.object(callPath, callVal, "helperFn", "params", "results")
+			if !ok {
+				continue
+			}
+
+			v.integer(callPath, call, "helperFn", 0, math.MaxInt32, true)
+			for _, regsKey := range []string{"params", "results"} {
+				regsVal, found := call[regsKey]
+				if !found || regsVal == nil {
+					continue
+				}
+
+				regs, _ := v.array(callPath+"."+regsKey, regsVal)
+				for j, regVal := range regs {
+					v.registerData(fmt.Sprintf("%s.%s[%d]", callPath, regsKey, j), regVal)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) registerData(path string, val interface{}) {
+	obj, ok := v.object(path, val, "reg", "value")
+	if !ok {
+		return
+	}
+
+	v.integer(path, obj, "reg", 0, 10, true)
+
+	switch value := obj["value"].(type) {
+	case json.Number:
+		if _, err := strconv.ParseUint(value.String(), 10, 64); err != nil {
+			v.errorf(path+".value", "expected an unsigned 64 bit integer, got %s", value)
+		}
+	case string:
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+			v.errorf(path+".value", "invalid base64: %s", err)
+		}
+	default:
+		v.errorf(path+".value", "expected a number or base64 string, got %s", jsonType(value))
+	}
+}
+
+// jsonType returns the JSON name of the type of a decoded value
+func jsonType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
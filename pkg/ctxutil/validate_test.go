@@ -0,0 +1,148 @@
+package ctxutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/dylandreimerink/mimic"
+)
+
+func TestValidateValid(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/ctx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Validate(data); err != nil {
+		t.Errorf("testdata/ctx.json: %s", err)
+	}
+
+	// Everything we generate should be valid
+	format, err := ParseTracepointFormat(bytes.NewReader([]byte(schedProcessExecFormat)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := NewTracepoint("tp", format, map[string]string{"filename": "/bin/sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Encode(&buf, []mimic.Context{
+		NewXDP("xdp", []byte{1, 2, 3}, 1),
+		NewSKBuff("skb", []byte{1, 2, 3}, 1),
+		NewPTRegs("pt_regs"),
+		NewPerfEventData("perf_event"),
+		tp,
+		&mimic.CapturedContext{Sub: NewXDP("sub", nil, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Validate(buf.Bytes()); err != nil {
+		t.Errorf("generated contexts: %s", err)
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		path string
+	}{
+		{
+			name: "syntax",
+			json: "[\n{\"type\": \"xdp_md\",}]",
+			path: "$",
+		},
+		{
+			name: "not an array",
+			json: `{"type": "xdp_md", "ctx": {}}`,
+			path: "$",
+		},
+		{
+			name: "unknown type",
+			json: `[{"type": "xdp", "ctx": {}}]`,
+			path: "$[0].type",
+		},
+		{
+			name: "unknown field",
+			json: `[{"type": "xdp_md", "ctx": {"pkt": ""}}]`,
+			path: "$[0].ctx.pkt",
+		},
+		{
+			name: "register",
+			json: `[{"type": "generic", "ctx": {"registers": {"r1": "foo"}, "memory": []}}]`,
+			path: "$[0].ctx.registers.r1",
+		},
+		{
+			name: "pointer target",
+			json: `[{"type": "generic", "ctx": {"memory": [
+				{"name": "p", "type": "ptr", "value": {"memory": "foo", "size": 32}}
+			]}}]`,
+			path: "$[0].ctx.memory[0].value.memory",
+		},
+		{
+			name: "pointer offset",
+			json: `[{"type": "generic", "ctx": {"memory": [
+				{"name": "b", "type": "block", "value": {"value": "AAE=", "byteorder": "le"}},
+				{"name": "p", "type": "ptr", "value": {"memory": "b", "offset": 3, "size": 32}}
+			]}}]`,
+			path: "$[0].ctx.memory[1].value.offset",
+		},
+		{
+			name: "struct field",
+			json: `[{"type": "generic", "ctx": {"memory": [
+				{"name": "b", "type": "block", "value": {"value": "AAE=", "byteorder": "le"}},
+				{"name": "s", "type": "struct", "value": [{"name": "a", "memory": "b"}]}
+			]}}]`,
+			path: "$[0].ctx.memory[1].value[0].memory",
+		},
+		{
+			name: "int size",
+			json: `[{"type": "generic", "ctx": {"memory": [
+				{"name": "i", "type": "int", "value": {"value": 1, "size": 12}}
+			]}}]`,
+			path: "$[0].ctx.memory[0].value.size",
+		},
+		{
+			name: "duplicate",
+			json: `[{"type": "generic", "ctx": {"memory": [
+				{"name": "i", "type": "int", "value": {"value": 1, "size": 8}},
+				{"name": "i", "type": "int", "value": {"value": 1, "size": 8}}
+			]}}]`,
+			path: "$[0].ctx.memory[1].name",
+		},
+		{
+			name: "sub context",
+			json: `[{"type": "captured", "ctx": {"subContext": {"type": "sk_buff", "ctx": {"packet": "%%"}}}}]`,
+			path: "$[0].ctx.subContext.ctx.packet",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate([]byte(test.json))
+
+			var validationErrs ValidationErrors
+			if !errors.As(err, &validationErrs) {
+				t.Fatalf("expected validation errors, got '%v'", err)
+			}
+
+			if len(validationErrs) != 1 || validationErrs[0].Path != test.path {
+				t.Errorf("expected a single error at %s, got:\n%s", test.path, err)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema(), &schema); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package ctxutil
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+var xdpVerdicts = []string{"XDP_ABORTED", "XDP_DROP", "XDP_PASS", "XDP_TX", "XDP_REDIRECT"}
+
+var tcVerdicts = []string{
+	"TC_ACT_OK",
+	"TC_ACT_RECLASSIFY",
+	"TC_ACT_SHOT",
+	"TC_ACT_PIPE",
+	"TC_ACT_STOLEN",
+	"TC_ACT_QUEUED",
+	"TC_ACT_REPEAT",
+	"TC_ACT_REDIRECT",
+	"TC_ACT_TRAP",
+}
+
+// Verdict returns the name of the return value of a program of the given type, for example 'XDP_PASS'. Unknown
+// values are formatted as 'RET_<value>'.
+func Verdict(progType ebpf.ProgramType, r0 uint64) string {
+	// Return values are 32-bit ints
+	ret := int32(r0)
+
+	switch progType {
+	case ebpf.XDP:
+		if ret >= 0 && int(ret) < len(xdpVerdicts) {
+			return xdpVerdicts[ret]
+		}
+
+	case ebpf.SchedCLS, ebpf.SchedACT:
+		if ret == -1 {
+			return "TC_ACT_UNSPEC"
+		}
+		if ret >= 0 && int(ret) < len(tcVerdicts) {
+			return tcVerdicts[ret]
+		}
+
+	case ebpf.SocketFilter:
+		// Socket filters return the amount of bytes to keep
+		if ret == 0 {
+			return "DROP"
+		}
+		return "PASS"
+
+	case ebpf.CGroupSKB:
+		switch ret {
+		case 0:
+			return "DROP"
+		case 1:
+			return "PASS"
+		}
+	}
+
+	return fmt.Sprintf("RET_%d", ret)
+}
@@ -0,0 +1,31 @@
+package ctxutil
+
+import "github.com/dylandreimerink/mimic"
+
+// NewXDP returns a generic context with the memory layout of a `struct xdp_md` for the given packet.
+func NewXDP(name string, pkt []byte, ingressIfindex int) *mimic.GenericContext {
+	return &mimic.GenericContext{
+		Name: name,
+		Registers: mimic.GenericContextRegisters{
+			R1: "xdp_md",
+		},
+		Memory: []mimic.GenericContextMemory{
+			newBlock("pkt", pkt),
+			newPtr("data", "pkt", 0),
+			newPtr("data_end", "pkt", len(pkt)),
+			newPtr("data_meta", "pkt", 0),
+			newInt("ingress_ifindex", 32, int64(ingressIfindex)),
+			// PCAP files and packets don't contain rx_queue_index info
+			newInt("rx_queue_index", 32, 0),
+			newInt("egress_ifindex", 32, 0),
+			newStruct("xdp_md", []string{
+				"data",
+				"data_end",
+				"data_meta",
+				"ingress_ifindex",
+				"rx_queue_index",
+				"egress_ifindex",
+			}),
+		},
+	}
+}
@@ -0,0 +1,221 @@
+// Package exthelper implements the protocol between edb and external helper processes. External helper processes
+// implement helper functions which the emulator can't model, like FIB or socket lookups which depend on the
+// environment the program runs in. They can be written in any language.
+//
+// edb starts the process and writes a request per helper call to its stdin, as a single line of JSON. The process
+// answers every request with a single line of JSON on stdout, in order. Anything the process writes to stderr is
+// shown to the user, so it can be used for logging.
+//
+// A request for a call to bpf_fib_lookup looks like:
+//
+//	{"id": 1, "helper": 69, "name": "bpf_fib_lookup", "args": [1048576, 2097152, 64, 0, 0],
+//	 "memory": [{"arg": 1, "data": "..."}, {"arg": 2, "data": "..."}]}
+//
+// 'args' holds R1-R5, pointers are addresses in the emulator. 'memory' holds the memory pointed to by the pointer
+// args, from the pointer to the end of the memory object it points into, with at most MaxMemory bytes. Pointers to
+// maps are sent as the name of the map in 'map' instead of 'data'. Memory data is base64 encoded.
+//
+// The response holds the same id, the return value in 'r0' and optionally memory writes, relative to the pointer
+// args:
+//
+//	{"id": 1, "r0": 0, "writes": [{"arg": 2, "offset": 14, "data": "..."}]}
+//
+// If the process can't handle the call, it can set 'error' which stops the program with that error.
+package exthelper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MaxMemory is the maximum amount of bytes of memory sent per pointer arg
+const MaxMemory = 4096
+
+// DefaultTimeout is the time a process has to answer a request
+const DefaultTimeout = 5 * time.Second
+
+// Request is a helper call sent to the external process
+type Request struct {
+	ID     uint64   `json:"id"`
+	Helper int      `json:"helper"`
+	Name   string   `json:"name"`
+	Args   []uint64 `json:"args"`
+	Memory []Memory `json:"memory,omitempty"`
+}
+
+// Memory is the memory a pointer arg points to
+type Memory struct {
+	// The arg number, 1 for R1 to 5 for R5
+	Arg  int    `json:"arg"`
+	Data []byte `json:"data,omitempty"`
+	// The name of the map, if the arg points to a map
+	Map string `json:"map,omitempty"`
+}
+
+// Response is the result of a helper call, as returned by the external process
+type Response struct {
+	ID     uint64  `json:"id"`
+	R0     int64   `json:"r0"`
+	Writes []Write `json:"writes,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Write is memory written by the helper, at an offset from the pointer in an arg
+type Write struct {
+	Arg    int    `json:"arg"`
+	Offset uint32 `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// ErrTimeout is returned when the process doesn't answer in time
+var ErrTimeout = errors.New("timeout waiting for response")
+
+// Process is a running external helper process
+type Process struct {
+	// Timeout is the time the process has to answer a request
+	Timeout time.Duration
+
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan response
+	readErr   error
+	nextID    uint64
+}
+
+type response struct {
+	resp Response
+	err  error
+}
+
+// Start starts an external helper process, its stderr is forwarded to stderr
+func Start(name string, args ...string) (*Process, error) {
+	p := &Process{
+		Timeout:   DefaultTimeout,
+		cmd:       exec.Command(name, args...),
+		responses: make(chan response),
+	}
+	p.cmd.Stderr = os.Stderr
+
+	var err error
+	p.stdin, err = p.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+
+	if err = p.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go p.readResponses(stdout)
+
+	return p, nil
+}
+
+func (p *Process) readResponses(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	// Writes can contain a lot of base64 data, so allow long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*MaxMemory*5)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var resp Response
+		err := json.Unmarshal([]byte(line), &resp)
+		if err != nil {
+			err = fmt.Errorf("decode response '%s': %w", line, err)
+		}
+		p.responses <- response{resp: resp, err: err}
+	}
+
+	// Closing the channel publishes readErr to Call
+	p.readErr = scanner.Err()
+	close(p.responses)
+}
+
+// Call sends a request to the process and waits for its response. The ID of the request is set by Call.
+func (p *Process) Call(req Request) (Response, error) {
+	p.nextID++
+	req.ID = p.nextID
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("encode request: %w", err)
+	}
+
+	if _, err = p.stdin.Write(append(b, '\n')); err != nil {
+		return Response{}, fmt.Errorf("write request: %w", err)
+	}
+
+	timeout := time.After(p.Timeout)
+	for {
+		select {
+		case r, ok := <-p.responses:
+			if !ok {
+				if p.readErr != nil {
+					return Response{}, fmt.Errorf("read response: %w", p.readErr)
+				}
+				return Response{}, errors.New("process exited")
+			}
+			if r.err != nil {
+				return Response{}, r.err
+			}
+			// Late responses to earlier calls which timed out are discarded
+			if r.resp.ID < req.ID {
+				continue
+			}
+			if r.resp.ID != req.ID {
+				return Response{}, fmt.Errorf("response has id %d, expected %d", r.resp.ID, req.ID)
+			}
+			if r.resp.Error != "" {
+				return r.resp, errors.New(r.resp.Error)
+			}
+			return r.resp, nil
+
+		case <-timeout:
+			return Response{}, ErrTimeout
+		}
+	}
+}
+
+// Close closes stdin of the process, which should make it exit, and kills it if it doesn't exit within the timeout.
+func (p *Process) Close() error {
+	p.stdin.Close()
+
+	// Discard responses to calls which timed out, so the reader isn't blocked
+	go func() {
+		for range p.responses {
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- p.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(p.Timeout):
+		p.cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+func (p *Process) String() string {
+	return strings.Join(p.cmd.Args, " ")
+}
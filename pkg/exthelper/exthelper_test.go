@@ -0,0 +1,171 @@
+package exthelper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// When the test binary is started with this variable set, it acts as external helper process instead of running the
+// tests.
+const helperEnv = "EXTHELPER_TEST_PROCESS"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "echo":
+		echoProcess()
+	case "slow":
+		slowProcess()
+	case "silent":
+		// Read requests, but never answer
+		bufio.NewScanner(os.Stdin).Scan()
+		time.Sleep(time.Second)
+	}
+	os.Exit(0)
+}
+
+// slowProcess returns the helper number, requests for helper 2 are answered after a delay
+func slowProcess() {
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			panic(err)
+		}
+
+		if req.Helper == 2 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		enc.Encode(Response{ID: req.ID, R0: int64(req.Helper)})
+	}
+}
+
+// echoProcess returns the sum of the args and writes the first memory arg reversed back to the same arg, or an error
+// for helper 0.
+func echoProcess() {
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			panic(err)
+		}
+
+		resp := Response{ID: req.ID}
+		if req.Helper == 0 {
+			resp.Error = "helper 0 not supported"
+			enc.Encode(resp)
+			continue
+		}
+
+		for _, arg := range req.Args {
+			resp.R0 += int64(arg)
+		}
+
+		for _, mem := range req.Memory {
+			if mem.Data == nil {
+				continue
+			}
+
+			data := make([]byte, len(mem.Data))
+			for i, b := range mem.Data {
+				data[len(data)-1-i] = b
+			}
+			resp.Writes = append(resp.Writes, Write{Arg: mem.Arg, Offset: 1, Data: data})
+			break
+		}
+
+		enc.Encode(resp)
+	}
+}
+
+func startTestProcess(t *testing.T, mode string) *Process {
+	t.Helper()
+
+	os.Setenv(helperEnv, mode)
+	defer os.Unsetenv(helperEnv)
+
+	p, err := Start(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestCall(t *testing.T) {
+	p := startTestProcess(t, "echo")
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := p.Call(Request{
+			Helper: 69,
+			Name:   "bpf_fib_lookup",
+			Args:   []uint64{1, 2, 3, 4, 5},
+			Memory: []Memory{
+				{Arg: 1, Map: "devmap"},
+				{Arg: 2, Data: []byte{1, 2, 3}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.ID != uint64(i+1) {
+			t.Errorf("got id %d, want %d", resp.ID, i+1)
+		}
+		if resp.R0 != 15 {
+			t.Errorf("got r0 %d, want 15", resp.R0)
+		}
+		if len(resp.Writes) != 1 || resp.Writes[0].Arg != 2 || resp.Writes[0].Offset != 1 ||
+			!bytes.Equal(resp.Writes[0].Data, []byte{3, 2, 1}) {
+			t.Errorf("unexpected writes: %+v", resp.Writes)
+		}
+	}
+
+	_, err := p.Call(Request{Helper: 0})
+	if err == nil || err.Error() != "helper 0 not supported" {
+		t.Errorf("got error '%v', want error from process", err)
+	}
+
+	if err = p.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	p := startTestProcess(t, "silent")
+	p.Timeout = 100 * time.Millisecond
+
+	_, err := p.Call(Request{Helper: 1})
+	if err != ErrTimeout {
+		t.Errorf("got error '%v', want timeout", err)
+	}
+
+	p.Close()
+
+	// The late response to a call which timed out must not be taken as the response to the next call
+	p = startTestProcess(t, "slow")
+	defer p.Close()
+	p.Timeout = 100 * time.Millisecond
+
+	_, err = p.Call(Request{Helper: 2})
+	if err != ErrTimeout {
+		t.Errorf("got error '%v', want timeout", err)
+	}
+
+	p.Timeout = time.Second
+	resp, err := p.Call(Request{Helper: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 2 || resp.R0 != 1 {
+		t.Errorf("got response %+v, want id 2 and r0 1", resp)
+	}
+}
@@ -7,16 +7,71 @@ import (
 
 // Code generated by 'go run cmd/gen/helperdata.go | gofmt > pkg/helperdata/helperdata.go' DO NOT EDIT
 
+// HelperFunc describes the signature of a helper function
 type HelperFunc struct {
+	// Name is the name of the helper in C, like bpf_map_lookup_elem
+	Name    string
 	RetType CType
 	Params  []HelperParam
+	// Ret describes what the return value of the helper is
+	Ret RetKind
+	// Outputs lists the params which point to memory written by the helper
+	Outputs []HelperOutput
 }
 
+// RetKind describes what the return value of a helper function is
+type RetKind int
+
+const (
+	// RetScalar is a number, like a size, an ID or an error code
+	RetScalar RetKind = iota
+	// RetVoid means the helper doesn't return a value
+	RetVoid
+	// RetMapValue is a pointer to a map value, or NULL
+	RetMapValue
+	// RetMem is a pointer to memory which isn't a map value, like a reserved ringbuffer record, or NULL
+	RetMem
+	// RetKernelPtr is a pointer to a kernel object, like a socket or a task, or NULL
+	RetKernelPtr
+)
+
+// IsPtr returns true if the return value is a pointer, these are only meaningful within the kernel which returned
+// them, except for comparisons against NULL.
+func (r RetKind) IsPtr() bool {
+	return r == RetMapValue || r == RetMem || r == RetKernelPtr
+}
+
+// OutputKind describes how the size of the memory written by a helper is determined
+type OutputKind int
+
+const (
+	// OutputSizeParam memory has the size given by another param of the helper
+	OutputSizeParam OutputKind = iota
+	// OutputFixed memory has a fixed size
+	OutputFixed
+	// OutputMapValue memory has the value size of the map passed as first param, like the value of
+	// bpf_map_peek_elem
+	OutputMapValue
+)
+
+// HelperOutput describes a param which points to memory written by the helper
+type HelperOutput struct {
+	Kind OutputKind
+	// The index of the pointer param
+	Param int
+	// The index of the param which holds the size of the memory, or -1 if the size isn't given by a param
+	SizeParam int
+	// The size of the memory if it is fixed
+	Size int
+}
+
+// HelperParam describes a parameter of a helper function
 type HelperParam struct {
 	Type CType
 	Name string
 }
 
+// CType describes a type in the C language
 type CType struct {
 	Name   string
 	Ptr    bool
@@ -43,15 +98,19 @@ func (c CType) String() string {
 	return strings.Join(parts, " ")
 }
 
+// Signatures is a map of eBPF helper function signatures keyed by asm.BuiltinFunc
 var Signatures = map[asm.BuiltinFunc]HelperFunc{
 	asm.FnMapLookupElem: {
+		Name:    "bpf_map_lookup_elem",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "key"},
 		},
+		Ret: RetMapValue,
 	},
 	asm.FnMapUpdateElem: {
+		Name:    "bpf_map_update_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -61,6 +120,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMapDeleteElem: {
+		Name:    "bpf_map_delete_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -68,18 +128,24 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnProbeRead: {
+		Name:    "bpf_probe_read",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnKtimeGetNs: {
+		Name:    "bpf_ktime_get_ns",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnTracePrintk: {
+		Name:    "bpf_trace_printk",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "fmt"},
@@ -88,14 +154,17 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetPrandomU32: {
+		Name:    "bpf_get_prandom_u32",
 		RetType: CType{Name: "__u32"},
 		Params:  []HelperParam{},
 	},
 	asm.FnGetSmpProcessorId: {
+		Name:    "bpf_get_smp_processor_id",
 		RetType: CType{Name: "__u32"},
 		Params:  []HelperParam{},
 	},
 	asm.FnSkbStoreBytes: {
+		Name:    "bpf_skb_store_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -106,6 +175,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnL3CsumReplace: {
+		Name:    "bpf_l3_csum_replace",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -116,6 +186,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnL4CsumReplace: {
+		Name:    "bpf_l4_csum_replace",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -126,14 +197,17 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnTailCall: {
+		Name:    "bpf_tail_call",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "void", Ptr: true}, Name: "prog_array_map"},
 			{Type: CType{Name: "__u32"}, Name: "index"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnCloneRedirect: {
+		Name:    "bpf_clone_redirect",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -142,27 +216,35 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetCurrentPidTgid: {
+		Name:    "bpf_get_current_pid_tgid",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnGetCurrentUidGid: {
+		Name:    "bpf_get_current_uid_gid",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnGetCurrentComm: {
+		Name:    "bpf_get_current_comm",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "__u32"}, Name: "size_of_buf"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnGetCgroupClassid: {
+		Name:    "bpf_get_cgroup_classid",
 		RetType: CType{Name: "__u32"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnSkbVlanPush: {
+		Name:    "bpf_skb_vlan_push",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -171,12 +253,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbVlanPop: {
+		Name:    "bpf_skb_vlan_pop",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnSkbGetTunnelKey: {
+		Name:    "bpf_skb_get_tunnel_key",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -184,8 +268,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSkbSetTunnelKey: {
+		Name:    "bpf_skb_set_tunnel_key",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -195,6 +283,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnPerfEventRead: {
+		Name:    "bpf_perf_event_read",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -202,6 +291,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRedirect: {
+		Name:    "bpf_redirect",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "ifindex"},
@@ -209,12 +299,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetRouteRealm: {
+		Name:    "bpf_get_route_realm",
 		RetType: CType{Name: "__u32"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnPerfEventOutput: {
+		Name:    "bpf_perf_event_output",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -225,6 +317,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbLoadBytes: {
+		Name:    "bpf_skb_load_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "skb"},
@@ -232,8 +325,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "to"},
 			{Type: CType{Name: "__u32"}, Name: "len"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.FnGetStackid: {
+		Name:    "bpf_get_stackid",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -242,6 +339,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnCsumDiff: {
+		Name:    "bpf_csum_diff",
 		RetType: CType{Name: "__s64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__be32", Ptr: true}, Name: "from"},
@@ -252,14 +350,19 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbGetTunnelOpt: {
+		Name:    "bpf_skb_get_tunnel_opt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 			{Type: CType{Name: "void", Ptr: true}, Name: "opt"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSkbSetTunnelOpt: {
+		Name:    "bpf_skb_set_tunnel_opt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -268,6 +371,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbChangeProto: {
+		Name:    "bpf_skb_change_proto",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -276,6 +380,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbChangeType: {
+		Name:    "bpf_skb_change_type",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -283,6 +388,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbUnderCgroup: {
+		Name:    "bpf_skb_under_cgroup",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -291,16 +397,19 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetHashRecalc: {
+		Name:    "bpf_get_hash_recalc",
 		RetType: CType{Name: "__u32"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnGetCurrentTask: {
+		Name:    "bpf_get_current_task",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnProbeWriteUser: {
+		Name:    "bpf_probe_write_user",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
@@ -309,6 +418,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnCurrentTaskUnderCgroup: {
+		Name:    "bpf_current_task_under_cgroup",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -316,6 +426,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbChangeTail: {
+		Name:    "bpf_skb_change_tail",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -324,6 +435,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbPullData: {
+		Name:    "bpf_skb_pull_data",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -331,6 +443,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnCsumUpdate: {
+		Name:    "bpf_csum_update",
 		RetType: CType{Name: "__s64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -338,16 +451,20 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSetHashInvalid: {
+		Name:    "bpf_set_hash_invalid",
 		RetType: CType{Name: "void"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnGetNumaNodeId: {
+		Name:    "bpf_get_numa_node_id",
 		RetType: CType{Name: "long"},
 		Params:  []HelperParam{},
 	},
 	asm.FnSkbChangeHead: {
+		Name:    "bpf_skb_change_head",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -356,6 +473,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnXdpAdjustHead: {
+		Name:    "bpf_xdp_adjust_head",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
@@ -363,26 +481,33 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnProbeReadStr: {
+		Name:    "bpf_probe_read_str",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnGetSocketCookie: {
+		Name:    "bpf_get_socket_cookie",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.FnGetSocketUid: {
+		Name:    "bpf_get_socket_uid",
 		RetType: CType{Name: "__u32"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnSetHash: {
+		Name:    "bpf_set_hash",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -390,6 +515,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSetsockopt: {
+		Name:    "bpf_setsockopt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "bpf_socket"},
@@ -400,6 +526,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbAdjustRoom: {
+		Name:    "bpf_skb_adjust_room",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -409,6 +536,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRedirectMap: {
+		Name:    "bpf_redirect_map",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -417,6 +545,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkRedirectMap: {
+		Name:    "bpf_sk_redirect_map",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -426,6 +555,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSockMapUpdate: {
+		Name:    "bpf_sock_map_update",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "skops"},
@@ -435,6 +565,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnXdpAdjustMeta: {
+		Name:    "bpf_xdp_adjust_meta",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
@@ -442,6 +573,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnPerfEventReadValue: {
+		Name:    "bpf_perf_event_read_value",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -449,16 +581,24 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "bpf_perf_event_value", Struct: true, Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "__u32"}, Name: "buf_size"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.FnPerfProgReadValue: {
+		Name:    "bpf_perf_prog_read_value",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_perf_event_data", Struct: true, Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "bpf_perf_event_value", Struct: true, Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "__u32"}, Name: "buf_size"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnGetsockopt: {
+		Name:    "bpf_getsockopt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "bpf_socket"},
@@ -467,8 +607,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "optval"},
 			{Type: CType{Name: "int"}, Name: "optlen"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 3, SizeParam: 4},
+		},
 	},
 	asm.FnOverrideReturn: {
+		Name:    "bpf_override_return",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "pt_regs", Struct: true, Ptr: true}, Name: "regs"},
@@ -476,6 +620,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSockOpsCbFlagsSet: {
+		Name:    "bpf_sock_ops_cb_flags_set",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "bpf_sock"},
@@ -483,6 +628,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgRedirectMap: {
+		Name:    "bpf_msg_redirect_map",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -492,6 +638,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgApplyBytes: {
+		Name:    "bpf_msg_apply_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -499,6 +646,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgCorkBytes: {
+		Name:    "bpf_msg_cork_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -506,6 +654,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgPullData: {
+		Name:    "bpf_msg_pull_data",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -515,6 +664,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnBind: {
+		Name:    "bpf_bind",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_addr", Struct: true, Ptr: true}, Name: "ctx"},
@@ -523,6 +673,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnXdpAdjustTail: {
+		Name:    "bpf_xdp_adjust_tail",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
@@ -530,6 +681,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbGetXfrmState: {
+		Name:    "bpf_skb_get_xfrm_state",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -538,8 +690,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.FnGetStack: {
+		Name:    "bpf_get_stack",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -547,8 +703,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSkbLoadBytesRelative: {
+		Name:    "bpf_skb_load_bytes_relative",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "skb"},
@@ -557,8 +717,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "len"},
 			{Type: CType{Name: "__u32"}, Name: "start_header"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.FnFibLookup: {
+		Name:    "bpf_fib_lookup",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -566,8 +730,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "int"}, Name: "plen"},
 			{Type: CType{Name: "__u32"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSockHashUpdate: {
+		Name:    "bpf_sock_hash_update",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "skops"},
@@ -577,6 +745,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgRedirectHash: {
+		Name:    "bpf_msg_redirect_hash",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -586,6 +755,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkRedirectHash: {
+		Name:    "bpf_sk_redirect_hash",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -595,6 +765,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnLwtPushEncap: {
+		Name:    "bpf_lwt_push_encap",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -604,6 +775,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnLwtSeg6StoreBytes: {
+		Name:    "bpf_lwt_seg6_store_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -613,6 +785,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnLwtSeg6AdjustSrh: {
+		Name:    "bpf_lwt_seg6_adjust_srh",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -621,6 +794,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnLwtSeg6Action: {
+		Name:    "bpf_lwt_seg6_action",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -630,12 +804,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRcRepeat: {
+		Name:    "bpf_rc_repeat",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.FnRcKeydown: {
+		Name:    "bpf_rc_keydown",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -645,23 +821,28 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbCgroupId: {
+		Name:    "bpf_skb_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnGetCurrentCgroupId: {
+		Name:    "bpf_get_current_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnGetLocalStorage: {
+		Name:    "bpf_get_local_storage",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetMapValue,
 	},
 	asm.FnSkSelectReuseport: {
+		Name:    "bpf_sk_select_reuseport",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_reuseport_md", Struct: true, Ptr: true}, Name: "reuse"},
@@ -671,6 +852,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbAncestorCgroupId: {
+		Name:    "bpf_skb_ancestor_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -678,6 +860,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkLookupTcp: {
+		Name:    "bpf_sk_lookup_tcp",
 		RetType: CType{Name: "bpf_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -686,8 +869,10 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64"}, Name: "netns"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkLookupUdp: {
+		Name:    "bpf_sk_lookup_udp",
 		RetType: CType{Name: "bpf_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -696,14 +881,17 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64"}, Name: "netns"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkRelease: {
+		Name:    "bpf_sk_release",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sock"},
 		},
 	},
 	asm.FnMapPushElem: {
+		Name:    "bpf_map_push_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -712,20 +900,29 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMapPopElem: {
+		Name:    "bpf_map_pop_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
 			{Type: CType{Name: "void", Ptr: true}, Name: "value"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputMapValue, Param: 1, SizeParam: -1},
+		},
 	},
 	asm.FnMapPeekElem: {
+		Name:    "bpf_map_peek_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
 			{Type: CType{Name: "void", Ptr: true}, Name: "value"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputMapValue, Param: 1, SizeParam: -1},
+		},
 	},
 	asm.FnMsgPushData: {
+		Name:    "bpf_msg_push_data",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -735,6 +932,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnMsgPopData: {
+		Name:    "bpf_msg_pop_data",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "sk_msg_md", Struct: true, Ptr: true}, Name: "msg"},
@@ -744,6 +942,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRcPointerRel: {
+		Name:    "bpf_rc_pointer_rel",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -752,42 +951,54 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSpinLock: {
+		Name:    "bpf_spin_lock",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_spin_lock", Struct: true, Ptr: true}, Name: "lock"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnSpinUnlock: {
+		Name:    "bpf_spin_unlock",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_spin_lock", Struct: true, Ptr: true}, Name: "lock"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnSkFullsock: {
+		Name:    "bpf_sk_fullsock",
 		RetType: CType{Name: "bpf_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock", Struct: true, Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnTcpSock: {
+		Name:    "bpf_tcp_sock",
 		RetType: CType{Name: "bpf_tcp_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock", Struct: true, Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkbEcnSetCe: {
+		Name:    "bpf_skb_ecn_set_ce",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnGetListenerSock: {
+		Name:    "bpf_get_listener_sock",
 		RetType: CType{Name: "bpf_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock", Struct: true, Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkcLookupTcp: {
+		Name:    "bpf_skc_lookup_tcp",
 		RetType: CType{Name: "bpf_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -796,8 +1007,10 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64"}, Name: "netns"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnTcpCheckSyncookie: {
+		Name:    "bpf_tcp_check_syncookie",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
@@ -808,6 +1021,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSysctlGetName: {
+		Name:    "bpf_sysctl_get_name",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sysctl", Struct: true, Ptr: true}, Name: "ctx"},
@@ -815,24 +1029,36 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "unsigned"}, Name: "buf_len"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSysctlGetCurrentValue: {
+		Name:    "bpf_sysctl_get_current_value",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sysctl", Struct: true, Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "char", Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "unsigned"}, Name: "buf_len"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSysctlGetNewValue: {
+		Name:    "bpf_sysctl_get_new_value",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sysctl", Struct: true, Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "char", Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "unsigned"}, Name: "buf_len"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSysctlSetNewValue: {
+		Name:    "bpf_sysctl_set_new_value",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sysctl", Struct: true, Ptr: true}, Name: "ctx"},
@@ -841,6 +1067,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnStrtol: {
+		Name:    "bpf_strtol",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "buf"},
@@ -848,8 +1075,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 			{Type: CType{Name: "long", Ptr: true}, Name: "res"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputFixed, Param: 3, SizeParam: -1, Size: 8},
+		},
 	},
 	asm.FnStrtoul: {
+		Name:    "bpf_strtoul",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "buf"},
@@ -857,8 +1088,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 			{Type: CType{Name: "unsigned"}, Name: "res"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputFixed, Param: 3, SizeParam: -1, Size: 8},
+		},
 	},
 	asm.FnSkStorageGet: {
+		Name:    "bpf_sk_storage_get",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -866,8 +1101,10 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "value"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetMapValue,
 	},
 	asm.FnSkStorageDelete: {
+		Name:    "bpf_sk_storage_delete",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -875,12 +1112,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSendSignal: {
+		Name:    "bpf_send_signal",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "sig"},
 		},
 	},
 	asm.FnTcpGenSyncookie: {
+		Name:    "bpf_tcp_gen_syncookie",
 		RetType: CType{Name: "__s64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
@@ -891,6 +1130,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbOutput: {
+		Name:    "bpf_skb_output",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -901,38 +1141,55 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnProbeReadUser: {
+		Name:    "bpf_probe_read_user",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnProbeReadKernel: {
+		Name:    "bpf_probe_read_kernel",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnProbeReadUserStr: {
+		Name:    "bpf_probe_read_user_str",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnProbeReadKernelStr: {
+		Name:    "bpf_probe_read_kernel_str",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "unsafe_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnTcpSendAck: {
+		Name:    "bpf_tcp_send_ack",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "tp"},
@@ -940,16 +1197,19 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSendSignalThread: {
+		Name:    "bpf_send_signal_thread",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "sig"},
 		},
 	},
 	asm.FnJiffies64: {
+		Name:    "bpf_jiffies64",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnReadBranchRecords: {
+		Name:    "bpf_read_branch_records",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_perf_event_data", Struct: true, Ptr: true}, Name: "ctx"},
@@ -957,8 +1217,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnGetNsCurrentPidTgid: {
+		Name:    "bpf_get_ns_current_pid_tgid",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u64"}, Name: "dev"},
@@ -966,8 +1230,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "bpf_pidns_info", Struct: true, Ptr: true}, Name: "nsdata"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.FnXdpOutput: {
+		Name:    "bpf_xdp_output",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -978,18 +1246,21 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetNetnsCookie: {
+		Name:    "bpf_get_netns_cookie",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.FnGetCurrentAncestorCgroupId: {
+		Name:    "bpf_get_current_ancestor_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "int"}, Name: "ancestor_level"},
 		},
 	},
 	asm.FnSkAssign: {
+		Name:    "bpf_sk_assign",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -998,10 +1269,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnKtimeGetBootNs: {
+		Name:    "bpf_ktime_get_boot_ns",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnSeqPrintf: {
+		Name:    "bpf_seq_printf",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "seq_file", Struct: true, Ptr: true}, Name: "m"},
@@ -1012,6 +1285,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSeqWrite: {
+		Name:    "bpf_seq_write",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "seq_file", Struct: true, Ptr: true}, Name: "m"},
@@ -1020,12 +1294,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkCgroupId: {
+		Name:    "bpf_sk_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
 	},
 	asm.FnSkAncestorCgroupId: {
+		Name:    "bpf_sk_ancestor_cgroup_id",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
@@ -1033,6 +1309,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRingbufOutput: {
+		Name:    "bpf_ringbuf_output",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ringbuf"},
@@ -1042,28 +1319,35 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnRingbufReserve: {
+		Name:    "bpf_ringbuf_reserve",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ringbuf"},
 			{Type: CType{Name: "__u64"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetMem,
 	},
 	asm.FnRingbufSubmit: {
+		Name:    "bpf_ringbuf_submit",
 		RetType: CType{Name: "void"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "data"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnRingbufDiscard: {
+		Name:    "bpf_ringbuf_discard",
 		RetType: CType{Name: "void"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "data"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetVoid,
 	},
 	asm.FnRingbufQuery: {
+		Name:    "bpf_ringbuf_query",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ringbuf"},
@@ -1071,6 +1355,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnCsumLevel: {
+		Name:    "bpf_csum_level",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
@@ -1078,36 +1363,47 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkcToTcp6Sock: {
+		Name:    "bpf_skc_to_tcp6_sock",
 		RetType: CType{Name: "tcp6_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkcToTcpSock: {
+		Name:    "bpf_skc_to_tcp_sock",
 		RetType: CType{Name: "tcp_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkcToTcpTimewaitSock: {
+		Name:    "bpf_skc_to_tcp_timewait_sock",
 		RetType: CType{Name: "tcp_timewait_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkcToTcpRequestSock: {
+		Name:    "bpf_skc_to_tcp_request_sock",
 		RetType: CType{Name: "tcp_request_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnSkcToUdp6Sock: {
+		Name:    "bpf_skc_to_udp6_sock",
 		RetType: CType{Name: "udp6_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnGetTaskStack: {
+		Name:    "bpf_get_task_stack",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "task_struct", Struct: true, Ptr: true}, Name: "task"},
@@ -1115,8 +1411,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnLoadHdrOpt: {
+		Name:    "bpf_load_hdr_opt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "skops"},
@@ -1124,8 +1424,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "len"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnStoreHdrOpt: {
+		Name:    "bpf_store_hdr_opt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "skops"},
@@ -1135,6 +1439,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnReserveHdrOpt: {
+		Name:    "bpf_reserve_hdr_opt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_sock_ops", Struct: true, Ptr: true}, Name: "skops"},
@@ -1143,6 +1448,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnInodeStorageGet: {
+		Name:    "bpf_inode_storage_get",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -1150,8 +1456,10 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "value"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetMapValue,
 	},
 	asm.FnInodeStorageDelete: {
+		Name:    "bpf_inode_storage_delete",
 		RetType: CType{Name: "int"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -1159,22 +1467,31 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnDPath: {
+		Name:    "bpf_d_path",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "path", Struct: true, Ptr: true}, Name: "path"},
 			{Type: CType{Name: "char", Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "__u32"}, Name: "sz"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnCopyFromUser: {
+		Name:    "bpf_copy_from_user",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "user_ptr"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnSnprintfBtf: {
+		Name:    "bpf_snprintf_btf",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Ptr: true}, Name: "str"},
@@ -1183,8 +1500,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u32"}, Name: "btf_ptr_size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnSeqPrintfBtf: {
+		Name:    "bpf_seq_printf_btf",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "seq_file", Struct: true, Ptr: true}, Name: "m"},
@@ -1194,12 +1515,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSkbCgroupClassid: {
+		Name:    "bpf_skb_cgroup_classid",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__sk_buff", Struct: true, Ptr: true}, Name: "skb"},
 		},
 	},
 	asm.FnRedirectNeigh: {
+		Name:    "bpf_redirect_neigh",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "ifindex"},
@@ -1209,19 +1532,24 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnPerCpuPtr: {
+		Name:    "bpf_per_cpu_ptr",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "percpu_ptr"},
 			{Type: CType{Name: "__u32"}, Name: "cpu"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnThisCpuPtr: {
+		Name:    "bpf_this_cpu_ptr",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Const: true, Ptr: true}, Name: "percpu_ptr"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnRedirectPeer: {
+		Name:    "bpf_redirect_peer",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "ifindex"},
@@ -1229,6 +1557,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnTaskStorageGet: {
+		Name:    "bpf_task_storage_get",
 		RetType: CType{Name: "void", Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -1236,8 +1565,10 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "value"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Ret: RetMapValue,
 	},
 	asm.FnTaskStorageDelete: {
+		Name:    "bpf_task_storage_delete",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -1245,10 +1576,13 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnGetCurrentTaskBtf: {
+		Name:    "bpf_get_current_task_btf",
 		RetType: CType{Name: "task_struct", Struct: true, Ptr: true},
 		Params:  []HelperParam{},
+		Ret:     RetKernelPtr,
 	},
 	asm.FnBprmOptsSet: {
+		Name:    "bpf_bprm_opts_set",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "linux_binprm", Struct: true, Ptr: true}, Name: "bprm"},
@@ -1256,24 +1590,32 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnKtimeGetCoarseNs: {
+		Name:    "bpf_ktime_get_coarse_ns",
 		RetType: CType{Name: "__u64"},
 		Params:  []HelperParam{},
 	},
 	asm.FnImaInodeHash: {
+		Name:    "bpf_ima_inode_hash",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "inode", Struct: true, Ptr: true}, Name: "inode"},
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 1, SizeParam: 2},
+		},
 	},
 	asm.FnSockFromFile: {
+		Name:    "bpf_sock_from_file",
 		RetType: CType{Name: "socket", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "file", Struct: true, Ptr: true}, Name: "file"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.FnCheckMtu: {
+		Name:    "bpf_check_mtu",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
@@ -1282,8 +1624,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__s32"}, Name: "len_diff"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputFixed, Param: 2, SizeParam: -1, Size: 4},
+		},
 	},
 	asm.FnForEachMapElem: {
+		Name:    "bpf_for_each_map_elem",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "map"},
@@ -1293,6 +1639,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSnprintf: {
+		Name:    "bpf_snprintf",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Ptr: true}, Name: "str"},
@@ -1301,8 +1648,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "__u64", Ptr: true}, Name: "data"},
 			{Type: CType{Name: "__u32"}, Name: "data_len"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.FnSysBpf: {
+		Name:    "bpf_sys_bpf",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "cmd"},
@@ -1311,6 +1662,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnBtfFindByNameKind: {
+		Name:    "bpf_btf_find_by_name_kind",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Ptr: true}, Name: "name"},
@@ -1320,12 +1672,14 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnSysClose: {
+		Name:    "bpf_sys_close",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "fd"},
 		},
 	},
 	asm.FnTimerInit: {
+		Name:    "bpf_timer_init",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_timer", Struct: true, Ptr: true}, Name: "timer"},
@@ -1334,6 +1688,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnTimerSetCallback: {
+		Name:    "bpf_timer_set_callback",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_timer", Struct: true, Ptr: true}, Name: "timer"},
@@ -1341,6 +1696,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnTimerStart: {
+		Name:    "bpf_timer_start",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_timer", Struct: true, Ptr: true}, Name: "timer"},
@@ -1349,38 +1705,48 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.FnTimerCancel: {
+		Name:    "bpf_timer_cancel",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "bpf_timer", Struct: true, Ptr: true}, Name: "timer"},
 		},
 	},
 	asm.FnGetFuncIp: {
+		Name:    "bpf_get_func_ip",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.FnGetAttachCookie: {
+		Name:    "bpf_get_attach_cookie",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.FnTaskPtRegs: {
+		Name:    "bpf_task_pt_regs",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "task_struct", Struct: true, Ptr: true}, Name: "task"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.BuiltinFunc(176): {
+		Name:    "bpf_get_branch_snapshot",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "entries"},
 			{Type: CType{Name: "__u32"}, Name: "size"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 	asm.BuiltinFunc(177): {
+		Name:    "bpf_trace_vprintk",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "fmt"},
@@ -1390,12 +1756,15 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(178): {
+		Name:    "bpf_skc_to_unix_sock",
 		RetType: CType{Name: "unix_sock", Struct: true, Ptr: true},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "sk"},
 		},
+		Ret: RetKernelPtr,
 	},
 	asm.BuiltinFunc(179): {
+		Name:    "bpf_kallsyms_lookup_name",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "name"},
@@ -1405,6 +1774,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(180): {
+		Name:    "bpf_find_vma",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "task_struct", Struct: true, Ptr: true}, Name: "task"},
@@ -1415,6 +1785,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(181): {
+		Name:    "bpf_loop",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "__u32"}, Name: "nr_loops"},
@@ -1424,6 +1795,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(182): {
+		Name:    "bpf_strncmp",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "char", Const: true, Ptr: true}, Name: "s1"},
@@ -1432,43 +1804,56 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(183): {
+		Name:    "bpf_get_func_arg",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "__u32"}, Name: "n"},
 			{Type: CType{Name: "__u64", Ptr: true}, Name: "value"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputFixed, Param: 2, SizeParam: -1, Size: 8},
+		},
 	},
 	asm.BuiltinFunc(184): {
+		Name:    "bpf_get_func_ret",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 			{Type: CType{Name: "__u64", Ptr: true}, Name: "value"},
 		},
+		Outputs: []HelperOutput{
+			{Kind: OutputFixed, Param: 1, SizeParam: -1, Size: 8},
+		},
 	},
 	asm.BuiltinFunc(185): {
+		Name:    "bpf_get_func_arg_cnt",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "ctx"},
 		},
 	},
 	asm.BuiltinFunc(186): {
+		Name:    "bpf_get_retval",
 		RetType: CType{Name: "int"},
 		Params:  []HelperParam{},
 	},
 	asm.BuiltinFunc(187): {
+		Name:    "bpf_set_retval",
 		RetType: CType{Name: "int"},
 		Params: []HelperParam{
 			{Type: CType{Name: "int"}, Name: "retval"},
 		},
 	},
 	asm.BuiltinFunc(188): {
+		Name:    "bpf_xdp_get_buff_len",
 		RetType: CType{Name: "__u64"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
 		},
 	},
 	asm.BuiltinFunc(189): {
+		Name:    "bpf_xdp_load_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
@@ -1476,8 +1861,12 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "void", Ptr: true}, Name: "buf"},
 			{Type: CType{Name: "__u32"}, Name: "len"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 2, SizeParam: 3},
+		},
 	},
 	asm.BuiltinFunc(190): {
+		Name:    "bpf_xdp_store_bytes",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "xdp_md", Struct: true, Ptr: true}, Name: "xdp_md"},
@@ -1487,6 +1876,7 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 		},
 	},
 	asm.BuiltinFunc(191): {
+		Name:    "bpf_copy_from_user_task",
 		RetType: CType{Name: "long"},
 		Params: []HelperParam{
 			{Type: CType{Name: "void", Ptr: true}, Name: "dst"},
@@ -1495,5 +1885,8 @@ var Signatures = map[asm.BuiltinFunc]HelperFunc{
 			{Type: CType{Name: "task_struct", Struct: true, Ptr: true}, Name: "tsk"},
 			{Type: CType{Name: "__u64"}, Name: "flags"},
 		},
+		Outputs: []HelperOutput{
+			{Param: 0, SizeParam: 1},
+		},
 	},
 }
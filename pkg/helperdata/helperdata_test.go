@@ -0,0 +1,49 @@
+package helperdata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+func TestOutputs(t *testing.T) {
+	tests := []struct {
+		fn   asm.BuiltinFunc
+		want []HelperOutput
+	}{
+		{asm.FnProbeRead, []HelperOutput{{Kind: OutputSizeParam, Param: 0, SizeParam: 1}}},
+		{asm.FnCheckMtu, []HelperOutput{{Kind: OutputFixed, Param: 2, SizeParam: -1, Size: 4}}},
+		{asm.FnStrtol, []HelperOutput{{Kind: OutputFixed, Param: 3, SizeParam: -1, Size: 8}}},
+		{asm.FnStrtoul, []HelperOutput{{Kind: OutputFixed, Param: 3, SizeParam: -1, Size: 8}}},
+		{asm.FnMapPeekElem, []HelperOutput{{Kind: OutputMapValue, Param: 1, SizeParam: -1}}},
+		{asm.FnMapPopElem, []HelperOutput{{Kind: OutputMapValue, Param: 1, SizeParam: -1}}},
+		{asm.FnMapLookupElem, nil},
+		{asm.FnSkLookupTcp, nil},
+	}
+
+	for _, test := range tests {
+		sig, found := Signatures[test.fn]
+		if !found {
+			t.Errorf("no signature for %s", test.fn)
+			continue
+		}
+
+		if !reflect.DeepEqual(sig.Outputs, test.want) {
+			t.Errorf("%s: got outputs %+v, want %+v", sig.Name, sig.Outputs, test.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"bpf_map_peek_elem", "map_peek_elem", "FnMapPeekElem", "89"} {
+		fn, found := Lookup(name)
+		if !found || fn != asm.FnMapPeekElem {
+			t.Errorf("Lookup(%q) = %s, %v, want %s", name, fn, found, asm.FnMapPeekElem)
+		}
+	}
+
+	if _, found := Lookup("bpf_does_not_exist"); found {
+		t.Error("found a helper which doesn't exist")
+	}
+}
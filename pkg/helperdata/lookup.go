@@ -0,0 +1,37 @@
+package helperdata
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/cilium/ebpf/asm"
+)
+
+// Lookup returns the helper function with the given name. The name can be the C name, with or without 'bpf_' prefix,
+// like 'bpf_ktime_get_ns' or 'ktime_get_ns', the name of the asm.BuiltinFunc, like 'FnKtimeGetNs', or the number of
+// the helper.
+func Lookup(name string) (asm.BuiltinFunc, bool) {
+	if num, err := strconv.Atoi(name); err == nil {
+		_, found := Signatures[asm.BuiltinFunc(num)]
+		return asm.BuiltinFunc(num), found
+	}
+
+	for fn, sig := range Signatures {
+		if sig.Name == name || sig.Name == "bpf_"+name || fn.String() == name {
+			return fn, true
+		}
+	}
+
+	return 0, false
+}
+
+// Names returns the C names of all helper functions, sorted alphabetically
+func Names() []string {
+	names := make([]string, 0, len(Signatures))
+	for _, sig := range Signatures {
+		names = append(names, sig.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,196 @@
+// Package ksym resolves kernel addresses to symbols, using a dump of /proc/kallsyms or the symbol table of a vmlinux
+// ELF file.
+package ksym
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a kernel symbol
+type Symbol struct {
+	Name string
+	Addr uint64
+	// The size of the symbol, 0 if unknown, in which case the symbol ends at the next symbol
+	Size uint64
+	// The module which contains the symbol, empty for the kernel itself
+	Module string
+}
+
+// Table is a table of kernel symbols, sorted by address
+type Table struct {
+	syms   []Symbol
+	byName map[string]int
+}
+
+// Load loads a symbol table from a vmlinux ELF file or a kallsyms dump, the format is detected from the contents.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err = io.ReadFull(f, magic); err == nil && string(magic) == elf.ELFMAG {
+		return ParseELF(f)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return ParseKallsyms(f)
+}
+
+// ParseKallsyms parses symbols in the format of /proc/kallsyms: 'address type name [module]' per line. Absolute
+// symbols, like those of per-CPU variables, are offsets instead of addresses and are skipped, as are symbols with a
+// zero address, which is what /proc/kallsyms shows to users without CAP_SYSLOG.
+func ParseKallsyms(r io.Reader) (*Table, error) {
+	var syms []Symbol
+
+	scanner := bufio.NewScanner(r)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected 'address type name [module]'", lineNr)
+		}
+
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address '%s'", lineNr, fields[0])
+		}
+
+		if addr == 0 || strings.EqualFold(fields[1], "a") {
+			continue
+		}
+
+		sym := Symbol{Name: fields[2], Addr: addr}
+		if len(fields) > 3 {
+			sym.Module = strings.Trim(fields[3], "[]")
+		}
+		syms = append(syms, sym)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return newTable(syms)
+}
+
+// ParseELF reads the function and object symbols of a vmlinux ELF file
+func ParseELF(r io.ReaderAt) (*Table, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	elfSyms, err := f.Symbols()
+	if err != nil {
+		return nil, fmt.Errorf("symbols: %w", err)
+	}
+
+	var syms []Symbol
+	for _, s := range elfSyms {
+		typ := elf.ST_TYPE(s.Info)
+		if (typ != elf.STT_FUNC && typ != elf.STT_OBJECT) || s.Section == elf.SHN_ABS || s.Value == 0 {
+			continue
+		}
+
+		syms = append(syms, Symbol{Name: s.Name, Addr: s.Value, Size: s.Size})
+	}
+
+	return newTable(syms)
+}
+
+func newTable(syms []Symbol) (*Table, error) {
+	if len(syms) == 0 {
+		return nil, fmt.Errorf("no symbols found")
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		return syms[i].Addr < syms[j].Addr
+	})
+
+	t := &Table{syms: syms, byName: make(map[string]int, len(syms))}
+	for i, sym := range syms {
+		// Static symbols can have the same name, the first one wins
+		if _, exists := t.byName[sym.Name]; !exists {
+			t.byName[sym.Name] = i
+		}
+	}
+
+	return t, nil
+}
+
+// Len returns the amount of symbols in the table
+func (t *Table) Len() int {
+	return len(t.syms)
+}
+
+// Lookup returns the symbol which contains the address and the offset of the address within the symbol
+func (t *Table) Lookup(addr uint64) (Symbol, uint64, bool) {
+	// The index of the first symbol after the address
+	i := sort.Search(len(t.syms), func(i int) bool {
+		return t.syms[i].Addr > addr
+	})
+	if i == 0 {
+		return Symbol{}, 0, false
+	}
+
+	sym := t.syms[i-1]
+	off := addr - sym.Addr
+
+	if sym.Size != 0 {
+		if off >= sym.Size {
+			return Symbol{}, 0, false
+		}
+		return sym, off, true
+	}
+
+	// Without size, the symbol ends at the next symbol, the end of the last symbol is unknown
+	if i == len(t.syms) {
+		return Symbol{}, 0, false
+	}
+
+	return sym, off, true
+}
+
+// ByName returns the symbol with the given name
+func (t *Table) ByName(name string) (Symbol, bool) {
+	i, found := t.byName[name]
+	if !found {
+		return Symbol{}, false
+	}
+	return t.syms[i], true
+}
+
+// Format returns the address as 'symbol+0xoffset', followed by the module in brackets if the symbol is part of a
+// module. An empty string is returned if the address isn't part of a symbol.
+func (t *Table) Format(addr uint64) string {
+	sym, off, found := t.Lookup(addr)
+	if !found {
+		return ""
+	}
+
+	var b bytes.Buffer
+	b.WriteString(sym.Name)
+	if off != 0 {
+		fmt.Fprintf(&b, "+0x%x", off)
+	}
+	if sym.Module != "" {
+		fmt.Fprintf(&b, " [%s]", sym.Module)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package ksym
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKallsyms = `
+0000000000000000 A fixed_percpu_data
+ffffffff81000000 T _text
+ffffffff81000000 T startup_64
+ffffffff81000070 T secondary_startup_64
+ffffffff81a1b2c0 T tcp_v4_connect
+ffffffff81a1b800 t tcp_v4_init_sock
+ffffffffc0a01000 t nf_conntrack_in	[nf_conntrack]
+ffffffffc0a02000 t nf_ct_get_tuple	[nf_conntrack]
+`
+
+func TestKallsyms(t *testing.T) {
+	table, err := ParseKallsyms(strings.NewReader(testKallsyms))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Len() != 7 {
+		t.Errorf("got %d symbols, want 7", table.Len())
+	}
+
+	tests := []struct {
+		addr uint64
+		want string
+	}{
+		{0xffffffff81a1b2c0, "tcp_v4_connect"},
+		{0xffffffff81a1b2d4, "tcp_v4_connect+0x14"},
+		{0xffffffff81000010, "startup_64+0x10"},
+		{0xffffffffc0a01010, "nf_conntrack_in+0x10 [nf_conntrack]"},
+		// Before the first symbol
+		{0x10, ""},
+		// The end of the last symbol is unknown
+		{0xffffffffc0a02010, ""},
+	}
+
+	for _, test := range tests {
+		if got := table.Format(test.addr); got != test.want {
+			t.Errorf("Format(0x%x) = '%s', want '%s'", test.addr, got, test.want)
+		}
+	}
+
+	sym, found := table.ByName("tcp_v4_init_sock")
+	if !found || sym.Addr != 0xffffffff81a1b800 {
+		t.Errorf("ByName returned %+v, %v", sym, found)
+	}
+
+	if _, found = table.ByName("fixed_percpu_data"); found {
+		t.Errorf("absolute symbols should be skipped")
+	}
+}
+
+func TestKallsymsErrors(t *testing.T) {
+	for input, want := range map[string]string{
+		"ffffffff81000000 T\n":   "line 1: expected 'address type name [module]'",
+		"\nxyz T startup_64\n":   "line 2: invalid address 'xyz'",
+		"0000000000000000 T a\n": "no symbols found",
+	} {
+		_, err := ParseKallsyms(strings.NewReader(input))
+		if err == nil || err.Error() != want {
+			t.Errorf("got error '%v', want '%s'", err, want)
+		}
+	}
+}
+
+func TestELF(t *testing.T) {
+	table, err := Load("../../elf/testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr uint64
+		want string
+	}{
+		{0x400498, "main"},
+		{0x4004a0, "main+0x8"},
+		// main is 27 bytes
+		{0x4004b3, ""},
+		// Symbols without size end at the next symbol
+		{0x400480, "frame_dummy+0x10"},
+	}
+
+	for _, test := range tests {
+		if got := table.Format(test.addr); got != test.want {
+			t.Errorf("Format(0x%x) = '%s', want '%s'", test.addr, got, test.want)
+		}
+	}
+
+	// Undefined symbols have no address
+	if _, found := table.ByName("puts@@GLIBC_2.2.5"); found {
+		t.Errorf("undefined symbols should be skipped")
+	}
+}
@@ -0,0 +1,168 @@
+// Package mapdump contains the format in which the contents of maps are saved, so maps in the emulator can be given
+// the same contents as maps in the kernel.
+package mapdump
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// Dump holds the contents of a set of maps at a point in time
+type Dump struct {
+	Maps []Map `json:"maps"`
+}
+
+// Map holds the contents of a single map
+type Map struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	KeySize   uint32  `json:"keySize"`
+	ValueSize uint32  `json:"valueSize"`
+	Entries   []Entry `json:"entries"`
+}
+
+// Entry is a single key-value pair of a map, for per-CPU maps Values holds the value of every CPU instead of Value.
+type Entry struct {
+	Key    []byte   `json:"key"`
+	Value  []byte   `json:"value,omitempty"`
+	Values [][]byte `json:"values,omitempty"`
+}
+
+// ErrUnsupported is returned by FromMap for map types of which the contents can't be dumped
+var ErrUnsupported = errors.New("map type not supported")
+
+// Supported returns true if the contents of maps of the given type can be dumped. The values of maps which hold file
+// descriptors, like program arrays and map-in-maps, have no meaning outside of the process which created them. Queues
+// and stacks can only be read by removing values.
+func Supported(typ ebpf.MapType) bool {
+	switch typ {
+	case ebpf.Hash, ebpf.Array, ebpf.PerCPUHash, ebpf.PerCPUArray, ebpf.LRUHash, ebpf.LRUCPUHash, ebpf.LPMTrie:
+		return true
+	}
+
+	return false
+}
+
+// IsPerCPU returns true if maps of the given type have a value per CPU
+func IsPerCPU(typ ebpf.MapType) bool {
+	switch typ {
+	case ebpf.PerCPUHash, ebpf.PerCPUArray, ebpf.LRUCPUHash:
+		return true
+	}
+
+	return false
+}
+
+// FromMap reads all entries of a map loaded in the kernel
+func FromMap(name string, m *ebpf.Map) (Map, error) {
+	dm := Map{
+		Name:      name,
+		Type:      m.Type().String(),
+		KeySize:   m.KeySize(),
+		ValueSize: m.ValueSize(),
+		Entries:   []Entry{},
+	}
+
+	if !Supported(m.Type()) {
+		return dm, fmt.Errorf("%s: %w", m.Type(), ErrUnsupported)
+	}
+
+	var (
+		key    []byte
+		value  []byte
+		values [][]byte
+	)
+
+	iter := m.Iterate()
+	for {
+		var ok bool
+		if IsPerCPU(m.Type()) {
+			ok = iter.Next(&key, &values)
+		} else {
+			ok = iter.Next(&key, &value)
+		}
+		if !ok {
+			break
+		}
+
+		dm.Entries = append(dm.Entries, Entry{
+			Key:    key,
+			Value:  value,
+			Values: values,
+		})
+
+		// The iterator unmarshals into the slices we give it, so start with new ones for the next entry
+		key, value, values = nil, nil, nil
+	}
+	if err := iter.Err(); err != nil {
+		return dm, fmt.Errorf("iterate: %w", err)
+	}
+
+	return dm, nil
+}
+
+// Encode writes the dump as indented JSON to w
+func Encode(w io.Writer, d Dump) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// Decode reads a dump, as written by Encode, from r
+func Decode(r io.Reader) (Dump, error) {
+	var d Dump
+	err := json.NewDecoder(r).Decode(&d)
+	if err != nil {
+		return d, err
+	}
+
+	for _, m := range d.Maps {
+		for i, e := range m.Entries {
+			if len(e.Key) != int(m.KeySize) {
+				return d, fmt.Errorf("map '%s' entry %d: key is %d bytes, expected %d", m.Name, i, len(e.Key),
+					m.KeySize)
+			}
+
+			if e.Values == nil {
+				if len(e.Value) != int(m.ValueSize) {
+					return d, fmt.Errorf("map '%s' entry %d: value is %d bytes, expected %d", m.Name, i,
+						len(e.Value), m.ValueSize)
+				}
+				continue
+			}
+
+			for cpu, v := range e.Values {
+				if len(v) != int(m.ValueSize) {
+					return d, fmt.Errorf("map '%s' entry %d: value of CPU %d is %d bytes, expected %d", m.Name, i,
+						cpu, len(v), m.ValueSize)
+				}
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// DecodeFile reads and decodes a dump file
+func DecodeFile(path string) (Dump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Dump{}, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// PathForContext returns the path of the map dump which belongs to the given context file. The dump is written next
+// to the context file, 'capture.json' and 'capture.jsonl' have 'capture.maps.json' as dump.
+func PathForContext(ctxPath string) string {
+	return strings.TrimSuffix(ctxPath, filepath.Ext(ctxPath)) + ".maps.json"
+}
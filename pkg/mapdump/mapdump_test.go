@@ -0,0 +1,94 @@
+package mapdump
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	dump := Dump{
+		Maps: []Map{
+			{
+				Name:      "counters",
+				Type:      "Hash",
+				KeySize:   2,
+				ValueSize: 4,
+				Entries: []Entry{
+					{Key: []byte{1, 2}, Value: []byte{3, 4, 5, 6}},
+				},
+			},
+			{
+				Name:      "per_cpu",
+				Type:      "PerCPUArray",
+				KeySize:   4,
+				ValueSize: 1,
+				Entries: []Entry{
+					{Key: []byte{0, 0, 0, 0}, Values: [][]byte{{1}, {2}}},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, dump); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, dump) {
+		t.Errorf("decoded dump differs, got: %+v, want: %+v", got, dump)
+	}
+}
+
+func TestDecodeSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{
+			name: "key",
+			json: `{"maps": [{"name": "m", "keySize": 4, "valueSize": 1, "entries": [{"key": "AQI=", "value": "AQ=="}]}]}`,
+			err:  "map 'm' entry 0: key is 2 bytes, expected 4",
+		},
+		{
+			name: "value",
+			json: `{"maps": [{"name": "m", "keySize": 1, "valueSize": 2, "entries": [{"key": "AQ==", "value": "AQ=="}]}]}`,
+			err:  "map 'm' entry 0: value is 1 bytes, expected 2",
+		},
+		{
+			name: "per-cpu value",
+			json: `{"maps": [{"name": "m", "keySize": 1, "valueSize": 1, "entries": [{"key": "AQ==", ` +
+				`"values": ["AQ==", "AQI="]}]}]}`,
+			err: "map 'm' entry 0: value of CPU 1 is 2 bytes, expected 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(test.json))
+			if err == nil || err.Error() != test.err {
+				t.Errorf("got error '%v', want '%s'", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPathForContext(t *testing.T) {
+	for ctx, want := range map[string]string{
+		"capture.json":           "capture.maps.json",
+		"capture.jsonl":          "capture.maps.json",
+		"/tmp/capture":           "/tmp/capture.maps.json",
+		"dir.d/capture.v1.jsonl": "dir.d/capture.v1.maps.json",
+	} {
+		if got := PathForContext(ctx); got != want {
+			t.Errorf("PathForContext(%q) = %q, want %q", ctx, got, want)
+		}
+	}
+}
@@ -0,0 +1,643 @@
+// Package netenv describes the network environment of the kernel a program runs in: interfaces, routes, neighbours
+// and sockets. Helpers like bpf_fib_lookup and bpf_sk_lookup_tcp depend on this state, an environment makes it
+// available to the emulator.
+//
+// Environments are JSON files, like:
+//
+//	{
+//	  "interfaces": [
+//	    {"name": "lo", "ifindex": 1, "mtu": 65536, "addrs": ["127.0.0.1/8"]},
+//	    {"name": "eth0", "ifindex": 2, "mac": "02:00:00:00:00:01", "addrs": ["10.0.0.1/24", "fd00::1/64"]}
+//	  ],
+//	  "routes": [
+//	    {"dst": "default", "gateway": "10.0.0.254", "dev": "eth0"},
+//	    {"dst": "192.168.0.0/16", "type": "blackhole"}
+//	  ],
+//	  "neighbours": [
+//	    {"ip": "10.0.0.254", "mac": "02:00:00:00:00:fe", "dev": "eth0"}
+//	  ],
+//	  "sockets": [
+//	    {"proto": "tcp", "state": "listen", "local": "0.0.0.0:80"},
+//	    {"proto": "tcp", "state": "established", "local": "10.0.0.1:80", "remote": "10.0.0.5:41234"}
+//	  ]
+//	}
+//
+// Like in the kernel, the addresses of interfaces add routes to their subnets.
+package netenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Env is a network environment
+type Env struct {
+	Interfaces []*Interface
+	Routes     []*Route
+	Neighbours []*Neighbour
+	Sockets    []*Socket
+}
+
+// Interface is a network interface
+type Interface struct {
+	Name    string
+	Ifindex int
+	MAC     net.HardwareAddr
+	MTU     int
+	Addrs   []Addr
+	// If false, packets received on this interface are not forwarded
+	Forwarding bool
+}
+
+// Addr is an IP address of an interface and the subnet it is in
+type Addr struct {
+	IP  net.IP
+	Net *net.IPNet
+}
+
+// RouteType is the type of a route
+type RouteType int
+
+const (
+	// RouteUnicast routes to a gateway or directly to a host on a connected network
+	RouteUnicast RouteType = iota
+	// RouteBlackhole silently drops packets
+	RouteBlackhole
+	// RouteUnreachable drops packets with a host unreachable error
+	RouteUnreachable
+	// RouteProhibit drops packets with a communication prohibited error
+	RouteProhibit
+)
+
+var routeTypes = map[string]RouteType{
+	"":            RouteUnicast,
+	"unicast":     RouteUnicast,
+	"blackhole":   RouteBlackhole,
+	"unreachable": RouteUnreachable,
+	"prohibit":    RouteProhibit,
+}
+
+func (t RouteType) String() string {
+	for name, typ := range routeTypes {
+		if typ == t && name != "" {
+			return name
+		}
+	}
+	return strconv.Itoa(int(t))
+}
+
+// Route is an entry of the routing table
+type Route struct {
+	Dst     *net.IPNet
+	Type    RouteType
+	Gateway net.IP
+	// The outgoing interface, nil for routes which aren't unicast
+	Dev    *Interface
+	Metric uint32
+}
+
+// Neighbour is an entry of the ARP or NDP table
+type Neighbour struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+	Dev *Interface
+}
+
+// SocketState is the state of a socket
+type SocketState int
+
+const (
+	// SocketListen is a listening TCP socket or an unconnected UDP socket
+	SocketListen SocketState = iota
+	// SocketEstablished is an established TCP connection or a connected UDP socket
+	SocketEstablished
+)
+
+// Socket is a TCP or UDP socket
+type Socket struct {
+	// "tcp" or "udp"
+	Proto  string
+	State  SocketState
+	Local  SockAddr
+	Remote SockAddr
+	// The interface the socket is bound to, or nil
+	Dev *Interface
+}
+
+// SockAddr is an IP address and port
+type SockAddr struct {
+	IP   net.IP
+	Port uint16
+}
+
+func (a SockAddr) String() string {
+	return net.JoinHostPort(a.IP.String(), strconv.Itoa(int(a.Port)))
+}
+
+func (s *Socket) String() string {
+	if s.State == SocketListen {
+		return fmt.Sprintf("%s listen %s", s.Proto, s.Local)
+	}
+	return fmt.Sprintf("%s %s <-> %s", s.Proto, s.Local, s.Remote)
+}
+
+// The JSON representation of an environment
+type fileEnv struct {
+	Interfaces []fileInterface `json:"interfaces"`
+	Routes     []fileRoute     `json:"routes"`
+	Neighbours []fileNeighbour `json:"neighbours"`
+	Sockets    []fileSocket    `json:"sockets"`
+}
+
+type fileInterface struct {
+	Name       string   `json:"name"`
+	Ifindex    int      `json:"ifindex"`
+	MAC        string   `json:"mac"`
+	MTU        int      `json:"mtu"`
+	Addrs      []string `json:"addrs"`
+	Forwarding *bool    `json:"forwarding"`
+}
+
+type fileRoute struct {
+	Dst     string `json:"dst"`
+	Type    string `json:"type"`
+	Gateway string `json:"gateway"`
+	Dev     string `json:"dev"`
+	Metric  uint32 `json:"metric"`
+}
+
+type fileNeighbour struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+	Dev string `json:"dev"`
+}
+
+type fileSocket struct {
+	Proto  string `json:"proto"`
+	State  string `json:"state"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+	Dev    string `json:"dev"`
+}
+
+// The MTU of interfaces which don't specify one
+const defaultMTU = 1500
+
+// Load reads and parses an environment file
+func Load(path string) (*Env, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse parses an environment from JSON and validates it
+func Parse(r io.Reader) (*Env, error) {
+	var file fileEnv
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	env := &Env{}
+	for i, fi := range file.Interfaces {
+		iface, err := env.parseInterface(fi)
+		if err != nil {
+			return nil, fmt.Errorf("interfaces[%d]: %w", i, err)
+		}
+		env.Interfaces = append(env.Interfaces, iface)
+	}
+
+	// Addresses of interfaces imply routes to their subnets
+	for _, iface := range env.Interfaces {
+		for _, addr := range iface.Addrs {
+			env.Routes = append(env.Routes, &Route{Dst: addr.Net, Dev: iface})
+		}
+	}
+
+	for i, fr := range file.Routes {
+		route, err := env.parseRoute(fr)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		env.Routes = append(env.Routes, route)
+	}
+
+	for i, fn := range file.Neighbours {
+		neigh, err := env.parseNeighbour(fn)
+		if err != nil {
+			return nil, fmt.Errorf("neighbours[%d]: %w", i, err)
+		}
+		env.Neighbours = append(env.Neighbours, neigh)
+	}
+
+	for i, fs := range file.Sockets {
+		sock, err := env.parseSocket(fs)
+		if err != nil {
+			return nil, fmt.Errorf("sockets[%d]: %w", i, err)
+		}
+		env.Sockets = append(env.Sockets, sock)
+	}
+
+	return env, nil
+}
+
+func (e *Env) parseInterface(fi fileInterface) (*Interface, error) {
+	if fi.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	if fi.Ifindex <= 0 {
+		return nil, fmt.Errorf("'%s': ifindex must be larger than 0", fi.Name)
+	}
+	if e.InterfaceByName(fi.Name) != nil {
+		return nil, fmt.Errorf("duplicate interface name '%s'", fi.Name)
+	}
+	if e.InterfaceByIndex(fi.Ifindex) != nil {
+		return nil, fmt.Errorf("'%s': duplicate ifindex %d", fi.Name, fi.Ifindex)
+	}
+
+	iface := &Interface{
+		Name:       fi.Name,
+		Ifindex:    fi.Ifindex,
+		MTU:        fi.MTU,
+		Forwarding: fi.Forwarding == nil || *fi.Forwarding,
+	}
+
+	if iface.MTU == 0 {
+		iface.MTU = defaultMTU
+	}
+
+	// Interfaces like loopback don't have a MAC address, use all zeros like the kernel
+	iface.MAC = make(net.HardwareAddr, 6)
+	if fi.MAC != "" {
+		mac, err := parseMAC(fi.MAC)
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %w", fi.Name, err)
+		}
+		iface.MAC = mac
+	}
+
+	for _, addrStr := range fi.Addrs {
+		ip, ipNet, err := net.ParseCIDR(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("'%s': invalid address '%s', expected address/prefix", fi.Name, addrStr)
+		}
+		iface.Addrs = append(iface.Addrs, Addr{IP: ip, Net: ipNet})
+	}
+
+	return iface, nil
+}
+
+func (e *Env) parseRoute(fr fileRoute) (*Route, error) {
+	typ, ok := routeTypes[fr.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type '%s', expected unicast, blackhole, unreachable or prohibit", fr.Type)
+	}
+
+	route := &Route{Type: typ, Metric: fr.Metric}
+
+	var err error
+	switch fr.Dst {
+	case "":
+		return nil, fmt.Errorf("missing dst")
+	case "default":
+		// The family of a default route is that of its gateway, IPv4 if there is none
+		_, route.Dst, _ = net.ParseCIDR("0.0.0.0/0")
+		if gw := net.ParseIP(fr.Gateway); gw != nil && gw.To4() == nil {
+			_, route.Dst, _ = net.ParseCIDR("::/0")
+		}
+	default:
+		_, route.Dst, err = net.ParseCIDR(fr.Dst)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dst '%s', expected 'default' or address/prefix", fr.Dst)
+		}
+	}
+
+	if typ != RouteUnicast {
+		if fr.Gateway != "" || fr.Dev != "" {
+			return nil, fmt.Errorf("%s routes can't have a gateway or dev", typ)
+		}
+		return route, nil
+	}
+
+	if fr.Gateway != "" {
+		route.Gateway = net.ParseIP(fr.Gateway)
+		if route.Gateway == nil {
+			return nil, fmt.Errorf("invalid gateway '%s'", fr.Gateway)
+		}
+		if (route.Gateway.To4() == nil) != (route.Dst.IP.To4() == nil) {
+			return nil, fmt.Errorf("gateway '%s' and dst '%s' have a different family", fr.Gateway, route.Dst)
+		}
+	}
+
+	if fr.Dev != "" {
+		route.Dev = e.InterfaceByName(fr.Dev)
+		if route.Dev == nil {
+			return nil, fmt.Errorf("unknown dev '%s'", fr.Dev)
+		}
+		return route, nil
+	}
+
+	// Without dev, the gateway must be on a connected network, like 'ip route add' requires
+	if route.Gateway == nil {
+		return nil, fmt.Errorf("unicast routes require a gateway or dev")
+	}
+	for _, iface := range e.Interfaces {
+		for _, addr := range iface.Addrs {
+			if addr.Net.Contains(route.Gateway) {
+				route.Dev = iface
+				return route, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("gateway '%s' isn't on a connected network, dev is required", route.Gateway)
+}
+
+func (e *Env) parseNeighbour(fn fileNeighbour) (*Neighbour, error) {
+	neigh := &Neighbour{IP: net.ParseIP(fn.IP)}
+	if neigh.IP == nil {
+		return nil, fmt.Errorf("invalid ip '%s'", fn.IP)
+	}
+
+	var err error
+	neigh.MAC, err = parseMAC(fn.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	neigh.Dev = e.InterfaceByName(fn.Dev)
+	if neigh.Dev == nil {
+		return nil, fmt.Errorf("unknown dev '%s'", fn.Dev)
+	}
+
+	return neigh, nil
+}
+
+func (e *Env) parseSocket(fs fileSocket) (*Socket, error) {
+	if fs.Proto != "tcp" && fs.Proto != "udp" {
+		return nil, fmt.Errorf("unknown proto '%s', expected tcp or udp", fs.Proto)
+	}
+
+	sock := &Socket{Proto: fs.Proto}
+
+	var err error
+	sock.Local, err = parseSockAddr(fs.Local)
+	if err != nil {
+		return nil, fmt.Errorf("local: %w", err)
+	}
+
+	switch fs.State {
+	case "listen":
+		sock.State = SocketListen
+		if fs.Remote != "" {
+			return nil, fmt.Errorf("listening sockets can't have a remote address")
+		}
+	case "established":
+		sock.State = SocketEstablished
+		sock.Remote, err = parseSockAddr(fs.Remote)
+		if err != nil {
+			return nil, fmt.Errorf("remote: %w", err)
+		}
+		if (sock.Local.IP.To4() == nil) != (sock.Remote.IP.To4() == nil) {
+			return nil, fmt.Errorf("local and remote address have a different family")
+		}
+	default:
+		return nil, fmt.Errorf("unknown state '%s', expected listen or established", fs.State)
+	}
+
+	if fs.Dev != "" {
+		sock.Dev = e.InterfaceByName(fs.Dev)
+		if sock.Dev == nil {
+			return nil, fmt.Errorf("unknown dev '%s'", fs.Dev)
+		}
+	}
+
+	return sock, nil
+}
+
+func parseMAC(str string) (net.HardwareAddr, error) {
+	mac, err := net.ParseMAC(str)
+	if err != nil || len(mac) != 6 {
+		return nil, fmt.Errorf("invalid MAC address '%s'", str)
+	}
+	return mac, nil
+}
+
+func parseSockAddr(str string) (SockAddr, error) {
+	host, portStr, err := net.SplitHostPort(str)
+	if err != nil {
+		return SockAddr{}, fmt.Errorf("invalid address '%s', expected ip:port or [ip]:port", str)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return SockAddr{}, fmt.Errorf("invalid IP '%s'", host)
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return SockAddr{}, fmt.Errorf("invalid port '%s'", portStr)
+	}
+
+	return SockAddr{IP: ip, Port: uint16(port)}, nil
+}
+
+// InterfaceByIndex returns the interface with the given ifindex, or nil
+func (e *Env) InterfaceByIndex(ifindex int) *Interface {
+	for _, iface := range e.Interfaces {
+		if iface.Ifindex == ifindex {
+			return iface
+		}
+	}
+	return nil
+}
+
+// InterfaceByName returns the interface with the given name, or nil
+func (e *Env) InterfaceByName(name string) *Interface {
+	for _, iface := range e.Interfaces {
+		if iface.Name == name {
+			return iface
+		}
+	}
+	return nil
+}
+
+// IsLocal returns true if the IP is an address of one of the interfaces
+func (e *Env) IsLocal(ip net.IP) bool {
+	for _, iface := range e.Interfaces {
+		for _, addr := range iface.Addrs {
+			if addr.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LookupRoute returns the route for the destination, the route with the longest prefix and of those the lowest
+// metric, or nil if there is no route.
+func (e *Env) LookupRoute(dst net.IP) *Route {
+	var (
+		best     *Route
+		bestOnes int
+	)
+	for _, route := range e.Routes {
+		// Contains matches IPv4 addresses against ::/0, so also check the family
+		if (route.Dst.IP.To4() == nil) != (dst.To4() == nil) || !route.Dst.Contains(dst) {
+			continue
+		}
+
+		ones, _ := route.Dst.Mask.Size()
+		if best == nil || ones > bestOnes || (ones == bestOnes && route.Metric < best.Metric) {
+			best = route
+			bestOnes = ones
+		}
+	}
+
+	return best
+}
+
+// LookupNeighbour returns the neighbour with the given IP on the given interface, or nil
+func (e *Env) LookupNeighbour(ip net.IP, dev *Interface) *Neighbour {
+	for _, neigh := range e.Neighbours {
+		if neigh.Dev == dev && neigh.IP.Equal(ip) {
+			return neigh
+		}
+	}
+	return nil
+}
+
+// FibResult is the result of a FIB lookup, the values match the BPF_FIB_LKUP_RET_* return values of
+// bpf_fib_lookup.
+type FibResult int
+
+const (
+	FibSuccess FibResult = iota
+	FibBlackhole
+	FibUnreachable
+	FibProhibit
+	FibNotForwarded
+	FibForwardingDisabled
+	FibUnsupportedLWT
+	FibNoNeighbour
+	FibFragNeeded
+)
+
+var fibResultNames = []string{
+	"BPF_FIB_LKUP_RET_SUCCESS",
+	"BPF_FIB_LKUP_RET_BLACKHOLE",
+	"BPF_FIB_LKUP_RET_UNREACHABLE",
+	"BPF_FIB_LKUP_RET_PROHIBIT",
+	"BPF_FIB_LKUP_RET_NOT_FWDED",
+	"BPF_FIB_LKUP_RET_FWD_DISABLED",
+	"BPF_FIB_LKUP_RET_UNSUPP_LWT",
+	"BPF_FIB_LKUP_RET_NO_NEIGH",
+	"BPF_FIB_LKUP_RET_FRAG_NEEDED",
+}
+
+func (r FibResult) String() string {
+	if int(r) < len(fibResultNames) {
+		return fibResultNames[r]
+	}
+	return strconv.Itoa(int(r))
+}
+
+// FibLookup is a FIB lookup, like done by bpf_fib_lookup
+type FibLookup struct {
+	// The destination to look up
+	Dst net.IP
+	// The interface the packet was received on, for output lookups the interface it is sent from
+	Dev *Interface
+	// If true, the lookup is for a packet sent by the host instead of a forwarded packet
+	Output bool
+	// The length of the packet, if larger than the MTU of the outgoing interface the lookup fails with
+	// FibFragNeeded. 0 skips the check.
+	TotLen int
+
+	// The following fields are set by the lookup, depending on how far the lookup got
+
+	// The matching route
+	Route *Route
+	// The address of the next hop, the gateway or the destination itself
+	NextHop net.IP
+	// The neighbour of the next hop
+	Neighbour *Neighbour
+}
+
+// FibLookup does a FIB lookup, following the steps and checks of the kernel.
+func (e *Env) FibLookup(l *FibLookup) FibResult {
+	if !l.Output && !l.Dev.Forwarding {
+		return FibForwardingDisabled
+	}
+
+	// Local addresses are delivered, not forwarded
+	if e.IsLocal(l.Dst) {
+		return FibNotForwarded
+	}
+
+	l.Route = e.LookupRoute(l.Dst)
+	if l.Route == nil {
+		return FibNotForwarded
+	}
+
+	switch l.Route.Type {
+	case RouteBlackhole:
+		return FibBlackhole
+	case RouteUnreachable:
+		return FibUnreachable
+	case RouteProhibit:
+		return FibProhibit
+	}
+
+	if l.TotLen > 0 && l.TotLen > l.Route.Dev.MTU {
+		return FibFragNeeded
+	}
+
+	l.NextHop = l.Dst
+	if l.Route.Gateway != nil {
+		l.NextHop = l.Route.Gateway
+	}
+
+	l.Neighbour = e.LookupNeighbour(l.NextHop, l.Route.Dev)
+	if l.Neighbour == nil {
+		return FibNoNeighbour
+	}
+
+	return FibSuccess
+}
+
+// LookupSocket returns the socket which receives a packet from src to dst, or nil. Like in the kernel, established
+// sockets take precedence over listening sockets and listening sockets bound to an address over those bound to the
+// unspecified address.
+func (e *Env) LookupSocket(proto string, src, dst SockAddr) *Socket {
+	var listener *Socket
+	for _, sock := range e.Sockets {
+		if sock.Proto != proto || sock.Local.Port != dst.Port || (sock.Local.IP.To4() == nil) != (dst.IP.To4() == nil) {
+			continue
+		}
+
+		if sock.State == SocketEstablished {
+			if sock.Local.IP.Equal(dst.IP) && sock.Remote.IP.Equal(src.IP) && sock.Remote.Port == src.Port {
+				return sock
+			}
+			continue
+		}
+
+		if sock.Local.IP.Equal(dst.IP) {
+			listener = sock
+		} else if sock.Local.IP.IsUnspecified() && listener == nil {
+			listener = sock
+		}
+	}
+
+	return listener
+}
@@ -0,0 +1,227 @@
+package netenv
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const testEnv = `{
+  "interfaces": [
+    {"name": "lo", "ifindex": 1, "mtu": 65536, "addrs": ["127.0.0.1/8"]},
+    {"name": "eth0", "ifindex": 2, "mac": "02:00:00:00:00:01", "addrs": ["10.0.0.1/24", "fd00::1/64"]},
+    {"name": "eth1", "ifindex": 3, "mac": "02:00:00:00:01:01", "mtu": 1400, "addrs": ["10.1.0.1/24"],
+     "forwarding": false}
+  ],
+  "routes": [
+    {"dst": "default", "gateway": "10.0.0.254"},
+    {"dst": "default", "gateway": "fd00::fe", "dev": "eth0"},
+    {"dst": "172.16.0.0/12", "gateway": "10.1.0.254", "metric": 10},
+    {"dst": "172.16.0.0/12", "gateway": "10.0.0.253", "metric": 5},
+    {"dst": "192.168.0.0/16", "type": "blackhole"},
+    {"dst": "192.168.1.0/24", "type": "unreachable"}
+  ],
+  "neighbours": [
+    {"ip": "10.0.0.254", "mac": "02:00:00:00:00:fe", "dev": "eth0"},
+    {"ip": "10.0.0.5", "mac": "02:00:00:00:00:05", "dev": "eth0"},
+    {"ip": "fd00::fe", "mac": "02:00:00:00:00:fe", "dev": "eth0"}
+  ],
+  "sockets": [
+    {"proto": "tcp", "state": "listen", "local": "0.0.0.0:80"},
+    {"proto": "tcp", "state": "listen", "local": "10.0.0.1:80"},
+    {"proto": "tcp", "state": "established", "local": "10.0.0.1:80", "remote": "10.0.0.5:41234"},
+    {"proto": "udp", "state": "listen", "local": "[::]:53"}
+  ]
+}`
+
+func parseTestEnv(t *testing.T) *Env {
+	t.Helper()
+
+	env, err := Parse(strings.NewReader(testEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestParse(t *testing.T) {
+	env := parseTestEnv(t)
+
+	if len(env.Interfaces) != 3 {
+		t.Fatalf("got %d interfaces, want 3", len(env.Interfaces))
+	}
+
+	lo := env.InterfaceByIndex(1)
+	if lo == nil || lo.Name != "lo" || lo.MTU != 65536 || lo.MAC.String() != "00:00:00:00:00:00" || !lo.Forwarding {
+		t.Errorf("unexpected lo: %+v", lo)
+	}
+
+	eth1 := env.InterfaceByName("eth1")
+	if eth1 == nil || eth1.Forwarding {
+		t.Errorf("unexpected eth1: %+v", eth1)
+	}
+
+	if env.InterfaceByName("eth0").MTU != defaultMTU {
+		t.Errorf("eth0 doesn't have the default MTU")
+	}
+
+	// 4 connected routes and 6 configured routes
+	if len(env.Routes) != 10 {
+		t.Errorf("got %d routes, want 10", len(env.Routes))
+	}
+
+	// The dev of the default route is derived from the gateway
+	if route := env.LookupRoute(net.ParseIP("8.8.8.8")); route == nil || route.Dev.Name != "eth0" {
+		t.Errorf("unexpected default route: %+v", route)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{
+			name: "duplicate ifindex",
+			json: `{"interfaces": [{"name": "a", "ifindex": 1}, {"name": "b", "ifindex": 1}]}`,
+			err:  "interfaces[1]: 'b': duplicate ifindex 1",
+		},
+		{
+			name: "invalid mac",
+			json: `{"interfaces": [{"name": "a", "ifindex": 1, "mac": "xx"}]}`,
+			err:  "interfaces[0]: 'a': invalid MAC address 'xx'",
+		},
+		{
+			name: "unknown dev",
+			json: `{"routes": [{"dst": "10.0.0.0/8", "dev": "eth9"}]}`,
+			err:  "routes[0]: unknown dev 'eth9'",
+		},
+		{
+			name: "unconnected gateway",
+			json: `{"routes": [{"dst": "default", "gateway": "10.0.0.1"}]}`,
+			err:  "routes[0]: gateway '10.0.0.1' isn't on a connected network, dev is required",
+		},
+		{
+			name: "blackhole with dev",
+			json: `{"interfaces": [{"name": "a", "ifindex": 1}], ` +
+				`"routes": [{"dst": "10.0.0.0/8", "type": "blackhole", "dev": "a"}]}`,
+			err: "routes[0]: blackhole routes can't have a gateway or dev",
+		},
+		{
+			name: "socket state",
+			json: `{"sockets": [{"proto": "tcp", "state": "closed", "local": "1.2.3.4:1"}]}`,
+			err:  "sockets[0]: unknown state 'closed', expected listen or established",
+		},
+		{
+			name: "socket address",
+			json: `{"sockets": [{"proto": "udp", "state": "listen", "local": "1.2.3.4"}]}`,
+			err:  "sockets[0]: local: invalid address '1.2.3.4', expected ip:port or [ip]:port",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.json))
+			if err == nil || err.Error() != test.err {
+				t.Errorf("got error '%v', want '%s'", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFibLookup(t *testing.T) {
+	env := parseTestEnv(t)
+	eth0 := env.InterfaceByName("eth0")
+	eth1 := env.InterfaceByName("eth1")
+
+	tests := []struct {
+		name    string
+		lookup  FibLookup
+		want    FibResult
+		dev     string
+		nextHop string
+	}{
+		{name: "gateway", lookup: FibLookup{Dst: net.ParseIP("8.8.8.8"), Dev: eth0},
+			want: FibSuccess, dev: "eth0", nextHop: "10.0.0.254"},
+		{name: "connected", lookup: FibLookup{Dst: net.ParseIP("10.0.0.5"), Dev: eth0},
+			want: FibSuccess, dev: "eth0", nextHop: "10.0.0.5"},
+		{name: "ipv6", lookup: FibLookup{Dst: net.ParseIP("2001:db8::1"), Dev: eth0},
+			want: FibSuccess, dev: "eth0", nextHop: "fd00::fe"},
+		{name: "lowest metric", lookup: FibLookup{Dst: net.ParseIP("172.16.1.1"), Dev: eth0},
+			want: FibNoNeighbour, dev: "eth0", nextHop: "10.0.0.253"},
+		{name: "no neighbour", lookup: FibLookup{Dst: net.ParseIP("10.1.0.7"), Dev: eth0},
+			want: FibNoNeighbour, dev: "eth1", nextHop: "10.1.0.7"},
+		{name: "local", lookup: FibLookup{Dst: net.ParseIP("10.0.0.1"), Dev: eth0},
+			want: FibNotForwarded},
+		{name: "blackhole", lookup: FibLookup{Dst: net.ParseIP("192.168.2.1"), Dev: eth0},
+			want: FibBlackhole},
+		{name: "longest prefix", lookup: FibLookup{Dst: net.ParseIP("192.168.1.1"), Dev: eth0},
+			want: FibUnreachable},
+		{name: "forwarding disabled", lookup: FibLookup{Dst: net.ParseIP("8.8.8.8"), Dev: eth1},
+			want: FibForwardingDisabled},
+		{name: "output", lookup: FibLookup{Dst: net.ParseIP("8.8.8.8"), Dev: eth1, Output: true},
+			want: FibSuccess, dev: "eth0", nextHop: "10.0.0.254"},
+		{name: "frag needed", lookup: FibLookup{Dst: net.ParseIP("10.1.0.7"), Dev: eth0, TotLen: 1401},
+			want: FibFragNeeded, dev: "eth1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := test.lookup
+			got := env.FibLookup(&l)
+			if got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+
+			if test.dev != "" && (l.Route == nil || l.Route.Dev.Name != test.dev) {
+				t.Errorf("got route %+v, want dev %s", l.Route, test.dev)
+			}
+
+			if test.nextHop != "" && !l.NextHop.Equal(net.ParseIP(test.nextHop)) {
+				t.Errorf("got next hop %s, want %s", l.NextHop, test.nextHop)
+			}
+		})
+	}
+}
+
+func TestLookupSocket(t *testing.T) {
+	env := parseTestEnv(t)
+
+	addr := func(str string) SockAddr {
+		a, err := parseSockAddr(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	tests := []struct {
+		name     string
+		proto    string
+		src, dst string
+		want     string
+	}{
+		{"established", "tcp", "10.0.0.5:41234", "10.0.0.1:80", "tcp 10.0.0.1:80 <-> 10.0.0.5:41234"},
+		{"bound listener", "tcp", "10.0.0.6:41234", "10.0.0.1:80", "tcp listen 10.0.0.1:80"},
+		{"wildcard listener", "tcp", "10.0.0.6:41234", "127.0.0.1:80", "tcp listen 0.0.0.0:80"},
+		{"ipv6", "udp", "[fd00::5]:1000", "[fd00::1]:53", "udp listen [::]:53"},
+		{"wrong port", "tcp", "10.0.0.6:41234", "10.0.0.1:81", ""},
+		{"wrong proto", "udp", "10.0.0.6:41234", "10.0.0.1:80", ""},
+		{"wrong family", "udp", "10.0.0.6:1000", "10.0.0.1:53", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sock := env.LookupSocket(test.proto, addr(test.src), addr(test.dst))
+			got := ""
+			if sock != nil {
+				got = sock.String()
+			}
+
+			if got != test.want {
+				t.Errorf("got '%s', want '%s'", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package pcapng implements a minimal PCAPNG writer which, unlike the gopacket writer, supports comments on
+// individual packets.
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	blockTypeSectionHeader       = 0x0A0D0D0A
+	blockTypeInterfaceDescriptor = 0x00000001
+	blockTypeEnhancedPacket      = 0x00000006
+
+	byteOrderMagic = 0x1A2B3C4D
+
+	optEndOfOpt = 0
+	optComment  = 1
+	optIfName   = 2
+)
+
+// Writer writes packets of a single interface to a PCAPNG file
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the section header and a interface description block with the given name and link type to w
+// and returns a writer for packets on that interface.
+func NewWriter(w io.Writer, ifName string, linkType layers.LinkType) (*Writer, error) {
+	pw := &Writer{w: w}
+
+	var shb bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&shb, le, uint32(byteOrderMagic))
+	// Version 1.0
+	_ = binary.Write(&shb, le, uint16(1))
+	_ = binary.Write(&shb, le, uint16(0))
+	// Section length unknown
+	_ = binary.Write(&shb, le, int64(-1))
+	if err := pw.writeBlock(blockTypeSectionHeader, shb.Bytes(), nil); err != nil {
+		return nil, fmt.Errorf("write section header: %w", err)
+	}
+
+	var idb bytes.Buffer
+	_ = binary.Write(&idb, le, uint16(linkType))
+	_ = binary.Write(&idb, le, uint16(0))
+	// No snap length limit
+	_ = binary.Write(&idb, le, uint32(0))
+	var opts []option
+	if ifName != "" {
+		opts = append(opts, option{code: optIfName, value: []byte(ifName)})
+	}
+	if err := pw.writeBlock(blockTypeInterfaceDescriptor, idb.Bytes(), opts); err != nil {
+		return nil, fmt.Errorf("write interface description: %w", err)
+	}
+
+	return pw, nil
+}
+
+// WritePacket writes a packet with an optional comment
+func (pw *Writer) WritePacket(ts time.Time, data []byte, comment string) error {
+	var epb bytes.Buffer
+	le := binary.LittleEndian
+
+	// Timestamps are in microseconds by default
+	usec := uint64(ts.UnixNano() / 1000)
+
+	_ = binary.Write(&epb, le, uint32(0))
+	_ = binary.Write(&epb, le, uint32(usec>>32))
+	_ = binary.Write(&epb, le, uint32(usec))
+	_ = binary.Write(&epb, le, uint32(len(data)))
+	_ = binary.Write(&epb, le, uint32(len(data)))
+	epb.Write(data)
+	epb.Write(make([]byte, pad(len(data))))
+
+	var opts []option
+	if comment != "" {
+		opts = append(opts, option{code: optComment, value: []byte(comment)})
+	}
+
+	return pw.writeBlock(blockTypeEnhancedPacket, epb.Bytes(), opts)
+}
+
+type option struct {
+	code  uint16
+	value []byte
+}
+
+// pad returns the amount of padding required to align n to 32 bits
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// writeBlock writes a block with the given body and options, the body must already be padded to 32 bits.
+func (pw *Writer) writeBlock(blockType uint32, body []byte, opts []option) error {
+	var optBuf bytes.Buffer
+	le := binary.LittleEndian
+	if len(opts) > 0 {
+		for _, opt := range opts {
+			_ = binary.Write(&optBuf, le, opt.code)
+			_ = binary.Write(&optBuf, le, uint16(len(opt.value)))
+			optBuf.Write(opt.value)
+			optBuf.Write(make([]byte, pad(len(opt.value))))
+		}
+		_ = binary.Write(&optBuf, le, uint16(optEndOfOpt))
+		_ = binary.Write(&optBuf, le, uint16(0))
+	}
+
+	// Block type + 2x block length + body + options
+	length := uint32(12 + len(body) + optBuf.Len())
+
+	var block bytes.Buffer
+	_ = binary.Write(&block, le, blockType)
+	_ = binary.Write(&block, le, length)
+	block.Write(body)
+	block.Write(optBuf.Bytes())
+	_ = binary.Write(&block, le, length)
+
+	_, err := pw.w.Write(block.Bytes())
+	return err
+}
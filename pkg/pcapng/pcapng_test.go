@@ -0,0 +1,143 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+type testPacket struct {
+	ts      time.Time
+	data    []byte
+	comment string
+}
+
+// Packets and comments of every length modulo 4, so every amount of padding is written
+var testPackets = []testPacket{
+	{ts: time.Unix(1650000000, 1000), data: []byte{1}, comment: "a"},
+	{ts: time.Unix(1650000000, 2000), data: []byte{1, 2}},
+	{ts: time.Unix(1650000001, 123456000), data: []byte{1, 2, 3}, comment: "abc"},
+	{ts: time.Unix(1650000002, 0), data: []byte{1, 2, 3, 4}, comment: "abcd"},
+	{ts: time.Unix(1650000003, 999999000), data: []byte{1, 2, 3, 4, 5}, comment: "ab"},
+	{ts: time.Unix(1650000004, 0), data: []byte{}},
+}
+
+func writeTestPackets(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "eth0", layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkt := range testPackets {
+		if err = w.WritePacket(pkt.ts, pkt.data, pkt.comment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	r, err := pcapgo.NewNgReader(bytes.NewReader(writeTestPackets(t)), pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("got link type %s, want %s", r.LinkType(), layers.LinkTypeEthernet)
+	}
+	intf, err := r.Interface(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intf.Name != "eth0" {
+		t.Errorf("got interface name %q, want %q", intf.Name, "eth0")
+	}
+
+	for i, want := range testPackets {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatalf("packet %d: %s", i, err)
+		}
+
+		if !bytes.Equal(data, want.data) {
+			t.Errorf("packet %d: got data %x, want %x", i, data, want.data)
+		}
+		if ci.CaptureLength != len(want.data) || ci.Length != len(want.data) {
+			t.Errorf("packet %d: got lengths %d/%d, want %d", i, ci.CaptureLength, ci.Length, len(want.data))
+		}
+		if !ci.Timestamp.Equal(want.ts) {
+			t.Errorf("packet %d: got timestamp %s, want %s", i, ci.Timestamp, want.ts)
+		}
+	}
+
+	if _, _, err = r.ReadPacketData(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after the last packet, got %v", err)
+	}
+}
+
+// TestAlignment walks the blocks of the file, checks that all blocks and options are aligned to 32 bits and that the
+// comments of the packets are written, which the pcapgo reader doesn't expose.
+func TestAlignment(t *testing.T) {
+	raw := writeTestPackets(t)
+	le := binary.LittleEndian
+
+	if len(raw)%4 != 0 {
+		t.Fatalf("file length %d is not aligned to 32 bits", len(raw))
+	}
+
+	var comments []string
+	for off := 0; off < len(raw); {
+		if off+12 > len(raw) {
+			t.Fatalf("block at %d: truncated", off)
+		}
+
+		blockType := le.Uint32(raw[off:])
+		length := int(le.Uint32(raw[off+4:]))
+		if length%4 != 0 || off+length > len(raw) {
+			t.Fatalf("block at %d: invalid length %d", off, length)
+		}
+		if trailer := int(le.Uint32(raw[off+length-4:])); trailer != length {
+			t.Fatalf("block at %d: trailing length %d, want %d", off, trailer, length)
+		}
+
+		if blockType == blockTypeEnhancedPacket {
+			capLen := int(le.Uint32(raw[off+20:]))
+			optOff := off + 28 + capLen + pad(capLen)
+
+			var comment string
+			for optOff < off+length-4 {
+				code := le.Uint16(raw[optOff:])
+				optLen := int(le.Uint16(raw[optOff+2:]))
+				if code == optEndOfOpt {
+					break
+				}
+				if code == optComment {
+					comment = string(raw[optOff+4 : optOff+4+optLen])
+				}
+				optOff += 4 + optLen + pad(optLen)
+			}
+			comments = append(comments, comment)
+		}
+
+		off += length
+	}
+
+	if len(comments) != len(testPackets) {
+		t.Fatalf("got %d packets, want %d", len(comments), len(testPackets))
+	}
+	for i, want := range testPackets {
+		if comments[i] != want.comment {
+			t.Errorf("packet %d: got comment %q, want %q", i, comments[i], want.comment)
+		}
+	}
+}
@@ -0,0 +1,611 @@
+// Package pktfilter implements a packet filter using a subset of the tcpdump/pcap-filter(7) expression syntax.
+//
+// The following primitives are supported:
+//
+//	[src|dst|src or dst|src and dst] host {ip address}
+//	[src|dst|src or dst|src and dst] net {cidr}
+//	[tcp|udp|sctp] [src|dst|src or dst|src and dst] port {port}
+//	[tcp|udp|sctp] [src|dst|src or dst|src and dst] portrange {port}-{port}
+//	ether [src|dst|src or dst|src and dst] host {mac address}
+//	ip|ip6 proto {number|tcp|udp|icmp|icmp6|sctp}
+//	vlan [{vlan id}]
+//	ether|ip|ip6|arp|tcp|udp|sctp|icmp|icmp6
+//	less|greater {length}
+//
+// Primitives can be combined with 'and'/'&&', 'or'/'||', 'not'/'!' and parentheses. Like in tcpdump, 'and' binds
+// as strong as 'or', so expressions are evaluated left to right unless parentheses are used. An address without
+// primitive type, like 'src 10.0.0.1' or '10.0.0.1', is a host.
+package pktfilter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Filter is a compiled filter expression
+type Filter struct {
+	expr string
+	root node
+}
+
+// Compile parses a filter expression. An empty expression matches all packets.
+func Compile(expr string) (*Filter, error) {
+	p := &parser{tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return &Filter{expr: expr}, nil
+	}
+
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected '%s' at token %d", p.peek(), p.pos+1)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// String returns the expression from which the filter was compiled
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match returns true if the packet matches the filter
+func (f *Filter) Match(pkt gopacket.Packet) bool {
+	if f.root == nil {
+		return true
+	}
+
+	return f.root.match(newPacketInfo(pkt))
+}
+
+// MatchEthernet decodes data as ethernet frame and returns true if it matches the filter
+func (f *Filter) MatchEthernet(data []byte) bool {
+	if f.root == nil {
+		return true
+	}
+
+	return f.Match(gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{
+		Lazy:   true,
+		NoCopy: true,
+	}))
+}
+
+// packetInfo holds the layers of a packet which filters can match on
+type packetInfo struct {
+	length int
+	eth    *layers.Ethernet
+	vlans  []*layers.Dot1Q
+	arp    *layers.ARP
+	ip4    *layers.IPv4
+	ip6    *layers.IPv6
+	tcp    *layers.TCP
+	udp    *layers.UDP
+	sctp   *layers.SCTP
+	icmp4  *layers.ICMPv4
+	icmp6  *layers.ICMPv6
+}
+
+func newPacketInfo(pkt gopacket.Packet) *packetInfo {
+	info := &packetInfo{length: len(pkt.Data())}
+	for _, l := range pkt.Layers() {
+		switch l := l.(type) {
+		case *layers.Ethernet:
+			if info.eth == nil {
+				info.eth = l
+			}
+		case *layers.Dot1Q:
+			info.vlans = append(info.vlans, l)
+		case *layers.ARP:
+			info.arp = l
+		case *layers.IPv4:
+			if info.ip4 == nil && info.ip6 == nil {
+				info.ip4 = l
+			}
+		case *layers.IPv6:
+			if info.ip4 == nil && info.ip6 == nil {
+				info.ip6 = l
+			}
+		case *layers.TCP:
+			info.tcp = l
+		case *layers.UDP:
+			info.udp = l
+		case *layers.SCTP:
+			info.sctp = l
+		case *layers.ICMPv4:
+			info.icmp4 = l
+		case *layers.ICMPv6:
+			info.icmp6 = l
+		}
+	}
+
+	return info
+}
+
+// ipAddrs returns the source and destination IP addresses of the packet, including those of ARP packets
+func (info *packetInfo) ipAddrs() (net.IP, net.IP) {
+	switch {
+	case info.ip4 != nil:
+		return info.ip4.SrcIP, info.ip4.DstIP
+	case info.ip6 != nil:
+		return info.ip6.SrcIP, info.ip6.DstIP
+	case info.arp != nil:
+		return net.IP(info.arp.SourceProtAddress), net.IP(info.arp.DstProtAddress)
+	}
+
+	return nil, nil
+}
+
+// ports returns the source and destination ports of the packet, limited to the given transport protocol if not empty
+func (info *packetInfo) ports(proto string) (int, int, bool) {
+	switch {
+	case info.tcp != nil && (proto == "" || proto == "tcp"):
+		return int(info.tcp.SrcPort), int(info.tcp.DstPort), true
+	case info.udp != nil && (proto == "" || proto == "udp"):
+		return int(info.udp.SrcPort), int(info.udp.DstPort), true
+	case info.sctp != nil && (proto == "" || proto == "sctp"):
+		return int(info.sctp.SrcPort), int(info.sctp.DstPort), true
+	}
+
+	return 0, 0, false
+}
+
+// node is a node in the expression tree
+type node interface {
+	match(info *packetInfo) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) match(info *packetInfo) bool { return n.left.match(info) && n.right.match(info) }
+
+type orNode struct{ left, right node }
+
+func (n *orNode) match(info *packetInfo) bool { return n.left.match(info) || n.right.match(info) }
+
+type notNode struct{ inner node }
+
+func (n *notNode) match(info *packetInfo) bool { return !n.inner.match(info) }
+
+// direction is the direction qualifier of a primitive
+type direction int
+
+const (
+	dirSrcOrDst direction = iota
+	dirSrc
+	dirDst
+	dirSrcAndDst
+)
+
+// matchDir applies the direction qualifier to the results of matching the source and destination
+func (d direction) matchDir(src, dst bool) bool {
+	switch d {
+	case dirSrc:
+		return src
+	case dirDst:
+		return dst
+	case dirSrcAndDst:
+		return src && dst
+	default:
+		return src || dst
+	}
+}
+
+type hostNode struct {
+	dir direction
+	ip  net.IP
+}
+
+func (n *hostNode) match(info *packetInfo) bool {
+	src, dst := info.ipAddrs()
+	if src == nil {
+		return false
+	}
+
+	return n.dir.matchDir(n.ip.Equal(src), n.ip.Equal(dst))
+}
+
+type netNode struct {
+	dir direction
+	net *net.IPNet
+}
+
+func (n *netNode) match(info *packetInfo) bool {
+	src, dst := info.ipAddrs()
+	if src == nil {
+		return false
+	}
+
+	return n.dir.matchDir(n.net.Contains(src), n.net.Contains(dst))
+}
+
+type portNode struct {
+	dir      direction
+	proto    string
+	from, to int
+}
+
+func (n *portNode) match(info *packetInfo) bool {
+	src, dst, ok := info.ports(n.proto)
+	if !ok {
+		return false
+	}
+
+	return n.dir.matchDir(src >= n.from && src <= n.to, dst >= n.from && dst <= n.to)
+}
+
+type etherHostNode struct {
+	dir direction
+	mac net.HardwareAddr
+}
+
+func (n *etherHostNode) match(info *packetInfo) bool {
+	if info.eth == nil {
+		return false
+	}
+
+	return n.dir.matchDir(
+		info.eth.SrcMAC.String() == n.mac.String(),
+		info.eth.DstMAC.String() == n.mac.String(),
+	)
+}
+
+type vlanNode struct {
+	// -1 matches any VLAN
+	id int
+}
+
+func (n *vlanNode) match(info *packetInfo) bool {
+	for _, vlan := range info.vlans {
+		if n.id == -1 || int(vlan.VLANIdentifier) == n.id {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ipProtoNode struct {
+	// "ip", "ip6" or empty for both
+	family string
+	proto  layers.IPProtocol
+}
+
+func (n *ipProtoNode) match(info *packetInfo) bool {
+	if info.ip4 != nil && n.family != "ip6" {
+		return info.ip4.Protocol == n.proto
+	}
+
+	if info.ip6 != nil && n.family != "ip" {
+		return info.ip6.NextHeader == n.proto
+	}
+
+	return false
+}
+
+type protoNode struct {
+	proto string
+}
+
+func (n *protoNode) match(info *packetInfo) bool {
+	switch n.proto {
+	case "ether":
+		return info.eth != nil
+	case "ip":
+		return info.ip4 != nil
+	case "ip6":
+		return info.ip6 != nil
+	case "arp":
+		return info.arp != nil
+	case "tcp":
+		return info.tcp != nil
+	case "udp":
+		return info.udp != nil
+	case "sctp":
+		return info.sctp != nil
+	case "icmp":
+		return info.icmp4 != nil
+	case "icmp6":
+		return info.icmp6 != nil
+	}
+
+	return false
+}
+
+type lengthNode struct {
+	less bool
+	n    int
+}
+
+func (n *lengthNode) match(info *packetInfo) bool {
+	if n.less {
+		return info.length <= n.n
+	}
+
+	return info.length >= n.n
+}
+
+// tokenize splits an expression into tokens, parentheses and '!' are separate tokens even without spaces
+func tokenize(expr string) []string {
+	r := strings.NewReplacer("(", " ( ", ")", " ) ", "!", " ! ", "&&", " and ", "||", " or ")
+	return strings.Fields(r.Replace(expr))
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+// parseExpr parses a chain of primitives joined by 'and' and 'or', which have the same precedence
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		if op != "and" && op != "or" {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		if op == "and" {
+			left = &andNode{left: left, right: right}
+		} else {
+			left = &orNode{left: left, right: right}
+		}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.peek() {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	case "not", "!":
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner: inner}, nil
+
+	case "(":
+		p.next()
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return inner, nil
+	}
+
+	return p.parsePrimitive()
+}
+
+// parseDir parses an optional direction qualifier
+func (p *parser) parseDir() direction {
+	var dir direction
+	switch p.peek() {
+	case "src":
+		dir = dirSrc
+	case "dst":
+		dir = dirDst
+	default:
+		return dirSrcOrDst
+	}
+	p.next()
+
+	// 'src or dst' and 'src and dst'
+	if p.pos+1 < len(p.tokens) && (p.peek() == "or" || p.peek() == "and") {
+		other := p.tokens[p.pos+1]
+		if (dir == dirSrc && other == "dst") || (dir == dirDst && other == "src") {
+			if p.next() == "or" {
+				dir = dirSrcOrDst
+			} else {
+				dir = dirSrcAndDst
+			}
+			p.next()
+		}
+	}
+
+	return dir
+}
+
+func (p *parser) parsePrimitive() (node, error) {
+	tok := p.peek()
+
+	switch tok {
+	case "less", "greater":
+		p.next()
+		n, err := strconv.Atoi(p.next())
+		if err != nil {
+			return nil, fmt.Errorf("'%s' expects a length", tok)
+		}
+		return &lengthNode{less: tok == "less", n: n}, nil
+
+	case "vlan":
+		p.next()
+		id, err := strconv.Atoi(p.peek())
+		if err != nil {
+			return &vlanNode{id: -1}, nil
+		}
+		p.next()
+		return &vlanNode{id: id}, nil
+
+	case "ether":
+		p.next()
+		dir := p.parseDir()
+		if p.peek() == "host" {
+			p.next()
+		} else if dir == dirSrcOrDst {
+			// 'ether' on its own matches all ethernet packets
+			return &protoNode{proto: "ether"}, nil
+		}
+
+		macStr := p.next()
+		mac, err := net.ParseMAC(macStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAC address '%s'", macStr)
+		}
+		return &etherHostNode{dir: dir, mac: mac}, nil
+
+	case "ip", "ip6", "arp", "tcp", "udp", "sctp", "icmp", "icmp6":
+		p.next()
+
+		switch p.peek() {
+		case "proto":
+			if tok != "ip" && tok != "ip6" {
+				return nil, fmt.Errorf("'proto' can only be used with 'ip' or 'ip6'")
+			}
+			p.next()
+			proto, err := parseIPProto(p.next())
+			if err != nil {
+				return nil, err
+			}
+			return &ipProtoNode{family: tok, proto: proto}, nil
+
+		case "src", "dst", "host", "net", "port", "portrange":
+			prim, err := p.parseQualified(tok)
+			if err != nil {
+				return nil, err
+			}
+			return &andNode{left: &protoNode{proto: tok}, right: prim}, nil
+		}
+
+		return &protoNode{proto: tok}, nil
+	}
+
+	return p.parseQualified("")
+}
+
+// parseQualified parses '[dir] [host|net|port|portrange] id' primitives, proto is the protocol qualifier if any.
+func (p *parser) parseQualified(proto string) (node, error) {
+	dir := p.parseDir()
+
+	typ := "host"
+	switch p.peek() {
+	case "host", "net", "port", "portrange":
+		typ = p.next()
+	}
+
+	id := p.next()
+	if id == "" {
+		return nil, fmt.Errorf("unexpected end of expression, expected %s", typ)
+	}
+
+	switch typ {
+	case "host":
+		ip := net.ParseIP(id)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host '%s', only IP addresses are supported", id)
+		}
+		return &hostNode{dir: dir, ip: ip}, nil
+
+	case "net":
+		_, ipNet, err := net.ParseCIDR(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid net '%s', expected CIDR notation", id)
+		}
+		return &netNode{dir: dir, net: ipNet}, nil
+
+	case "port":
+		port, err := parsePort(id)
+		if err != nil {
+			return nil, err
+		}
+		return &portNode{dir: dir, proto: transportProto(proto), from: port, to: port}, nil
+
+	default:
+		parts := strings.SplitN(id, "-", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid port range '%s', expected {port}-{port}", id)
+		}
+
+		from, err := parsePort(parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := parsePort(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return &portNode{dir: dir, proto: transportProto(proto), from: from, to: to}, nil
+	}
+}
+
+// transportProto returns the protocol if it is a transport protocol with ports, otherwise an empty string
+func transportProto(proto string) string {
+	switch proto {
+	case "tcp", "udp", "sctp":
+		return proto
+	}
+
+	return ""
+}
+
+func parsePort(str string) (int, error) {
+	port, err := strconv.Atoi(str)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port '%s'", str)
+	}
+
+	return port, nil
+}
+
+func parseIPProto(str string) (layers.IPProtocol, error) {
+	switch str {
+	case "tcp":
+		return layers.IPProtocolTCP, nil
+	case "udp":
+		return layers.IPProtocolUDP, nil
+	case "icmp":
+		return layers.IPProtocolICMPv4, nil
+	case "icmp6":
+		return layers.IPProtocolICMPv6, nil
+	case "sctp":
+		return layers.IPProtocolSCTP, nil
+	}
+
+	proto, err := strconv.ParseUint(str, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol '%s'", str)
+	}
+
+	return layers.IPProtocol(proto), nil
+}
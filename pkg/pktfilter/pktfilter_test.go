@@ -0,0 +1,127 @@
+package pktfilter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func serialize(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestFilter(t *testing.T) {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{192, 168, 1, 2},
+	}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 80, SYN: true}
+	tcpPkt := serialize(t, eth, ip, tcp, gopacket.Payload(make([]byte, 20)))
+
+	vlanEth := *eth
+	vlanEth.EthernetType = layers.EthernetTypeDot1Q
+	udpIP := *ip
+	udpIP.Protocol = layers.IPProtocolUDP
+	vlanUDPPkt := serialize(t,
+		&vlanEth,
+		&layers.Dot1Q{VLANIdentifier: 42, Type: layers.EthernetTypeIPv4},
+		&udpIP,
+		&layers.UDP{SrcPort: 5353, DstPort: 53},
+	)
+
+	tests := []struct {
+		expr string
+		tcp  bool
+		udp  bool
+	}{
+		{"", true, true},
+		{"tcp", true, false},
+		{"udp", false, true},
+		{"ip", true, true},
+		{"ip6", false, false},
+		{"host 10.0.0.1", true, true},
+		{"10.0.0.1", true, true},
+		{"src 10.0.0.1", true, true},
+		{"dst 10.0.0.1", false, false},
+		{"src and dst host 10.0.0.1", false, false},
+		{"src or dst host 192.168.1.2", true, true},
+		{"net 192.168.0.0/16", true, true},
+		{"dst net 10.0.0.0/8", false, false},
+		{"port 80", true, false},
+		{"tcp port 53", false, false},
+		{"udp port 53", false, true},
+		{"src port 5353", false, true},
+		{"portrange 50-100", true, true},
+		{"tcp dst portrange 50-100", true, false},
+		{"vlan", false, true},
+		{"vlan 42", false, true},
+		{"vlan 43", false, false},
+		{"ether src 02:00:00:00:00:01", true, true},
+		{"ether dst host 02:00:00:00:00:01", false, false},
+		{"ip proto udp", false, true},
+		{"ip proto 6", true, false},
+		{"not tcp", false, true},
+		{"!tcp", false, true},
+		{"tcp and port 80", true, false},
+		{"tcp && port 53", false, false},
+		{"tcp or udp", true, true},
+		{"udp || (tcp and not port 80)", false, true},
+		{"not (host 10.0.0.1 and port 80)", false, true},
+		{"less 60", false, true},
+		{"greater 61", true, false},
+	}
+
+	for _, test := range tests {
+		f, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", test.expr, err)
+			continue
+		}
+
+		if got := f.MatchEthernet(tcpPkt); got != test.tcp {
+			t.Errorf("%q on TCP packet = %v, want %v", test.expr, got, test.tcp)
+		}
+
+		if got := f.MatchEthernet(vlanUDPPkt); got != test.udp {
+			t.Errorf("%q on VLAN UDP packet = %v, want %v", test.expr, got, test.udp)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"host",
+		"host example.com",
+		"net 10.0.0.1",
+		"port http",
+		"portrange 80",
+		"tcp and",
+		"(tcp",
+		"tcp)",
+		"tcp proto 6",
+		"ether host 10.0.0.1",
+		"less",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,793 @@
+// Package pktspec builds packets from a textual specification, inspired by the way packets are stacked in scapy.
+//
+// A spec is a list of layers separated by '/', starting with the outermost layer. Each layer has optional arguments
+// in the form of key=value pairs:
+//
+//	eth(src=02:00:00:00:00:01,dst=02:00:00:00:00:02)/ipv4(src=10.0.0.1,dst=10.0.0.2)/tcp(dport=80,flags=S)/payload("GET")
+//
+// The following layers and arguments are supported:
+//
+//	eth(src, dst, type)
+//	vlan(id, prio, type)                            (alias: dot1q)
+//	arp(op, hwsrc, psrc, hwdst, pdst)               op is 'request', 'reply' or a number
+//	ipv4(src, dst, ttl, tos, id, proto, flags, frag) (alias: ip) flags is DF, MF or DF+MF
+//	ipv6(src, dst, hlim, tc, fl, nh)                (alias: ip6)
+//	tcp(sport, dport, seq, ack, flags, window, urg) flags is a combination of FSRPAUEC, like 'SA'
+//	udp(sport, dport)
+//	icmp(type, code, id, seq)                       (alias: icmp4)
+//	icmp6(type, code, id, seq)
+//	payload(data, len)                              (alias: raw) data is a quoted string or hex/base64 bytes,
+//	                                                given as data=... or without key, len pads the payload
+//	                                                with zeros
+//
+// Arguments which are not given get a default value. Type and protocol fields are derived from the next layer,
+// lengths and checksums are always computed.
+package pktspec
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dylandreimerink/edb/pkg/ctxutil"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Build parses the spec and serializes the described packet
+func Build(spec string) ([]byte, error) {
+	specLayers, err := parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var serializable []gopacket.SerializableLayer
+	var built []*builtLayer
+	for _, sl := range specLayers {
+		builder, found := builders[sl.name]
+		if !found {
+			return nil, fmt.Errorf("unknown layer '%s'", sl.name)
+		}
+
+		bl, err := builder(sl.args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sl.name, err)
+		}
+
+		built = append(built, bl)
+		serializable = append(serializable, bl.layers...)
+	}
+
+	// Link each layer to the next, so type fields are set correctly
+	for i, bl := range built {
+		var next gopacket.SerializableLayer
+		if i+1 < len(built) {
+			next = built[i+1].layers[0]
+		}
+		if bl.link != nil {
+			bl.link(next)
+		}
+	}
+
+	// The checksums of transport layers include a pseudo header of the network layer
+	var network gopacket.NetworkLayer
+	for _, l := range serializable {
+		if nl, ok := l.(gopacket.NetworkLayer); ok {
+			network = nl
+		}
+
+		if cl, ok := l.(checksumLayer); ok && network != nil {
+			if err := cl.SetNetworkLayerForChecksum(network); err != nil {
+				return nil, fmt.Errorf("%s: %w", l.LayerType(), err)
+			}
+		}
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}, serializable...)
+	if err != nil {
+		return nil, fmt.Errorf("serialize: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// specLayer is a single parsed layer of the spec
+type specLayer struct {
+	name string
+	args *args
+}
+
+// parse splits a spec into layers and their arguments
+func parse(spec string) ([]specLayer, error) {
+	var result []specLayer
+	for _, part := range splitOutside(spec, '/') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty layer in '%s'", spec)
+		}
+
+		name, rest, hasArgs := strings.Cut(part, "(")
+		sl := specLayer{
+			name: strings.ToLower(strings.TrimSpace(name)),
+			args: &args{values: make(map[string]string)},
+		}
+
+		if hasArgs {
+			if !strings.HasSuffix(rest, ")") {
+				return nil, fmt.Errorf("missing ')' in '%s'", part)
+			}
+			rest = strings.TrimSuffix(rest, ")")
+
+			for _, arg := range splitOutside(rest, ',') {
+				arg = strings.TrimSpace(arg)
+				if arg == "" {
+					continue
+				}
+
+				key, value, found := cutOutside(arg, '=')
+				if !found {
+					sl.args.positional = append(sl.args.positional, arg)
+					continue
+				}
+
+				key = strings.ToLower(strings.TrimSpace(key))
+				if _, dup := sl.args.values[key]; dup {
+					return nil, fmt.Errorf("%s: argument '%s' given twice", sl.name, key)
+				}
+				sl.args.values[key] = strings.TrimSpace(value)
+			}
+		}
+
+		result = append(result, sl)
+	}
+
+	return result, nil
+}
+
+// splitOutside splits str at every sep which is not within quotes or parentheses
+func splitOutside(str string, sep rune) []string {
+	var (
+		parts []string
+		quote rune
+		depth int
+		start int
+	)
+	for i, r := range str {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == sep && depth == 0:
+			parts = append(parts, str[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, str[start:])
+}
+
+// cutOutside cuts str around the first sep which is not within quotes
+func cutOutside(str string, sep rune) (string, string, bool) {
+	parts := splitOutside(str, sep)
+	if len(parts) == 1 {
+		return str, "", false
+	}
+
+	return parts[0], str[len(parts[0])+1:], true
+}
+
+// isQuoted returns true if str is surrounded by single or double quotes
+func isQuoted(str string) bool {
+	return len(str) >= 2 && (str[0] == '"' || str[0] == '\'') && str[len(str)-1] == str[0]
+}
+
+// unquote removes single or double quotes around a value, double quoted values may contain Go escape sequences
+func unquote(str string) string {
+	if !isQuoted(str) {
+		return str
+	}
+
+	if str[0] == '"' {
+		if s, err := strconv.Unquote(str); err == nil {
+			return s
+		}
+	}
+
+	return str[1 : len(str)-1]
+}
+
+// args are the arguments of a layer, keys are removed once used so unknown arguments can be detected
+type args struct {
+	values     map[string]string
+	positional []string
+}
+
+// take returns the unquoted value of the argument and marks it as used
+func (a *args) take(key string) (string, bool) {
+	v, ok := a.takeRaw(key)
+	return unquote(v), ok
+}
+
+// takeRaw returns the value of the argument as written, including quotes, and marks it as used
+func (a *args) takeRaw(key string) (string, bool) {
+	v, ok := a.values[key]
+	delete(a.values, key)
+	return v, ok
+}
+
+func (a *args) uint(key string, bits int, def uint64) (uint64, error) {
+	v, ok := a.take(key)
+	if !ok {
+		return def, nil
+	}
+
+	n, err := strconv.ParseUint(v, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", key, v, err)
+	}
+
+	return n, nil
+}
+
+func (a *args) mac(key string, def net.HardwareAddr) (net.HardwareAddr, error) {
+	v, ok := a.take(key)
+	if !ok {
+		return def, nil
+	}
+
+	mac, err := net.ParseMAC(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s': %w", key, v, err)
+	}
+
+	return mac, nil
+}
+
+func (a *args) ip(key string, v6 bool, def net.IP) (net.IP, error) {
+	v, ok := a.take(key)
+	if !ok {
+		return def, nil
+	}
+
+	ip := net.ParseIP(v)
+	if ip == nil || (ip.To4() == nil) != v6 {
+		return nil, fmt.Errorf("invalid %s '%s'", key, v)
+	}
+
+	if !v6 {
+		return ip.To4(), nil
+	}
+	return ip, nil
+}
+
+// done returns an error if any arguments were not used
+func (a *args) done() error {
+	if len(a.positional) > 0 {
+		return fmt.Errorf("unexpected argument '%s'", a.positional[0])
+	}
+
+	for key := range a.values {
+		return fmt.Errorf("unknown argument '%s'", key)
+	}
+
+	return nil
+}
+
+// builtLayer is a spec layer converted into one or more gopacket layers
+type builtLayer struct {
+	layers []gopacket.SerializableLayer
+	// link is called with the first gopacket layer of the next spec layer, or nil if this is the last layer
+	link func(next gopacket.SerializableLayer)
+}
+
+// checksumLayer is implemented by layers which have a checksum over a pseudo header of the network layer
+type checksumLayer interface {
+	SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+}
+
+var builders = map[string]func(a *args) (*builtLayer, error){
+	"eth":     buildEthernet,
+	"vlan":    buildDot1Q,
+	"dot1q":   buildDot1Q,
+	"arp":     buildARP,
+	"ipv4":    buildIPv4,
+	"ip":      buildIPv4,
+	"ipv6":    buildIPv6,
+	"ip6":     buildIPv6,
+	"tcp":     buildTCP,
+	"udp":     buildUDP,
+	"icmp":    buildICMPv4,
+	"icmp4":   buildICMPv4,
+	"icmp6":   buildICMPv6,
+	"payload": buildPayload,
+	"raw":     buildPayload,
+}
+
+// etherType returns the ethernet type for the given layer
+func etherType(l gopacket.SerializableLayer) (layers.EthernetType, bool) {
+	switch l.(type) {
+	case *layers.Dot1Q:
+		return layers.EthernetTypeDot1Q, true
+	case *layers.ARP:
+		return layers.EthernetTypeARP, true
+	case *layers.IPv4:
+		return layers.EthernetTypeIPv4, true
+	case *layers.IPv6:
+		return layers.EthernetTypeIPv6, true
+	}
+
+	return 0, false
+}
+
+// ipProto returns the IP protocol for the given layer
+func ipProto(l gopacket.SerializableLayer) (layers.IPProtocol, bool) {
+	switch l.(type) {
+	case *layers.TCP:
+		return layers.IPProtocolTCP, true
+	case *layers.UDP:
+		return layers.IPProtocolUDP, true
+	case *layers.ICMPv4:
+		return layers.IPProtocolICMPv4, true
+	case *layers.ICMPv6:
+		return layers.IPProtocolICMPv6, true
+	case *layers.IPv4:
+		return layers.IPProtocolIPv4, true
+	case *layers.IPv6:
+		return layers.IPProtocolIPv6, true
+	}
+
+	return 0, false
+}
+
+func buildEthernet(a *args) (*builtLayer, error) {
+	eth := &layers.Ethernet{}
+
+	var err error
+	if eth.SrcMAC, err = a.mac("src", make(net.HardwareAddr, 6)); err != nil {
+		return nil, err
+	}
+	if eth.DstMAC, err = a.mac("dst", make(net.HardwareAddr, 6)); err != nil {
+		return nil, err
+	}
+
+	_, explicitType := a.values["type"]
+	t, err := a.uint("type", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+	eth.EthernetType = layers.EthernetType(t)
+
+	return &builtLayer{
+		layers: []gopacket.SerializableLayer{eth},
+		link: func(next gopacket.SerializableLayer) {
+			if t, ok := etherType(next); ok && !explicitType {
+				eth.EthernetType = t
+			}
+		},
+	}, a.done()
+}
+
+func buildDot1Q(a *args) (*builtLayer, error) {
+	vlan := &layers.Dot1Q{}
+
+	id, err := a.uint("id", 12, 0)
+	if err != nil {
+		return nil, err
+	}
+	vlan.VLANIdentifier = uint16(id)
+
+	prio, err := a.uint("prio", 3, 0)
+	if err != nil {
+		return nil, err
+	}
+	vlan.Priority = uint8(prio)
+
+	_, explicitType := a.values["type"]
+	t, err := a.uint("type", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+	vlan.Type = layers.EthernetType(t)
+
+	return &builtLayer{
+		layers: []gopacket.SerializableLayer{vlan},
+		link: func(next gopacket.SerializableLayer) {
+			if t, ok := etherType(next); ok && !explicitType {
+				vlan.Type = t
+			}
+		},
+	}, a.done()
+}
+
+func buildARP(a *args) (*builtLayer, error) {
+	arp := &layers.ARP{
+		AddrType:        layers.LinkTypeEthernet,
+		Protocol:        layers.EthernetTypeIPv4,
+		HwAddressSize:   6,
+		ProtAddressSize: 4,
+		Operation:       layers.ARPRequest,
+	}
+
+	if op, ok := a.take("op"); ok {
+		switch op {
+		case "request":
+			arp.Operation = layers.ARPRequest
+		case "reply":
+			arp.Operation = layers.ARPReply
+		default:
+			n, err := strconv.ParseUint(op, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid op '%s', expected request, reply or a number", op)
+			}
+			arp.Operation = uint16(n)
+		}
+	}
+
+	hwsrc, err := a.mac("hwsrc", make(net.HardwareAddr, 6))
+	if err != nil {
+		return nil, err
+	}
+	arp.SourceHwAddress = hwsrc
+
+	hwdst, err := a.mac("hwdst", make(net.HardwareAddr, 6))
+	if err != nil {
+		return nil, err
+	}
+	arp.DstHwAddress = hwdst
+
+	psrc, err := a.ip("psrc", false, net.IPv4zero.To4())
+	if err != nil {
+		return nil, err
+	}
+	arp.SourceProtAddress = psrc
+
+	pdst, err := a.ip("pdst", false, net.IPv4zero.To4())
+	if err != nil {
+		return nil, err
+	}
+	arp.DstProtAddress = pdst
+
+	return &builtLayer{layers: []gopacket.SerializableLayer{arp}}, a.done()
+}
+
+func buildIPv4(a *args) (*builtLayer, error) {
+	ip := &layers.IPv4{Version: 4}
+
+	var err error
+	if ip.SrcIP, err = a.ip("src", false, net.IPv4(127, 0, 0, 1).To4()); err != nil {
+		return nil, err
+	}
+	if ip.DstIP, err = a.ip("dst", false, net.IPv4(127, 0, 0, 1).To4()); err != nil {
+		return nil, err
+	}
+
+	ttl, err := a.uint("ttl", 8, 64)
+	if err != nil {
+		return nil, err
+	}
+	ip.TTL = uint8(ttl)
+
+	tos, err := a.uint("tos", 8, 0)
+	if err != nil {
+		return nil, err
+	}
+	ip.TOS = uint8(tos)
+
+	id, err := a.uint("id", 16, 1)
+	if err != nil {
+		return nil, err
+	}
+	ip.Id = uint16(id)
+
+	frag, err := a.uint("frag", 13, 0)
+	if err != nil {
+		return nil, err
+	}
+	ip.FragOffset = uint16(frag)
+
+	if flags, ok := a.take("flags"); ok {
+		for _, f := range strings.Split(strings.ToUpper(flags), "+") {
+			switch strings.TrimSpace(f) {
+			case "DF":
+				ip.Flags |= layers.IPv4DontFragment
+			case "MF":
+				ip.Flags |= layers.IPv4MoreFragments
+			case "":
+			default:
+				return nil, fmt.Errorf("invalid flag '%s', expected DF, MF or DF+MF", f)
+			}
+		}
+	}
+
+	_, explicitProto := a.values["proto"]
+	if proto, ok := a.take("proto"); ok {
+		p, err := parseIPProto(proto)
+		if err != nil {
+			return nil, err
+		}
+		ip.Protocol = p
+	}
+
+	return &builtLayer{
+		layers: []gopacket.SerializableLayer{ip},
+		link: func(next gopacket.SerializableLayer) {
+			if p, ok := ipProto(next); ok && !explicitProto {
+				ip.Protocol = p
+			}
+		},
+	}, a.done()
+}
+
+func buildIPv6(a *args) (*builtLayer, error) {
+	ip := &layers.IPv6{Version: 6}
+
+	var err error
+	if ip.SrcIP, err = a.ip("src", true, net.IPv6loopback); err != nil {
+		return nil, err
+	}
+	if ip.DstIP, err = a.ip("dst", true, net.IPv6loopback); err != nil {
+		return nil, err
+	}
+
+	hlim, err := a.uint("hlim", 8, 64)
+	if err != nil {
+		return nil, err
+	}
+	ip.HopLimit = uint8(hlim)
+
+	tc, err := a.uint("tc", 8, 0)
+	if err != nil {
+		return nil, err
+	}
+	ip.TrafficClass = uint8(tc)
+
+	fl, err := a.uint("fl", 20, 0)
+	if err != nil {
+		return nil, err
+	}
+	ip.FlowLabel = uint32(fl)
+
+	_, explicitNH := a.values["nh"]
+	if nh, ok := a.take("nh"); ok {
+		p, err := parseIPProto(nh)
+		if err != nil {
+			return nil, err
+		}
+		ip.NextHeader = p
+	}
+
+	return &builtLayer{
+		layers: []gopacket.SerializableLayer{ip},
+		link: func(next gopacket.SerializableLayer) {
+			if explicitNH {
+				return
+			}
+			if p, ok := ipProto(next); ok {
+				ip.NextHeader = p
+			} else {
+				ip.NextHeader = layers.IPProtocolNoNextHeader
+			}
+		},
+	}, a.done()
+}
+
+func buildTCP(a *args) (*builtLayer, error) {
+	tcp := &layers.TCP{}
+
+	sport, err := a.uint("sport", 16, 20)
+	if err != nil {
+		return nil, err
+	}
+	tcp.SrcPort = layers.TCPPort(sport)
+
+	dport, err := a.uint("dport", 16, 80)
+	if err != nil {
+		return nil, err
+	}
+	tcp.DstPort = layers.TCPPort(dport)
+
+	seq, err := a.uint("seq", 32, 0)
+	if err != nil {
+		return nil, err
+	}
+	tcp.Seq = uint32(seq)
+
+	ack, err := a.uint("ack", 32, 0)
+	if err != nil {
+		return nil, err
+	}
+	tcp.Ack = uint32(ack)
+
+	window, err := a.uint("window", 16, 8192)
+	if err != nil {
+		return nil, err
+	}
+	tcp.Window = uint16(window)
+
+	urg, err := a.uint("urg", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+	tcp.Urgent = uint16(urg)
+
+	flags, ok := a.take("flags")
+	if !ok {
+		flags = "S"
+	}
+	for _, f := range strings.ToUpper(flags) {
+		switch f {
+		case 'F':
+			tcp.FIN = true
+		case 'S':
+			tcp.SYN = true
+		case 'R':
+			tcp.RST = true
+		case 'P':
+			tcp.PSH = true
+		case 'A':
+			tcp.ACK = true
+		case 'U':
+			tcp.URG = true
+		case 'E':
+			tcp.ECE = true
+		case 'C':
+			tcp.CWR = true
+		default:
+			return nil, fmt.Errorf("invalid flag '%c', expected any of FSRPAUEC", f)
+		}
+	}
+
+	return &builtLayer{layers: []gopacket.SerializableLayer{tcp}}, a.done()
+}
+
+func buildUDP(a *args) (*builtLayer, error) {
+	udp := &layers.UDP{}
+
+	sport, err := a.uint("sport", 16, 53)
+	if err != nil {
+		return nil, err
+	}
+	udp.SrcPort = layers.UDPPort(sport)
+
+	dport, err := a.uint("dport", 16, 53)
+	if err != nil {
+		return nil, err
+	}
+	udp.DstPort = layers.UDPPort(dport)
+
+	return &builtLayer{layers: []gopacket.SerializableLayer{udp}}, a.done()
+}
+
+func buildICMPv4(a *args) (*builtLayer, error) {
+	icmpType, err := a.uint("type", 8, layers.ICMPv4TypeEchoRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := a.uint("code", 8, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := a.uint("id", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := a.uint("seq", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &builtLayer{layers: []gopacket.SerializableLayer{&layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(uint8(icmpType), uint8(code)),
+		Id:       uint16(id),
+		Seq:      uint16(seq),
+	}}}, a.done()
+}
+
+func buildICMPv6(a *args) (*builtLayer, error) {
+	icmpType, err := a.uint("type", 8, layers.ICMPv6TypeEchoRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := a.uint("code", 8, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	icmp := &layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(uint8(icmpType), uint8(code)),
+	}
+	bl := &builtLayer{layers: []gopacket.SerializableLayer{icmp}}
+
+	// The identifier and sequence number of echo messages are a separate layer in gopacket
+	_, hasID := a.values["id"]
+	_, hasSeq := a.values["seq"]
+	if icmpType == layers.ICMPv6TypeEchoRequest || icmpType == layers.ICMPv6TypeEchoReply || hasID || hasSeq {
+		id, err := a.uint("id", 16, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		seq, err := a.uint("seq", 16, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		bl.layers = append(bl.layers, &layers.ICMPv6Echo{
+			Identifier: uint16(id),
+			SeqNumber:  uint16(seq),
+		})
+	}
+
+	return bl, a.done()
+}
+
+func buildPayload(a *args) (*builtLayer, error) {
+	values := a.positional
+	a.positional = nil
+	if v, ok := a.takeRaw("data"); ok {
+		values = append(values, v)
+	}
+
+	var data []byte
+	for _, v := range values {
+		if isQuoted(v) {
+			data = append(data, unquote(v)...)
+			continue
+		}
+
+		b, err := ctxutil.ParseBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+
+	size, err := a.uint("len", 16, 0)
+	if err != nil {
+		return nil, err
+	}
+	if int(size) > len(data) {
+		// Pad with zeros up to the requested length
+		data = append(data, make([]byte, int(size)-len(data))...)
+	}
+
+	return &builtLayer{layers: []gopacket.SerializableLayer{gopacket.Payload(data)}}, a.done()
+}
+
+var ipProtoNames = map[string]layers.IPProtocol{
+	"icmp":  layers.IPProtocolICMPv4,
+	"tcp":   layers.IPProtocolTCP,
+	"udp":   layers.IPProtocolUDP,
+	"icmp6": layers.IPProtocolICMPv6,
+	"sctp":  layers.IPProtocolSCTP,
+	"gre":   layers.IPProtocolGRE,
+}
+
+func parseIPProto(str string) (layers.IPProtocol, error) {
+	if p, ok := ipProtoNames[strings.ToLower(str)]; ok {
+		return p, nil
+	}
+
+	n, err := strconv.ParseUint(str, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol '%s'", str)
+	}
+
+	return layers.IPProtocol(n), nil
+}
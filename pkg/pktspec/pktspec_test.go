@@ -0,0 +1,159 @@
+package pktspec
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestBuildTCP(t *testing.T) {
+	data, err := Build(`eth(src=02:00:00:00:00:01,dst=02:00:00:00:00:02)/ipv4(src=10.0.0.1,dst=10.0.0.2,flags=DF)/` +
+		`tcp(dport=80,flags=SA,seq=1000)/payload("GET /")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	if errLayer := pkt.ErrorLayer(); errLayer != nil {
+		t.Fatal(errLayer.Error())
+	}
+
+	eth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if eth.EthernetType != layers.EthernetTypeIPv4 {
+		t.Errorf("ethernet type = %s, want IPv4", eth.EthernetType)
+	}
+	if !bytes.Equal(eth.DstMAC, net.HardwareAddr{2, 0, 0, 0, 0, 2}) {
+		t.Errorf("dst mac = %s", eth.DstMAC)
+	}
+
+	ip := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if ip.Protocol != layers.IPProtocolTCP {
+		t.Errorf("ip protocol = %s, want TCP", ip.Protocol)
+	}
+	// IPv4 header + TCP header + payload, the ethernet frame itself is padded to 60 bytes
+	if ip.Length != 20+20+5 {
+		t.Errorf("ip length = %d, want %d", ip.Length, 20+20+5)
+	}
+	if ip.Flags != layers.IPv4DontFragment {
+		t.Errorf("ip flags = %s, want DF", ip.Flags)
+	}
+	if !ip.SrcIP.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("src ip = %s", ip.SrcIP)
+	}
+
+	tcp := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !tcp.SYN || !tcp.ACK || tcp.FIN || tcp.DstPort != 80 || tcp.Seq != 1000 {
+		t.Errorf("unexpected tcp header %+v", tcp)
+	}
+	if string(tcp.Payload) != "GET /" {
+		t.Errorf("payload = %q", tcp.Payload)
+	}
+
+	// Verify the checksum by recomputing it
+	want := tcp.Checksum
+	_ = tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true}, tcp, gopacket.Payload(tcp.Payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tcp.Checksum != want || want == 0 {
+		t.Errorf("tcp checksum = 0x%04X, want 0x%04X", want, tcp.Checksum)
+	}
+}
+
+func TestBuildLayers(t *testing.T) {
+	tests := []struct {
+		spec   string
+		layers []gopacket.LayerType
+	}{
+		{"eth()/vlan(id=42)/ipv6()/udp(dport=53)", []gopacket.LayerType{
+			layers.LayerTypeEthernet, layers.LayerTypeDot1Q, layers.LayerTypeIPv6, layers.LayerTypeUDP,
+		}},
+		{"eth/arp(op=reply,psrc=10.0.0.1)", []gopacket.LayerType{layers.LayerTypeEthernet, layers.LayerTypeARP}},
+		{"eth()/ip()/icmp(id=1,seq=2)", []gopacket.LayerType{
+			layers.LayerTypeEthernet, layers.LayerTypeIPv4, layers.LayerTypeICMPv4,
+		}},
+		{"eth()/ip6()/icmp6()", []gopacket.LayerType{
+			layers.LayerTypeEthernet, layers.LayerTypeIPv6, layers.LayerTypeICMPv6, layers.LayerTypeICMPv6Echo,
+		}},
+		{"eth() / ip(proto=udp) / raw(0xdeadbeef)", []gopacket.LayerType{
+			layers.LayerTypeEthernet, layers.LayerTypeIPv4, layers.LayerTypeUDP,
+		}},
+	}
+
+	for _, test := range tests {
+		data, err := Build(test.spec)
+		if err != nil {
+			t.Errorf("Build(%q): %v", test.spec, err)
+			continue
+		}
+
+		pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		var got []gopacket.LayerType
+		for _, l := range pkt.Layers() {
+			got = append(got, l.LayerType())
+		}
+
+		if len(got) < len(test.layers) {
+			t.Errorf("Build(%q) decoded as %v, want %v", test.spec, got, test.layers)
+			continue
+		}
+		for i := range test.layers {
+			if got[i] != test.layers[i] {
+				t.Errorf("Build(%q) decoded as %v, want %v", test.spec, got, test.layers)
+				break
+			}
+		}
+	}
+}
+
+func TestBuildPayload(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []byte
+	}{
+		{`payload("GET")`, []byte("GET")},
+		{`payload(data="GET")`, []byte("GET")},
+		{`payload(data='dead')`, []byte("dead")},
+		{`payload(data=0xdead)`, []byte{0xde, 0xad}},
+		{`raw(data="a,b", len=4)`, []byte{'a', ',', 'b', 0}},
+		{`payload("GE", 0x54)`, []byte("GET")},
+	}
+
+	for _, test := range tests {
+		data, err := Build(test.spec)
+		if err != nil {
+			t.Errorf("Build(%q): %v", test.spec, err)
+			continue
+		}
+
+		if !bytes.Equal(data, test.want) {
+			t.Errorf("Build(%q) = %v, want %v", test.spec, data, test.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, spec := range []string{
+		"foo()",
+		"eth(src=1.2.3.4)",
+		"eth(bar=1)",
+		"eth()//ip()",
+		"ip(src=::1)",
+		"ip6(src=10.0.0.1)",
+		"tcp(flags=X)",
+		"tcp(dport=70000)",
+		"eth(src=02:00:00:00:00:01",
+		"udp(1)",
+		"payload(zz)",
+		"payload(data=zz)",
+	} {
+		if _, err := Build(spec); err == nil {
+			t.Errorf("Build(%q) expected error", spec)
+		}
+	}
+}